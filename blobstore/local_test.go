@@ -0,0 +1,74 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalStore(t *testing.T) {
+	ctx := context.Background()
+	root := filepath.Join(t.TempDir(), "blobs")
+	store, err := NewLocalStore(root, "http://localhost:8000/media/")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = store.Put(ctx, "products/1/a.jpg", strings.NewReader("jpeg"), "image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := store.Get(ctx, "products/1/a.jpg")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := io.ReadAll(r)
+	r.Close()
+
+	if string(data) != "jpeg" {
+		t.Errorf("read %q, want %q", data, "jpeg")
+	}
+
+	if got := store.URL("products/1/a.jpg"); got != "http://localhost:8000/media/products/1/a.jpg" {
+		t.Errorf("URL() = %q", got)
+	}
+
+	entries, _ := os.ReadDir(filepath.Join(root, "products", "1"))
+
+	if len(entries) != 1 {
+		t.Errorf("left %d files behind, want only the blob", len(entries))
+	}
+
+	if err = store.Delete(ctx, "products/1/a.jpg"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = store.Get(ctx, "products/1/a.jpg"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("get after delete: got %v, want %v", err, ErrNotFound)
+	}
+
+	if err = store.Delete(ctx, "products/1/a.jpg"); err != nil {
+		t.Errorf("deleting a missing blob: %v", err)
+	}
+}
+
+func TestLocalStoreRefusesKeysOutsideRoot(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir(), "/media")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"", "/", "../escape", "a/../../escape", "/abs", "a//b", "a/./b"} {
+		if err := store.Put(context.Background(), key, strings.NewReader("x"), "text/plain"); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Put(%q): got %v, want %v", key, err, ErrInvalidKey)
+		}
+	}
+}
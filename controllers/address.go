@@ -2,11 +2,10 @@ package controllers
 
 import (
 	"context"
-	"fmt"
-	"log"
 	"net/http"
 	"time"
 
+	"github.com/Ricardo-Cardozo/ecommerce_golang/logging"
 	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
@@ -28,7 +27,7 @@ func AddAddress() gin.HandlerFunc {
 		address, err := primitive.ObjectIDFromHex(user_id)
 
 		if err != nil {
-			log.Println(err)
+			logging.FromContext(c.Request.Context()).Debug("invalid user id", "error", err)
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
 			return
 		}
@@ -42,7 +41,7 @@ func AddAddress() gin.HandlerFunc {
 			return
 		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
 
 		defer cancel()
 
@@ -96,7 +95,7 @@ func AddAddress() gin.HandlerFunc {
 			_, err := UserCollection.UpdateOne(ctx, filter, update)
 
 			if err != nil {
-				fmt.Println(err)
+				logging.FromContext(ctx).Error("cannot add the address", "error", err)
 			}
 
 		} else {
@@ -130,7 +129,7 @@ func EditHomeAddress() gin.HandlerFunc {
 			return
 		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
 
 		defer cancel()
 
@@ -144,6 +143,8 @@ func EditHomeAddress() gin.HandlerFunc {
 					{Key: "address.0.street_name", Value: editaddress.Street},
 					{Key: "address.0.city_name", Value: editaddress.City},
 					{Key: "address.0.pin_code", Value: editaddress.Pincode},
+					{Key: "address.0.country", Value: editaddress.Country},
+					{Key: "address.0.region", Value: editaddress.Region},
 				},
 			},
 		}
@@ -182,7 +183,7 @@ func EditWorkAddress() gin.HandlerFunc {
 			return
 		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
 
 		defer cancel()
 
@@ -196,6 +197,8 @@ func EditWorkAddress() gin.HandlerFunc {
 					{Key: "address.1.street_name", Value: editaddress.Street},
 					{Key: "address.1.city_name", Value: editaddress.City},
 					{Key: "address.1.pin_code", Value: editaddress.Pincode},
+					{Key: "address.1.country", Value: editaddress.Country},
+					{Key: "address.1.region", Value: editaddress.Region},
 				},
 			},
 		}
@@ -231,7 +234,7 @@ func DeleteAddress() gin.HandlerFunc {
 		}
 
 		ctx, cancel := context.WithTimeout(
-			context.Background(),
+			c.Request.Context(),
 			100*time.Second,
 		)
 
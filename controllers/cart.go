@@ -2,12 +2,16 @@ package controllers
 
 import (
 	"errors"
-	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/Ricardo-Cardozo/ecommerce_golang/database"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/events"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/logging"
 	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/money"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/notification"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -27,12 +31,139 @@ func NewApplication(prodCollection *mongo.Collection, userCollection *mongo.Coll
 	}
 }
 
+// pricingOptions reads what a cart is priced with: the currency, see
+// requestCurrency, the delivery address, ?address_id= or the first one in
+// the address book, and the ?shipping_method= if one was chosen.
+func pricingOptions(c *gin.Context) (database.PricingOptions, error) {
+	currency, err := requestCurrency(c)
+
+	if err != nil {
+		return database.PricingOptions{}, err
+	}
+
+	opts := database.PricingOptions{
+		Currency:  currency,
+		Rates:     Rates,
+		Taxes:     Taxes,
+		AddressID: c.Query("address_id"),
+	}
+
+	if v := c.Query("shipping_method"); v != "" {
+		methodID, err := primitive.ObjectIDFromHex(v)
+
+		if err != nil {
+			return opts, database.ErrCantFindShippingMethod
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+
+		defer cancel()
+
+		method, err := database.FindShippingMethod(ctx, ShippingCollection, methodID)
+
+		if err != nil {
+			return opts, err
+		}
+
+		opts.Shipping = &method
+	}
+
+	return opts, nil
+}
+
+// expectedTotal reads ?total=, the total the customer was shown in minor
+// units of currency; checkout refuses to charge another. It is nil when not
+// given.
+func expectedTotal(c *gin.Context, currency string) (*money.Money, error) {
+	v := c.Query("total")
+
+	if v == "" {
+		return nil, nil
+	}
+
+	total, err := strconv.ParseInt(v, 10, 64)
+
+	if err != nil {
+		return nil, errors.New("total must be a number")
+	}
+
+	amount := money.New(total, currency)
+
+	return &amount, nil
+}
+
+// loadCart reads the user's cart checked against the catalog, comparing
+// prices in the currency of opts.
+func loadCart(ctx context.Context, userID string, opts database.PricingOptions) (models.Cart, error) {
+	return database.LoadCart(ctx, ProductCollection, CartCollection, userID, opts.Currency, opts.Rates)
+}
+
+// checkoutCart buys the user's cart and reports whether it did; otherwise
+// the response is written. A cart with changes the customer hasn't seen yet
+// is not bought: the notices are returned with 409 instead, and buying again
+// goes ahead at the new prices.
+func checkoutCart(
+	ctx context.Context,
+	c *gin.Context,
+	userCollection *mongo.Collection,
+	userID string,
+	opts database.PricingOptions,
+	total *money.Money,
+) (primitive.ObjectID, bool) {
+	cart, err := loadCart(ctx, userID, opts)
+
+	if err != nil {
+		couponError(c, err)
+		return primitive.NilObjectID, false
+	}
+
+	if len(cart.Notices) > 0 {
+		if err := database.AcknowledgeCartNotices(ctx, CartCollection, cart); err != nil {
+			logging.FromContext(ctx).Error("cannot acknowledge the cart notices", "error", err)
+		}
+
+		c.JSON(http.StatusConflict, gin.H{"error": database.ErrCartChanged.Error(), "notices": cart.Notices})
+		return primitive.NilObjectID, false
+	}
+
+	orderID, err := placeOrder(ctx, userCollection, userID, func(ctx context.Context) (primitive.ObjectID, error) {
+		return database.BuyItemFromCart(
+			ctx,
+			userCollection,
+			ProductCollection,
+			CartCollection,
+			CouponCollection,
+			RedemptionCollection,
+			PromotionCollection,
+			cart,
+			opts,
+			total,
+		)
+	})
+
+	if err != nil {
+		couponError(c, err)
+		return primitive.NilObjectID, false
+	}
+
+	if err := database.RecordCartConversion(ctx, ReminderCollection, userID, orderID); err != nil {
+		logging.FromContext(ctx).Error("cannot record the cart conversion", "error", err)
+	}
+
+	notify(ctx, notification.OrderPlaced, userID, map[string]string{
+		"order_id":   orderID.Hex(),
+		"item_count": strconv.Itoa(len(cart.Items)),
+	})
+
+	return orderID, true
+}
+
 func (app *Application) AddToCart() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		productQueryID := c.Query("id")
 
 		if productQueryID == "" {
-			log.Println("product id is empty")
+			logging.FromContext(c.Request.Context()).Debug("product id is empty")
 			c.JSON(http.StatusNotFound, gin.H{
 				"error":     "product id is empty",
 				"productId": productQueryID,
@@ -42,10 +173,10 @@ func (app *Application) AddToCart() gin.HandlerFunc {
 			return
 		}
 
-		userQueryID := c.Query("userID")
+		userQueryID := cartUserID(c, "userID")
 
 		if userQueryID == "" {
-			log.Println("user id is empty")
+			logging.FromContext(c.Request.Context()).Debug("user id is empty")
 			c.JSON(http.StatusNotFound, gin.H{
 				"error":     "user id is empty",
 				"productId": userQueryID,
@@ -57,7 +188,7 @@ func (app *Application) AddToCart() gin.HandlerFunc {
 		productID, err := primitive.ObjectIDFromHex(productQueryID)
 
 		if err != nil {
-			log.Println(err)
+			logging.FromContext(c.Request.Context()).Debug("invalid product id", "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": err.Error(),
 			})
@@ -65,16 +196,22 @@ func (app *Application) AddToCart() gin.HandlerFunc {
 			return
 		}
 
-		var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		var ctx, cancel = context.WithTimeout(c.Request.Context(), 5*time.Second)
 		defer cancel()
 
-		err = database.AddProductToCart(
-			ctx,
-			app.prodCollection,
-			app.userCollection,
-			productID,
-			userQueryID,
-		)
+		err = cartUpdated(ctx, userQueryID, events.CartItemAdded, productQueryID, func(ctx context.Context) error {
+			return database.AddProductToCart(ctx, app.prodCollection, CartCollection, productID, userQueryID)
+		})
+
+		if errors.Is(err, database.ErrCantFindProduct) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		if errors.Is(err, database.ErrProductUnavailable) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
 
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
@@ -92,17 +229,17 @@ func (app *Application) RemoveItem() gin.HandlerFunc {
 		productQueryID := c.Query("id")
 
 		if productQueryID == "" {
-			log.Println("product id is empty")
+			logging.FromContext(c.Request.Context()).Debug("product id is empty")
 
 			_ = c.AbortWithError(http.StatusBadRequest, errors.New("product id is empty"))
 
 			return
 		}
 
-		userQueryID := c.Query("userID")
+		userQueryID := cartUserID(c, "userID")
 
 		if userQueryID == "" {
-			log.Println("user id is empty")
+			logging.FromContext(c.Request.Context()).Debug("user id is empty")
 			_ = c.AbortWithError(http.StatusBadRequest, errors.New("user id is empty"))
 			return
 		}
@@ -110,21 +247,17 @@ func (app *Application) RemoveItem() gin.HandlerFunc {
 		productID, err := primitive.ObjectIDFromHex(productQueryID)
 
 		if err != nil {
-			log.Println(err)
+			logging.FromContext(c.Request.Context()).Debug("invalid product id", "error", err)
 			c.AbortWithStatus(http.StatusInternalServerError)
 			return
 		}
 
-		var ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		var ctx, cancel = context.WithTimeout(c.Request.Context(), 5*time.Second)
 		defer cancel()
 
-		err = database.RemoveCartItem(
-			ctx,
-			app.prodCollection,
-			app.userCollection,
-			productID,
-			userQueryID,
-		)
+		err = cartUpdated(ctx, userQueryID, events.CartItemRemoved, productQueryID, func(ctx context.Context) error {
+			return database.RemoveCartItem(ctx, app.prodCollection, CartCollection, productID, userQueryID)
+		})
 
 		if err != nil {
 			c.IndentedJSON(http.StatusInternalServerError, err)
@@ -137,7 +270,7 @@ func (app *Application) RemoveItem() gin.HandlerFunc {
 
 func GetItemFromCart() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		user_id := c.Query("id")
+		user_id := cartUserID(c, "id")
 
 		if user_id == "" {
 			c.JSON(http.StatusNotFound, gin.H{
@@ -149,13 +282,20 @@ func GetItemFromCart() gin.HandlerFunc {
 		usert_id, err := primitive.ObjectIDFromHex(user_id)
 
 		if err != nil {
-			log.Println(err)
+			logging.FromContext(c.Request.Context()).Debug("invalid user id", "error", err)
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
 			return
 		}
 
+		opts, err := pricingOptions(c)
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
 		ctx, cancel := context.WithTimeout(
-			context.Background(),
+			c.Request.Context(),
 			100*time.Second,
 		)
 
@@ -174,58 +314,39 @@ func GetItemFromCart() gin.HandlerFunc {
 		).Decode(&filledcart)
 
 		if err != nil {
-			log.Println(err)
+			logging.FromContext(ctx).Error("cannot find the cart", "error", err)
 			c.IndentedJSON(404, "not found")
 			return
 		}
 
-		pipeline := mongo.Pipeline{
-			{{
-				Key: "$match",
-				Value: bson.M{
-					"_id": usert_id,
-				},
-			}},
-			{{
-				Key: "$unwind",
-				Value: bson.M{
-					"path": "$usercart",
-				},
-			}},
-			{{
-				Key: "$group",
-				Value: bson.M{
-					"_id": "$_id",
-					"total": bson.M{
-						"$sum": "$usercart.price",
-					},
-				}},
-			},
-		}
-
-		pointcursor, err := UserCollection.Aggregate(ctx, pipeline)
+		cart, err := loadCart(ctx, user_id, opts)
 
 		if err != nil {
-			log.Println(err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Aggregation failed"})
+			couponError(c, err)
 			return
 		}
 
-		var listing []bson.M
+		totals, err := database.CartTotals(
+			ctx,
+			CouponCollection,
+			RedemptionCollection,
+			PromotionCollection,
+			filledcart,
+			cart.Items,
+			opts,
+		)
 
-		if err = pointcursor.All(ctx, &listing); err != nil {
-			log.Println(err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode results"})
+		if err != nil {
+			couponError(c, err)
 			return
 		}
 
-		responseData := make([]gin.H, 0, len(listing))
-
-		for _, json := range listing {
-			responseData = append(responseData, gin.H{"total": json["total"], "cart": filledcart.UserCart})
+		// the customer sees the notices here, checkout won't repeat them
+		if err := database.AcknowledgeCartNotices(ctx, CartCollection, cart); err != nil {
+			logging.FromContext(ctx).Error("cannot acknowledge the cart notices", "error", err)
 		}
 
-		c.JSON(200, responseData)
+		c.JSON(200, gin.H{"cart": totals.Lines, "totals": totals, "notices": cart.Notices})
 	}
 }
 
@@ -234,22 +355,29 @@ func (app *Application) BuyFromCart() gin.HandlerFunc {
 		userQueryID := c.Query("id")
 
 		if userQueryID == "" {
-			log.Panicln("user id empty")
 			_ = c.AbortWithError(http.StatusBadRequest, errors.New("UserId is empty"))
+			return
 		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		opts, err := pricingOptions(c)
 
-		defer cancel()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 
-		err := database.BuyItemFromCart(
-			ctx,
-			app.userCollection,
-			userQueryID,
-		)
+		total, err := expectedTotal(c, opts.Currency)
 
 		if err != nil {
-			c.IndentedJSON(http.StatusInternalServerError, err)
+			_ = c.AbortWithError(http.StatusBadRequest, err)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+
+		defer cancel()
+
+		if _, ok := checkoutCart(ctx, c, app.userCollection, userQueryID, opts, total); !ok {
 			return
 		}
 
@@ -262,7 +390,7 @@ func (app *Application) InstantBuy() gin.HandlerFunc {
 		productQueryID := c.Query("id")
 
 		if productQueryID == "" {
-			log.Println("product id is empty")
+			logging.FromContext(c.Request.Context()).Debug("product id is empty")
 
 			_ = c.AbortWithError(http.StatusBadRequest, errors.New("product id is empty"))
 
@@ -272,7 +400,7 @@ func (app *Application) InstantBuy() gin.HandlerFunc {
 		userQueryID := c.Query("userID")
 
 		if userQueryID == "" {
-			log.Println("user id is empty")
+			logging.FromContext(c.Request.Context()).Debug("user id is empty")
 			_ = c.AbortWithError(http.StatusBadRequest, errors.New("user id is empty"))
 			return
 		}
@@ -280,24 +408,27 @@ func (app *Application) InstantBuy() gin.HandlerFunc {
 		productID, err := primitive.ObjectIDFromHex(productQueryID)
 
 		if err != nil {
-			log.Println(err)
+			logging.FromContext(c.Request.Context()).Debug("invalid product id", "error", err)
 			c.AbortWithStatus(http.StatusInternalServerError)
 			return
 		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		opts, err := pricingOptions(c)
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
 		defer cancel()
 
-		err = database.InstantBuyer(
-			ctx,
-			app.prodCollection,
-			app.userCollection,
-			productID,
-			userQueryID,
-		)
+		_, err = placeOrder(ctx, app.userCollection, userQueryID, func(ctx context.Context) (primitive.ObjectID, error) {
+			return database.InstantBuyer(ctx, app.prodCollection, app.userCollection, productID, userQueryID, opts)
+		})
 
 		if err != nil {
-			c.IndentedJSON(http.StatusInternalServerError, err)
+			couponError(c, err)
 			return
 		}
 
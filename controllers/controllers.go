@@ -2,13 +2,24 @@ package controllers
 
 import (
 	"context"
-	"log"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Ricardo-Cardozo/ecommerce_golang/database"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/events"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/logging"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/metrics"
 	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/money"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/notification"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/pricing"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/search"
 	generate "github.com/Ricardo-Cardozo/ecommerce_golang/tokens"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/tracing"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 	"go.mongodb.org/mongo-driver/bson"
@@ -20,22 +31,53 @@ import (
 var (
 	UserCollection    *mongo.Collection = database.UserData(database.Client, "Users")
 	ProductCollection *mongo.Collection = database.ProductData(database.Client, "Products")
-	Validate                            = validator.New()
+	SynonymCollection *mongo.Collection = database.SynonymData(database.Client, "Synonyms")
+	ReviewCollection  *mongo.Collection = database.ReviewData(database.Client, "Reviews")
+	CouponCollection  *mongo.Collection = database.CouponData(database.Client, "Coupons")
+	// RedemptionCollection records which orders used which coupon
+	RedemptionCollection *mongo.Collection = database.CouponData(database.Client, "CouponRedemptions")
+	PromotionCollection  *mongo.Collection = database.PromotionData(database.Client, "Promotions")
+	TaxRuleCollection    *mongo.Collection = database.TaxRuleData(database.Client, "TaxRules")
+	ShippingCollection   *mongo.Collection = database.ShippingData(database.Client, "ShippingMethods")
+	ShipmentCollection   *mongo.Collection = database.ShipmentData(database.Client, "Shipments")
+	ReturnCollection     *mongo.Collection = database.ReturnData(database.Client, "Returns")
+	RefundCollection     *mongo.Collection = database.RefundData(database.Client, "Refunds")
+	CartCollection       *mongo.Collection = database.CartData(database.Client, "Carts")
+	WishlistCollection   *mongo.Collection = database.WishlistData(database.Client, "Wishlists")
+	ReminderCollection   *mongo.Collection = database.ReminderData(database.Client, "CartReminders")
+	OutboxCollection     *mongo.Collection = database.OutboxData(database.Client, "Outbox")
+	WebhookCollection    *mongo.Collection = database.WebhookData(database.Client, "Webhooks")
+	DeliveryCollection   *mongo.Collection = database.WebhookData(database.Client, "WebhookDeliveries")
+	Validate                               = validator.New()
+	Speller                                = search.NewSpeller()
+	Synonyms                               = search.NewSynonyms()
+	// Taxes holds the rules of TaxRuleCollection; reload it after changes
+	Taxes = pricing.NewRuleTable()
+	// Notifier delivers notifications to users
+	Notifier notification.Notifier = notification.LogNotifier{}
 )
 
-func HashPassword(password string) string {
+func HashPassword(ctx context.Context, password string) (string, error) {
+	_, span := tracing.Start(ctx, "password.hash")
+
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
 
+	tracing.End(span, err)
+
 	if err != nil {
-		log.Panic(err)
+		return "", err
 	}
 
-	return string(bytes)
+	return string(bytes), nil
 }
 
-func VerifyPassword(userPassword string, givenPassword string) (bool, string) {
+func VerifyPassword(ctx context.Context, userPassword string, givenPassword string) (bool, string) {
+	_, span := tracing.Start(ctx, "password.verify")
+
 	err := bcrypt.CompareHashAndPassword([]byte(givenPassword), []byte(userPassword))
 
+	span.End()
+
 	valid := true
 
 	msg := ""
@@ -50,7 +92,7 @@ func VerifyPassword(userPassword string, givenPassword string) (bool, string) {
 
 func Signup() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var ctx, cancel = context.WithTimeout(c.Request.Context(), 100*time.Second)
 
 		defer cancel()
 
@@ -72,10 +114,11 @@ func Signup() gin.HandlerFunc {
 			return
 		}
 
-		count, err := UserCollection.CountDocuments(ctx, bson.M{"email": user.Email})
+		// guests leave an email on their orders but have no account
+		count, err := UserCollection.CountDocuments(ctx, bson.M{"email": user.Email, "guest": bson.M{"$ne": true}})
 
 		if err != nil {
-			log.Panic(err)
+			logging.FromContext(ctx).Error("cannot count the users", "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": err,
 			})
@@ -88,12 +131,12 @@ func Signup() gin.HandlerFunc {
 			})
 		}
 
-		count, err = UserCollection.CountDocuments(ctx, bson.M{"phone": user.Phone})
+		count, err = UserCollection.CountDocuments(ctx, bson.M{"phone": user.Phone, "guest": bson.M{"$ne": true}})
 
 		defer cancel()
 
 		if err != nil {
-			log.Panic(err)
+			logging.FromContext(ctx).Error("cannot count the users", "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": err,
 			})
@@ -107,7 +150,12 @@ func Signup() gin.HandlerFunc {
 			return
 		}
 
-		password := HashPassword(*user.Password)
+		password, err := HashPassword(ctx, *user.Password)
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 
 		user.Password = &password
 
@@ -115,25 +163,38 @@ func Signup() gin.HandlerFunc {
 		user.Updated_At, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		user.ID = primitive.NewObjectID()
 		user.User_ID = user.ID.Hex()
+		// staff are made in the database, never by signing up
+		user.Role = ""
 
 		token, refreshtoken, _ := generate.TokenGenerator(
+			ctx,
 			*user.Email,
 			*user.First_Name,
 			*user.Last_Name,
 			user.User_ID,
+			user.Role,
 		)
 
 		user.Token = &token
 
 		user.Refresh_Token = &refreshtoken
 
-		user.UserCart = make([]models.ProductUser, 0)
-
 		user.Address_Details = make([]models.Address, 0)
 
 		user.Order_Status = make([]models.Order, 0)
 
-		_, inserterr := UserCollection.InsertOne(ctx, user)
+		inserterr := withEvent(ctx, func(ctx context.Context) (events.Event, error) {
+			if _, err := UserCollection.InsertOne(ctx, user); err != nil {
+				return events.Event{}, err
+			}
+
+			return events.New(events.UserSignedUp, user.User_ID, events.UserSignedUpPayload{
+				User_ID:    user.User_ID,
+				Email:      *user.Email,
+				First_Name: *user.First_Name,
+				Last_Name:  *user.Last_Name,
+			})
+		})
 
 		if inserterr != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
@@ -150,7 +211,7 @@ func Signup() gin.HandlerFunc {
 
 func Login() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var ctx, cancel = context.WithTimeout(c.Request.Context(), 100*time.Second)
 
 		defer cancel()
 
@@ -164,22 +225,24 @@ func Login() gin.HandlerFunc {
 			return
 		}
 
-		err := UserCollection.FindOne(ctx, bson.M{"email": user.Email}).Decode(&founduser)
+		err := UserCollection.FindOne(ctx, bson.M{"email": user.Email, "guest": bson.M{"$ne": true}}).Decode(&founduser)
 
 		defer cancel()
 
 		if err != nil {
+			metrics.FailedLogins.With(metrics.LoginUnknownUser).Inc()
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": "login or password incorrect",
 			})
 			return
 		}
 
-		PasswordIsValid, msg := VerifyPassword(*user.Password, *founduser.Password)
+		PasswordIsValid, msg := VerifyPassword(ctx, *user.Password, *founduser.Password)
 
 		defer cancel()
 
 		if !PasswordIsValid {
+			metrics.FailedLogins.With(metrics.LoginWrongPassword).Inc()
 			c.JSON(
 				http.StatusInternalServerError,
 				gin.H{
@@ -190,15 +253,33 @@ func Login() gin.HandlerFunc {
 		}
 
 		token, refreshToken, _ := generate.TokenGenerator(
+			ctx,
 			*founduser.Email,
 			*founduser.First_Name,
 			*founduser.Last_Name,
 			founduser.User_ID,
+			founduser.Role,
 		)
 
 		defer cancel()
 
-		generate.UpdateAllTokens(token, refreshToken, founduser.User_ID)
+		if _, err := generate.UpdateAllTokens(ctx, token, refreshToken, founduser.User_ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not save the tokens"})
+			return
+		}
+
+		// a guest signing in keeps what they put in their cart
+		if cartToken := c.GetHeader("X-Cart-Token"); cartToken != "" {
+			if claims, msg := generate.ValidateCartToken(ctx, cartToken); msg == "" {
+				err := cartUpdated(ctx, founduser.User_ID, events.CartMergedGuest, "", func(ctx context.Context) error {
+					return database.MergeGuestCart(ctx, CartCollection, claims.Cart_ID, founduser.User_ID)
+				})
+
+				if err != nil {
+					logging.FromContext(ctx).Error("cannot merge the guest cart", "error", err)
+				}
+			}
+		}
 
 		c.JSON(http.StatusFound, founduser)
 	}
@@ -206,7 +287,7 @@ func Login() gin.HandlerFunc {
 
 func ProductViewerAdmin() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
 
 		defer cancel()
 
@@ -217,107 +298,196 @@ func ProductViewerAdmin() gin.HandlerFunc {
 			return
 		}
 
+		if err := checkAmount("price", &products.Price); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if products.Weight_Grams < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "weight_grams must not be negative"})
+			return
+		}
+
+		if products.Stock != nil && *products.Stock < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "stock must not be negative"})
+			return
+		}
+
+		if products.Dimensions != nil {
+			if err := Validate.Struct(products.Dimensions); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		seen := map[string]bool{products.Price.Currency: true}
+
+		for i := range products.Prices {
+			if err := checkAmount("prices", &products.Prices[i]); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+
+			if seen[products.Prices[i].Currency] {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "prices must list each currency once, apart from price"})
+				return
+			}
+
+			seen[products.Prices[i].Currency] = true
+		}
+
 		products.Product_ID = primitive.NewObjectID()
+		products.Created_At, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
+		products.Search_Terms = database.ProductTerms(products)
+		// ratings are earned through reviews, never set by hand
+		products.Rating = 0
+		products.Rating_Count = 0
 
 		if _, err := ProductCollection.InsertOne(ctx, products); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "not inserted"})
 			return
 		}
 
+		Speller.Add(products.Search_Terms...)
+
 		c.JSON(http.StatusFound, "succesfully added")
 	}
 }
 
-func SearchProduct() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		var productlist []models.Product
-		ctx, cancel := context.WithTimeout(
-			context.Background(),
-			100*time.Second,
-		)
+// checkAmount fills in the default currency of an amount sent without one
+// and rejects unknown currencies and negative amounts.
+func checkAmount(field string, m *money.Money) error {
+	if m.Currency == "" {
+		m.Currency = money.DefaultCurrency
+	}
 
-		defer cancel()
+	m.Currency = strings.ToUpper(m.Currency)
 
-		cursor, err := ProductCollection.Find(ctx, bson.D{{}})
+	if !money.Valid(m.Currency) {
+		return fmt.Errorf("%s: %w", field, money.ErrUnknownCurrency)
+	}
 
-		if err != nil {
-			c.IndentedJSON(
-				http.StatusInternalServerError,
-				"something went wrong. please try after some time",
-			)
-			return
-		}
+	if m.Amount < 0 {
+		return fmt.Errorf("%s must not be negative", field)
+	}
 
-		cursor.All(ctx, &productlist)
+	return nil
+}
 
-		if err != nil {
-			log.Println(err)
-			c.AbortWithStatusJSON(http.StatusInternalServerError, err)
-			return
-		}
+// parseProductQuery reads the paging, sorting and filter parameters shared
+// by the product listing endpoints.
+func parseProductQuery(c *gin.Context) (database.ProductQuery, error) {
+	q := database.ProductQuery{
+		Category: c.Query("category"),
+		Brand:    c.Query("brand"),
+		Sort:     c.Query("sort"),
+		Cursor:   c.Query("cursor"),
+	}
 
-		defer cursor.Close(ctx)
+	// variant attribute filters come as attr=color:red&attr=size:42
+	for _, attr := range c.QueryArray("attr") {
+		key, value, ok := strings.Cut(attr, ":")
 
-		if err := cursor.Err(); err != nil {
-			log.Println(err)
-			c.IndentedJSON(400, "invalid")
-			return
+		if !ok || key == "" || strings.ContainsAny(key, ".$") {
+			return q, errors.New("attr must look like name:value")
 		}
 
-		defer cancel()
+		if q.Attributes == nil {
+			q.Attributes = make(map[string]string)
+		}
 
-		c.IndentedJSON(200, productlist)
+		q.Attributes[key] = value
 	}
-}
 
-func SearchProductByQuery() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		var searchproduct []models.Product
+	if v := c.Query("limit"); v != "" {
+		limit, err := strconv.ParseInt(v, 10, 64)
 
-		queryParam := c.Query("name")
-
-		if queryParam == "" {
-			c.JSON(http.StatusNotFound, gin.H{
-				"error": "invalid search index",
-			})
-			return
+		if err != nil || limit <= 0 {
+			return q, errors.New("limit must be a positive number")
 		}
 
-		ctx, cancel := context.WithTimeout(
-			context.Background(),
-			100*time.Second,
-		)
+		q.Limit = limit
+	}
 
-		defer cancel()
+	currency, err := requestCurrency(c)
 
-		searchproductdb, err := ProductCollection.Find(
-			ctx,
-			bson.M{"product_name": bson.M{"$regex": queryParam}},
-		)
+	if err != nil {
+		return q, err
+	}
 
-		if err != nil {
-			c.IndentedJSON(404, "something went wrong while fetching the data")
-			return
+	q.Currency = currency
+
+	if v := c.Query("min_price"); v != "" {
+		price, err := strconv.ParseInt(v, 10, 64)
+
+		if err != nil || price < 0 {
+			return q, errors.New("min_price must be a positive number")
 		}
 
-		err = searchproductdb.All(ctx, &searchproduct)
+		q.MinPrice = &price
+	}
+
+	if v := c.Query("max_price"); v != "" {
+		price, err := strconv.ParseInt(v, 10, 64)
 
-		if err != nil {
-			log.Println(err)
-			c.IndentedJSON(400, "invalid")
-			return
+		if err != nil || price < 0 {
+			return q, errors.New("max_price must be a positive number")
 		}
 
-		defer searchproductdb.Close(ctx)
+		q.MaxPrice = &price
+	}
 
-		if err := searchproductdb.Err(); err != nil {
-			log.Println(err)
-			c.IndentedJSON(400, "invalid request")
-			return
+	if v := c.Query("min_rating"); v != "" {
+		rating, err := strconv.ParseUint(v, 10, 8)
+
+		if err != nil || rating > 5 {
+			return q, errors.New("min_rating must be between 0 and 5")
 		}
 
-		defer cancel()
+		r := uint8(rating)
+		q.MinRating = &r
+	}
+
+	return q, nil
+}
+
+func listProducts(c *gin.Context, extra bson.M) {
+	query, err := parseProductQuery(c)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+
+	defer cancel()
 
-		c.IndentedJSON(200, searchproduct)
+	productlist, next, err := database.ListProducts(ctx, ProductCollection, query, extra)
+
+	if errors.Is(err, database.ErrInvalidCursor) || errors.Is(err, database.ErrInvalidSort) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		c.IndentedJSON(
+			http.StatusInternalServerError,
+			"something went wrong. please try after some time",
+		)
+		return
+	}
+
+	localizeProducts(productlist, query.Currency)
+
+	c.IndentedJSON(200, gin.H{
+		"products":    productlist,
+		"next_cursor": next,
+	})
+}
+
+func SearchProduct() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		listProducts(c, nil)
 	}
 }
@@ -0,0 +1,213 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/database"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/pricing"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// couponError maps coupon and checkout errors to a status; coupon rule,
+// currency and shipping violations are the customer's to fix, so they come
+// back as 400 with the reason.
+func couponError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, database.ErrCantFindCoupon),
+		errors.Is(err, database.ErrCantFindUser),
+		errors.Is(err, database.ErrCantFindAddress),
+		errors.Is(err, database.ErrCantFindShippingMethod):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, pricing.ErrCouponInactive),
+		errors.Is(err, pricing.ErrCouponNotStarted),
+		errors.Is(err, pricing.ErrCouponExpired),
+		errors.Is(err, pricing.ErrCouponExhausted),
+		errors.Is(err, pricing.ErrCouponUserLimit),
+		errors.Is(err, pricing.ErrCouponMinCartValue),
+		errors.Is(err, pricing.ErrCouponNotEligible),
+		errors.Is(err, pricing.ErrCouponCurrency),
+		errors.Is(err, database.ErrCantPriceCart),
+		isCurrencyError(err),
+		errors.Is(err, database.ErrShippingMethodRequired),
+		errors.Is(err, pricing.ErrShippingUnavailable),
+		errors.Is(err, pricing.ErrAddressRequired),
+		errors.Is(err, database.ErrCouponCodeTaken),
+		errors.Is(err, database.ErrCartIsEmpty),
+		errors.Is(err, database.ErrUserIdIsNotValid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, database.ErrTotalsChanged),
+		errors.Is(err, database.ErrCartChanged),
+		errors.Is(err, database.ErrProductUnavailable),
+		errors.Is(err, database.ErrCantReserveStock):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func CreateCoupon() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var coupon models.Coupon
+
+		if err := c.BindJSON(&coupon); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := Validate.Struct(coupon); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if coupon.Type == models.CouponPercentage && (coupon.Percent <= 0 || coupon.Percent > 100) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "a percentage coupon needs a percent between 1 and 100"})
+			return
+		}
+
+		if err := checkAmount("amount", &coupon.Amount); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if coupon.Type == models.CouponFixedAmount && coupon.Amount.IsZero() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "a fixed amount coupon needs an amount"})
+			return
+		}
+
+		if err := checkAmount("min_cart_value", &coupon.Min_Cart_Value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if coupon.Starts_At != nil && coupon.Ends_At != nil && !coupon.Ends_At.After(*coupon.Starts_At) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "ends_at must be after starts_at"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		saved, err := database.CreateCoupon(ctx, CouponCollection, coupon)
+
+		if err != nil {
+			couponError(c, err)
+			return
+		}
+
+		c.IndentedJSON(http.StatusCreated, saved)
+	}
+}
+
+func ListCoupons() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		coupons, err := database.ListCoupons(ctx, CouponCollection)
+
+		if err != nil {
+			couponError(c, err)
+			return
+		}
+
+		c.IndentedJSON(200, coupons)
+	}
+}
+
+// SetCouponActive switches the coupon in "id" on or off with active=true or
+// active=false.
+func SetCouponActive() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		couponID, err := primitive.ObjectIDFromHex(c.Query("id"))
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+			return
+		}
+
+		active := c.Query("active") == "true"
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		if err := database.SetCouponActive(ctx, CouponCollection, couponID, active); err != nil {
+			couponError(c, err)
+			return
+		}
+
+		c.IndentedJSON(200, "Succesfully updated the coupon")
+	}
+}
+
+// ApplyCoupon puts the code in "code" on the signed in customer's cart and
+// returns the new totals.
+func ApplyCoupon() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		code := c.Query("code")
+
+		if code == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "coupon code is empty"})
+			return
+		}
+
+		opts, err := pricingOptions(c)
+
+		if err != nil {
+			couponError(c, err)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		cart, err := loadCart(ctx, c.GetString("uid"), opts)
+
+		if err != nil {
+			couponError(c, err)
+			return
+		}
+
+		totals, err := database.ApplyCouponToCart(
+			ctx,
+			UserCollection,
+			CouponCollection,
+			RedemptionCollection,
+			PromotionCollection,
+			c.GetString("uid"),
+			cart.Items,
+			code,
+			opts,
+		)
+
+		if err != nil {
+			couponError(c, err)
+			return
+		}
+
+		c.IndentedJSON(200, totals)
+	}
+}
+
+func RemoveCoupon() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		if err := database.RemoveCouponFromCart(ctx, UserCollection, c.GetString("uid")); err != nil {
+			couponError(c, err)
+			return
+		}
+
+		c.IndentedJSON(200, "Succesfully removed the coupon")
+	}
+}
@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/logging"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/money"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/pricing"
+	"github.com/gin-gonic/gin"
+)
+
+// Rates converts prices for products without a price list entry in the
+// requested currency. main loads it from RatesFile, where admin updates are
+// saved back.
+var (
+	Rates     = money.NewRates()
+	RatesFile string
+)
+
+// requestCurrency is the currency the customer asked for with ?currency= or
+// the X-Currency header, DefaultCurrency when neither is set.
+func requestCurrency(c *gin.Context) (string, error) {
+	currency := c.Query("currency")
+
+	if currency == "" {
+		currency = c.GetHeader("X-Currency")
+	}
+
+	if currency == "" {
+		return money.DefaultCurrency, nil
+	}
+
+	if !money.Valid(currency) {
+		return "", money.ErrUnknownCurrency
+	}
+
+	return strings.ToUpper(currency), nil
+}
+
+// localizeProducts sets the display price of each product in currency. A
+// product that can't be converted keeps no display price rather than
+// failing the whole listing.
+func localizeProducts(products []models.Product, currency string) {
+	for i := range products {
+		price, _, err := pricing.ListPrice(products[i].Price, products[i].Prices, currency, Rates)
+
+		if err != nil {
+			continue
+		}
+
+		products[i].Display_Price = &price
+	}
+}
+
+func isCurrencyError(err error) bool {
+	return errors.Is(err, money.ErrUnknownCurrency) || errors.Is(err, money.ErrNoRate)
+}
+
+func GetRates() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.IndentedJSON(200, Rates.Table())
+	}
+}
+
+// UpdateRates replaces the exchange-rate table and saves it to RatesFile.
+func UpdateRates() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var table money.Table
+
+		if err := c.BindJSON(&table); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		// the table is stamped when it is set, not when the client says
+		table.UpdatedAt = time.Time{}
+
+		if err := Rates.Set(table); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if RatesFile != "" {
+			if err := Rates.Save(RatesFile); err != nil {
+				logging.FromContext(c.Request.Context()).Error("cannot save the rates", "error", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "the rates were updated but could not be saved"})
+				return
+			}
+		}
+
+		c.IndentedJSON(200, Rates.Table())
+	}
+}
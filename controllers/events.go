@@ -0,0 +1,97 @@
+package controllers
+
+import (
+	"context"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/database"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/events"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/metrics"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// withEvent runs change and records the event it returns in the outbox
+// along with it, see database.WithEvents.
+func withEvent(ctx context.Context, change func(ctx context.Context) (events.Event, error)) error {
+	return database.WithEvents(ctx, OutboxCollection, func(ctx context.Context) ([]events.Event, error) {
+		event, err := change(ctx)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return []events.Event{event}, nil
+	})
+}
+
+// cartUpdated records a change of the user's cart made by change.
+func cartUpdated(ctx context.Context, userID string, action string, productID string, change func(ctx context.Context) error) error {
+	return withEvent(ctx, func(ctx context.Context) (events.Event, error) {
+		if err := change(ctx); err != nil {
+			return events.Event{}, err
+		}
+
+		return events.New(events.CartUpdated, userID, events.CartUpdatedPayload{
+			User_ID:    userID,
+			Action:     action,
+			Product_ID: productID,
+		})
+	})
+}
+
+// placeOrder records the order buy places for the user, and counts it in
+// the metrics once it is saved.
+func placeOrder(
+	ctx context.Context,
+	userCollection *mongo.Collection,
+	userID string,
+	buy func(ctx context.Context) (primitive.ObjectID, error),
+) (primitive.ObjectID, error) {
+	var orderID primitive.ObjectID
+	var total money.Money
+
+	err := withEvent(ctx, func(ctx context.Context) (events.Event, error) {
+		id, err := buy(ctx)
+
+		if err != nil {
+			return events.Event{}, err
+		}
+
+		_, order, err := database.FindOrder(ctx, userCollection, id)
+
+		if err != nil {
+			return events.Event{}, err
+		}
+
+		orderID = id
+		total = order.Price
+
+		return events.New(events.OrderPlaced, id.Hex(), events.OrderPlacedPayload{User_ID: userID, Order: order})
+	})
+
+	if err == nil {
+		metrics.OrderPlaced(total)
+	}
+
+	return orderID, err
+}
+
+// orderRefunded is the event of refund.
+func orderRefunded(refund models.Refund) (events.Event, error) {
+	return events.New(events.OrderRefunded, refund.Order_ID.Hex(), events.OrderRefundedPayload{
+		User_ID:  refund.User_ID,
+		Order_ID: refund.Order_ID.Hex(),
+		Refund:   refund,
+	})
+}
+
+// returnUpdated is the event of ret in its current status.
+func returnUpdated(ret models.Return) (events.Event, error) {
+	return events.New(events.ReturnUpdated, ret.Order_ID.Hex(), events.ReturnUpdatedPayload{
+		User_ID:  ret.User_ID,
+		Order_ID: ret.Order_ID.Hex(),
+		Return:   ret,
+	})
+}
@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/database"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/logging"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	generate "github.com/Ricardo-Cardozo/ecommerce_golang/tokens"
+	"github.com/gin-gonic/gin"
+)
+
+// cartUserID is whose cart a cart request is about. Guests, see
+// middleware.CartToken, only ever reach their own cart; signed in users
+// name it in the query parameter, or get their own without one.
+func cartUserID(c *gin.Context, param string) string {
+	if c.GetBool("guest") {
+		return c.GetString("uid")
+	}
+
+	if v := c.Query(param); v != "" {
+		return v
+	}
+
+	return c.GetString("uid")
+}
+
+// NewGuestCart starts an anonymous cart and returns the token that
+// identifies it in the X-Cart-Token header of the /guest endpoints.
+func NewGuestCart() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		guest, err := database.CreateGuest(ctx, UserCollection)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		token, expiresAt, err := generate.CartTokenGenerator(ctx, guest.User_ID)
+
+		if err != nil {
+			logging.FromContext(c.Request.Context()).Error("cannot sign the cart token", "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not sign the cart token"})
+			return
+		}
+
+		c.IndentedJSON(http.StatusCreated, gin.H{"cart_token": token, "expires_at": expiresAt})
+	}
+}
+
+type guestCheckout struct {
+	Email   *string         `json:"email" validate:"required,email"`
+	Address *models.Address `json:"address"`
+}
+
+// GuestCheckout places the order of a guest's cart with just an email and a
+// delivery address, which local pickup doesn't need. It takes the same
+// query parameters as BuyFromCart.
+func GuestCheckout() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request guestCheckout
+
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := Validate.Struct(request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		opts, err := pricingOptions(c)
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		total, err := expectedTotal(c, opts.Currency)
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+
+		defer cancel()
+
+		guestID := c.GetString("uid")
+		email := strings.ToLower(strings.TrimSpace(*request.Email))
+
+		address, err := database.SetGuestContact(ctx, UserCollection, guestID, email, request.Address)
+
+		if errors.Is(err, database.ErrNotAGuest) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if address != nil {
+			opts.AddressID = address.Address_ID.Hex()
+		}
+
+		orderID, ok := checkoutCart(ctx, c, UserCollection, guestID, opts, total)
+
+		if !ok {
+			return
+		}
+
+		c.IndentedJSON(200, gin.H{"message": "Succesfully placed the order", "order_id": orderID})
+	}
+}
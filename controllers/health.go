@@ -0,0 +1,59 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/database"
+	"github.com/gin-gonic/gin"
+)
+
+// Draining is set when the service starts shutting down, so Ready sends
+// new traffic elsewhere while the requests in flight finish.
+var Draining atomic.Bool
+
+// storageStatus pings MongoDB, for a health check.
+func storageStatus(c *gin.Context) (string, bool) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Second)
+
+	defer cancel()
+
+	if err := database.Ping(ctx); err != nil {
+		return err.Error(), false
+	}
+
+	return "ok", true
+}
+
+// Healthy tells the service is alive. It answers 200 whenever it can
+// answer at all, so a database outage doesn't get it restarted, and shows
+// whether MongoDB answers.
+func Healthy() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		mongodb, _ := storageStatus(c)
+
+		c.JSON(http.StatusOK, gin.H{"status": "ok", "mongodb": mongodb})
+	}
+}
+
+// Ready tells whether the service should get traffic: 503 while MongoDB
+// doesn't answer or once it is shutting down.
+func Ready() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if Draining.Load() {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"status": "shutting down"})
+			return
+		}
+
+		mongodb, ok := storageStatus(c)
+
+		if !ok {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "mongodb": mongodb})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"status": "ok", "mongodb": mongodb})
+	}
+}
@@ -0,0 +1,260 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/blobstore"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/database"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/imaging"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/logging"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Blobs stores uploaded product images; main sets it up before serving.
+var Blobs blobstore.BlobStore
+
+func imageError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, database.ErrCantFindProduct), errors.Is(err, database.ErrCantFindImage):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, database.ErrInvalidImageSet):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, imaging.ErrTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+	case errors.Is(err, imaging.ErrUnsupportedType), errors.Is(err, imaging.ErrCorrupt):
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// storeImage writes the original and its thumbnails under
+// products/<product>/<image>, removing what it wrote if any step fails.
+func storeImage(ctx context.Context, productID primitive.ObjectID, data []byte) (models.ProductImage, error) {
+	image := models.ProductImage{Image_ID: primitive.NewObjectID()}
+
+	contentType, err := imaging.Sniff(data)
+
+	if err != nil {
+		return image, err
+	}
+
+	decoded, err := imaging.Decode(data)
+
+	if err != nil {
+		return image, err
+	}
+
+	base := "products/" + productID.Hex() + "/" + image.Image_ID.Hex()
+	written := make([]string, 0, len(imaging.ThumbnailSizes)+1)
+
+	// removeWritten deletes what was stored so far, when a step fails
+	removeWritten := func() {
+		for _, key := range written {
+			_ = Blobs.Delete(ctx, key)
+		}
+	}
+
+	put := func(key string, body []byte, contentType string) error {
+		if err := Blobs.Put(ctx, key, bytes.NewReader(body), contentType); err != nil {
+			logging.FromContext(ctx).Error("cannot store the image", "error", err)
+			removeWritten()
+
+			return database.ErrCantSaveImage
+		}
+
+		written = append(written, key)
+		return nil
+	}
+
+	image.Key = base + imaging.Extension(contentType)
+	image.URL = Blobs.URL(image.Key)
+	image.Content_Type = contentType
+	image.Width = decoded.Bounds().Dx()
+	image.Height = decoded.Bounds().Dy()
+
+	if err = put(image.Key, data, contentType); err != nil {
+		return image, err
+	}
+
+	for _, size := range imaging.ThumbnailSizes {
+		thumb := imaging.Fit(decoded, size)
+
+		body, thumbType, err := imaging.Encode(thumb, contentType)
+
+		if err != nil {
+			logging.FromContext(ctx).Error("cannot encode the thumbnail", "error", err)
+			removeWritten()
+
+			return image, imaging.ErrCorrupt
+		}
+
+		key := base + "_" + size.Name + imaging.Extension(thumbType)
+
+		if err = put(key, body, thumbType); err != nil {
+			return image, err
+		}
+
+		image.Thumbnails = append(image.Thumbnails, models.Thumbnail{
+			Size:   size.Name,
+			Key:    key,
+			URL:    Blobs.URL(key),
+			Width:  thumb.Bounds().Dx(),
+			Height: thumb.Bounds().Dy(),
+		})
+	}
+
+	return image, nil
+}
+
+func deleteImageBlobs(ctx context.Context, image models.ProductImage) {
+	keys := []string{image.Key}
+
+	for _, thumb := range image.Thumbnails {
+		keys = append(keys, thumb.Key)
+	}
+
+	for _, key := range keys {
+		if err := Blobs.Delete(ctx, key); err != nil {
+			logging.FromContext(ctx).Error("cannot delete the image", "error", err)
+		}
+	}
+}
+
+// UploadProductImage takes a multipart "image" file for the product in "id"
+// and appends it, with thumbnails, to the product's images.
+func UploadProductImage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, err := primitive.ObjectIDFromHex(c.Query("id"))
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+			return
+		}
+
+		// leave room for the multipart framing around the file
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, imaging.MaxBytes+1<<20)
+
+		file, _, err := c.Request.FormFile("image")
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "an image file is required"})
+			return
+		}
+
+		defer file.Close()
+
+		data, err := io.ReadAll(io.LimitReader(file, imaging.MaxBytes+1))
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if len(data) > imaging.MaxBytes {
+			imageError(c, imaging.ErrTooLarge)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+
+		defer cancel()
+
+		if _, err := database.FindProduct(ctx, ProductCollection, productID); err != nil {
+			imageError(c, err)
+			return
+		}
+
+		image, err := storeImage(ctx, productID, data)
+
+		if err != nil {
+			imageError(c, err)
+			return
+		}
+
+		images, err := database.AddProductImage(ctx, ProductCollection, productID, image)
+
+		if err != nil {
+			deleteImageBlobs(ctx, image)
+			imageError(c, err)
+			return
+		}
+
+		c.IndentedJSON(http.StatusCreated, images)
+	}
+}
+
+// ReorderProductImages takes {"order": [image ids]} for the product in "id";
+// the first image becomes the main one.
+func ReorderProductImages() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, err := primitive.ObjectIDFromHex(c.Query("id"))
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+			return
+		}
+
+		var body struct {
+			Order []primitive.ObjectID `json:"order"`
+		}
+
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		images, err := database.ReorderProductImages(ctx, ProductCollection, productID, body.Order)
+
+		if err != nil {
+			imageError(c, err)
+			return
+		}
+
+		c.IndentedJSON(200, images)
+	}
+}
+
+func DeleteProductImage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, err := primitive.ObjectIDFromHex(c.Query("id"))
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+			return
+		}
+
+		imageID, err := primitive.ObjectIDFromHex(c.Query("image"))
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		removed, err := database.RemoveProductImage(ctx, ProductCollection, productID, imageID)
+
+		if err != nil {
+			imageError(c, err)
+			return
+		}
+
+		deleteImageBlobs(ctx, removed)
+
+		c.IndentedJSON(200, "Succesfully deleted the image")
+	}
+}
@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/database"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/logging"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/notification"
+	"github.com/gin-gonic/gin"
+)
+
+// notify sends the event in the background, so retries don't hold up the
+// request that caused it. The request's logging fields go along, its
+// deadline doesn't.
+func notify(ctx context.Context, kind string, userID string, data map[string]string) {
+	event := notification.Event{Kind: kind, User_ID: userID, Data: data, Created_At: time.Now()}
+	ctx = context.WithoutCancel(ctx)
+
+	go func() {
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+
+		defer cancel()
+
+		if err := Notifier.Notify(ctx, event); err != nil {
+			logging.FromContext(ctx).Error("cannot send the notification", "kind", kind, "user_id", userID, "error", err)
+		}
+	}()
+}
+
+// NotificationPreferences shows the channels the signed in user gets
+// messages on.
+func NotificationPreferences() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		user, err := database.FindUser(ctx, UserCollection, c.GetString("uid"))
+
+		if err != nil {
+			couponError(c, err)
+			return
+		}
+
+		preferences := database.NotificationPreferences(user)
+
+		c.IndentedJSON(200, models.NotificationPreferences{Email: preferences.Email, SMS: preferences.SMS})
+	}
+}
+
+// SetNotificationPreferences chooses the channels the signed in user gets
+// messages on. Password resets and verification codes are emailed anyway.
+func SetNotificationPreferences() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var preferences models.NotificationPreferences
+
+		if err := c.BindJSON(&preferences); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		if err := database.SetNotificationPreferences(ctx, UserCollection, c.GetString("uid"), preferences); err != nil {
+			couponError(c, err)
+			return
+		}
+
+		c.IndentedJSON(200, "Succesfully saved the notification preferences")
+	}
+}
@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/database"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// validatePromotion checks the fields each promotion type depends on and
+// fills in the default currency of its amounts.
+func validatePromotion(promotion *models.Promotion) error {
+	switch promotion.Type {
+	case models.PromotionBuyXGetY:
+		if promotion.Buy_Quantity <= 0 || promotion.Get_Quantity <= 0 ||
+			promotion.Get_Percent <= 0 || promotion.Get_Percent > 100 {
+			return errors.New("buy_x_get_y needs buy_quantity, get_quantity and a get_percent up to 100")
+		}
+	case models.PromotionSpendThreshold:
+		if len(promotion.Tiers) == 0 {
+			return errors.New("spend_threshold needs at least one tier")
+		}
+
+		for i := range promotion.Tiers {
+			tier := &promotion.Tiers[i]
+
+			if err := checkAmount("min_subtotal", &tier.Min_Subtotal); err != nil {
+				return err
+			}
+
+			if err := checkAmount("amount", &tier.Amount); err != nil {
+				return err
+			}
+
+			if tier.Amount.Currency != tier.Min_Subtotal.Currency {
+				return errors.New("a tier's amount and min_subtotal must use the same currency")
+			}
+
+			if tier.Percent < 0 || tier.Percent > 100 {
+				return errors.New("a tier's percent must be between 0 and 100")
+			}
+		}
+	case models.PromotionBundle:
+		if len(promotion.Product_IDs) < 2 {
+			return errors.New("a bundle needs at least two product_ids")
+		}
+
+		if err := checkAmount("bundle_price", &promotion.Bundle_Price); err != nil {
+			return err
+		}
+	}
+
+	if promotion.Starts_At != nil && promotion.Ends_At != nil && !promotion.Ends_At.After(*promotion.Starts_At) {
+		return errors.New("ends_at must be after starts_at")
+	}
+
+	return nil
+}
+
+func CreatePromotion() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var promotion models.Promotion
+
+		if err := c.BindJSON(&promotion); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := Validate.Struct(promotion); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := validatePromotion(&promotion); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		saved, err := database.CreatePromotion(ctx, PromotionCollection, promotion)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.IndentedJSON(http.StatusCreated, saved)
+	}
+}
+
+func ListPromotions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		promotions, err := database.ListPromotions(ctx, PromotionCollection)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.IndentedJSON(200, promotions)
+	}
+}
+
+// SetPromotionActive switches the promotion in "id" on or off with
+// active=true or active=false.
+func SetPromotionActive() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		promotionID, err := primitive.ObjectIDFromHex(c.Query("id"))
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		err = database.SetPromotionActive(ctx, PromotionCollection, promotionID, c.Query("active") == "true")
+
+		if errors.Is(err, database.ErrCantFindPromotion) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.IndentedJSON(200, "Succesfully updated the promotion")
+	}
+}
@@ -0,0 +1,343 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/database"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/events"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CancelOrder cancels the signed in user's order in "order_id" if nothing
+// of it has shipped yet, and refunds it.
+func CancelOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orderID, err := primitive.ObjectIDFromHex(c.Query("order_id"))
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		var refund *models.Refund
+
+		err = database.WithEvents(ctx, OutboxCollection, func(ctx context.Context) ([]events.Event, error) {
+			userID := c.GetString("uid")
+
+			refunded, err := database.CancelOrder(
+				ctx,
+				UserCollection,
+				ProductCollection,
+				ShipmentCollection,
+				RefundCollection,
+				CouponCollection,
+				RedemptionCollection,
+				userID,
+				orderID,
+			)
+
+			if err != nil {
+				return nil, err
+			}
+
+			refund = refunded
+
+			cancelled, err := events.New(events.OrderCancelled, orderID.Hex(), events.OrderCancelledPayload{
+				User_ID:  userID,
+				Order_ID: orderID.Hex(),
+				Refund:   refunded,
+			})
+
+			if err != nil || refunded == nil {
+				return []events.Event{cancelled}, err
+			}
+
+			event, err := orderRefunded(*refunded)
+
+			return []events.Event{cancelled, event}, err
+		})
+
+		if err != nil {
+			orderError(c, err)
+			return
+		}
+
+		c.IndentedJSON(200, gin.H{"message": "Succesfully cancelled the order", "refund": refund})
+	}
+}
+
+// RequestReturn opens a return of delivered items of the signed in user's
+// order.
+func RequestReturn() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request models.Return
+
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := Validate.Struct(request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		var saved models.Return
+
+		err := withEvent(ctx, func(ctx context.Context) (events.Event, error) {
+			ret, err := database.RequestReturn(
+				ctx,
+				UserCollection,
+				ShipmentCollection,
+				ReturnCollection,
+				c.GetString("uid"),
+				request,
+			)
+
+			if err != nil {
+				return events.Event{}, err
+			}
+
+			saved = ret
+
+			return returnUpdated(ret)
+		})
+
+		if err != nil {
+			orderError(c, err)
+			return
+		}
+
+		c.IndentedJSON(http.StatusCreated, saved)
+	}
+}
+
+// MyReturns lists the signed in user's returns.
+func MyReturns() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		returns, err := database.ListReturns(ctx, ReturnCollection, bson.M{"user_id": c.GetString("uid")})
+
+		if err != nil {
+			orderError(c, err)
+			return
+		}
+
+		c.IndentedJSON(200, returns)
+	}
+}
+
+// ListReturns lists the returns in ?status=, requested ones by default.
+func ListReturns() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		status := c.DefaultQuery("status", models.ReturnRequested)
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		returns, err := database.ListReturns(ctx, ReturnCollection, bson.M{"status": status})
+
+		if err != nil {
+			orderError(c, err)
+			return
+		}
+
+		c.IndentedJSON(200, returns)
+	}
+}
+
+// DecideReturn approves the return in "id" with ?approve=true and rejects
+// it otherwise. The body may carry a note for the customer.
+func DecideReturn() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		returnID, err := primitive.ObjectIDFromHex(c.Query("id"))
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+			return
+		}
+
+		var body struct {
+			Note *string `json:"note"`
+		}
+
+		if c.Request.ContentLength != 0 {
+			if err := c.BindJSON(&body); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		var ret models.Return
+
+		err = withEvent(ctx, func(ctx context.Context) (events.Event, error) {
+			decided, err := database.DecideReturn(ctx, ReturnCollection, returnID, c.Query("approve") == "true", body.Note)
+
+			if err != nil {
+				return events.Event{}, err
+			}
+
+			ret = decided
+
+			return returnUpdated(decided)
+		})
+
+		if err != nil {
+			orderError(c, err)
+			return
+		}
+
+		c.IndentedJSON(200, ret)
+	}
+}
+
+// ReceiveReturn records that the goods of the return in "id" came back and
+// refunds them. ?restock=true puts them back in stock.
+func ReceiveReturn() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		returnID, err := primitive.ObjectIDFromHex(c.Query("id"))
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		var ret models.Return
+
+		err = database.WithEvents(ctx, OutboxCollection, func(ctx context.Context) ([]events.Event, error) {
+			received, refund, err := database.ReceiveReturn(
+				ctx,
+				UserCollection,
+				ProductCollection,
+				ReturnCollection,
+				RefundCollection,
+				returnID,
+				c.Query("restock") == "true",
+			)
+
+			if err != nil {
+				return nil, err
+			}
+
+			ret = received
+
+			updated, err := returnUpdated(received)
+
+			if err != nil || refund == nil {
+				return []events.Event{updated}, err
+			}
+
+			event, err := orderRefunded(*refund)
+
+			return []events.Event{updated, event}, err
+		})
+
+		if err != nil {
+			orderError(c, err)
+			return
+		}
+
+		c.IndentedJSON(200, ret)
+	}
+}
+
+// RefundOrder refunds lines of the order in "order_id", in full or by the
+// amount given per line, and optionally its shipping.
+func RefundOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orderID, err := primitive.ObjectIDFromHex(c.Query("order_id"))
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+			return
+		}
+
+		var request database.RefundRequest
+
+		if err := c.BindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		for _, line := range request.Lines {
+			if line.Amount != nil && line.Amount.Amount < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "a refund amount must not be negative"})
+				return
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		var refund models.Refund
+
+		err = withEvent(ctx, func(ctx context.Context) (events.Event, error) {
+			refunded, err := database.RefundOrder(ctx, UserCollection, RefundCollection, orderID, request)
+
+			if err != nil {
+				return events.Event{}, err
+			}
+
+			refund = refunded
+
+			return orderRefunded(refunded)
+		})
+
+		if err != nil {
+			orderError(c, err)
+			return
+		}
+
+		c.IndentedJSON(http.StatusCreated, refund)
+	}
+}
+
+func ListRefunds() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orderID, err := primitive.ObjectIDFromHex(c.Query("order_id"))
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		refunds, err := database.ListRefunds(ctx, RefundCollection, orderID)
+
+		if err != nil {
+			orderError(c, err)
+			return
+		}
+
+		c.IndentedJSON(200, refunds)
+	}
+}
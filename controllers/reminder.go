@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/database"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/logging"
+	generate "github.com/Ricardo-Cardozo/ecommerce_golang/tokens"
+	"github.com/gin-gonic/gin"
+)
+
+// RestoreCart is the one-click link of an abandoned cart reminder, with
+// the reminder's "token". Guests get a new cart token for the restored
+// cart; signed in users find it in their cart after logging in.
+func RestoreCart() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		reminder, err := database.RestoreCart(ctx, CartCollection, ReminderCollection, c.Query("token"))
+
+		if errors.Is(err, database.ErrCantFindReminder) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		response := gin.H{"message": "Succesfully restored the cart", "items": reminder.Items}
+
+		user, err := database.FindUser(ctx, UserCollection, reminder.User_ID)
+
+		if err != nil {
+			couponError(c, err)
+			return
+		}
+
+		if user.Guest {
+			token, expiresAt, err := generate.CartTokenGenerator(ctx, user.User_ID)
+
+			if err != nil {
+				logging.FromContext(ctx).Error("cannot sign the cart token", "error", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "could not sign the cart token"})
+				return
+			}
+
+			response["cart_token"] = token
+			response["expires_at"] = expiresAt
+		}
+
+		c.IndentedJSON(200, response)
+	}
+}
+
+// CartReminderStats sums up the abandoned cart reminders of the last
+// ?days=, 30 by default: how many were sent, restored and converted.
+func CartReminderStats() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+
+		if err != nil || days <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "days must be a positive number"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		stats, err := database.CartReminderStats(ctx, ReminderCollection, time.Now().AddDate(0, 0, -days))
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.IndentedJSON(200, stats)
+	}
+}
@@ -0,0 +1,201 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/database"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func reviewError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, database.ErrNotDelivered):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, database.ErrCantFindReview):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, database.ErrInvalidReviewState), errors.Is(err, database.ErrUserIdIsNotValid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// AddReview creates or replaces the signed in customer's review of the
+// product in "id". It is held for moderation before it counts.
+func AddReview() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, err := primitive.ObjectIDFromHex(c.Query("id"))
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+			return
+		}
+
+		var review models.Review
+
+		if err := c.BindJSON(&review); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := Validate.Struct(review); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "rating must be between 1 and 5"})
+			return
+		}
+
+		author := c.GetString("first_name")
+
+		review.Product_ID = productID
+		review.User_ID = c.GetString("uid")
+		review.Author = &author
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		saved, err := database.SaveReview(ctx, UserCollection, ReviewCollection, ProductCollection, review)
+
+		if err != nil {
+			reviewError(c, err)
+			return
+		}
+
+		c.IndentedJSON(http.StatusCreated, saved)
+	}
+}
+
+// DeleteMyReview lets a customer remove their own review.
+func DeleteMyReview() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		reviewID, err := primitive.ObjectIDFromHex(c.Query("id"))
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		if err := database.DeleteReview(ctx, ReviewCollection, ProductCollection, reviewID, c.GetString("uid")); err != nil {
+			reviewError(c, err)
+			return
+		}
+
+		c.IndentedJSON(200, "Succesfully deleted the review")
+	}
+}
+
+// ProductReviews lists the approved reviews of the product in "id".
+func ProductReviews() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, err := primitive.ObjectIDFromHex(c.Query("id"))
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+			return
+		}
+
+		limit, _ := strconv.ParseInt(c.Query("limit"), 10, 64)
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		reviews, err := database.ListReviews(ctx, ReviewCollection, &productID, models.ReviewApproved, limit)
+
+		if err != nil {
+			reviewError(c, err)
+			return
+		}
+
+		c.IndentedJSON(200, reviews)
+	}
+}
+
+// PendingReviews is the moderation queue, optionally narrowed to one
+// product with "id".
+func PendingReviews() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var productID *primitive.ObjectID
+
+		if v := c.Query("id"); v != "" {
+			id, err := primitive.ObjectIDFromHex(v)
+
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+				return
+			}
+
+			productID = &id
+		}
+
+		limit, _ := strconv.ParseInt(c.Query("limit"), 10, 64)
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		reviews, err := database.ListReviews(ctx, ReviewCollection, productID, models.ReviewPending, limit)
+
+		if err != nil {
+			reviewError(c, err)
+			return
+		}
+
+		c.IndentedJSON(200, reviews)
+	}
+}
+
+// ModerateReview sets the review in "id" to the "status" query parameter,
+// approved or rejected.
+func ModerateReview() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		reviewID, err := primitive.ObjectIDFromHex(c.Query("id"))
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		if err := database.ModerateReview(ctx, ReviewCollection, ProductCollection, reviewID, c.Query("status")); err != nil {
+			reviewError(c, err)
+			return
+		}
+
+		c.IndentedJSON(200, "Succesfully moderated the review")
+	}
+}
+
+func DeleteReview() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		reviewID, err := primitive.ObjectIDFromHex(c.Query("id"))
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		if err := database.DeleteReview(ctx, ReviewCollection, ProductCollection, reviewID, ""); err != nil {
+			reviewError(c, err)
+			return
+		}
+
+		c.IndentedJSON(200, "Succesfully deleted the review")
+	}
+}
@@ -0,0 +1,217 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/database"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/logging"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/search"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SearchProducts serves the full-text product search. It takes the same
+// paging and filter parameters as the product listing, plus the query in
+// "q" ("name" is still accepted for older clients). Misspelled terms are
+// corrected within "fuzziness" edits and reported in did_you_mean, and
+// synonyms are searched too. Facet counts over the whole result set are
+// returned with the first page, or with every page when facets=true.
+func SearchProducts() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		text := c.Query("q")
+
+		if text == "" {
+			text = c.Query("name")
+		}
+
+		query, err := parseProductQuery(c)
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		maxEdits := search.DefaultMaxEdits
+
+		if v := c.Query("fuzziness"); v != "" {
+			maxEdits, err = strconv.Atoi(v)
+
+			if err != nil || maxEdits < 0 || maxEdits > 2 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "fuzziness must be 0, 1 or 2"})
+				return
+			}
+		}
+
+		expansion := search.Expand(text, Speller, Synonyms, maxEdits)
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 100*time.Second)
+
+		defer cancel()
+
+		products, next, err := database.SearchProducts(ctx, ProductCollection, expansion.Terms, query)
+
+		if errors.Is(err, database.ErrEmptySearch) ||
+			errors.Is(err, database.ErrInvalidCursor) ||
+			errors.Is(err, database.ErrInvalidSort) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err != nil {
+			c.IndentedJSON(http.StatusInternalServerError, "something went wrong while fetching the data")
+			return
+		}
+
+		localizeProducts(products, query.Currency)
+
+		response := gin.H{
+			"products":    products,
+			"next_cursor": next,
+		}
+
+		if expansion.DidYouMean != "" {
+			response["did_you_mean"] = expansion.DidYouMean
+		}
+
+		if wantFacets := c.Query("facets"); wantFacets == "true" || (wantFacets == "" && query.Cursor == "") {
+			facets, err := database.ProductFacets(ctx, ProductCollection, expansion.Terms, query)
+
+			if err != nil {
+				c.IndentedJSON(http.StatusInternalServerError, "something went wrong while fetching the data")
+				return
+			}
+
+			response["facets"] = facets
+		}
+
+		c.IndentedJSON(200, response)
+	}
+}
+
+func Autocomplete() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var limit int64
+
+		if v := c.Query("limit"); v != "" {
+			parsed, err := strconv.ParseInt(v, 10, 64)
+
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a number"})
+				return
+			}
+
+			limit = parsed
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+
+		defer cancel()
+
+		suggestions, err := database.AutocompleteProducts(ctx, ProductCollection, c.Query("q"), limit)
+
+		if errors.Is(err, database.ErrEmptySearch) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err != nil {
+			c.IndentedJSON(http.StatusInternalServerError, "something went wrong while fetching the data")
+			return
+		}
+
+		c.IndentedJSON(200, gin.H{"suggestions": suggestions})
+	}
+}
+
+func ListSynonyms() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+
+		defer cancel()
+
+		groups, err := database.ListSynonyms(ctx, SynonymCollection)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.IndentedJSON(200, groups)
+	}
+}
+
+func AddSynonyms() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var group models.Synonym
+
+		if err := c.BindJSON(&group); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := Validate.Struct(group); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "a synonym group needs at least two terms"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+
+		defer cancel()
+
+		saved, err := database.AddSynonymGroup(ctx, SynonymCollection, group.Terms)
+
+		if errors.Is(err, database.ErrSynonymNotAWord) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := database.LoadSynonyms(ctx, SynonymCollection, Synonyms); err != nil {
+			logging.FromContext(ctx).Error("cannot reload the synonyms", "error", err)
+		}
+
+		c.IndentedJSON(http.StatusCreated, saved)
+	}
+}
+
+func DeleteSynonyms() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		groupID, err := primitive.ObjectIDFromHex(c.Query("id"))
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+
+		defer cancel()
+
+		err = database.DeleteSynonymGroup(ctx, SynonymCollection, groupID)
+
+		if errors.Is(err, database.ErrCantFindSynonym) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := database.LoadSynonyms(ctx, SynonymCollection, Synonyms); err != nil {
+			logging.FromContext(ctx).Error("cannot reload the synonyms", "error", err)
+		}
+
+		c.IndentedJSON(200, "Succesfully deleted the synonym group")
+	}
+}
@@ -0,0 +1,279 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/database"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/events"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/money"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/notification"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// shipmentRequest is the body of the fulfillment endpoints. Lines are
+// indexes into the order's order_list; none means every line not shipped
+// yet.
+type shipmentRequest struct {
+	Lines           []int   `json:"lines"`
+	Carrier         *string `json:"carrier"`
+	Tracking_Number *string `json:"tracking_number"`
+}
+
+// orderError maps the errors of order fulfillment, cancellation, returns
+// and refunds to a response.
+func orderError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, database.ErrCantFindOrder),
+		errors.Is(err, database.ErrCantFindShipment),
+		errors.Is(err, database.ErrCantFindReturn):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, database.ErrInvalidShipmentLine),
+		errors.Is(err, database.ErrNothingToShip),
+		errors.Is(err, database.ErrInvalidReturnLine),
+		errors.Is(err, database.ErrInvalidRefundLine),
+		errors.Is(err, database.ErrRefundTooLarge),
+		errors.Is(err, database.ErrNothingToRefund),
+		errors.Is(err, money.ErrCurrencyMismatch):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, database.ErrShipmentState),
+		errors.Is(err, database.ErrShipmentConflict),
+		errors.Is(err, database.ErrReturnState),
+		errors.Is(err, database.ErrOrderCancelled),
+		errors.Is(err, database.ErrCantCancelOrder),
+		errors.Is(err, database.ErrRefundConflict),
+		errors.Is(err, database.ErrOrderNotPaid):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// CreateShipment packs lines of the order in "order_id" into a new shipment.
+func CreateShipment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orderID, err := primitive.ObjectIDFromHex(c.Query("order_id"))
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+			return
+		}
+
+		var request shipmentRequest
+
+		// an empty body ships everything that is left
+		if c.Request.ContentLength != 0 {
+			if err := c.BindJSON(&request); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		shipment, err := database.CreateShipment(
+			ctx,
+			UserCollection,
+			ShipmentCollection,
+			orderID,
+			request.Lines,
+			request.Carrier,
+			request.Tracking_Number,
+		)
+
+		if err != nil {
+			orderError(c, err)
+			return
+		}
+
+		c.IndentedJSON(http.StatusCreated, shipment)
+	}
+}
+
+func ListShipments() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orderID, err := primitive.ObjectIDFromHex(c.Query("order_id"))
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		shipments, err := database.ListShipments(ctx, ShipmentCollection, orderID)
+
+		if err != nil {
+			orderError(c, err)
+			return
+		}
+
+		c.IndentedJSON(200, shipments)
+	}
+}
+
+// ShipShipment marks the shipment in "id" as handed to the carrier. The
+// body can set or correct the carrier and tracking number.
+func ShipShipment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		shipmentID, err := primitive.ObjectIDFromHex(c.Query("id"))
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+			return
+		}
+
+		var request shipmentRequest
+
+		if c.Request.ContentLength != 0 {
+			if err := c.BindJSON(&request); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		var shipment models.Shipment
+
+		err = withEvent(ctx, func(ctx context.Context) (events.Event, error) {
+			shipped, err := database.MarkShipmentShipped(
+				ctx,
+				UserCollection,
+				ShipmentCollection,
+				shipmentID,
+				request.Carrier,
+				request.Tracking_Number,
+			)
+
+			if err != nil {
+				return events.Event{}, err
+			}
+
+			shipment = shipped
+
+			return events.New(events.OrderShipped, shipped.Order_ID.Hex(), events.OrderShippedPayload{
+				User_ID:  shipped.User_ID,
+				Order_ID: shipped.Order_ID.Hex(),
+				Shipment: shipped,
+			})
+		})
+
+		if err != nil {
+			orderError(c, err)
+			return
+		}
+
+		data := map[string]string{"order_id": shipment.Order_ID.Hex()}
+
+		if shipment.Carrier != nil {
+			data["carrier"] = *shipment.Carrier
+		}
+
+		if shipment.Tracking_Number != nil {
+			data["tracking_number"] = *shipment.Tracking_Number
+		}
+
+		notify(ctx, notification.OrderShipped, shipment.User_ID, data)
+
+		c.IndentedJSON(200, shipment)
+	}
+}
+
+func DeliverShipment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		shipmentID, err := primitive.ObjectIDFromHex(c.Query("id"))
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		var shipment models.Shipment
+
+		err = database.WithEvents(ctx, OutboxCollection, func(ctx context.Context) ([]events.Event, error) {
+			delivered, err := database.MarkShipmentDelivered(ctx, UserCollection, ShipmentCollection, shipmentID)
+
+			if err != nil {
+				return nil, err
+			}
+
+			shipment = delivered
+
+			_, order, err := database.FindOrder(ctx, UserCollection, delivered.Order_ID)
+
+			if err != nil {
+				return nil, err
+			}
+
+			arrived, err := events.New(events.OrderDelivered, order.Order_ID.Hex(), events.OrderDeliveredPayload{
+				User_ID:  delivered.User_ID,
+				Order_ID: order.Order_ID.Hex(),
+				Status:   order.Status,
+				Shipment: delivered,
+			})
+
+			// cash on delivery is paid once the last parcel arrives
+			if err != nil || order.Status != models.OrderDelivered || !order.Payment_Method.COD {
+				return []events.Event{arrived}, err
+			}
+
+			event, err := events.New(events.PaymentCaptured, order.Order_ID.Hex(), events.PaymentCapturedPayload{
+				User_ID:    delivered.User_ID,
+				Order_ID:   order.Order_ID.Hex(),
+				Payment_ID: order.Payment_Method.Payment_ID.Hex(),
+				Method:     "cod",
+				Amount:     order.Price,
+			})
+
+			return []events.Event{arrived, event}, err
+		})
+
+		if err != nil {
+			orderError(c, err)
+			return
+		}
+
+		c.IndentedJSON(200, shipment)
+	}
+}
+
+// TrackOrder shows the signed in user where the items of their order in
+// "order_id" are.
+func TrackOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orderID, err := primitive.ObjectIDFromHex(c.Query("order_id"))
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		tracking, err := database.OrderTracking(ctx, UserCollection, ShipmentCollection, c.GetString("uid"), orderID)
+
+		if err != nil {
+			orderError(c, err)
+			return
+		}
+
+		c.IndentedJSON(200, tracking)
+	}
+}
@@ -0,0 +1,183 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/database"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// validateShippingMethod checks the amounts each method type depends on and
+// fills in their default currency.
+func validateShippingMethod(method *models.ShippingMethod) error {
+	if err := checkAmount("rate", &method.Rate); err != nil {
+		return err
+	}
+
+	if err := checkAmount("per_kg", &method.Per_Kg); err != nil {
+		return err
+	}
+
+	if err := checkAmount("free_above", &method.Free_Above); err != nil {
+		return err
+	}
+
+	switch method.Type {
+	case models.ShippingWeight:
+		if method.Per_Kg.Currency != method.Rate.Currency {
+			return errors.New("rate and per_kg must use the same currency")
+		}
+
+		if method.Per_Kg.IsZero() {
+			return errors.New("weight based shipping needs a per_kg price")
+		}
+	case models.ShippingFreeAbove:
+		if method.Free_Above.IsZero() {
+			return errors.New("free_above shipping needs a free_above threshold")
+		}
+	case models.ShippingPickup:
+		if method.Pickup_Location == nil || *method.Pickup_Location == "" {
+			return errors.New("local pickup needs a pickup_location")
+		}
+	}
+
+	return nil
+}
+
+func CreateShippingMethod() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var method models.ShippingMethod
+
+		if err := c.BindJSON(&method); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := Validate.Struct(method); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := validateShippingMethod(&method); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		saved, err := database.CreateShippingMethod(ctx, ShippingCollection, method)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.IndentedJSON(http.StatusCreated, saved)
+	}
+}
+
+func ListShippingMethods() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		methods, err := database.ListShippingMethods(ctx, ShippingCollection, false)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.IndentedJSON(200, methods)
+	}
+}
+
+// SetShippingMethodActive switches the method in "id" on or off with
+// active=true or active=false.
+func SetShippingMethodActive() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		methodID, err := primitive.ObjectIDFromHex(c.Query("id"))
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+			return
+		}
+
+		active := c.Query("active") == "true"
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		err = database.SetShippingMethodActive(ctx, ShippingCollection, methodID, active)
+
+		if errors.Is(err, database.ErrCantFindShippingMethod) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.IndentedJSON(200, "Succesfully updated the shipping method")
+	}
+}
+
+// ShippingQuotes lists what each available shipping method costs for the
+// signed in user's cart, delivered to ?address_id= or their first address.
+func ShippingQuotes() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		opts, err := pricingOptions(c)
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		user, err := database.FindUser(ctx, UserCollection, c.GetString("uid"))
+
+		if err != nil {
+			couponError(c, err)
+			return
+		}
+
+		cart, err := loadCart(ctx, user.User_ID, opts)
+
+		if err != nil {
+			couponError(c, err)
+			return
+		}
+
+		quotes, err := database.ShippingQuotes(
+			ctx,
+			CouponCollection,
+			RedemptionCollection,
+			PromotionCollection,
+			ShippingCollection,
+			user,
+			cart.Items,
+			opts,
+		)
+
+		if err != nil {
+			couponError(c, err)
+			return
+		}
+
+		c.IndentedJSON(200, gin.H{"quotes": quotes})
+	}
+}
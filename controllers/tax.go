@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/database"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/logging"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/pricing"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func ListTaxRules() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		rules, err := database.ListTaxRules(ctx, TaxRuleCollection)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.IndentedJSON(200, rules)
+	}
+}
+
+func CreateTaxRule() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var rule models.TaxRule
+
+		if err := c.BindJSON(&rule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := Validate.Struct(rule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if _, _, err := pricing.ParseTaxRate(rule.Rate); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		saved, err := database.CreateTaxRule(ctx, TaxRuleCollection, rule)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := database.LoadTaxRules(ctx, TaxRuleCollection, Taxes); err != nil {
+			logging.FromContext(ctx).Error("cannot reload the tax rules", "error", err)
+		}
+
+		c.IndentedJSON(http.StatusCreated, saved)
+	}
+}
+
+func DeleteTaxRule() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ruleID, err := primitive.ObjectIDFromHex(c.Query("id"))
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		err = database.DeleteTaxRule(ctx, TaxRuleCollection, ruleID)
+
+		if errors.Is(err, database.ErrCantFindTaxRule) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := database.LoadTaxRules(ctx, TaxRuleCollection, Taxes); err != nil {
+			logging.FromContext(ctx).Error("cannot reload the tax rules", "error", err)
+		}
+
+		c.IndentedJSON(200, "Succesfully deleted the tax rule")
+	}
+}
@@ -0,0 +1,203 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/database"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/webhook"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func webhookError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, database.ErrCantFindWebhook),
+		errors.Is(err, database.ErrCantFindDelivery):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func ListWebhooks() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		hooks, err := database.ListWebhooks(ctx, WebhookCollection)
+
+		if err != nil {
+			webhookError(c, err)
+			return
+		}
+
+		c.IndentedJSON(200, hooks)
+	}
+}
+
+// CreateWebhook registers an endpoint for the event types in "events", or
+// for all of them when it is empty. The URL must be https and not point
+// inside our network. The signing secret is only shown here.
+func CreateWebhook() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var hook models.Webhook
+
+		if err := c.BindJSON(&hook); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := Validate.Struct(hook); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := webhook.CheckURL(*hook.URL); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		saved, err := database.CreateWebhook(ctx, WebhookCollection, hook)
+
+		if err != nil {
+			webhookError(c, err)
+			return
+		}
+
+		c.IndentedJSON(http.StatusCreated, gin.H{"webhook": saved, "secret": saved.Secret})
+	}
+}
+
+// SetWebhookActive turns the webhook in "id" on with ?active=true and off
+// otherwise. Deliveries due to a webhook that is off go to the dead
+// letters.
+func SetWebhookActive() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		webhookID, err := primitive.ObjectIDFromHex(c.Query("id"))
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		if err := database.SetWebhookActive(ctx, WebhookCollection, webhookID, c.Query("active") == "true"); err != nil {
+			webhookError(c, err)
+			return
+		}
+
+		c.IndentedJSON(200, "Succesfully updated the webhook")
+	}
+}
+
+func DeleteWebhook() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		webhookID, err := primitive.ObjectIDFromHex(c.Query("id"))
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		if err := database.DeleteWebhook(ctx, WebhookCollection, webhookID); err != nil {
+			webhookError(c, err)
+			return
+		}
+
+		c.IndentedJSON(200, "Succesfully deleted the webhook")
+	}
+}
+
+// ListDeliveries shows the latest deliveries to the webhook in "id" with
+// their attempts, only those with ?status= if given.
+func ListDeliveries() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		webhookID, err := primitive.ObjectIDFromHex(c.Query("id"))
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+			return
+		}
+
+		filter := bson.M{"webhook_id": webhookID}
+
+		if status := c.Query("status"); status != "" {
+			filter["status"] = status
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		deliveries, err := database.ListDeliveries(ctx, DeliveryCollection, filter, 100)
+
+		if err != nil {
+			webhookError(c, err)
+			return
+		}
+
+		c.IndentedJSON(200, deliveries)
+	}
+}
+
+// DeadLetters lists the latest deliveries to any webhook that ran out of
+// attempts.
+func DeadLetters() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		deliveries, err := database.ListDeliveries(ctx, DeliveryCollection, bson.M{"status": models.DeliveryDead}, 100)
+
+		if err != nil {
+			webhookError(c, err)
+			return
+		}
+
+		c.IndentedJSON(200, deliveries)
+	}
+}
+
+// RedeliverWebhook sends the delivery in "id" again, e.g. a dead letter
+// after the endpoint was fixed.
+func RedeliverWebhook() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		deliveryID, err := primitive.ObjectIDFromHex(c.Query("id"))
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		delivery, err := database.Redeliver(ctx, DeliveryCollection, deliveryID)
+
+		if err != nil {
+			webhookError(c, err)
+			return
+		}
+
+		c.IndentedJSON(200, delivery)
+	}
+}
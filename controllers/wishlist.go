@@ -0,0 +1,288 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/database"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/events"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/logging"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func wishlistError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, database.ErrCantFindWishlist),
+		errors.Is(err, database.ErrNotOnWishlist),
+		errors.Is(err, database.ErrNotInCart),
+		errors.Is(err, database.ErrCantFindProduct):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, database.ErrUserIdIsNotValid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, database.ErrWishlistNameTaken),
+		errors.Is(err, database.ErrProductUnavailable):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// ListWishlists lists the signed in user's wishlists with the price drops
+// and restocks since they last looked.
+func ListWishlists() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		lists, err := database.ListWishlists(ctx, ProductCollection, WishlistCollection, c.GetString("uid"))
+
+		if err != nil {
+			wishlistError(c, err)
+			return
+		}
+
+		for _, list := range lists {
+			if err := database.AcknowledgeWishlistNotices(ctx, WishlistCollection, list); err != nil {
+				logging.FromContext(ctx).Error("cannot acknowledge the wishlist notices", "error", err)
+			}
+		}
+
+		c.IndentedJSON(200, lists)
+	}
+}
+
+func CreateWishlist() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var list models.Wishlist
+
+		if err := c.BindJSON(&list); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if list.Name != nil {
+			*list.Name = strings.TrimSpace(*list.Name)
+		}
+
+		if err := Validate.Struct(list); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		saved, err := database.CreateWishlist(ctx, WishlistCollection, c.GetString("uid"), *list.Name)
+
+		if err != nil {
+			wishlistError(c, err)
+			return
+		}
+
+		c.IndentedJSON(http.StatusCreated, saved)
+	}
+}
+
+func DeleteWishlist() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		wishlistID, err := primitive.ObjectIDFromHex(c.Query("id"))
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		if err := database.DeleteWishlist(ctx, WishlistCollection, c.GetString("uid"), wishlistID); err != nil {
+			wishlistError(c, err)
+			return
+		}
+
+		c.IndentedJSON(200, "Succesfully deleted the wishlist")
+	}
+}
+
+// AddToWishlist puts the product in "product_id" on the wishlist in "id".
+func AddToWishlist() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		wishlistID, err := primitive.ObjectIDFromHex(c.Query("id"))
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+			return
+		}
+
+		productID, err := primitive.ObjectIDFromHex(c.Query("product_id"))
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		err = database.AddToWishlist(ctx, ProductCollection, WishlistCollection, c.GetString("uid"), wishlistID, productID)
+
+		if err != nil {
+			wishlistError(c, err)
+			return
+		}
+
+		c.IndentedJSON(200, "Succesfully added to the wishlist")
+	}
+}
+
+func RemoveFromWishlist() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		wishlistID, err := primitive.ObjectIDFromHex(c.Query("id"))
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+			return
+		}
+
+		productID, err := primitive.ObjectIDFromHex(c.Query("product_id"))
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		err = database.RemoveFromWishlist(ctx, WishlistCollection, c.GetString("uid"), wishlistID, productID)
+
+		if err != nil {
+			wishlistError(c, err)
+			return
+		}
+
+		c.IndentedJSON(200, "Succesfully removed from the wishlist")
+	}
+}
+
+// ShareWishlist creates a share link for the wishlist in "id" with
+// ?share=true, replacing an earlier one, and takes it away otherwise.
+func ShareWishlist() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		wishlistID, err := primitive.ObjectIDFromHex(c.Query("id"))
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		list, err := database.ShareWishlist(ctx, WishlistCollection, c.GetString("uid"), wishlistID, c.Query("share") == "true")
+
+		if err != nil {
+			wishlistError(c, err)
+			return
+		}
+
+		c.IndentedJSON(200, gin.H{"share_token": list.Share_Token})
+	}
+}
+
+// SharedWishlist shows the wishlist shared with "token" to anyone who has
+// the link, without its owner or notices.
+func SharedWishlist() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		list, err := database.SharedWishlist(ctx, WishlistCollection, c.Query("token"))
+
+		if err != nil {
+			wishlistError(c, err)
+			return
+		}
+
+		c.IndentedJSON(200, gin.H{"name": list.Name, "items": list.Items})
+	}
+}
+
+// MoveToCart moves the product in "product_id" from the wishlist in "id" to
+// the signed in user's cart.
+func MoveToCart() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		wishlistID, err := primitive.ObjectIDFromHex(c.Query("id"))
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+			return
+		}
+
+		productID, err := primitive.ObjectIDFromHex(c.Query("product_id"))
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		userID := c.GetString("uid")
+
+		err = cartUpdated(ctx, userID, events.CartMovedFromList, productID.Hex(), func(ctx context.Context) error {
+			return database.MoveToCart(ctx, ProductCollection, CartCollection, WishlistCollection, userID, wishlistID, productID)
+		})
+
+		if err != nil {
+			wishlistError(c, err)
+			return
+		}
+
+		c.IndentedJSON(200, "Succesfully moved to the cart")
+	}
+}
+
+// SaveForLater moves the product in "product_id" from the signed in user's
+// cart to their models.SavedForLater wishlist.
+func SaveForLater() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, err := primitive.ObjectIDFromHex(c.Query("product_id"))
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+
+		defer cancel()
+
+		userID := c.GetString("uid")
+
+		err = cartUpdated(ctx, userID, events.CartSavedForLater, productID.Hex(), func(ctx context.Context) error {
+			return database.SaveForLater(ctx, ProductCollection, CartCollection, WishlistCollection, userID, productID)
+		})
+
+		if err != nil {
+			wishlistError(c, err)
+			return
+		}
+
+		c.IndentedJSON(200, "Succesfully saved for later")
+	}
+}
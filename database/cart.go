@@ -3,14 +3,17 @@ package database
 import (
 	"context"
 	"errors"
-	"fmt"
-	"log"
 	"time"
 
+	"github.com/Ricardo-Cardozo/ecommerce_golang/logging"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/metrics"
 	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/money"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/pricing"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 var (
@@ -21,236 +24,328 @@ var (
 	ErrCantRemoveItemCart = errors.New("cannot remove this add from the cart")
 	ErrCantGetItem        = errors.New("was unable to get the item from the cart")
 	ErrCantBuyCartItem    = errors.New("cannot update the purchase")
+	ErrCartIsEmpty        = errors.New("the cart is empty")
+	ErrCartChanged        = errors.New("the cart changed, check it again before buying")
+	ErrProductUnavailable = errors.New("this product is out of stock")
 )
 
+// AddProductToCart puts one of the product in the user's cart, creating the
+// cart on the first add.
 func AddProductToCart(
 	ctx context.Context,
 	prodCollection *mongo.Collection,
-	userCollection *mongo.Collection,
+	cartCollection *mongo.Collection,
 	productID primitive.ObjectID,
 	userID string,
 ) error {
-	fmt.Println("Product Collection:", prodCollection.Name())
-	fmt.Println("User Collection:", userCollection.Name())
+	if _, err := primitive.ObjectIDFromHex(userID); err != nil {
+		logging.FromContext(ctx).Warn("this user is not valid", "error", err)
+		return ErrUserIdIsNotValid
+	}
 
-	searchfromdb, err := prodCollection.Find(ctx, bson.M{"_id": productID})
+	product, err := findCatalogItem(ctx, prodCollection, productID)
 
 	if err != nil {
-		log.Println(err.Error(), searchfromdb)
-		return ErrCantFindProduct
+		return err
 	}
 
-	var productcart []models.ProductUser
-
-	err = searchfromdb.All(ctx, &productcart)
-
-	if err != nil {
-		log.Println(err)
-		return ErrCantDecodeProducts
+	if product.Stock != nil && *product.Stock <= 0 {
+		return ErrProductUnavailable
 	}
 
-	id, err := primitive.ObjectIDFromHex(userID)
+	now := time.Now()
 
-	if err != nil {
-		log.Println(err)
-		return ErrUserIdIsNotValid
+	update := bson.M{
+		"$push": bson.M{"items": product.ProductUser},
+		"$set":  bson.M{"updated_at": now},
+		"$setOnInsert": bson.M{
+			"_id":        primitive.NewObjectID(),
+			"notices":    make([]models.CartNotice, 0),
+			"created_at": now,
+		},
 	}
 
-	filter := bson.D{{Key: "_id", Value: id}}
-
-	update := bson.D{{Key: "$push", Value: bson.D{{Key: "usercart", Value: bson.D{{
-		Key: "$each", Value: productcart,
-	}}}}}}
-
-	_, err = userCollection.UpdateOne(ctx, filter, update)
+	result, err := cartCollection.UpdateOne(ctx, bson.M{"user_id": userID}, update, options.Update().SetUpsert(true))
 
 	if err != nil {
-		log.Println(err)
+		logging.FromContext(ctx).Error("cannot add this product to the cart", "error", err)
 		return ErrCantUpdateUser
 	}
 
-	return nil
+	if result.UpsertedCount > 0 {
+		metrics.CartsCreated.With().Inc()
+	}
 
+	return nil
 }
 
 func RemoveCartItem(
 	ctx context.Context,
 	prodCollection *mongo.Collection,
-	userCollection *mongo.Collection,
+	cartCollection *mongo.Collection,
 	productID primitive.ObjectID,
 	userID string,
 ) error {
-	id, err := primitive.ObjectIDFromHex(userID)
-
-	if err != nil {
-		log.Println(err)
+	if _, err := primitive.ObjectIDFromHex(userID); err != nil {
+		logging.FromContext(ctx).Warn("this user is not valid", "error", err)
 		return ErrUserIdIsNotValid
 	}
 
-	filter := bson.D{{Key: "_id", Value: id}}
-	update := bson.M{"$pull": bson.M{"usercart": bson.M{"_id": productID}}}
+	filter := bson.M{"user_id": userID}
+	update := bson.M{
+		"$pull": bson.M{"items": bson.M{"_id": productID}},
+		"$set":  bson.M{"updated_at": time.Now()},
+	}
 
-	_, err = userCollection.UpdateMany(ctx, filter, update)
+	_, err := cartCollection.UpdateOne(ctx, filter, update)
 
 	if err != nil {
+		logging.FromContext(ctx).Error("cannot remove the item from the cart", "error", err)
 		return ErrCantRemoveItemCart
 	}
 
 	return nil
 }
 
+// BuyItemFromCart turns the cart, as loaded by LoadCart, into an order
+// priced exactly like the cart view, reserves its stock, redeems its coupon,
+// empties the cart and returns the order id. When expectedTotal is set and
+// the cart no longer prices to it, e.g. because a promotion ended, nothing
+// is bought and ErrTotalsChanged is returned; when the cart changed since it
+// was loaded, ErrCartChanged.
 func BuyItemFromCart(
 	ctx context.Context,
 	userCollection *mongo.Collection,
-	userID string,
-) error {
-	id, err := primitive.ObjectIDFromHex(userID)
+	prodCollection *mongo.Collection,
+	cartCollection *mongo.Collection,
+	couponCollection *mongo.Collection,
+	redemptionCollection *mongo.Collection,
+	promotionCollection *mongo.Collection,
+	cart models.Cart,
+	opts PricingOptions,
+	expectedTotal *money.Money,
+) (primitive.ObjectID, error) {
+	getcartitems, err := FindUser(ctx, userCollection, cart.User_ID)
 
 	if err != nil {
-		log.Println(err)
-		return ErrUserIdIsNotValid
+		return primitive.NilObjectID, err
 	}
 
-	var getcartitems models.User
-	var ordercart models.Order
-
-	ordercart.Order_ID = primitive.NewObjectID()
-	ordercart.Ordered_At = time.Now()
-	ordercart.Order_Cart = make([]models.ProductUser, 0)
-	ordercart.Payment_Method.COD = true
+	if len(cart.Items) == 0 {
+		return primitive.NilObjectID, ErrCartIsEmpty
+	}
 
-	unwind := bson.D{{Key: "$unwind", Value: bson.D{{Key: "path", Value: "$usercart"}}}}
-	grouping := bson.D{
-		{
-			Key: "$group",
-			Value: bson.D{{
-				Key:   "_id",
-				Value: "$usercart",
-			},
-			},
-		},
-		{
-			Key: "total",
-			Value: bson.D{{
-				Key:   "$sum",
-				Value: "$usercart.price",
-			}},
-		},
+	if opts.Shipping == nil {
+		return primitive.NilObjectID, ErrShippingMethodRequired
 	}
 
-	currentresult, err := userCollection.Aggregate(ctx, mongo.Pipeline{unwind, grouping})
+	totals, err := CartTotals(ctx, couponCollection, redemptionCollection, promotionCollection, getcartitems, cart.Items, opts)
 
 	if err != nil {
-		log.Panic(err)
+		return primitive.NilObjectID, err
 	}
 
-	var getusercart []bson.M
-
-	if err = currentresult.All(ctx, &getusercart); err != nil {
-		log.Panic(err)
+	if expectedTotal != nil && *expectedTotal != totals.Total {
+		return primitive.NilObjectID, ErrTotalsChanged
 	}
 
-	var total_price int32
+	var ordercart models.Order
 
-	for _, user_item := range getusercart {
-		price := user_item["total"]
-		total_price = price.(int32)
+	ordercart.Order_ID = primitive.NewObjectID()
+	ordercart.Ordered_At = time.Now()
+	ordercart.Order_Cart = totals.Lines
+	ordercart.Currency = totals.Currency
+	ordercart.Exchange_Rates = totals.ExchangeRates
+	ordercart.Tax = totals.Tax
+	ordercart.Tax_Lines = totals.TaxLines
+	ordercart.Shipping = totals.Shipping
+	ordercart.Shipping_Address = totals.ShippingAddress
+	ordercart.Payment_Method.Payment_ID = primitive.NewObjectID()
+	ordercart.Payment_Method.COD = true
+	ordercart.Status = models.OrderPlaced
+	ordercart.Subtotal = totals.Subtotal
+	ordercart.Promotions = totals.Promotions
+	ordercart.Price = totals.Total
+	ordercart.Discount = totals.Discount
+	ordercart.Refunded = money.Zero(totals.Currency)
+
+	if err = ReserveStock(ctx, prodCollection, cart.Items); err != nil {
+		return primitive.NilObjectID, err
 	}
 
-	ordercart.Price = int(total_price)
+	// empty the cart only if nobody changed it since it was priced
+	claimed, err := cartCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": cart.Cart_ID, "updated_at": cart.Updated_At},
+		bson.M{"$set": bson.M{"items": make([]models.ProductUser, 0), "updated_at": time.Now()}},
+	)
 
-	filter := bson.D{{Key: "_id", Value: id}}
-	update := bson.D{{Key: "$push", Value: bson.D{{Key: "orders", Value: ordercart}}}}
+	if err != nil || claimed.MatchedCount == 0 {
+		if err != nil {
+			logging.FromContext(ctx).Error("cannot empty the cart", "error", err)
+		}
 
-	_, err = userCollection.UpdateMany(ctx, filter, update)
+		ReleaseStock(ctx, prodCollection, cart.Items)
 
-	if err != nil {
-		log.Println(err)
+		return primitive.NilObjectID, ErrCartChanged
 	}
 
-	err = userCollection.FindOne(ctx, bson.D{{Key: "_id", Value: id}}).Decode(&getcartitems)
+	restore := func() {
+		update := bson.M{"$push": bson.M{"items": bson.M{"$each": cart.Items}}}
 
-	if err != nil {
-		log.Println(err)
+		if _, err := cartCollection.UpdateByID(ctx, cart.Cart_ID, update); err != nil {
+			logging.FromContext(ctx).Error("cannot put the items back in the cart", "error", err)
+		}
+
+		ReleaseStock(ctx, prodCollection, cart.Items)
 	}
 
-	filter2 := bson.D{{Key: "_id", Value: id}}
-	update2 := bson.M{
-		"$push": bson.M{
-			"orders.$[].order_list": bson.M{
-				"$each": getcartitems.UserCart,
-			},
-		},
+	var redemption *models.CouponRedemption
+
+	if totals.Coupon != nil {
+		redeemed, err := RedeemCoupon(
+			ctx,
+			couponCollection,
+			redemptionCollection,
+			totals.Coupon.Code,
+			getcartitems.User_ID,
+			ordercart.Order_ID,
+			totals.Coupon.Discount,
+		)
+
+		if err != nil {
+			restore()
+			return primitive.NilObjectID, err
+		}
+
+		redemption = &redeemed
+		ordercart.Coupon_Code = &totals.Coupon.Code
+		ordercart.Coupon_Lines = totals.Coupon.Lines
+	}
+
+	filter := bson.D{{Key: "_id", Value: getcartitems.ID}}
+	update := bson.M{
+		"$push":  bson.M{"orders": ordercart},
+		"$unset": bson.M{"coupon_code": ""},
 	}
 
-	_, err = userCollection.UpdateOne(ctx, filter2, update2)
+	_, err = userCollection.UpdateOne(ctx, filter, update)
 
 	if err != nil {
-		log.Println(err)
-	}
+		logging.FromContext(ctx).Error("cannot save the order", "error", err)
 
-	usercart_empty := make([]models.ProductUser, 0)
-	filter3 := bson.D{{Key: "_id", Value: id}}
-	update3 := bson.D{{
-		Key: "$set", Value: bson.D{{
-			Key: "usercart", Value: usercart_empty,
-		}},
-	}}
+		if redemption != nil {
+			ReleaseCoupon(ctx, couponCollection, redemptionCollection, *redemption)
+		}
 
-	_, err = userCollection.UpdateOne(ctx, filter3, update3)
+		restore()
 
-	if err != nil {
-		return ErrCantBuyCartItem
+		return primitive.NilObjectID, ErrCantBuyCartItem
 	}
 
-	return nil
+	return ordercart.Order_ID, nil
 }
 
+// InstantBuyer places an order for a single product, priced, taxed and
+// shipped like a cart holding only that product, without promotions or
+// coupons, and returns the order id.
 func InstantBuyer(
 	ctx context.Context,
 	prodCollection *mongo.Collection,
 	userCollection *mongo.Collection,
 	productID primitive.ObjectID,
 	userID string,
-) error {
-	id, err := primitive.ObjectIDFromHex(userID)
+	opts PricingOptions,
+) (primitive.ObjectID, error) {
+	user, err := FindUser(ctx, userCollection, userID)
+
 	if err != nil {
-		log.Println(err)
-		return ErrUserIdIsNotValid
+		return primitive.NilObjectID, err
+	}
+
+	if opts.Shipping == nil {
+		return primitive.NilObjectID, ErrShippingMethodRequired
+	}
+
+	address, err := DeliveryAddress(user, opts.AddressID)
+
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	var location pricing.TaxLocation
+
+	if address != nil {
+		location = pricing.LocationOf(*address)
 	}
 
 	var product_details models.ProductUser
 	var orders_details models.Order
 
-	orders_details.Order_ID = primitive.NewObjectID()
-	orders_details.Ordered_At = time.Now()
-	orders_details.Order_Cart = make([]models.ProductUser, 0)
-	orders_details.Payment_Method.COD = true
-
 	err = prodCollection.FindOne(ctx, bson.D{{Key: "_id", Value: productID}}).Decode(&product_details)
 
 	if err != nil {
-		log.Println(err)
+		logging.FromContext(ctx).Error("can't find the product", "error", err)
+		return primitive.NilObjectID, ErrCantFindProduct
 	}
 
-	orders_details.Price = product_details.Price
+	lines, used, err := pricing.Localize([]models.ProductUser{product_details}, opts.Currency, opts.Rates)
 
-	filter := bson.D{{Key: "_id", Value: id}}
-	update := bson.D{{Key: "$push", Value: bson.D{{Key: "orders", Value: orders_details}}}}
-	_, err = userCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	totals, err := pricing.Price(opts.Currency, lines, nil, nil, 0, opts.Taxes, location, time.Now())
 
 	if err != nil {
-		log.Println(err)
+		logging.FromContext(ctx).Error("the cart total is out of range", "error", err)
+		return primitive.NilObjectID, ErrCantPriceCart
 	}
 
-	filter2 := bson.D{{Key: "_id", Value: id}}
-	update2 := bson.M{"$push": bson.M{"orders.$[].order_list": product_details}}
+	if opts.Shipping.Type != models.ShippingPickup {
+		orders_details.Shipping_Address = address
+	}
 
-	_, err = userCollection.UpdateOne(ctx, filter2, update2)
+	quote, err := pricing.QuoteShipping(*opts.Shipping, lines, totals.Subtotal, address, opts.Rates)
 
 	if err != nil {
-		log.Println(err)
+		return primitive.NilObjectID, err
 	}
 
-	return nil
+	if err = totals.AddShipping(quote); err != nil {
+		logging.FromContext(ctx).Error("the cart total is out of range", "error", err)
+		return primitive.NilObjectID, ErrCantPriceCart
+	}
+
+	orders_details.Order_ID = primitive.NewObjectID()
+	orders_details.Ordered_At = time.Now()
+	orders_details.Order_Cart = lines
+	orders_details.Payment_Method.Payment_ID = primitive.NewObjectID()
+	orders_details.Payment_Method.COD = true
+	orders_details.Status = models.OrderPlaced
+	orders_details.Currency = opts.Currency
+	orders_details.Exchange_Rates = used
+	orders_details.Subtotal = totals.Subtotal
+	orders_details.Discount = totals.Discount
+	orders_details.Tax = totals.Tax
+	orders_details.Tax_Lines = totals.TaxLines
+	orders_details.Shipping = totals.Shipping
+	orders_details.Price = totals.Total
+	orders_details.Refunded = money.Zero(opts.Currency)
+
+	if err = ReserveStock(ctx, prodCollection, lines); err != nil {
+		return primitive.NilObjectID, err
+	}
+
+	filter := bson.D{{Key: "_id", Value: user.ID}}
+	update := bson.D{{Key: "$push", Value: bson.D{{Key: "orders", Value: orders_details}}}}
+	_, err = userCollection.UpdateOne(ctx, filter, update)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot save the order", "error", err)
+		ReleaseStock(ctx, prodCollection, lines)
+		return primitive.NilObjectID, ErrCantBuyCartItem
+	}
+
+	return orders_details.Order_ID, nil
 }
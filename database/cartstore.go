@@ -0,0 +1,373 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/logging"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/money"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/pricing"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrCantMigrateCarts = errors.New("cannot move the carts out of the users")
+
+// catalogItem is a product as a cart line copies it, with its stock.
+type catalogItem struct {
+	models.ProductUser `bson:",inline"`
+	Stock              *int64 `bson:"stock"`
+}
+
+func EnsureCartIndexes(ctx context.Context, cartCollection *mongo.Collection) error {
+	_, err := cartCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "user_id", Value: 1}},
+		Options: options.Index().SetName("cart_user").SetUnique(true),
+	})
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot create the indexes", "error", err)
+		return ErrCantCreateIndex
+	}
+
+	return nil
+}
+
+// MigrateCarts moves the carts that used to live in the user documents to
+// the cart collection. It is safe to run on every start.
+func MigrateCarts(ctx context.Context, userCollection *mongo.Collection, cartCollection *mongo.Collection) error {
+	cursor, err := userCollection.Find(
+		ctx,
+		bson.M{"usercart.0": bson.M{"$exists": true}},
+		options.Find().SetProjection(bson.M{"user_id": 1, "usercart": 1}),
+	)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot move the carts out of the users", "error", err)
+		return ErrCantMigrateCarts
+	}
+
+	var users []struct {
+		ID       primitive.ObjectID   `bson:"_id"`
+		User_ID  string               `bson:"user_id"`
+		UserCart []models.ProductUser `bson:"usercart"`
+	}
+
+	if err = cursor.All(ctx, &users); err != nil {
+		logging.FromContext(ctx).Error("cannot move the carts out of the users", "error", err)
+		return ErrCantMigrateCarts
+	}
+
+	for _, user := range users {
+		now := time.Now()
+
+		update := bson.M{
+			"$push": bson.M{"items": bson.M{"$each": user.UserCart}},
+			"$set":  bson.M{"updated_at": now},
+			"$setOnInsert": bson.M{
+				"_id":        primitive.NewObjectID(),
+				"notices":    make([]models.CartNotice, 0),
+				"created_at": now,
+			},
+		}
+
+		_, err = cartCollection.UpdateOne(ctx, bson.M{"user_id": user.ID.Hex()}, update, options.Update().SetUpsert(true))
+
+		if err != nil {
+			logging.FromContext(ctx).Error("cannot move the carts out of the users", "error", err)
+			return ErrCantMigrateCarts
+		}
+
+		if _, err = userCollection.UpdateByID(ctx, user.ID, bson.M{"$unset": bson.M{"usercart": ""}}); err != nil {
+			logging.FromContext(ctx).Error("cannot move the carts out of the users", "error", err)
+			return ErrCantMigrateCarts
+		}
+	}
+
+	_, err = userCollection.UpdateMany(ctx, bson.M{"usercart": bson.M{"$exists": true}}, bson.M{"$unset": bson.M{"usercart": ""}})
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot move the carts out of the users", "error", err)
+		return ErrCantMigrateCarts
+	}
+
+	return nil
+}
+
+func findCart(ctx context.Context, cartCollection *mongo.Collection, userID string) (models.Cart, error) {
+	var cart models.Cart
+
+	err := cartCollection.FindOne(ctx, bson.M{"user_id": userID}).Decode(&cart)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// nothing was added yet
+		return models.Cart{
+			User_ID: userID,
+			Items:   make([]models.ProductUser, 0),
+			Notices: make([]models.CartNotice, 0),
+		}, nil
+	}
+
+	if err != nil {
+		logging.FromContext(ctx).Error("was unable to get the item from the cart", "error", err)
+		return cart, ErrCantGetItem
+	}
+
+	if cart.Items == nil {
+		cart.Items = make([]models.ProductUser, 0)
+	}
+
+	if cart.Notices == nil {
+		cart.Notices = make([]models.CartNotice, 0)
+	}
+
+	return cart, nil
+}
+
+func findCatalogItem(ctx context.Context, prodCollection *mongo.Collection, productID primitive.ObjectID) (catalogItem, error) {
+	var product catalogItem
+
+	err := prodCollection.FindOne(ctx, bson.M{"_id": productID}).Decode(&product)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return product, ErrCantFindProduct
+	}
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cant find the product", "error", err)
+		return product, ErrCantDecodeProducts
+	}
+
+	return product.normalized(), nil
+}
+
+// normalized leaves Prices nil when there are none, as a saved line reads
+// back, so checked lines compare equal to unchanged ones.
+func (item catalogItem) normalized() catalogItem {
+	if len(item.Prices) == 0 {
+		item.Prices = nil
+	}
+
+	return item
+}
+
+func catalogItems(ctx context.Context, prodCollection *mongo.Collection, items []models.ProductUser) (map[primitive.ObjectID]catalogItem, error) {
+	ids := make([]primitive.ObjectID, 0, len(items))
+
+	for _, item := range items {
+		ids = append(ids, item.Product_ID)
+	}
+
+	cursor, err := prodCollection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cant find the product", "error", err)
+		return nil, ErrCantDecodeProducts
+	}
+
+	var products []catalogItem
+
+	if err = cursor.All(ctx, &products); err != nil {
+		logging.FromContext(ctx).Error("cant find the product", "error", err)
+		return nil, ErrCantDecodeProducts
+	}
+
+	catalog := make(map[primitive.ObjectID]catalogItem, len(products))
+
+	for _, product := range products {
+		catalog[product.Product_ID] = product.normalized()
+	}
+
+	return catalog, nil
+}
+
+func productName(item models.ProductUser) string {
+	if item.Product_Name == nil {
+		return "an item"
+	}
+
+	return *item.Product_Name
+}
+
+// revalidateItems checks the cart lines against the catalog: each line takes
+// the product's current price and details, lines of products that are gone
+// or out of stock are dropped, and every change the customer should know
+// about gets one notice per product. Prices are compared in currency.
+func revalidateItems(
+	items []models.ProductUser,
+	catalog map[primitive.ObjectID]catalogItem,
+	currency string,
+	rates *money.Rates,
+	now time.Time,
+) ([]models.ProductUser, []models.CartNotice) {
+	fresh := make([]models.ProductUser, 0, len(items))
+	notices := make([]models.CartNotice, 0)
+	noticed := make(map[primitive.ObjectID]bool)
+	taken := make(map[primitive.ObjectID]int64)
+
+	notice := func(kind string, item models.ProductUser, message string) *models.CartNotice {
+		if noticed[item.Product_ID] {
+			return nil
+		}
+
+		noticed[item.Product_ID] = true
+		notices = append(notices, models.CartNotice{
+			Kind:         kind,
+			Product_ID:   item.Product_ID,
+			Product_Name: item.Product_Name,
+			Message:      message,
+			Noticed_At:   now,
+		})
+
+		return &notices[len(notices)-1]
+	}
+
+	for _, item := range items {
+		product, ok := catalog[item.Product_ID]
+
+		if !ok {
+			notice(models.CartItemUnavailable, item, fmt.Sprintf("%s is no longer sold and was removed from your cart", productName(item)))
+			continue
+		}
+
+		taken[item.Product_ID]++
+
+		if product.Stock != nil && taken[item.Product_ID] > *product.Stock {
+			if *product.Stock <= 0 {
+				notice(models.CartItemUnavailable, product.ProductUser, fmt.Sprintf("%s is out of stock and was removed from your cart", productName(product.ProductUser)))
+			} else {
+				notice(models.CartQuantityReduced, product.ProductUser, fmt.Sprintf("only %d of %s are left, your cart was updated", *product.Stock, productName(product.ProductUser)))
+			}
+
+			continue
+		}
+
+		oldPrice, _, oldErr := pricing.ListPrice(item.Price, item.Prices, currency, rates)
+		newPrice, _, newErr := pricing.ListPrice(product.Price, product.Prices, currency, rates)
+
+		// without a rate, fall back to comparing the base prices
+		if oldErr != nil || newErr != nil {
+			oldPrice, newPrice = item.Price, product.Price
+		}
+
+		if oldPrice.Currency == newPrice.Currency && oldPrice.Amount != newPrice.Amount {
+			kind, verb := models.CartPriceIncreased, "went up"
+
+			if newPrice.Amount < oldPrice.Amount {
+				kind, verb = models.CartPriceDecreased, "went down"
+			}
+
+			message := fmt.Sprintf("the price of %s %s from %s to %s", productName(product.ProductUser), verb, oldPrice, newPrice)
+
+			if n := notice(kind, product.ProductUser, message); n != nil {
+				n.Old_Price, n.New_Price = &oldPrice, &newPrice
+			}
+		}
+
+		fresh = append(fresh, product.ProductUser)
+	}
+
+	return fresh, notices
+}
+
+// LoadCart reads the user's cart checked against the catalog, see
+// revalidateItems, and saves what changed. Notices the customer hasn't
+// acknowledged yet, see AcknowledgeCartNotices, are kept in cart.Notices.
+func LoadCart(
+	ctx context.Context,
+	prodCollection *mongo.Collection,
+	cartCollection *mongo.Collection,
+	userID string,
+	currency string,
+	rates *money.Rates,
+) (models.Cart, error) {
+	if _, err := primitive.ObjectIDFromHex(userID); err != nil {
+		logging.FromContext(ctx).Warn("this user is not valid", "error", err)
+		return models.Cart{}, ErrUserIdIsNotValid
+	}
+
+	// a cart changed by another request in between is read again
+	for attempt := 0; attempt < 3; attempt++ {
+		cart, err := findCart(ctx, cartCollection, userID)
+
+		if err != nil || len(cart.Items) == 0 {
+			return cart, err
+		}
+
+		catalog, err := catalogItems(ctx, prodCollection, cart.Items)
+
+		if err != nil {
+			return cart, err
+		}
+
+		now := time.Now()
+		items, notices := revalidateItems(cart.Items, catalog, currency, rates, now)
+
+		if len(notices) == 0 && reflect.DeepEqual(items, cart.Items) {
+			return cart, nil
+		}
+
+		update := bson.M{
+			"$set":  bson.M{"items": items, "updated_at": now},
+			"$push": bson.M{"notices": bson.M{"$each": notices}},
+		}
+
+		result, err := cartCollection.UpdateOne(ctx, bson.M{"_id": cart.Cart_ID, "updated_at": cart.Updated_At}, update)
+
+		if err != nil {
+			logging.FromContext(ctx).Error("was unable to get the item from the cart", "error", err)
+			return cart, ErrCantGetItem
+		}
+
+		if result.MatchedCount == 0 {
+			continue
+		}
+
+		cart.Items = items
+		cart.Notices = append(cart.Notices, notices...)
+		cart.Updated_At = now
+
+		return cart, nil
+	}
+
+	return models.Cart{}, ErrCartChanged
+}
+
+// AcknowledgeCartNotices drops the notices of cart once the customer has
+// been shown them; newer ones stay.
+func AcknowledgeCartNotices(ctx context.Context, cartCollection *mongo.Collection, cart models.Cart) error {
+	if len(cart.Notices) == 0 {
+		return nil
+	}
+
+	if err := acknowledgeNotices(ctx, cartCollection, cart.Cart_ID, cart.Notices); err != nil {
+		logging.FromContext(ctx).Error("cannot add this product to the cart", "error", err)
+		return ErrCantUpdateUser
+	}
+
+	return nil
+}
+
+// acknowledgeNotices drops the notices of the document in id up to the
+// latest of notices; newer ones stay.
+func acknowledgeNotices(ctx context.Context, collection *mongo.Collection, id primitive.ObjectID, notices []models.CartNotice) error {
+	latest := notices[0].Noticed_At
+
+	for _, notice := range notices[1:] {
+		if notice.Noticed_At.After(latest) {
+			latest = notice.Noticed_At
+		}
+	}
+
+	update := bson.M{"$pull": bson.M{"notices": bson.M{"noticed_at": bson.M{"$lte": latest}}}}
+
+	_, err := collection.UpdateByID(ctx, id, update)
+
+	return err
+}
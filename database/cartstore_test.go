@@ -0,0 +1,111 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRevalidateItems(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	ids := []primitive.ObjectID{primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()}
+
+	item := func(i int, price int64) models.ProductUser {
+		name := []string{"mug", "hat", "scarf"}[i]
+		return models.ProductUser{Product_ID: ids[i], Product_Name: &name, Price: money.New(price, "USD")}
+	}
+
+	stocked := func(i int, price int64, stock int64) catalogItem {
+		return catalogItem{ProductUser: item(i, price), Stock: &stock}
+	}
+
+	unlimited := func(i int, price int64) catalogItem {
+		return catalogItem{ProductUser: item(i, price)}
+	}
+
+	tests := []struct {
+		name    string
+		items   []models.ProductUser
+		catalog []catalogItem
+		kept    int
+		notices []string
+	}{
+		{
+			name:    "unchanged",
+			items:   []models.ProductUser{item(0, 1000), item(1, 500)},
+			catalog: []catalogItem{unlimited(0, 1000), stocked(1, 500, 3)},
+			kept:    2,
+		},
+		{
+			name:    "price went up once per product",
+			items:   []models.ProductUser{item(0, 1000), item(0, 1000)},
+			catalog: []catalogItem{unlimited(0, 1200)},
+			kept:    2,
+			notices: []string{models.CartPriceIncreased},
+		},
+		{
+			name:    "price went down",
+			items:   []models.ProductUser{item(0, 1000)},
+			catalog: []catalogItem{unlimited(0, 800)},
+			kept:    1,
+			notices: []string{models.CartPriceDecreased},
+		},
+		{
+			name:    "no longer sold",
+			items:   []models.ProductUser{item(0, 1000), item(1, 500)},
+			catalog: []catalogItem{unlimited(1, 500)},
+			kept:    1,
+			notices: []string{models.CartItemUnavailable},
+		},
+		{
+			name:    "out of stock",
+			items:   []models.ProductUser{item(2, 300)},
+			catalog: []catalogItem{stocked(2, 300, 0)},
+			kept:    0,
+			notices: []string{models.CartItemUnavailable},
+		},
+		{
+			name:    "fewer left than in the cart",
+			items:   []models.ProductUser{item(2, 300), item(2, 300), item(2, 300)},
+			catalog: []catalogItem{stocked(2, 300, 2)},
+			kept:    2,
+			notices: []string{models.CartQuantityReduced},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			catalog := make(map[primitive.ObjectID]catalogItem)
+
+			for _, product := range tt.catalog {
+				catalog[product.Product_ID] = product
+			}
+
+			items, notices := revalidateItems(tt.items, catalog, "USD", nil, now)
+
+			if len(items) != tt.kept {
+				t.Errorf("kept %d items, want %d", len(items), tt.kept)
+			}
+
+			for _, fresh := range items {
+				if fresh.Price != catalog[fresh.Product_ID].Price {
+					t.Errorf("item price %v, want the catalog's %v", fresh.Price, catalog[fresh.Product_ID].Price)
+				}
+			}
+
+			if len(notices) != len(tt.notices) {
+				t.Fatalf("notices = %+v, want kinds %v", notices, tt.notices)
+			}
+
+			for i, kind := range tt.notices {
+				if notices[i].Kind != kind || !notices[i].Noticed_At.Equal(now) {
+					t.Errorf("notice %d = %+v, want %s", i, notices[i], kind)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,546 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/logging"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/money"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/pricing"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrCantFindCoupon   = errors.New("can't find the coupon")
+	ErrCouponCodeTaken  = errors.New("a coupon with this code already exists")
+	ErrCantSaveCoupon   = errors.New("cannot save the coupon")
+	ErrCantRedeemCoupon = errors.New("cannot redeem the coupon")
+	ErrCantFindUser     = errors.New("can't find the user")
+	ErrCantPriceCart    = errors.New("the cart total is out of range")
+	ErrCantFindAddress  = errors.New("can't find the address")
+)
+
+// NormalizeCouponCode makes codes case insensitive.
+func NormalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func EnsureCouponIndexes(
+	ctx context.Context,
+	couponCollection *mongo.Collection,
+	redemptionCollection *mongo.Collection,
+) error {
+	_, err := couponCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "code", Value: 1}},
+		Options: options.Index().SetName("coupon_code").SetUnique(true),
+	})
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot create the indexes", "error", err)
+		return ErrCantCreateIndex
+	}
+
+	_, err = redemptionCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "coupon_id", Value: 1}, {Key: "user_id", Value: 1}},
+		Options: options.Index().SetName("redemption_coupon_user"),
+	})
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot create the indexes", "error", err)
+		return ErrCantCreateIndex
+	}
+
+	_, err = redemptionCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "coupon_id", Value: 1}, {Key: "user_id", Value: 1}, {Key: "slot", Value: 1}},
+		Options: options.Index().
+			SetName("redemption_coupon_user_slot").
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"slot": bson.M{"$exists": true}}),
+	})
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot create the indexes", "error", err)
+		return ErrCantCreateIndex
+	}
+
+	return nil
+}
+
+func CreateCoupon(ctx context.Context, couponCollection *mongo.Collection, coupon models.Coupon) (models.Coupon, error) {
+	coupon.Coupon_ID = primitive.NewObjectID()
+	coupon.Code = NormalizeCouponCode(coupon.Code)
+	coupon.Uses = 0
+	coupon.Created_At = time.Now()
+
+	if _, err := couponCollection.InsertOne(ctx, coupon); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return coupon, ErrCouponCodeTaken
+		}
+
+		logging.FromContext(ctx).Error("cannot save the coupon", "error", err)
+		return coupon, ErrCantSaveCoupon
+	}
+
+	return coupon, nil
+}
+
+func ListCoupons(ctx context.Context, couponCollection *mongo.Collection) ([]models.Coupon, error) {
+	cursor, err := couponCollection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}))
+
+	if err != nil {
+		logging.FromContext(ctx).Error("can't find the coupon", "error", err)
+		return nil, ErrCantFindCoupon
+	}
+
+	defer cursor.Close(ctx)
+
+	coupons := make([]models.Coupon, 0)
+
+	if err = cursor.All(ctx, &coupons); err != nil {
+		logging.FromContext(ctx).Error("can't find the coupon", "error", err)
+		return nil, ErrCantFindCoupon
+	}
+
+	return coupons, nil
+}
+
+// SetCouponActive switches a coupon on or off. Coupons are never deleted so
+// past orders keep pointing at a real code.
+func SetCouponActive(ctx context.Context, couponCollection *mongo.Collection, couponID primitive.ObjectID, active bool) error {
+	res, err := couponCollection.UpdateByID(ctx, couponID, bson.M{"$set": bson.M{"active": active}})
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot save the coupon", "error", err)
+		return ErrCantSaveCoupon
+	}
+
+	if res.MatchedCount == 0 {
+		return ErrCantFindCoupon
+	}
+
+	return nil
+}
+
+func FindCouponByCode(ctx context.Context, couponCollection *mongo.Collection, code string) (models.Coupon, error) {
+	var coupon models.Coupon
+
+	err := couponCollection.FindOne(ctx, bson.M{"code": NormalizeCouponCode(code)}).Decode(&coupon)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return coupon, ErrCantFindCoupon
+	}
+
+	if err != nil {
+		logging.FromContext(ctx).Error("can't find the coupon", "error", err)
+		return coupon, ErrCantFindCoupon
+	}
+
+	return coupon, nil
+}
+
+// CountRedemptions returns how many orders of the user used the coupon.
+func CountRedemptions(
+	ctx context.Context,
+	redemptionCollection *mongo.Collection,
+	couponID primitive.ObjectID,
+	userID string,
+) (int, error) {
+	count, err := redemptionCollection.CountDocuments(ctx, bson.M{"coupon_id": couponID, "user_id": userID})
+
+	if err != nil {
+		logging.FromContext(ctx).Error("can't find the coupon", "error", err)
+		return 0, ErrCantFindCoupon
+	}
+
+	return int(count), nil
+}
+
+// FindUser loads a user by the hex id carried in tokens and query strings.
+func FindUser(ctx context.Context, userCollection *mongo.Collection, userID string) (models.User, error) {
+	var user models.User
+
+	id, err := primitive.ObjectIDFromHex(userID)
+
+	if err != nil {
+		logging.FromContext(ctx).Warn("this user is not valid", "error", err)
+		return user, ErrUserIdIsNotValid
+	}
+
+	err = userCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&user)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return user, ErrCantFindUser
+	}
+
+	if err != nil {
+		logging.FromContext(ctx).Error("can't find the user", "error", err)
+		return user, ErrCantFindUser
+	}
+
+	return user, nil
+}
+
+// cartCoupon loads the coupon applied to the user's cart, if any, and how
+// often the user already redeemed it.
+func cartCoupon(
+	ctx context.Context,
+	couponCollection *mongo.Collection,
+	redemptionCollection *mongo.Collection,
+	user models.User,
+) (*models.Coupon, int, error) {
+	if user.Coupon_Code == nil || *user.Coupon_Code == "" {
+		return nil, 0, nil
+	}
+
+	coupon, err := FindCouponByCode(ctx, couponCollection, *user.Coupon_Code)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	uses, err := CountRedemptions(ctx, redemptionCollection, coupon.Coupon_ID, user.User_ID)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return &coupon, uses, nil
+}
+
+// PricingOptions are the customer's choices a cart is priced with.
+type PricingOptions struct {
+	// Currency is charged; lines without a price in it are converted with
+	// Rates.
+	Currency string
+	Rates    *money.Rates
+	// Taxes may be nil to price without tax.
+	Taxes pricing.TaxCalculator
+	// AddressID picks the delivery address from the user's address book;
+	// empty picks the first one.
+	AddressID string
+	// Shipping is the chosen method, nil when none was chosen yet.
+	Shipping *models.ShippingMethod
+}
+
+// DeliveryAddress finds the address addressID names in the user's address
+// book, or the first address when it is empty. It returns nil when the user
+// has no address and none was asked for.
+func DeliveryAddress(user models.User, addressID string) (*models.Address, error) {
+	if addressID == "" {
+		if len(user.Address_Details) == 0 {
+			return nil, nil
+		}
+
+		return &user.Address_Details[0], nil
+	}
+
+	id, err := primitive.ObjectIDFromHex(addressID)
+
+	if err != nil {
+		return nil, ErrCantFindAddress
+	}
+
+	for i := range user.Address_Details {
+		if user.Address_Details[i].Address_ID == id {
+			return &user.Address_Details[i], nil
+		}
+	}
+
+	return nil, ErrCantFindAddress
+}
+
+// CartTotals prices the user's cart items, see LoadCart, with the running
+// promotions, the coupon applied to the cart, the tax of its delivery
+// address and the chosen shipping.
+func CartTotals(
+	ctx context.Context,
+	couponCollection *mongo.Collection,
+	redemptionCollection *mongo.Collection,
+	promotionCollection *mongo.Collection,
+	user models.User,
+	items []models.ProductUser,
+	opts PricingOptions,
+) (pricing.Totals, error) {
+	now := time.Now()
+
+	address, err := DeliveryAddress(user, opts.AddressID)
+
+	if err != nil {
+		return pricing.Totals{}, err
+	}
+
+	var location pricing.TaxLocation
+
+	if address != nil {
+		location = pricing.LocationOf(*address)
+	}
+
+	cart, used, err := pricing.Localize(items, opts.Currency, opts.Rates)
+
+	if err != nil {
+		return pricing.Totals{}, err
+	}
+
+	promotions, err := ActivePromotions(ctx, promotionCollection, now)
+
+	if err != nil {
+		return pricing.Totals{}, err
+	}
+
+	coupon, uses, err := cartCoupon(ctx, couponCollection, redemptionCollection, user)
+
+	if err != nil && !errors.Is(err, ErrCantFindCoupon) {
+		return pricing.Totals{}, err
+	}
+
+	totals, err := pricing.Price(opts.Currency, cart, promotions, coupon, uses, opts.Taxes, location, now)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot price the cart", "error", err)
+		return totals, ErrCantPriceCart
+	}
+
+	totals.ExchangeRates = used
+	totals.ShippingAddress = address
+
+	if opts.Shipping == nil {
+		return totals, nil
+	}
+
+	if opts.Shipping.Type == models.ShippingPickup {
+		totals.ShippingAddress = nil
+	}
+
+	spent, err := totals.Subtotal.Sub(totals.Discount)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot price the cart", "error", err)
+		return totals, ErrCantPriceCart
+	}
+
+	quote, err := pricing.QuoteShipping(*opts.Shipping, cart, spent, address, opts.Rates)
+
+	if err != nil {
+		return totals, err
+	}
+
+	if err = totals.AddShipping(quote); err != nil {
+		logging.FromContext(ctx).Error("cannot price the cart", "error", err)
+		return totals, ErrCantPriceCart
+	}
+
+	return totals, nil
+}
+
+// ApplyCouponToCart validates the code against the current cart and stores
+// it on the user; it is checked again whenever the cart is priced.
+func ApplyCouponToCart(
+	ctx context.Context,
+	userCollection *mongo.Collection,
+	couponCollection *mongo.Collection,
+	redemptionCollection *mongo.Collection,
+	promotionCollection *mongo.Collection,
+	userID string,
+	items []models.ProductUser,
+	code string,
+	opts PricingOptions,
+) (pricing.Totals, error) {
+	user, err := FindUser(ctx, userCollection, userID)
+
+	if err != nil {
+		return pricing.Totals{}, err
+	}
+
+	coupon, err := FindCouponByCode(ctx, couponCollection, code)
+
+	if err != nil {
+		return pricing.Totals{}, err
+	}
+
+	user.Coupon_Code = &coupon.Code
+
+	totals, err := CartTotals(ctx, couponCollection, redemptionCollection, promotionCollection, user, items, opts)
+
+	if err != nil {
+		return totals, err
+	}
+
+	if totals.CouponErr != nil {
+		return totals, totals.CouponErr
+	}
+
+	update := bson.M{"$set": bson.M{"coupon_code": coupon.Code}}
+
+	if _, err = userCollection.UpdateByID(ctx, user.ID, update); err != nil {
+		logging.FromContext(ctx).Error("cannot add this product to the cart", "error", err)
+		return pricing.Totals{}, ErrCantUpdateUser
+	}
+
+	return totals, nil
+}
+
+func RemoveCouponFromCart(ctx context.Context, userCollection *mongo.Collection, userID string) error {
+	id, err := primitive.ObjectIDFromHex(userID)
+
+	if err != nil {
+		logging.FromContext(ctx).Warn("this user is not valid", "error", err)
+		return ErrUserIdIsNotValid
+	}
+
+	if _, err = userCollection.UpdateByID(ctx, id, bson.M{"$unset": bson.M{"coupon_code": ""}}); err != nil {
+		logging.FromContext(ctx).Error("cannot add this product to the cart", "error", err)
+		return ErrCantUpdateUser
+	}
+
+	return nil
+}
+
+// RedeemCoupon counts one use of the coupon against its global limit, which
+// is checked in the same update as the coupon being active and within its
+// validity, so concurrent checkouts can't overshoot it. The redemption it
+// records takes one of the user's slots when the coupon has a per-user
+// limit, and there are only that many, so concurrent checkouts of one user
+// can't overshoot that either.
+func RedeemCoupon(
+	ctx context.Context,
+	couponCollection *mongo.Collection,
+	redemptionCollection *mongo.Collection,
+	couponCode string,
+	userID string,
+	orderID primitive.ObjectID,
+	discount money.Money,
+) (models.CouponRedemption, error) {
+	var redemption models.CouponRedemption
+	var coupon models.Coupon
+
+	code := NormalizeCouponCode(couponCode)
+	now := time.Now()
+
+	filter := bson.M{
+		"code":   code,
+		"active": true,
+		"$and": bson.A{
+			bson.M{"$or": bson.A{
+				bson.M{"max_uses": bson.M{"$lte": 0}},
+				bson.M{"$expr": bson.M{"$lt": bson.A{"$uses", "$max_uses"}}},
+			}},
+			bson.M{"$or": bson.A{bson.M{"starts_at": nil}, bson.M{"starts_at": bson.M{"$lte": now}}}},
+			bson.M{"$or": bson.A{bson.M{"ends_at": nil}, bson.M{"ends_at": bson.M{"$gt": now}}}},
+		},
+	}
+
+	err := couponCollection.FindOneAndUpdate(ctx, filter, bson.M{"$inc": bson.M{"uses": 1}}).Decode(&coupon)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return redemption, unredeemable(ctx, couponCollection, code, now)
+	}
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot redeem the coupon", "error", err)
+		return redemption, ErrCantRedeemCoupon
+	}
+
+	redemption = models.CouponRedemption{
+		Redemption_ID: primitive.NewObjectID(),
+		Coupon_ID:     coupon.Coupon_ID,
+		User_ID:       userID,
+		Order_ID:      orderID,
+		Discount:      discount,
+		Redeemed_At:   time.Now(),
+	}
+
+	if coupon.Max_Uses_Per_User <= 0 {
+		_, err = redemptionCollection.InsertOne(ctx, redemption)
+	} else {
+		err = takeSlot(ctx, redemptionCollection, &redemption, coupon.Max_Uses_Per_User)
+	}
+
+	if err != nil {
+		ReleaseCoupon(ctx, couponCollection, redemptionCollection, redemption)
+
+		if errors.Is(err, pricing.ErrCouponUserLimit) {
+			return redemption, err
+		}
+
+		logging.FromContext(ctx).Error("cannot redeem the coupon", "error", err)
+
+		return redemption, ErrCantRedeemCoupon
+	}
+
+	return redemption, nil
+}
+
+// takeSlot records the redemption in the first of the user's limit slots
+// that is free, or fails with pricing.ErrCouponUserLimit when none is.
+func takeSlot(
+	ctx context.Context,
+	redemptionCollection *mongo.Collection,
+	redemption *models.CouponRedemption,
+	limit int,
+) error {
+	// redemptions from before slots count against the limit too
+	used, err := CountRedemptions(ctx, redemptionCollection, redemption.Coupon_ID, redemption.User_ID)
+
+	if err != nil {
+		return err
+	}
+
+	for slot := 0; used < limit && slot < limit; slot++ {
+		slot := slot
+		redemption.Slot = &slot
+
+		_, err = redemptionCollection.InsertOne(ctx, redemption)
+
+		if err == nil {
+			return nil
+		}
+
+		if !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+	}
+
+	redemption.Slot = nil
+
+	return pricing.ErrCouponUserLimit
+}
+
+// unredeemable tells why the coupon in code couldn't be redeemed at now.
+func unredeemable(ctx context.Context, couponCollection *mongo.Collection, code string, now time.Time) error {
+	coupon, err := FindCouponByCode(ctx, couponCollection, code)
+
+	switch {
+	case err != nil:
+		return err
+	case !coupon.Active:
+		return pricing.ErrCouponInactive
+	case coupon.Starts_At != nil && now.Before(*coupon.Starts_At):
+		return pricing.ErrCouponNotStarted
+	case coupon.Ends_At != nil && !now.Before(*coupon.Ends_At):
+		return pricing.ErrCouponExpired
+	default:
+		return pricing.ErrCouponExhausted
+	}
+}
+
+// ReleaseCoupon undoes RedeemCoupon when the order it was for is not placed.
+func ReleaseCoupon(
+	ctx context.Context,
+	couponCollection *mongo.Collection,
+	redemptionCollection *mongo.Collection,
+	redemption models.CouponRedemption,
+) {
+	if _, err := couponCollection.UpdateByID(ctx, redemption.Coupon_ID, bson.M{"$inc": bson.M{"uses": -1}}); err != nil {
+		logging.FromContext(ctx).Error("cannot give the coupon use back", "error", err)
+	}
+
+	if _, err := redemptionCollection.DeleteOne(ctx, bson.M{"_id": redemption.Redemption_ID}); err != nil {
+		logging.FromContext(ctx).Error("cannot delete the coupon redemption", "error", err)
+	}
+}
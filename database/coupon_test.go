@@ -0,0 +1,174 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/money"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/pricing"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCreateCouponNormalizesCodes(t *testing.T) {
+	ctx := context.Background()
+	db := testDatabase(t)
+	coupons := db.Collection("Coupons")
+
+	if err := EnsureCouponIndexes(ctx, coupons, db.Collection("CouponRedemptions")); err != nil {
+		t.Fatal(err)
+	}
+
+	created, err := CreateCoupon(ctx, coupons, models.Coupon{Code: " summer10 ", Type: models.CouponPercentage, Percent: 10})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if created.Code != "SUMMER10" {
+		t.Errorf("code = %q, want SUMMER10", created.Code)
+	}
+
+	if _, err = CreateCoupon(ctx, coupons, models.Coupon{Code: "Summer10", Type: models.CouponFixedAmount, Amount: money.New(500, "USD")}); !errors.Is(err, ErrCouponCodeTaken) {
+		t.Errorf("same code again: got %v, want %v", err, ErrCouponCodeTaken)
+	}
+
+	found, err := FindCouponByCode(ctx, coupons, "summer10")
+
+	if err != nil || found.Coupon_ID != created.Coupon_ID {
+		t.Errorf("FindCouponByCode() = %v, %v", found.Coupon_ID, err)
+	}
+
+	if _, err = FindCouponByCode(ctx, coupons, "winter"); !errors.Is(err, ErrCantFindCoupon) {
+		t.Errorf("unknown code: got %v, want %v", err, ErrCantFindCoupon)
+	}
+}
+
+func TestRedeemCoupon(t *testing.T) {
+	ctx := context.Background()
+	db := testDatabase(t)
+	coupons := db.Collection("Coupons")
+	redemptions := db.Collection("CouponRedemptions")
+
+	uses := func(code string) int {
+		t.Helper()
+
+		coupon, err := FindCouponByCode(ctx, coupons, code)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return coupon.Uses
+	}
+
+	if err := EnsureCouponIndexes(ctx, coupons, redemptions); err != nil {
+		t.Fatal(err)
+	}
+
+	hour := time.Hour
+	later, earlier := time.Now().Add(hour), time.Now().Add(-hour)
+
+	for _, coupon := range []models.Coupon{
+		{Code: "TWICE", Type: models.CouponPercentage, Percent: 10, Max_Uses: 2, Active: true},
+		{Code: "ALWAYS", Type: models.CouponPercentage, Percent: 10, Active: true},
+		{Code: "OFF", Type: models.CouponPercentage, Percent: 10},
+		{Code: "ONCEEACH", Type: models.CouponPercentage, Percent: 10, Max_Uses_Per_User: 1, Active: true},
+		{Code: "SOON", Type: models.CouponPercentage, Percent: 10, Active: true, Starts_At: &later},
+		{Code: "OVER", Type: models.CouponPercentage, Percent: 10, Active: true, Ends_At: &earlier},
+	} {
+		if _, err := CreateCoupon(ctx, coupons, coupon); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	first, err := RedeemCoupon(ctx, coupons, redemptions, "twice", "ann", primitive.NewObjectID(), money.New(100, "USD"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = RedeemCoupon(ctx, coupons, redemptions, "TWICE", "ann", primitive.NewObjectID(), money.New(100, "USD")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = RedeemCoupon(ctx, coupons, redemptions, "TWICE", "bob", primitive.NewObjectID(), money.New(100, "USD")); !errors.Is(err, pricing.ErrCouponExhausted) {
+		t.Errorf("third use: got %v, want %v", err, pricing.ErrCouponExhausted)
+	}
+
+	if got := uses("TWICE"); got != 2 {
+		t.Errorf("uses = %d, want 2", got)
+	}
+
+	if count, _ := CountRedemptions(ctx, redemptions, first.Coupon_ID, "ann"); count != 2 {
+		t.Errorf("ann redeemed %d times, want 2", count)
+	}
+
+	// an order that isn't placed gives its use back
+	ReleaseCoupon(ctx, coupons, redemptions, first)
+
+	if got := uses("TWICE"); got != 1 {
+		t.Errorf("uses after release = %d, want 1", got)
+	}
+
+	if count, _ := redemptions.CountDocuments(ctx, bson.M{"_id": first.Redemption_ID}); count != 0 {
+		t.Error("the released redemption is still there")
+	}
+
+	if _, err = RedeemCoupon(ctx, coupons, redemptions, "TWICE", "bob", primitive.NewObjectID(), money.New(100, "USD")); err != nil {
+		t.Errorf("use after release: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err = RedeemCoupon(ctx, coupons, redemptions, "ALWAYS", "ann", primitive.NewObjectID(), money.New(100, "USD")); err != nil {
+			t.Fatalf("coupon without a limit: %v", err)
+		}
+	}
+
+	refused := []struct {
+		code string
+		want error
+	}{
+		{code: "OFF", want: pricing.ErrCouponInactive},
+		{code: "SOON", want: pricing.ErrCouponNotStarted},
+		{code: "OVER", want: pricing.ErrCouponExpired},
+	}
+
+	for _, tt := range refused {
+		if _, err = RedeemCoupon(ctx, coupons, redemptions, tt.code, "ann", primitive.NewObjectID(), money.New(100, "USD")); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.code, err, tt.want)
+		}
+
+		if got := uses(tt.code); got != 0 {
+			t.Errorf("%s: uses = %d, want 0", tt.code, got)
+		}
+	}
+
+	once, err := RedeemCoupon(ctx, coupons, redemptions, "ONCEEACH", "ann", primitive.NewObjectID(), money.New(100, "USD"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = RedeemCoupon(ctx, coupons, redemptions, "ONCEEACH", "ann", primitive.NewObjectID(), money.New(100, "USD")); !errors.Is(err, pricing.ErrCouponUserLimit) {
+		t.Errorf("second use by one user: got %v, want %v", err, pricing.ErrCouponUserLimit)
+	}
+
+	if got := uses("ONCEEACH"); got != 1 {
+		t.Errorf("uses after a refused redemption = %d, want 1", got)
+	}
+
+	if _, err = RedeemCoupon(ctx, coupons, redemptions, "ONCEEACH", "bob", primitive.NewObjectID(), money.New(100, "USD")); err != nil {
+		t.Errorf("another user: %v", err)
+	}
+
+	// a released use frees the user's slot
+	ReleaseCoupon(ctx, coupons, redemptions, once)
+
+	if _, err = RedeemCoupon(ctx, coupons, redemptions, "ONCEEACH", "ann", primitive.NewObjectID(), money.New(100, "USD")); err != nil {
+		t.Errorf("use after release: %v", err)
+	}
+}
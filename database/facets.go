@@ -0,0 +1,279 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/logging"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/money"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// PriceBuckets are the lower bounds, in major units of the query currency, of
+// the price ranges counted in search facets; the last bucket is open ended.
+var PriceBuckets = []int64{0, 10, 50, 100, 500, 1000}
+
+// RatingThresholds are the "N stars and up" ranges counted in search facets.
+var RatingThresholds = []int{1, 2, 3, 4}
+
+var ErrCantComputeFacets = errors.New("cannot compute the search facets")
+
+type FacetValue struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
+}
+
+type PriceFacet struct {
+	Min   money.Money  `json:"min"`
+	Max   *money.Money `json:"max"`
+	Count int64        `json:"count"`
+}
+
+type RatingFacet struct {
+	MinRating int   `json:"min_rating"`
+	Count     int64 `json:"count"`
+}
+
+type Facets struct {
+	Category   []FacetValue            `json:"category"`
+	Brand      []FacetValue            `json:"brand"`
+	Price      []PriceFacet            `json:"price"`
+	Rating     []RatingFacet           `json:"rating"`
+	Attributes map[string][]FacetValue `json:"attributes"`
+}
+
+func valueFacet(field string) bson.A {
+	return bson.A{
+		bson.M{"$match": bson.M{field: bson.M{"$nin": bson.A{nil, ""}}}},
+		bson.M{"$sortByCount": "$" + field},
+	}
+}
+
+// priceBounds converts PriceBuckets to minor units of currency.
+func priceBounds(currency string) []money.Money {
+	bounds := make([]money.Money, 0, len(PriceBuckets))
+
+	for _, major := range PriceBuckets {
+		bound, err := money.FromMajor(major, currency)
+
+		if err != nil {
+			break
+		}
+
+		bounds = append(bounds, bound)
+	}
+
+	return bounds
+}
+
+func priceFacet(currency string) bson.A {
+	boundaries := bson.A{}
+
+	for _, bound := range priceBounds(currency) {
+		boundaries = append(boundaries, bound.Amount)
+	}
+
+	// $bucket needs a closing boundary; anything above it lands in "default"
+	boundaries = append(boundaries, int64(1)<<62)
+
+	// the price list entry in currency wins over a base price in it
+	listed := bson.M{"$filter": bson.M{
+		"input": bson.M{"$ifNull": bson.A{"$prices", bson.A{}}},
+		"cond":  bson.M{"$eq": bson.A{"$$this.currency", currency}},
+	}}
+
+	amount := bson.M{"$ifNull": bson.A{
+		bson.M{"$arrayElemAt": bson.A{"$$listed.amount", 0}},
+		bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$price.currency", currency}}, "$price.amount", nil}},
+	}}
+
+	return bson.A{
+		bson.M{"$project": bson.M{"amount": bson.M{"$let": bson.M{
+			"vars": bson.M{"listed": listed},
+			"in":   amount,
+		}}}},
+		bson.M{"$match": bson.M{"amount": bson.M{"$type": "number"}}},
+		bson.M{"$bucket": bson.M{
+			"groupBy":    "$amount",
+			"boundaries": boundaries,
+			"default":    "other",
+			"output":     bson.M{"count": bson.M{"$sum": 1}},
+		}},
+	}
+}
+
+func ratingFacet() bson.A {
+	group := bson.M{"_id": nil}
+
+	for _, threshold := range RatingThresholds {
+		group[ratingKey(threshold)] = bson.M{"$sum": bson.M{
+			"$cond": bson.A{bson.M{"$gte": bson.A{"$rating", threshold}}, 1, 0},
+		}}
+	}
+
+	return bson.A{bson.M{"$group": group}}
+}
+
+func ratingKey(threshold int) string {
+	return "r" + strconv.Itoa(threshold)
+}
+
+// attributeFacet counts products per variant attribute value. A product with
+// two red variants counts once for color=red.
+func attributeFacet() bson.A {
+	return bson.A{
+		bson.M{"$unwind": "$variants"},
+		bson.M{"$project": bson.M{"attrs": bson.M{"$objectToArray": "$variants.attributes"}}},
+		bson.M{"$unwind": "$attrs"},
+		bson.M{"$group": bson.M{"_id": bson.M{"k": "$attrs.k", "v": "$attrs.v", "p": "$_id"}}},
+		bson.M{"$group": bson.M{"_id": bson.M{"k": "$_id.k", "v": "$_id.v"}, "count": bson.M{"$sum": 1}}},
+	}
+}
+
+// ProductFacets counts the products matching q and terms per category, brand,
+// price bucket, rating threshold and variant attribute, in one aggregation.
+// Without terms it computes the facets of the plain listing.
+func ProductFacets(
+	ctx context.Context,
+	prodCollection *mongo.Collection,
+	terms []string,
+	q ProductQuery,
+) (Facets, error) {
+	var extra bson.M
+
+	if len(terms) > 0 {
+		extra = textMatch(terms)
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: q.filter(extra)}},
+		{{Key: "$facet", Value: bson.M{
+			"category":   valueFacet("category"),
+			"brand":      valueFacet("brand"),
+			"price":      priceFacet(q.currency()),
+			"rating":     ratingFacet(),
+			"attributes": attributeFacet(),
+		}}},
+	}
+
+	cursor, err := prodCollection.Aggregate(ctx, pipeline)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot compute the search facets", "error", err)
+		return Facets{}, ErrCantComputeFacets
+	}
+
+	defer cursor.Close(ctx)
+
+	var result []struct {
+		Category []struct {
+			ID    string `bson:"_id"`
+			Count int64  `bson:"count"`
+		} `bson:"category"`
+		Brand []struct {
+			ID    string `bson:"_id"`
+			Count int64  `bson:"count"`
+		} `bson:"brand"`
+		Price []struct {
+			ID    interface{} `bson:"_id"`
+			Count int64       `bson:"count"`
+		} `bson:"price"`
+		Rating     []bson.M `bson:"rating"`
+		Attributes []struct {
+			ID struct {
+				K string `bson:"k"`
+				V string `bson:"v"`
+			} `bson:"_id"`
+			Count int64 `bson:"count"`
+		} `bson:"attributes"`
+	}
+
+	if err = cursor.All(ctx, &result); err != nil {
+		logging.FromContext(ctx).Error("cannot compute the search facets", "error", err)
+		return Facets{}, ErrCantComputeFacets
+	}
+
+	facets := Facets{
+		Category:   make([]FacetValue, 0),
+		Brand:      make([]FacetValue, 0),
+		Price:      make([]PriceFacet, 0, len(PriceBuckets)),
+		Rating:     make([]RatingFacet, 0, len(RatingThresholds)),
+		Attributes: make(map[string][]FacetValue),
+	}
+
+	if len(result) == 0 {
+		return facets, nil
+	}
+
+	row := result[0]
+
+	for _, v := range row.Category {
+		facets.Category = append(facets.Category, FacetValue{Value: v.ID, Count: v.Count})
+	}
+
+	for _, v := range row.Brand {
+		facets.Brand = append(facets.Brand, FacetValue{Value: v.ID, Count: v.Count})
+	}
+
+	counts := make(map[int64]int64)
+
+	for _, bucket := range row.Price {
+		if bound, ok := numberToInt64(bucket.ID); ok {
+			counts[bound] = bucket.Count
+		}
+	}
+
+	bounds := priceBounds(q.currency())
+
+	for i, bound := range bounds {
+		facet := PriceFacet{Min: bound, Count: counts[bound.Amount]}
+
+		if i+1 < len(bounds) {
+			upper := bounds[i+1]
+			facet.Max = &upper
+		}
+
+		facets.Price = append(facets.Price, facet)
+	}
+
+	for _, threshold := range RatingThresholds {
+		var count int64
+
+		if len(row.Rating) > 0 {
+			count, _ = numberToInt64(row.Rating[0][ratingKey(threshold)])
+		}
+
+		facets.Rating = append(facets.Rating, RatingFacet{MinRating: threshold, Count: count})
+	}
+
+	for _, v := range row.Attributes {
+		facets.Attributes[v.ID.K] = append(facets.Attributes[v.ID.K], FacetValue{Value: v.ID.V, Count: v.Count})
+	}
+
+	for _, values := range facets.Attributes {
+		sort.Slice(values, func(i, j int) bool {
+			if values[i].Count != values[j].Count {
+				return values[i].Count > values[j].Count
+			}
+			return values[i].Value < values[j].Value
+		})
+	}
+
+	return facets, nil
+}
+
+func numberToInt64(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	case float64:
+		return int64(n), true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,126 @@
+package database
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestNumberToInt64(t *testing.T) {
+	tests := []struct {
+		in   interface{}
+		want int64
+		ok   bool
+	}{
+		{in: int32(10), want: 10, ok: true},
+		{in: int64(500), want: 500, ok: true},
+		{in: float64(50), want: 50, ok: true},
+		{in: int64(-1), want: -1, ok: true},
+		{in: "other", ok: false},
+		{in: nil, ok: false},
+	}
+
+	for _, tt := range tests {
+		if got, ok := numberToInt64(tt.in); got != tt.want || ok != tt.ok {
+			t.Errorf("numberToInt64(%#v) = %d, %v, want %d, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestPriceBounds(t *testing.T) {
+	usd := priceBounds("USD")
+	jpy := priceBounds("JPY")
+
+	if len(usd) != len(PriceBuckets) || usd[1] != money.New(1000, "USD") {
+		t.Errorf("USD bounds = %v", usd)
+	}
+
+	if len(jpy) != len(PriceBuckets) || jpy[1] != money.New(10, "JPY") {
+		t.Errorf("JPY bounds = %v", jpy)
+	}
+}
+
+func TestProductFacets(t *testing.T) {
+	db := testDatabase(t)
+	ctx := context.Background()
+	products := db.Collection("Products")
+
+	str := func(s string) *string { return &s }
+	// prices in whole dollars, like the buckets
+	price := func(dollars int64) money.Money { return money.New(dollars*100, "USD") }
+	variant := func(attrs map[string]string) models.Variant { return models.Variant{Attributes: attrs} }
+
+	stock := []models.Product{
+		{Category: str("shoes"), Brand: str("acme"), Price: price(5), Rating: 5, Variants: []models.Variant{
+			variant(map[string]string{"color": "red", "size": "42"}),
+			variant(map[string]string{"color": "red", "size": "43"}),
+		}},
+		{Category: str("shoes"), Brand: str("zeta"), Price: price(75), Rating: 3, Variants: []models.Variant{
+			variant(map[string]string{"color": "blue", "size": "42"}),
+		}},
+		{Category: str("hats"), Brand: str("acme"), Price: price(2000), Rating: 1},
+		{Category: str("shoes"), Price: price(100)},
+		// counted everywhere but in the dollar price buckets
+		{Category: str("hats"), Price: money.New(500, "EUR")},
+	}
+
+	for _, product := range stock {
+		product.Product_ID = primitive.NewObjectID()
+
+		if _, err := products.InsertOne(ctx, product); err != nil {
+			t.Fatalf("InsertOne: %v", err)
+		}
+	}
+
+	facets, err := ProductFacets(ctx, products, nil, ProductQuery{})
+
+	if err != nil {
+		t.Fatalf("ProductFacets: %v", err)
+	}
+
+	if want := []FacetValue{{Value: "shoes", Count: 3}, {Value: "hats", Count: 2}}; !reflect.DeepEqual(facets.Category, want) {
+		t.Errorf("category = %v, want %v", facets.Category, want)
+	}
+
+	if want := []FacetValue{{Value: "acme", Count: 2}, {Value: "zeta", Count: 1}}; !reflect.DeepEqual(facets.Brand, want) {
+		t.Errorf("brand = %v, want %v", facets.Brand, want)
+	}
+
+	prices := make([]int64, len(facets.Price))
+
+	for i, bucket := range facets.Price {
+		prices[i] = bucket.Count
+	}
+
+	if want := []int64{1, 0, 1, 1, 0, 1}; !reflect.DeepEqual(prices, want) {
+		t.Errorf("price buckets = %v, want %v", prices, want)
+	}
+
+	if last := facets.Price[len(facets.Price)-1]; last.Max != nil {
+		t.Errorf("the last price bucket ends at %v, want it open", *last.Max)
+	}
+
+	ratings := make([]int64, len(facets.Rating))
+
+	for i, r := range facets.Rating {
+		ratings[i] = r.Count
+	}
+
+	if want := []int64{3, 2, 2, 1}; !reflect.DeepEqual(ratings, want) {
+		t.Errorf("ratings = %v, want %v", ratings, want)
+	}
+
+	want := map[string][]FacetValue{
+		// the two red variants of one product count once
+		"color": {{Value: "blue", Count: 1}, {Value: "red", Count: 1}},
+		"size":  {{Value: "42", Count: 2}, {Value: "43", Count: 1}},
+	}
+
+	if !reflect.DeepEqual(facets.Attributes, want) {
+		t.Errorf("attributes = %v, want %v", facets.Attributes, want)
+	}
+}
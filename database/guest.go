@@ -0,0 +1,143 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/logging"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/metrics"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrCantCreateGuest = errors.New("cannot create the guest cart")
+	ErrNotAGuest       = errors.New("this cart doesn't belong to a guest")
+)
+
+// CreateGuest creates the user document that holds a guest's cart.
+func CreateGuest(ctx context.Context, userCollection *mongo.Collection) (models.User, error) {
+	now := time.Now()
+
+	guest := models.User{
+		ID:              primitive.NewObjectID(),
+		Created_At:      now,
+		Updated_At:      now,
+		Address_Details: make([]models.Address, 0),
+		Order_Status:    make([]models.Order, 0),
+		Guest:           true,
+	}
+
+	guest.User_ID = guest.ID.Hex()
+
+	if _, err := userCollection.InsertOne(ctx, guest); err != nil {
+		logging.FromContext(ctx).Error("cannot create the guest cart", "error", err)
+		return guest, ErrCantCreateGuest
+	}
+
+	return guest, nil
+}
+
+// SetGuestContact stores the email and delivery address a guest checks out
+// with. The address replaces any earlier one and is returned with its id.
+func SetGuestContact(
+	ctx context.Context,
+	userCollection *mongo.Collection,
+	guestID string,
+	email string,
+	address *models.Address,
+) (*models.Address, error) {
+	id, err := primitive.ObjectIDFromHex(guestID)
+
+	if err != nil {
+		logging.FromContext(ctx).Warn("this user is not valid", "error", err)
+		return nil, ErrUserIdIsNotValid
+	}
+
+	addresses := make([]models.Address, 0, 1)
+
+	if address != nil {
+		address.Address_ID = primitive.NewObjectID()
+		addresses = append(addresses, *address)
+	}
+
+	update := bson.M{"$set": bson.M{
+		"email":      email,
+		"address":    addresses,
+		"updated_at": time.Now(),
+	}}
+
+	result, err := userCollection.UpdateOne(ctx, bson.M{"_id": id, "guest": true}, update)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot add this product to the cart", "error", err)
+		return nil, ErrCantUpdateUser
+	}
+
+	if result.MatchedCount == 0 {
+		return nil, ErrNotAGuest
+	}
+
+	return address, nil
+}
+
+// MergeGuestCart moves the items of a guest's cart to the end of the user's
+// cart, typically when the guest signs in.
+func MergeGuestCart(ctx context.Context, cartCollection *mongo.Collection, guestID string, userID string) error {
+	if _, err := primitive.ObjectIDFromHex(userID); err != nil {
+		logging.FromContext(ctx).Warn("this user is not valid", "error", err)
+		return ErrUserIdIsNotValid
+	}
+
+	var guest models.Cart
+
+	now := time.Now()
+
+	// take the items and empty the cart in one step, so a retried login
+	// can't merge them twice
+	err := cartCollection.FindOneAndUpdate(
+		ctx,
+		bson.M{"user_id": guestID},
+		bson.M{"$set": bson.M{"items": make([]models.ProductUser, 0), "updated_at": now}},
+	).Decode(&guest)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil
+	}
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot add this product to the cart", "error", err)
+		return ErrCantUpdateUser
+	}
+
+	if len(guest.Items) == 0 {
+		return nil
+	}
+
+	update := bson.M{
+		"$push": bson.M{"items": bson.M{"$each": guest.Items}},
+		"$set":  bson.M{"updated_at": now},
+		"$setOnInsert": bson.M{
+			"_id":        primitive.NewObjectID(),
+			"notices":    make([]models.CartNotice, 0),
+			"created_at": now,
+		},
+	}
+
+	result, err := cartCollection.UpdateOne(ctx, bson.M{"user_id": userID}, update, options.Update().SetUpsert(true))
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot add this product to the cart", "error", err)
+		return ErrCantUpdateUser
+	}
+
+	if result.UpsertedCount > 0 {
+		metrics.CartsCreated.With().Inc()
+	}
+
+	return nil
+}
@@ -0,0 +1,124 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMergeGuestCart(t *testing.T) {
+	db := testDatabase(t)
+	ctx := context.Background()
+	carts := db.Collection("Carts")
+
+	item := func() models.ProductUser {
+		return models.ProductUser{Product_ID: primitive.NewObjectID()}
+	}
+
+	guestID, userID, newcomerID := primitive.NewObjectID().Hex(), primitive.NewObjectID().Hex(), primitive.NewObjectID().Hex()
+	guestItems := []models.ProductUser{item(), item()}
+	owned := item()
+
+	_, err := carts.InsertMany(ctx, []interface{}{
+		models.Cart{Cart_ID: primitive.NewObjectID(), User_ID: guestID, Items: guestItems},
+		models.Cart{Cart_ID: primitive.NewObjectID(), User_ID: userID, Items: []models.ProductUser{owned}},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = MergeGuestCart(ctx, carts, guestID, "not-an-id"); !errors.Is(err, ErrUserIdIsNotValid) {
+		t.Errorf("bad user id: err = %v, want %v", err, ErrUserIdIsNotValid)
+	}
+
+	// a retried login merges nothing more
+	for i := 0; i < 2; i++ {
+		if err = MergeGuestCart(ctx, carts, guestID, userID); err != nil {
+			t.Fatalf("MergeGuestCart: %v", err)
+		}
+	}
+
+	cart, err := findCart(ctx, carts, userID)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []primitive.ObjectID{owned.Product_ID, guestItems[0].Product_ID, guestItems[1].Product_ID}
+
+	if len(cart.Items) != len(want) {
+		t.Fatalf("cart has %d items, want %d", len(cart.Items), len(want))
+	}
+
+	for i, id := range want {
+		if cart.Items[i].Product_ID != id {
+			t.Errorf("cart item %d is %v, want %v", i, cart.Items[i].Product_ID, id)
+		}
+	}
+
+	if guest, _ := findCart(ctx, carts, guestID); len(guest.Items) != 0 {
+		t.Errorf("guest cart still has %d items", len(guest.Items))
+	}
+
+	// a user without a cart gets one
+	if _, err = carts.UpdateOne(ctx, bson.M{"user_id": guestID}, bson.M{"$set": bson.M{"items": guestItems}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = MergeGuestCart(ctx, carts, guestID, newcomerID); err != nil {
+		t.Fatalf("MergeGuestCart: %v", err)
+	}
+
+	if cart, _ = findCart(ctx, carts, newcomerID); len(cart.Items) != 2 || cart.Cart_ID.IsZero() {
+		t.Errorf("new cart %+v, want the guest's 2 items", cart)
+	}
+
+	if err = MergeGuestCart(ctx, carts, primitive.NewObjectID().Hex(), userID); err != nil {
+		t.Errorf("merging a guest without a cart: %v", err)
+	}
+}
+
+func TestSetGuestContact(t *testing.T) {
+	db := testDatabase(t)
+	ctx := context.Background()
+	users := db.Collection("Users")
+
+	guest, err := CreateGuest(ctx, users)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	city := "Lisbon"
+
+	for i := 0; i < 2; i++ {
+		address, err := SetGuestContact(ctx, users, guest.User_ID, "guest@example.com", &models.Address{City: &city})
+
+		if err != nil || address.Address_ID.IsZero() {
+			t.Fatalf("SetGuestContact() = %+v, %v", address, err)
+		}
+	}
+
+	var stored models.User
+
+	if err = users.FindOne(ctx, bson.M{"_id": guest.ID}).Decode(&stored); err != nil {
+		t.Fatal(err)
+	}
+
+	if stored.Email == nil || *stored.Email != "guest@example.com" || len(stored.Address_Details) != 1 {
+		t.Errorf("guest has email %v and %d addresses, want one address", stored.Email, len(stored.Address_Details))
+	}
+
+	if _, err = SetGuestContact(ctx, users, primitive.NewObjectID().Hex(), "guest@example.com", nil); !errors.Is(err, ErrNotAGuest) {
+		t.Errorf("unknown guest: err = %v, want %v", err, ErrNotAGuest)
+	}
+
+	if _, err = SetGuestContact(ctx, users, "not-an-id", "guest@example.com", nil); !errors.Is(err, ErrUserIdIsNotValid) {
+		t.Errorf("bad id: err = %v, want %v", err, ErrUserIdIsNotValid)
+	}
+}
@@ -0,0 +1,170 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/logging"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrCantFindImage   = errors.New("can't find the image")
+	ErrCantSaveImage   = errors.New("cannot save the product images")
+	ErrInvalidImageSet = errors.New("the order must list every image of the product exactly once")
+)
+
+// FindProduct loads one product, returning ErrCantFindProduct when it does
+// not exist.
+func FindProduct(ctx context.Context, prodCollection *mongo.Collection, productID primitive.ObjectID) (models.Product, error) {
+	var product models.Product
+
+	err := prodCollection.FindOne(ctx, bson.M{"_id": productID}).Decode(&product)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return product, ErrCantFindProduct
+	}
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cant find the product", "error", err)
+		return product, ErrCantDecodeProducts
+	}
+
+	return product, nil
+}
+
+// saveImages rewrites the image list in order, renumbering positions and
+// keeping the legacy image field pointing at the first one.
+func saveImages(
+	ctx context.Context,
+	prodCollection *mongo.Collection,
+	productID primitive.ObjectID,
+	images []models.ProductImage,
+) error {
+	var primary *string
+
+	for i := range images {
+		images[i].Position = i
+	}
+
+	if len(images) > 0 {
+		primary = &images[0].URL
+	}
+
+	update := bson.M{"$set": bson.M{"images": images, "image": primary}}
+
+	if _, err := prodCollection.UpdateByID(ctx, productID, update); err != nil {
+		logging.FromContext(ctx).Error("cannot save the product images", "error", err)
+		return ErrCantSaveImage
+	}
+
+	return nil
+}
+
+// AddProductImage appends an image after the existing ones.
+func AddProductImage(
+	ctx context.Context,
+	prodCollection *mongo.Collection,
+	productID primitive.ObjectID,
+	image models.ProductImage,
+) ([]models.ProductImage, error) {
+	product, err := FindProduct(ctx, prodCollection, productID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	images := append(product.Images, image)
+
+	if err = saveImages(ctx, prodCollection, productID, images); err != nil {
+		return nil, err
+	}
+
+	return images, nil
+}
+
+// ReorderProductImages puts the images in the order of imageIDs, which must
+// name each of them once.
+func ReorderProductImages(
+	ctx context.Context,
+	prodCollection *mongo.Collection,
+	productID primitive.ObjectID,
+	imageIDs []primitive.ObjectID,
+) ([]models.ProductImage, error) {
+	product, err := FindProduct(ctx, prodCollection, productID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(imageIDs) != len(product.Images) {
+		return nil, ErrInvalidImageSet
+	}
+
+	rank := make(map[primitive.ObjectID]int, len(imageIDs))
+
+	for i, id := range imageIDs {
+		if _, dup := rank[id]; dup {
+			return nil, ErrInvalidImageSet
+		}
+
+		rank[id] = i
+	}
+
+	for _, image := range product.Images {
+		if _, ok := rank[image.Image_ID]; !ok {
+			return nil, ErrInvalidImageSet
+		}
+	}
+
+	images := product.Images
+
+	sort.Slice(images, func(i, j int) bool {
+		return rank[images[i].Image_ID] < rank[images[j].Image_ID]
+	})
+
+	if err = saveImages(ctx, prodCollection, productID, images); err != nil {
+		return nil, err
+	}
+
+	return images, nil
+}
+
+// RemoveProductImage drops an image from the product and returns it, so the
+// caller can delete its blobs.
+func RemoveProductImage(
+	ctx context.Context,
+	prodCollection *mongo.Collection,
+	productID primitive.ObjectID,
+	imageID primitive.ObjectID,
+) (models.ProductImage, error) {
+	var removed models.ProductImage
+
+	product, err := FindProduct(ctx, prodCollection, productID)
+
+	if err != nil {
+		return removed, err
+	}
+
+	images := make([]models.ProductImage, 0, len(product.Images))
+	found := false
+
+	for _, image := range product.Images {
+		if image.Image_ID == imageID {
+			removed, found = image, true
+			continue
+		}
+
+		images = append(images, image)
+	}
+
+	if !found {
+		return removed, ErrCantFindImage
+	}
+
+	return removed, saveImages(ctx, prodCollection, productID, images)
+}
@@ -0,0 +1,124 @@
+package database
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/logging"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/metrics"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/tracing"
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// commandMonitor logs every command sent to MongoDB at debug and the ones
+// that fail at warn, with the logger of the context they run in, so they
+// carry the request id of the request that sent them. It also times them
+// and counts the failures for the metrics, by collection, and traces each
+// in a client span, a child of the request's.
+func commandMonitor() *event.CommandMonitor {
+	// the commands in flight, by driver request id; the finished events
+	// don't have their collection and can't carry a span in their context
+	var commands sync.Map
+
+	// finished handles a command that ended, with the failure when it
+	// failed
+	finished := func(ctx context.Context, e event.CommandFinishedEvent, failure string) {
+		value, _ := commands.LoadAndDelete(e.RequestID)
+		command, _ := value.(inFlight)
+		collection := command.collection
+
+		if command.span != nil {
+			if failure != "" {
+				command.span.SetStatus(codes.Error, failure)
+			}
+
+			command.span.End()
+		}
+
+		metrics.MongoDuration.With(collection, e.CommandName).Observe(e.Duration.Seconds())
+
+		level := slog.LevelDebug
+		attrs := make([]slog.Attr, 0, 4)
+
+		if failure != "" {
+			metrics.MongoErrors.With(collection, e.CommandName).Inc()
+
+			level = slog.LevelWarn
+			attrs = append(attrs, slog.String("error", failure))
+		}
+
+		logger := logging.FromContext(ctx)
+
+		if !logger.Enabled(ctx, level) {
+			return
+		}
+
+		attrs = append(attrs,
+			slog.String("command", e.CommandName),
+			slog.String("collection", collection),
+			slog.Duration("duration", e.Duration),
+		)
+
+		logger.LogAttrs(ctx, level, "mongodb command", attrs...)
+	}
+
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			collection := commandCollection(e)
+
+			name := e.CommandName
+
+			if collection != "" {
+				name += " " + collection
+			}
+
+			_, span := tracing.Tracer().Start(ctx, name,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(
+					semconv.DBSystemMongoDB,
+					semconv.DBName(e.DatabaseName),
+					semconv.DBOperation(e.CommandName),
+					semconv.DBMongoDBCollection(collection),
+				),
+			)
+
+			commands.Store(e.RequestID, inFlight{collection: collection, span: span})
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			finished(ctx, e.CommandFinishedEvent, "")
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			finished(ctx, e.CommandFinishedEvent, e.Failure)
+		},
+	}
+}
+
+// inFlight is a command sent to MongoDB that didn't finish yet.
+type inFlight struct {
+	collection string
+	span       trace.Span
+}
+
+// commandCollection is the collection a command works on, or "" for
+// commands on none, like hello. CRUD commands name it first; getMore in its
+// "collection" field.
+func commandCollection(e *event.CommandStartedEvent) string {
+	if e.CommandName == "getMore" {
+		collection, _ := e.Command.Lookup("collection").StringValueOK()
+		return collection
+	}
+
+	element, err := e.Command.IndexErr(0)
+
+	if err != nil {
+		return ""
+	}
+
+	collection, _ := element.Value().StringValueOK()
+
+	return collection
+}
@@ -0,0 +1,87 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/logging"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/notification"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var ErrCantSavePreferences = errors.New("cannot save the notification preferences")
+
+// UserContacts finds how to reach users in the user collection, for
+// notification.Dispatcher.
+type UserContacts struct {
+	Collection *mongo.Collection
+}
+
+func (u UserContacts) Contact(ctx context.Context, userID string) (notification.Contact, error) {
+	var contact notification.Contact
+
+	user, err := FindUser(ctx, u.Collection, userID)
+
+	if err != nil {
+		return contact, err
+	}
+
+	contact.Preferences = NotificationPreferences(user)
+
+	if user.First_Name != nil {
+		contact.First_Name = *user.First_Name
+	}
+
+	if user.Email != nil {
+		contact.Email = *user.Email
+	}
+
+	if user.Phone != nil {
+		contact.Phone = *user.Phone
+	}
+
+	return contact, nil
+}
+
+// NotificationPreferences are the user's channels, the defaults when they
+// never chose.
+func NotificationPreferences(user models.User) notification.Preferences {
+	if user.Notifications == nil {
+		return notification.DefaultPreferences
+	}
+
+	return notification.Preferences{Email: user.Notifications.Email, SMS: user.Notifications.SMS}
+}
+
+func SetNotificationPreferences(
+	ctx context.Context,
+	userCollection *mongo.Collection,
+	userID string,
+	preferences models.NotificationPreferences,
+) error {
+	id, err := primitive.ObjectIDFromHex(userID)
+
+	if err != nil {
+		logging.FromContext(ctx).Warn("this user is not valid", "error", err)
+		return ErrUserIdIsNotValid
+	}
+
+	update := bson.M{"$set": bson.M{"notifications": preferences, "updated_at": time.Now()}}
+
+	result, err := userCollection.UpdateOne(ctx, bson.M{"_id": id}, update)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot save the notification preferences", "error", err)
+		return ErrCantSavePreferences
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrCantFindUser
+	}
+
+	return nil
+}
@@ -0,0 +1,321 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/events"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/logging"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrCantRecordEvent      = errors.New("cannot record the event")
+	ErrCantDispatchEvents   = errors.New("cannot dispatch the outbox events")
+	ErrCantStartTransaction = errors.New("cannot start the transaction")
+	ErrNoTransactions       = errors.New("MongoDB runs no transactions, run it as a replica set")
+)
+
+// outboxEntry is an event waiting in the outbox with its delivery state:
+// the sinks that already took it and when to try the others again.
+type outboxEntry struct {
+	events.Event    `bson:",inline"`
+	Delivered       []string   `bson:"delivered"`
+	Attempts        int        `bson:"attempts"`
+	Next_Attempt_At time.Time  `bson:"next_attempt_at"`
+	Claimed_Until   time.Time  `bson:"claimed_until"`
+	Last_Error      string     `bson:"last_error,omitempty"`
+	Dispatched_At   *time.Time `bson:"dispatched_at,omitempty"`
+}
+
+// OutboxRetention is how long dispatched events stay in the outbox.
+var OutboxRetention = 7 * 24 * time.Hour
+
+func EnsureOutboxIndexes(ctx context.Context, outboxCollection *mongo.Collection) error {
+	_, err := outboxCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "next_attempt_at", Value: 1}},
+			Options: options.Index().SetName("outbox_next_attempt"),
+		},
+		{
+			Keys:    bson.D{{Key: "dispatched_at", Value: 1}},
+			Options: options.Index().SetName("outbox_dispatched").SetExpireAfterSeconds(int32(OutboxRetention.Seconds())),
+		},
+	})
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot create the indexes", "error", err)
+		return ErrCantCreateIndex
+	}
+
+	return nil
+}
+
+// EventsWithoutTransactions lets WithEvents run on a MongoDB without
+// transactions, writing the events after the change. An event is lost when
+// that write fails, so it is off unless asked for.
+var EventsWithoutTransactions = false
+
+var transactions struct {
+	sync.Mutex
+	checked   bool
+	supported bool
+}
+
+// supportsTransactions tells whether the server is a replica set member or
+// a mongos, the deployments that run transactions. The answer is kept once
+// the server gave one; a failed probe is tried again on the next call.
+func supportsTransactions(ctx context.Context, client *mongo.Client) (bool, error) {
+	transactions.Lock()
+	defer transactions.Unlock()
+
+	if transactions.checked {
+		return transactions.supported, nil
+	}
+
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+
+	err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot tell whether MongoDB runs transactions", "error", err)
+		return false, ErrCantStartTransaction
+	}
+
+	transactions.checked = true
+	transactions.supported = hello.SetName != "" || hello.Msg == "isdbgrid"
+
+	return transactions.supported, nil
+}
+
+// CheckTransactions makes sure WithEvents can run: it returns
+// ErrNoTransactions when MongoDB runs no transactions, unless
+// EventsWithoutTransactions allows it.
+func CheckTransactions(ctx context.Context, client *mongo.Client) error {
+	supported, err := supportsTransactions(ctx, client)
+
+	if err != nil {
+		return err
+	}
+
+	if supported {
+		return nil
+	}
+
+	if !EventsWithoutTransactions {
+		return ErrNoTransactions
+	}
+
+	logging.FromContext(ctx).Warn("MongoDB is not a replica set, outbox events are written without a transaction")
+
+	return nil
+}
+
+func recordEvents(ctx context.Context, outboxCollection *mongo.Collection, evs []events.Event) error {
+	if len(evs) == 0 {
+		return nil
+	}
+
+	entries := make([]interface{}, len(evs))
+
+	for i, event := range evs {
+		entries[i] = outboxEntry{
+			Event:           event,
+			Delivered:       make([]string, 0),
+			Next_Attempt_At: event.Occurred_At,
+		}
+	}
+
+	if _, err := outboxCollection.InsertMany(ctx, entries); err != nil {
+		logging.FromContext(ctx).Error("cannot record the event", "error", err)
+		return ErrCantRecordEvent
+	}
+
+	return nil
+}
+
+// WithEvents runs change and writes the events it returns to the outbox in
+// the same transaction, so either both happen or neither does. change must
+// use the context it is given for its writes to be part of it, and may run
+// more than once when the transaction is retried. A standalone MongoDB runs
+// no transactions; there WithEvents returns ErrNoTransactions, or writes the
+// events after change when EventsWithoutTransactions allows it.
+func WithEvents(
+	ctx context.Context,
+	outboxCollection *mongo.Collection,
+	change func(ctx context.Context) ([]events.Event, error),
+) error {
+	run := func(ctx context.Context) error {
+		evs, err := change(ctx)
+
+		if err != nil {
+			return err
+		}
+
+		return recordEvents(ctx, outboxCollection, evs)
+	}
+
+	client := outboxCollection.Database().Client()
+
+	supported, err := supportsTransactions(ctx, client)
+
+	if err != nil {
+		return err
+	}
+
+	if !supported && !EventsWithoutTransactions {
+		return ErrNoTransactions
+	}
+
+	if !supported {
+		return run(ctx)
+	}
+
+	session, err := client.StartSession()
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot start the transaction", "error", err)
+		return ErrCantStartTransaction
+	}
+
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, run(sc)
+	})
+
+	return err
+}
+
+// outboxRetryDelay is how long to wait before trying an event again after
+// attempts failed ones.
+func outboxRetryDelay(attempts int) time.Duration {
+	delay := time.Second
+
+	for i := 1; i < attempts && delay < 10*time.Minute; i++ {
+		delay *= 2
+	}
+
+	if delay > 10*time.Minute {
+		delay = 10 * time.Minute
+	}
+
+	return delay
+}
+
+// OutboxDispatcher delivers the events in the outbox to every sink, oldest
+// first, at least once: an event is done when each sink took it, and sinks
+// that failed get it again later, with growing delays. A sink may see an
+// event twice, e.g. when the service stops during a delivery.
+type OutboxDispatcher struct {
+	Collection *mongo.Collection
+	Sinks      map[string]events.Sink
+	// Batch is how many events one Dispatch delivers at most.
+	Batch int
+}
+
+// claimFor is how long a dispatcher has an event to itself.
+const claimFor = time.Minute
+
+// Dispatch delivers the events that are due and returns how many it
+// handled.
+func (d *OutboxDispatcher) Dispatch(ctx context.Context) (int, error) {
+	handled := 0
+
+	for handled < d.Batch {
+		now := time.Now()
+
+		filter := bson.M{
+			"dispatched_at":   bson.M{"$exists": false},
+			"next_attempt_at": bson.M{"$lte": now},
+			"claimed_until":   bson.M{"$lte": now},
+		}
+		update := bson.M{"$set": bson.M{"claimed_until": now.Add(claimFor)}}
+		opts := options.FindOneAndUpdate().SetSort(bson.D{{Key: "_id", Value: 1}})
+
+		var entry outboxEntry
+
+		err := d.Collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&entry)
+
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return handled, nil
+		}
+
+		if err != nil {
+			logging.FromContext(ctx).Error("cannot dispatch the outbox events", "error", err)
+			return handled, ErrCantDispatchEvents
+		}
+
+		if err = d.deliver(ctx, entry); err != nil {
+			return handled, err
+		}
+
+		handled++
+	}
+
+	return handled, nil
+}
+
+func (d *OutboxDispatcher) deliver(ctx context.Context, entry outboxEntry) error {
+	delivered := make(map[string]bool, len(entry.Delivered))
+
+	for _, name := range entry.Delivered {
+		delivered[name] = true
+	}
+
+	names := make([]string, 0, len(d.Sinks))
+
+	for name := range d.Sinks {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var failed error
+
+	for _, name := range names {
+		if delivered[name] {
+			continue
+		}
+
+		if err := d.Sinks[name].Publish(ctx, entry.Event); err != nil {
+			failed = fmt.Errorf("%s: %w", name, err)
+			continue
+		}
+
+		if _, err := d.Collection.UpdateByID(ctx, entry.Event_ID, bson.M{"$addToSet": bson.M{"delivered": name}}); err != nil {
+			logging.FromContext(ctx).Error("cannot dispatch the outbox events", "error", err)
+			return ErrCantDispatchEvents
+		}
+	}
+
+	now := time.Now()
+	update := bson.M{"$set": bson.M{"dispatched_at": now}}
+
+	if failed != nil {
+		logging.FromContext(ctx).Warn("cannot deliver the event", "event_id", entry.Event_ID.Hex(), "type", entry.Type, "error", failed)
+
+		update = bson.M{"$set": bson.M{
+			"attempts":        entry.Attempts + 1,
+			"next_attempt_at": now.Add(outboxRetryDelay(entry.Attempts + 1)),
+			"claimed_until":   time.Time{},
+			"last_error":      failed.Error(),
+		}}
+	}
+
+	if _, err := d.Collection.UpdateByID(ctx, entry.Event_ID, update); err != nil {
+		logging.FromContext(ctx).Error("cannot dispatch the outbox events", "error", err)
+		return ErrCantDispatchEvents
+	}
+
+	return nil
+}
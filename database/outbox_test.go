@@ -0,0 +1,238 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/events"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestOutboxRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, time.Second},
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{10, 512 * time.Second},
+		{11, 10 * time.Minute},
+		{1000, 10 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := outboxRetryDelay(tt.attempts); got != tt.want {
+			t.Errorf("outboxRetryDelay(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestOutboxDispatcher(t *testing.T) {
+	db := testDatabase(t)
+	ctx := context.Background()
+	outbox := db.Collection("Outbox")
+
+	evs := make([]events.Event, 3)
+
+	for i := range evs {
+		event, err := events.New(events.CartUpdated, "user-1", events.CartUpdatedPayload{User_ID: "user-1", Action: events.CartItemAdded})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		event.Occurred_At = event.Occurred_At.Add(-time.Second)
+		evs[i] = event
+	}
+
+	if err := recordEvents(ctx, outbox, evs[:2]); err != nil {
+		t.Fatalf("recordEvents: %v", err)
+	}
+
+	// another dispatcher is working on the third one
+	if err := recordEvents(ctx, outbox, evs[2:]); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := outbox.UpdateByID(ctx, evs[2].Event_ID, bson.M{"$set": bson.M{"claimed_until": time.Now().Add(time.Hour)}}); err != nil {
+		t.Fatal(err)
+	}
+
+	reliable := &events.MemorySink{}
+	flaky := &events.MemorySink{}
+	down := true
+
+	dispatcher := &OutboxDispatcher{
+		Collection: outbox,
+		Sinks: map[string]events.Sink{
+			"reliable": reliable,
+			"flaky": events.SinkFunc(func(ctx context.Context, event events.Event) error {
+				if down {
+					return errors.New("unavailable")
+				}
+
+				return flaky.Publish(ctx, event)
+			}),
+		},
+		Batch: 10,
+	}
+
+	dispatch := func(want int) {
+		t.Helper()
+
+		if handled, err := dispatcher.Dispatch(ctx); err != nil || handled != want {
+			t.Fatalf("Dispatch() = %d, %v, want %d", handled, err, want)
+		}
+	}
+
+	dispatch(2)
+
+	if got := reliable.Events(); len(got) != 2 || got[0].Event_ID != evs[0].Event_ID || got[1].Event_ID != evs[1].Event_ID {
+		t.Errorf("reliable sink got %+v, want the first two events in order", got)
+	}
+
+	var entry outboxEntry
+
+	if err := outbox.FindOne(ctx, bson.M{"_id": evs[0].Event_ID}).Decode(&entry); err != nil {
+		t.Fatal(err)
+	}
+
+	if entry.Attempts != 1 || entry.Last_Error == "" || entry.Dispatched_At != nil || !entry.Next_Attempt_At.After(time.Now()) {
+		t.Errorf("after a failed delivery the entry is %+v", entry)
+	}
+
+	if len(entry.Delivered) != 1 || entry.Delivered[0] != "reliable" {
+		t.Errorf("delivered to %v, want only the reliable sink", entry.Delivered)
+	}
+
+	// nothing is due before the retry delay
+	dispatch(0)
+
+	if _, err := outbox.UpdateMany(ctx, bson.M{"dispatched_at": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"next_attempt_at": time.Now().Add(-time.Second)}}); err != nil {
+		t.Fatal(err)
+	}
+
+	down = false
+	dispatch(2)
+
+	if got := reliable.Events(); len(got) != 2 {
+		t.Errorf("reliable sink got %d events, want them only once", len(got))
+	}
+
+	if got := flaky.Events(); len(got) != 2 {
+		t.Errorf("flaky sink got %d events, want 2 once it came back", len(got))
+	}
+
+	if count, _ := outbox.CountDocuments(ctx, bson.M{"dispatched_at": bson.M{"$exists": true}}); count != 2 {
+		t.Errorf("%d events dispatched, want 2", count)
+	}
+
+	dispatch(0)
+}
+
+func TestWithEvents(t *testing.T) {
+	db := testDatabase(t)
+	ctx := context.Background()
+	outbox := db.Collection("Outbox")
+
+	event, err := events.New(events.UserSignedUp, "user-1", events.UserSignedUpPayload{User_ID: "user-1"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	supported, err := supportsTransactions(ctx, db.Client())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a standalone MongoDB only records events when allowed to
+	if !supported {
+		err = WithEvents(ctx, outbox, func(ctx context.Context) ([]events.Event, error) {
+			return []events.Event{event}, nil
+		})
+
+		if !errors.Is(err, ErrNoTransactions) {
+			t.Errorf("err = %v, want %v", err, ErrNoTransactions)
+		}
+
+		if err = CheckTransactions(ctx, db.Client()); !errors.Is(err, ErrNoTransactions) {
+			t.Errorf("CheckTransactions() = %v, want %v", err, ErrNoTransactions)
+		}
+
+		EventsWithoutTransactions = true
+		t.Cleanup(func() { EventsWithoutTransactions = false })
+	}
+
+	if err = CheckTransactions(ctx, db.Client()); err != nil {
+		t.Errorf("CheckTransactions() = %v", err)
+	}
+
+	failed := errors.New("failed")
+
+	err = WithEvents(ctx, outbox, func(ctx context.Context) ([]events.Event, error) {
+		return []events.Event{event}, failed
+	})
+
+	if !errors.Is(err, failed) {
+		t.Errorf("err = %v, want the change's error", err)
+	}
+
+	if count, _ := outbox.CountDocuments(ctx, bson.M{}); count != 0 {
+		t.Errorf("%d events recorded for a failed change", count)
+	}
+
+	err = WithEvents(ctx, outbox, func(ctx context.Context) ([]events.Event, error) {
+		return []events.Event{event}, nil
+	})
+
+	if err != nil {
+		t.Fatalf("WithEvents: %v", err)
+	}
+
+	var entry outboxEntry
+
+	if err = outbox.FindOne(ctx, bson.M{"_id": event.Event_ID}).Decode(&entry); err != nil {
+		t.Fatalf("event not recorded: %v", err)
+	}
+
+	if entry.Type != events.UserSignedUp || entry.Attempts != 0 || len(entry.Delivered) != 0 {
+		t.Errorf("recorded %+v", entry)
+	}
+}
+
+func TestSupportsTransactionsRetries(t *testing.T) {
+	db := testDatabase(t)
+	ctx := context.Background()
+
+	forget := func() {
+		transactions.Lock()
+		transactions.checked = false
+		transactions.Unlock()
+	}
+
+	forget()
+	t.Cleanup(forget)
+
+	// never connected, so the probe fails
+	offline, err := mongo.NewClient(options.Client().ApplyURI("mongodb://127.0.0.1:1"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = supportsTransactions(ctx, offline); !errors.Is(err, ErrCantStartTransaction) {
+		t.Errorf("err = %v, want %v", err, ErrCantStartTransaction)
+	}
+
+	if _, err = supportsTransactions(ctx, db.Client()); err != nil {
+		t.Errorf("probing again: %v", err)
+	}
+}
@@ -0,0 +1,340 @@
+package database
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/logging"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/money"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+const (
+	SortNewest     = "newest"
+	SortPriceAsc   = "price_asc"
+	SortPriceDesc  = "price_desc"
+	SortRatingDesc = "rating_desc"
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid page cursor")
+	ErrInvalidSort   = errors.New("invalid sort option")
+	ErrCantListItems = errors.New("cannot list the products")
+
+	ErrCantUpdateProducts = errors.New("cannot update the products")
+)
+
+// ProductQuery describes one page of a product listing. Cursor is the
+// next_cursor returned with the previous page, empty for the first one.
+// Price bounds are in minor units of Currency, DefaultCurrency when empty,
+// and match a product's price list entry in it, or its base price when it
+// has none. Products priced only in other currencies never match them.
+// Price sorts order by the base price.
+type ProductQuery struct {
+	MinPrice  *int64
+	MaxPrice  *int64
+	Currency  string
+	MinRating *uint8
+	Category  string
+	Brand     string
+	// Attributes must all be matched by a single variant, e.g. color=red
+	// and size=42 on the same SKU.
+	Attributes map[string]string
+	Sort       string
+	Limit      int64
+	Cursor     string
+}
+
+type pageCursor struct {
+	Value interface{} `json:"v,omitempty"`
+	// Null is set when the last product had no value to sort by; those sort
+	// before any value, so after the others when sorting down.
+	Null   bool   `json:"n,omitempty"`
+	ID     string `json:"id"`
+	Offset int64  `json:"o,omitempty"`
+}
+
+type sortSpec struct {
+	field string
+	dir   int
+}
+
+func sortFor(name string) (sortSpec, error) {
+	switch name {
+	case "", SortNewest:
+		return sortSpec{field: "_id", dir: -1}, nil
+	case SortPriceAsc:
+		return sortSpec{field: "price.amount", dir: 1}, nil
+	case SortPriceDesc:
+		return sortSpec{field: "price.amount", dir: -1}, nil
+	case SortRatingDesc:
+		return sortSpec{field: "rating", dir: -1}, nil
+	}
+
+	return sortSpec{}, ErrInvalidSort
+}
+
+// after matches the products that come after the cursor's, which had
+// lastID. A missing sort value counts as null, which MongoDB sorts before
+// every number.
+func (spec sortSpec) after(cur pageCursor, lastID primitive.ObjectID) bson.M {
+	op := "$gt"
+
+	if spec.dir < 0 {
+		op = "$lt"
+	}
+
+	if spec.field == "_id" {
+		return bson.M{"_id": bson.M{op: lastID}}
+	}
+
+	if cur.Null {
+		sameNull := bson.M{spec.field: nil, "_id": bson.M{op: lastID}}
+
+		if spec.dir < 0 {
+			return sameNull
+		}
+
+		return bson.M{"$or": bson.A{sameNull, bson.M{spec.field: bson.M{"$ne": nil}}}}
+	}
+
+	after := bson.A{
+		bson.M{spec.field: bson.M{op: cur.Value}},
+		bson.M{spec.field: cur.Value, "_id": bson.M{op: lastID}},
+	}
+
+	if spec.dir < 0 {
+		after = append(after, bson.M{spec.field: nil})
+	}
+
+	return bson.M{"$or": after}
+}
+
+func encodeCursor(cur pageCursor) string {
+	raw, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(s string) (pageCursor, primitive.ObjectID, error) {
+	var cur pageCursor
+
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+
+	if err != nil {
+		return cur, primitive.NilObjectID, ErrInvalidCursor
+	}
+
+	if err = json.Unmarshal(raw, &cur); err != nil {
+		return cur, primitive.NilObjectID, ErrInvalidCursor
+	}
+
+	id, err := primitive.ObjectIDFromHex(cur.ID)
+
+	if err != nil {
+		return cur, primitive.NilObjectID, ErrInvalidCursor
+	}
+
+	return cur, id, nil
+}
+
+func (q ProductQuery) currency() string {
+	if q.Currency == "" {
+		return money.DefaultCurrency
+	}
+
+	return q.Currency
+}
+
+// filter builds the match stage for the query, ANDed with extra when the
+// caller needs to narrow the listing further (e.g. a search expression).
+func (q ProductQuery) filter(extra bson.M) bson.M {
+	and := bson.A{}
+
+	if len(extra) > 0 {
+		and = append(and, extra)
+	}
+
+	price := bson.M{}
+
+	if q.MinPrice != nil {
+		price["$gte"] = *q.MinPrice
+	}
+
+	if q.MaxPrice != nil {
+		price["$lte"] = *q.MaxPrice
+	}
+
+	if len(price) > 0 {
+		currency := q.currency()
+
+		and = append(and, bson.M{"$or": bson.A{
+			bson.M{"prices": bson.M{"$elemMatch": bson.M{"currency": currency, "amount": price}}},
+			bson.M{"price.currency": currency, "price.amount": price, "prices.currency": bson.M{"$ne": currency}},
+		}})
+	}
+
+	if q.MinRating != nil {
+		and = append(and, bson.M{"rating": bson.M{"$gte": *q.MinRating}})
+	}
+
+	if q.Category != "" {
+		and = append(and, bson.M{"category": q.Category})
+	}
+
+	if q.Brand != "" {
+		and = append(and, bson.M{"brand": q.Brand})
+	}
+
+	if len(q.Attributes) > 0 {
+		attrs := bson.M{}
+
+		for key, value := range q.Attributes {
+			attrs["attributes."+key] = value
+		}
+
+		and = append(and, bson.M{"variants": bson.M{"$elemMatch": attrs}})
+	}
+
+	if len(and) == 0 {
+		return bson.M{}
+	}
+
+	return bson.M{"$and": and}
+}
+
+// ListProducts returns a page of products ordered by q.Sort with _id as the
+// tie-breaker, so pages never overlap or skip items when values repeat. The
+// returned cursor is empty when there are no further pages.
+func ListProducts(
+	ctx context.Context,
+	prodCollection *mongo.Collection,
+	q ProductQuery,
+	extra bson.M,
+) ([]models.Product, string, error) {
+	spec, err := sortFor(q.Sort)
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	if q.Limit <= 0 {
+		q.Limit = DefaultPageLimit
+	}
+
+	if q.Limit > MaxPageLimit {
+		q.Limit = MaxPageLimit
+	}
+
+	filter := q.filter(extra)
+
+	if q.Cursor != "" {
+		cur, lastID, err := decodeCursor(q.Cursor)
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		filter = bson.M{"$and": bson.A{filter, spec.after(cur, lastID)}}
+	}
+
+	sort := bson.D{{Key: spec.field, Value: spec.dir}}
+
+	if spec.field != "_id" {
+		sort = append(sort, bson.E{Key: "_id", Value: spec.dir})
+	}
+
+	// fetch one extra document to know whether another page exists
+	opts := options.Find().SetSort(sort).SetLimit(q.Limit + 1)
+
+	cursor, err := prodCollection.Find(ctx, filter, opts)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot list the products", "error", err)
+		return nil, "", ErrCantListItems
+	}
+
+	defer cursor.Close(ctx)
+
+	// the raw documents tell a missing sort value from a zero one
+	raws := make([]bson.Raw, 0, q.Limit+1)
+
+	if err = cursor.All(ctx, &raws); err != nil {
+		logging.FromContext(ctx).Error("cant find the product", "error", err)
+		return nil, "", ErrCantDecodeProducts
+	}
+
+	products := make([]models.Product, len(raws))
+
+	for i, raw := range raws {
+		if err = bson.Unmarshal(raw, &products[i]); err != nil {
+			logging.FromContext(ctx).Error("cant find the product", "error", err)
+			return nil, "", ErrCantDecodeProducts
+		}
+	}
+
+	if int64(len(products)) <= q.Limit {
+		return products, "", nil
+	}
+
+	products = products[:q.Limit]
+	last := products[len(products)-1]
+
+	next := pageCursor{ID: last.Product_ID.Hex()}
+
+	if value, err := raws[q.Limit-1].LookupErr(strings.Split(spec.field, ".")...); err != nil || value.Type == bsontype.Null {
+		next.Null = spec.field != "_id"
+	} else {
+		switch spec.field {
+		case "price.amount":
+			next.Value = last.Price.Amount
+		case "rating":
+			next.Value = last.Rating
+		}
+	}
+
+	return products, encodeCursor(next), nil
+}
+
+// MigrateProductPrices rewrites prices stored as a bare number of major
+// units, from before prices carried a currency, as Money in DefaultCurrency,
+// so price filters and sorts on price.amount see every product.
+func MigrateProductPrices(ctx context.Context, prodCollection *mongo.Collection) error {
+	factor := int64(1)
+
+	for i := 0; i < money.Digits(money.DefaultCurrency); i++ {
+		factor *= 10
+	}
+
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"price": bson.M{
+			"amount":   bson.M{"$toLong": bson.M{"$multiply": bson.A{"$price", factor}}},
+			"currency": money.DefaultCurrency,
+		}}}},
+	}
+
+	res, err := prodCollection.UpdateMany(ctx, bson.M{"price": bson.M{"$type": "number"}}, update)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot update the products", "error", err)
+		return ErrCantUpdateProducts
+	}
+
+	if res.ModifiedCount > 0 {
+		logging.FromContext(ctx).Info("migrated the product prices", "count", res.ModifiedCount, "currency", money.DefaultCurrency)
+	}
+
+	return nil
+}
@@ -0,0 +1,321 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/money"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestSortFor(t *testing.T) {
+	tests := []struct {
+		name string
+		want sortSpec
+		err  error
+	}{
+		{name: "", want: sortSpec{field: "_id", dir: -1}},
+		{name: SortNewest, want: sortSpec{field: "_id", dir: -1}},
+		{name: SortPriceAsc, want: sortSpec{field: "price.amount", dir: 1}},
+		{name: SortPriceDesc, want: sortSpec{field: "price.amount", dir: -1}},
+		{name: SortRatingDesc, want: sortSpec{field: "rating", dir: -1}},
+		{name: "price", err: ErrInvalidSort},
+	}
+
+	for _, tt := range tests {
+		got, err := sortFor(tt.name)
+
+		if got != tt.want || !errors.Is(err, tt.err) {
+			t.Errorf("sortFor(%q) = %+v, %v, want %+v, %v", tt.name, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestCursor(t *testing.T) {
+	id := primitive.NewObjectID()
+
+	cur, gotID, err := decodeCursor(encodeCursor(pageCursor{Value: int64(1999), ID: id.Hex()}))
+
+	if err != nil {
+		t.Fatalf("decodeCursor: %v", err)
+	}
+
+	// JSON gives numbers back as float64, which MongoDB compares with the
+	// stored integers by value
+	if gotID != id || cur.Value != float64(1999) {
+		t.Errorf("decoded %v, %v, want 1999, %v", cur.Value, gotID, id)
+	}
+
+	cur, _, err = decodeCursor(encodeCursor(pageCursor{Null: true, ID: id.Hex()}))
+
+	if err != nil || !cur.Null || cur.Value != nil {
+		t.Errorf("decoded a null cursor as %+v, %v", cur, err)
+	}
+
+	invalid := []string{
+		"not base64!",
+		"bm90IGpzb24",                         // "not json"
+		encodeCursor(pageCursor{ID: "12345"}), // not an ObjectID
+		encodeCursor(pageCursor{}),
+	}
+
+	for _, s := range invalid {
+		if _, _, err := decodeCursor(s); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("decodeCursor(%q) = %v, want ErrInvalidCursor", s, err)
+		}
+	}
+}
+
+func TestSortSpecAfter(t *testing.T) {
+	id := primitive.NewObjectID()
+
+	tests := []struct {
+		name string
+		spec sortSpec
+		cur  pageCursor
+		want bson.M
+	}{
+		{
+			name: "newest",
+			spec: sortSpec{field: "_id", dir: -1},
+			want: bson.M{"_id": bson.M{"$lt": id}},
+		},
+		{
+			name: "value, up",
+			spec: sortSpec{field: "price.amount", dir: 1},
+			cur:  pageCursor{Value: float64(500)},
+			want: bson.M{"$or": bson.A{
+				bson.M{"price.amount": bson.M{"$gt": float64(500)}},
+				bson.M{"price.amount": float64(500), "_id": bson.M{"$gt": id}},
+			}},
+		},
+		{
+			name: "value, down, then the products without one",
+			spec: sortSpec{field: "rating", dir: -1},
+			cur:  pageCursor{Value: float64(3)},
+			want: bson.M{"$or": bson.A{
+				bson.M{"rating": bson.M{"$lt": float64(3)}},
+				bson.M{"rating": float64(3), "_id": bson.M{"$lt": id}},
+				bson.M{"rating": nil},
+			}},
+		},
+		{
+			name: "no value, up, then every product with one",
+			spec: sortSpec{field: "rating", dir: 1},
+			cur:  pageCursor{Null: true},
+			want: bson.M{"$or": bson.A{
+				bson.M{"rating": nil, "_id": bson.M{"$gt": id}},
+				bson.M{"rating": bson.M{"$ne": nil}},
+			}},
+		},
+		{
+			name: "no value, down",
+			spec: sortSpec{field: "rating", dir: -1},
+			cur:  pageCursor{Null: true},
+			want: bson.M{"rating": nil, "_id": bson.M{"$lt": id}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.spec.after(tt.cur, id); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("after = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProductQueryFilter(t *testing.T) {
+	low, high := int64(100), int64(500)
+	four := uint8(4)
+
+	// a price list entry in the currency, else the base price when the
+	// product has no entry in it
+	priced := func(currency string, price bson.M) bson.M {
+		return bson.M{"$or": bson.A{
+			bson.M{"prices": bson.M{"$elemMatch": bson.M{"currency": currency, "amount": price}}},
+			bson.M{"price.currency": currency, "price.amount": price, "prices.currency": bson.M{"$ne": currency}},
+		}}
+	}
+
+	tests := []struct {
+		name  string
+		query ProductQuery
+		extra bson.M
+		want  bson.M
+	}{
+		{name: "everything", want: bson.M{}},
+		{
+			name:  "price range",
+			query: ProductQuery{MinPrice: &low, MaxPrice: &high},
+			want:  bson.M{"$and": bson.A{priced("USD", bson.M{"$gte": low, "$lte": high})}},
+		},
+		{
+			name:  "price range in another currency",
+			query: ProductQuery{MaxPrice: &high, Currency: "EUR"},
+			want:  bson.M{"$and": bson.A{priced("EUR", bson.M{"$lte": high})}},
+		},
+		{
+			name:  "all filters with the caller's",
+			query: ProductQuery{MinPrice: &low, MinRating: &four, Category: "shoes"},
+			extra: bson.M{"$text": bson.M{"$search": "red"}},
+			want: bson.M{"$and": bson.A{
+				bson.M{"$text": bson.M{"$search": "red"}},
+				priced("USD", bson.M{"$gte": low}),
+				bson.M{"rating": bson.M{"$gte": four}},
+				bson.M{"category": "shoes"},
+			}},
+		},
+		{
+			name:  "brand and the attributes of one variant",
+			query: ProductQuery{Brand: "acme", Attributes: map[string]string{"color": "red", "size": "42"}},
+			want: bson.M{"$and": bson.A{
+				bson.M{"brand": "acme"},
+				bson.M{"variants": bson.M{"$elemMatch": bson.M{"attributes.color": "red", "attributes.size": "42"}}},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.query.filter(tt.extra); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("filter = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestListProductsPages(t *testing.T) {
+	db := testDatabase(t)
+	ctx := context.Background()
+	products := db.Collection("Products")
+
+	price := func(p int64) money.Money { return money.New(p, "USD") }
+
+	// repeated prices and ratings, so pages have to break ties on _id
+	stock := []models.Product{
+		{Price: price(500), Rating: 3},
+		{Price: price(100), Rating: 5},
+		{Price: price(500), Rating: 5},
+		{Price: price(300), Rating: 1},
+		{Price: price(100), Rating: 3},
+		{Price: price(500), Rating: 3},
+		{Price: price(300), Rating: 5},
+	}
+
+	docs := make([]interface{}, len(stock))
+
+	for i := range stock {
+		stock[i].Product_ID = primitive.NewObjectID()
+		docs[i] = stock[i]
+	}
+
+	// and products never rated, 7 and 8
+	for i := 0; i < 2; i++ {
+		unrated := models.Product{Product_ID: primitive.NewObjectID(), Price: price(200)}
+		stock = append(stock, unrated)
+		docs = append(docs, bson.M{"_id": unrated.Product_ID, "price": unrated.Price})
+	}
+
+	if _, err := products.InsertMany(ctx, docs); err != nil {
+		t.Fatalf("InsertMany: %v", err)
+	}
+
+	tests := []struct {
+		sort string
+		want []int
+	}{
+		{sort: SortNewest, want: []int{8, 7, 6, 5, 4, 3, 2, 1, 0}},
+		{sort: SortPriceAsc, want: []int{1, 4, 7, 8, 3, 6, 0, 2, 5}},
+		{sort: SortPriceDesc, want: []int{5, 2, 0, 6, 3, 8, 7, 4, 1}},
+		{sort: SortRatingDesc, want: []int{6, 2, 1, 5, 4, 0, 3, 8, 7}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sort, func(t *testing.T) {
+			var got []primitive.ObjectID
+
+			q := ProductQuery{Sort: tt.sort, Limit: 2}
+
+			for pages := 0; ; pages++ {
+				if pages > len(stock) {
+					t.Fatal("the cursor never ran out")
+				}
+
+				page, next, err := ListProducts(ctx, products, q, nil)
+
+				if err != nil {
+					t.Fatalf("ListProducts: %v", err)
+				}
+
+				for _, p := range page {
+					got = append(got, p.Product_ID)
+				}
+
+				if next == "" {
+					break
+				}
+
+				q.Cursor = next
+			}
+
+			want := make([]primitive.ObjectID, len(tt.want))
+
+			for i, n := range tt.want {
+				want[i] = stock[n].Product_ID
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("pages hold %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestMigrateProductPrices(t *testing.T) {
+	db := testDatabase(t)
+	ctx := context.Background()
+	products := db.Collection("Products")
+
+	legacy, current := primitive.NewObjectID(), primitive.NewObjectID()
+
+	_, err := products.InsertMany(ctx, []interface{}{
+		bson.M{"_id": legacy, "price": 20},
+		bson.M{"_id": current, "price": bson.M{"amount": int64(1999), "currency": "EUR"}},
+	})
+
+	if err != nil {
+		t.Fatalf("InsertMany: %v", err)
+	}
+
+	if err = MigrateProductPrices(ctx, products); err != nil {
+		t.Fatalf("MigrateProductPrices: %v", err)
+	}
+
+	want := map[primitive.ObjectID]money.Money{
+		legacy:  money.New(2000, "USD"),
+		current: money.New(1999, "EUR"),
+	}
+
+	for id, price := range want {
+		// not money.Money, which would read a bare number just as well
+		var doc struct {
+			Price struct {
+				Amount   int64  `bson:"amount"`
+				Currency string `bson:"currency"`
+			} `bson:"price"`
+		}
+
+		if err = products.FindOne(ctx, bson.M{"_id": id}).Decode(&doc); err != nil {
+			t.Fatalf("FindOne: %v", err)
+		}
+
+		if got := money.New(doc.Price.Amount, doc.Price.Currency); got != price {
+			t.Errorf("price = %v, want %v", got, price)
+		}
+	}
+}
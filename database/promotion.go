@@ -0,0 +1,91 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/logging"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrCantFindPromotion = errors.New("can't find the promotion")
+	ErrCantSavePromotion = errors.New("cannot save the promotion")
+	ErrTotalsChanged     = errors.New("the cart total changed since it was displayed")
+)
+
+func CreatePromotion(ctx context.Context, promotionCollection *mongo.Collection, promotion models.Promotion) (models.Promotion, error) {
+	promotion.Promotion_ID = primitive.NewObjectID()
+	promotion.Created_At = time.Now()
+
+	if _, err := promotionCollection.InsertOne(ctx, promotion); err != nil {
+		logging.FromContext(ctx).Error("cannot save the promotion", "error", err)
+		return promotion, ErrCantSavePromotion
+	}
+
+	return promotion, nil
+}
+
+func ListPromotions(ctx context.Context, promotionCollection *mongo.Collection) ([]models.Promotion, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "priority", Value: -1}, {Key: "_id", Value: 1}})
+
+	return findPromotions(ctx, promotionCollection, bson.M{}, opts)
+}
+
+// ActivePromotions returns the promotions running at now.
+func ActivePromotions(ctx context.Context, promotionCollection *mongo.Collection, now time.Time) ([]models.Promotion, error) {
+	filter := bson.M{
+		"active": true,
+		"$and": bson.A{
+			bson.M{"$or": bson.A{bson.M{"starts_at": nil}, bson.M{"starts_at": bson.M{"$lte": now}}}},
+			bson.M{"$or": bson.A{bson.M{"ends_at": nil}, bson.M{"ends_at": bson.M{"$gt": now}}}},
+		},
+	}
+
+	return findPromotions(ctx, promotionCollection, filter, options.Find())
+}
+
+func findPromotions(
+	ctx context.Context,
+	promotionCollection *mongo.Collection,
+	filter bson.M,
+	opts *options.FindOptions,
+) ([]models.Promotion, error) {
+	cursor, err := promotionCollection.Find(ctx, filter, opts)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("can't find the promotion", "error", err)
+		return nil, ErrCantFindPromotion
+	}
+
+	defer cursor.Close(ctx)
+
+	promotions := make([]models.Promotion, 0)
+
+	if err = cursor.All(ctx, &promotions); err != nil {
+		logging.FromContext(ctx).Error("can't find the promotion", "error", err)
+		return nil, ErrCantFindPromotion
+	}
+
+	return promotions, nil
+}
+
+func SetPromotionActive(ctx context.Context, promotionCollection *mongo.Collection, promotionID primitive.ObjectID, active bool) error {
+	res, err := promotionCollection.UpdateByID(ctx, promotionID, bson.M{"$set": bson.M{"active": active}})
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot save the promotion", "error", err)
+		return ErrCantSavePromotion
+	}
+
+	if res.MatchedCount == 0 {
+		return ErrCantFindPromotion
+	}
+
+	return nil
+}
@@ -0,0 +1,49 @@
+package database
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+)
+
+func TestActivePromotions(t *testing.T) {
+	ctx := context.Background()
+	promotions := testDatabase(t).Collection("Promotions")
+	now := time.Now()
+	past, later := now.Add(-time.Hour), now.Add(time.Hour)
+
+	for _, promotion := range []models.Promotion{
+		{Name: "always", Active: true},
+		{Name: "switched off"},
+		{Name: "not started", Active: true, Starts_At: &later},
+		{Name: "ended", Active: true, Ends_At: &past},
+		{Name: "running", Active: true, Starts_At: &past, Ends_At: &later},
+	} {
+		promotion.Type = models.PromotionSpendThreshold
+
+		if _, err := CreatePromotion(ctx, promotions, promotion); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	active, err := ActivePromotions(ctx, promotions, now)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := make([]string, 0, len(active))
+
+	for _, promotion := range active {
+		names = append(names, promotion.Name)
+	}
+
+	sort.Strings(names)
+
+	if len(names) != 2 || names[0] != "always" || names[1] != "running" {
+		t.Errorf("active promotions %v, want [always running]", names)
+	}
+}
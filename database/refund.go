@@ -0,0 +1,334 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/logging"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/money"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/pricing"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrCantFindRefund    = errors.New("can't find the refunds")
+	ErrCantSaveRefund    = errors.New("cannot save the refund")
+	ErrInvalidRefundLine = errors.New("the lines must be items of the order, each listed once")
+	ErrRefundTooLarge    = errors.New("the refund is more than what is left to refund on this line")
+	ErrNothingToRefund   = errors.New("there is nothing left to refund")
+	ErrOrderCancelled    = errors.New("the order is cancelled")
+	ErrCantCancelOrder   = errors.New("the order can't be cancelled once it has shipped")
+	ErrRefundConflict    = errors.New("the order was refunded meanwhile, try again")
+	ErrOrderNotPaid      = errors.New("the order hasn't been paid for yet")
+)
+
+// RefundLine asks to refund one order line. Without an amount the line gets
+// back everything not refunded yet.
+type RefundLine struct {
+	Line   int          `json:"line"`
+	Amount *money.Money `json:"amount"`
+}
+
+type RefundRequest struct {
+	Lines []RefundLine `json:"lines"`
+	// Shipping refunds what is left of the shipping cost.
+	Shipping  bool                `json:"shipping"`
+	Reason    string              `json:"reason"`
+	Return_ID *primitive.ObjectID `json:"-"`
+}
+
+func ListRefunds(ctx context.Context, refundCollection *mongo.Collection, orderID primitive.ObjectID) ([]models.Refund, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}})
+
+	cursor, err := refundCollection.Find(ctx, bson.M{"order_id": orderID}, opts)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("can't find the refunds", "error", err)
+		return nil, ErrCantFindRefund
+	}
+
+	defer cursor.Close(ctx)
+
+	refunds := make([]models.Refund, 0)
+
+	if err = cursor.All(ctx, &refunds); err != nil {
+		logging.FromContext(ctx).Error("can't find the refunds", "error", err)
+		return nil, ErrCantFindRefund
+	}
+
+	return refunds, nil
+}
+
+// RefundOrder records a refund of order lines and, optionally, shipping
+// against the order's payment. A line is never refunded more than what was
+// paid for it, see pricing.LinesPaid, over all of its refunds. The order's
+// refunded total is only raised if it is still what the refunds read add
+// up to, so of two refunds made at once one gets ErrRefundConflict rather
+// than both spending what is left. Orders not paid yet, see Paid, get
+// ErrOrderNotPaid.
+func RefundOrder(
+	ctx context.Context,
+	userCollection *mongo.Collection,
+	refundCollection *mongo.Collection,
+	orderID primitive.ObjectID,
+	request RefundRequest,
+) (models.Refund, error) {
+	var refund models.Refund
+
+	userID, order, err := FindOrder(ctx, userCollection, orderID)
+
+	if err != nil {
+		return refund, err
+	}
+
+	if !Paid(order) {
+		return refund, ErrOrderNotPaid
+	}
+
+	previous, err := ListRefunds(ctx, refundCollection, orderID)
+
+	if err != nil {
+		return refund, err
+	}
+
+	currency := order.Price.Currency
+	paid := pricing.LinesPaid(order)
+	refunded := make([]int64, len(paid))
+	shippingRefunded := int64(0)
+	total := int64(0)
+
+	for _, r := range previous {
+		for _, line := range r.Lines {
+			if line.Line >= 0 && line.Line < len(refunded) {
+				refunded[line.Line] += line.Amount.Amount
+			}
+		}
+
+		shippingRefunded += r.Shipping.Amount
+		total += r.Amount.Amount
+	}
+
+	refund = models.Refund{
+		Refund_ID:      primitive.NewObjectID(),
+		Order_ID:       orderID,
+		User_ID:        userID,
+		Payment_ID:     order.Payment_Method.Payment_ID,
+		Payment_Method: order.Payment_Method,
+		Return_ID:      request.Return_ID,
+		Lines:          make([]models.LineDiscount, 0, len(request.Lines)),
+		Shipping:       money.Zero(currency),
+		Amount:         money.Zero(currency),
+		Reason:         request.Reason,
+		Created_At:     time.Now(),
+	}
+
+	seen := make(map[int]bool, len(request.Lines))
+
+	for _, line := range request.Lines {
+		if line.Line < 0 || line.Line >= len(paid) || seen[line.Line] {
+			return refund, ErrInvalidRefundLine
+		}
+
+		seen[line.Line] = true
+		left := paid[line.Line].Amount - refunded[line.Line]
+		amount := left
+
+		if line.Amount != nil {
+			if line.Amount.Currency != "" && line.Amount.Currency != currency {
+				return refund, money.ErrCurrencyMismatch
+			}
+
+			if line.Amount.Amount > left {
+				return refund, ErrRefundTooLarge
+			}
+
+			amount = line.Amount.Amount
+		}
+
+		if amount <= 0 {
+			continue
+		}
+
+		refund.Lines = append(refund.Lines, models.LineDiscount{
+			Line:       line.Line,
+			Product_ID: order.Order_Cart[line.Line].Product_ID,
+			Amount:     money.New(amount, currency),
+		})
+		refund.Amount.Amount += amount
+	}
+
+	if request.Shipping && order.Shipping != nil {
+		if left := order.Shipping.Cost.Amount - shippingRefunded; left > 0 {
+			refund.Shipping.Amount = left
+			refund.Amount.Amount += left
+		}
+	}
+
+	if refund.Amount.Amount == 0 {
+		return refund, ErrNothingToRefund
+	}
+
+	after := total + refund.Amount.Amount
+
+	result, err := userCollection.UpdateOne(ctx, refundedFilter(orderID, total), bson.M{
+		"$set": bson.M{"orders.$.refunded": money.New(after, currency)},
+	})
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot update the order", "error", err)
+		return refund, ErrCantUpdateOrder
+	}
+
+	if result.MatchedCount == 0 {
+		return refund, ErrRefundConflict
+	}
+
+	if _, err = refundCollection.InsertOne(ctx, refund); err != nil {
+		logging.FromContext(ctx).Error("cannot save the refund", "error", err)
+
+		// give the amount back to the order, unless another refund came
+		// since, so the total keeps matching the refunds
+		_, err = userCollection.UpdateOne(ctx, refundedFilter(orderID, after), bson.M{
+			"$set": bson.M{"orders.$.refunded": money.New(total, currency)},
+		})
+
+		if err != nil {
+			logging.FromContext(ctx).Error("cannot update the order", "error", err)
+		}
+
+		return refund, ErrCantSaveRefund
+	}
+
+	return refund, nil
+}
+
+// refundedFilter matches the order while its refunded total is amount.
+// Orders placed before refunds existed have none, which is 0.
+func refundedFilter(orderID primitive.ObjectID, amount int64) bson.M {
+	refunded := bson.M{"_id": orderID, "refunded.amount": amount}
+
+	if amount == 0 {
+		refunded["refunded.amount"] = bson.M{"$in": bson.A{nil, 0}}
+	}
+
+	return bson.M{"orders": bson.M{"$elemMatch": refunded}}
+}
+
+// Paid tells whether the buyer paid for the order yet: cash on delivery is
+// only captured once the order is delivered.
+func Paid(order models.Order) bool {
+	return !order.Payment_Method.COD || order.Status == models.OrderDelivered
+}
+
+// RefundAll refunds everything left on the order, shipping included.
+func RefundAll(
+	ctx context.Context,
+	userCollection *mongo.Collection,
+	refundCollection *mongo.Collection,
+	order models.Order,
+	request RefundRequest,
+) (models.Refund, error) {
+	request.Lines = make([]RefundLine, len(order.Order_Cart))
+
+	for i := range order.Order_Cart {
+		request.Lines[i] = RefundLine{Line: i}
+	}
+
+	request.Shipping = true
+
+	return RefundOrder(ctx, userCollection, refundCollection, order.Order_ID, request)
+}
+
+// CancelOrder cancels one of the user's orders before any of it has
+// shipped: parcels being packed are dropped, the stock and the coupon use
+// are given back and everything paid is refunded. The refund is nil when
+// nothing was paid.
+func CancelOrder(
+	ctx context.Context,
+	userCollection *mongo.Collection,
+	prodCollection *mongo.Collection,
+	shipmentCollection *mongo.Collection,
+	refundCollection *mongo.Collection,
+	couponCollection *mongo.Collection,
+	redemptionCollection *mongo.Collection,
+	userID string,
+	orderID primitive.ObjectID,
+) (*models.Refund, error) {
+	owner, order, err := FindOrder(ctx, userCollection, orderID)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if owner != userID {
+		return nil, ErrCantFindOrder
+	}
+
+	if order.Status == models.OrderCancelled {
+		return nil, ErrOrderCancelled
+	}
+
+	// the status only leaves placed once a shipment is on its way, and the
+	// filter keeps a shipment marked meanwhile from being cancelled
+	filter := bson.M{"orders": bson.M{"$elemMatch": bson.M{"_id": orderID, "status": models.OrderPlaced}}}
+	update := bson.M{"$set": bson.M{
+		"orders.$.status":       models.OrderCancelled,
+		"orders.$.cancelled_at": time.Now(),
+	}}
+
+	result, err := userCollection.UpdateOne(ctx, filter, update)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot update the order", "error", err)
+		return nil, ErrCantUpdateOrder
+	}
+
+	if result.MatchedCount == 0 {
+		return nil, ErrCantCancelOrder
+	}
+
+	if _, err = shipmentCollection.DeleteMany(ctx, bson.M{"order_id": orderID, "status": models.ShipmentPending}); err != nil {
+		logging.FromContext(ctx).Error("cannot drop the pending shipments", "error", err)
+	}
+
+	lines := make([]int, len(order.Order_Cart))
+
+	for i := range lines {
+		lines[i] = i
+	}
+
+	if err = Restock(ctx, prodCollection, order, lines); err != nil {
+		logging.FromContext(ctx).Error("cannot restock the order", "error", err)
+	}
+
+	var redemption models.CouponRedemption
+
+	err = redemptionCollection.FindOne(ctx, bson.M{"order_id": orderID}).Decode(&redemption)
+
+	if err == nil {
+		ReleaseCoupon(ctx, couponCollection, redemptionCollection, redemption)
+	} else if !errors.Is(err, mongo.ErrNoDocuments) {
+		logging.FromContext(ctx).Error("cannot find the coupon redemption", "error", err)
+	}
+
+	if !Paid(order) {
+		return nil, nil
+	}
+
+	refund, err := RefundAll(ctx, userCollection, refundCollection, order, RefundRequest{Reason: "cancelled"})
+
+	if errors.Is(err, ErrNothingToRefund) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &refund, nil
+}
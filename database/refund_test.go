@@ -0,0 +1,431 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/money"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// paidOrder is a placed order of two lines, 10.00 and 5.00 USD, with 3.00
+// USD shipping, paid by card.
+func paidOrder(status string, products ...primitive.ObjectID) models.Order {
+	order := models.Order{
+		Order_ID:       primitive.NewObjectID(),
+		Price:          money.New(1800, "USD"),
+		Currency:       "USD",
+		Payment_Method: models.Payment{Payment_ID: primitive.NewObjectID(), Digital: true},
+		Shipping:       &models.ShippingQuote{Cost: money.New(300, "USD")},
+		Status:         status,
+	}
+
+	for i, amount := range []int64{1000, 500} {
+		line := models.ProductUser{Product_ID: primitive.NewObjectID(), Price: money.New(amount, "USD")}
+
+		if i < len(products) {
+			line.Product_ID = products[i]
+		}
+
+		order.Order_Cart = append(order.Order_Cart, line)
+	}
+
+	return order
+}
+
+// placeOrders stores a user with the orders and returns the user's id.
+func placeOrders(t *testing.T, userCollection *mongo.Collection, orders ...models.Order) string {
+	t.Helper()
+
+	user := models.User{ID: primitive.NewObjectID(), Order_Status: orders}
+	user.User_ID = user.ID.Hex()
+
+	if _, err := userCollection.InsertOne(context.Background(), user); err != nil {
+		t.Fatalf("InsertOne: %v", err)
+	}
+
+	return user.User_ID
+}
+
+func TestRefundOrder(t *testing.T) {
+	db := testDatabase(t)
+	ctx := context.Background()
+	users, refunds := db.Collection("Users"), db.Collection("Refunds")
+
+	order := paidOrder(models.OrderDelivered)
+	placeOrders(t, users, order)
+
+	amount := func(a int64, currency string) *money.Money {
+		m := money.New(a, currency)
+		return &m
+	}
+
+	steps := []struct {
+		name    string
+		request RefundRequest
+		want    int64
+		err     error
+	}{
+		{name: "part of a line", request: RefundRequest{Lines: []RefundLine{{Line: 0, Amount: amount(400, "USD")}}}, want: 400},
+		{name: "more than is left", request: RefundRequest{Lines: []RefundLine{{Line: 0, Amount: amount(700, "USD")}}}, err: ErrRefundTooLarge},
+		{name: "the rest of the line", request: RefundRequest{Lines: []RefundLine{{Line: 0}}}, want: 600},
+		{name: "a line with nothing left", request: RefundRequest{Lines: []RefundLine{{Line: 0}}}, err: ErrNothingToRefund},
+		{name: "a line twice", request: RefundRequest{Lines: []RefundLine{{Line: 1}, {Line: 1}}}, err: ErrInvalidRefundLine},
+		{name: "no such line", request: RefundRequest{Lines: []RefundLine{{Line: 2}}}, err: ErrInvalidRefundLine},
+		{name: "another currency", request: RefundRequest{Lines: []RefundLine{{Line: 1, Amount: amount(100, "EUR")}}}, err: money.ErrCurrencyMismatch},
+		{name: "shipping", request: RefundRequest{Shipping: true}, want: 300},
+		{name: "shipping again", request: RefundRequest{Shipping: true}, err: ErrNothingToRefund},
+	}
+
+	for _, step := range steps {
+		refund, err := RefundOrder(ctx, users, refunds, order.Order_ID, step.request)
+
+		if !errors.Is(err, step.err) {
+			t.Fatalf("%s: err = %v, want %v", step.name, err, step.err)
+		}
+
+		if err == nil && refund.Amount != money.New(step.want, "USD") {
+			t.Errorf("%s: refunded %v, want %d USD", step.name, refund.Amount, step.want)
+		}
+
+		if err == nil && refund.Payment_ID != order.Payment_Method.Payment_ID {
+			t.Errorf("%s: refunded against %v, want the order's payment", step.name, refund.Payment_ID)
+		}
+	}
+
+	_, stored, err := FindOrder(ctx, users, order.Order_ID)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stored.Refunded != money.New(1300, "USD") {
+		t.Errorf("order refunded %v, want 13.00 USD", stored.Refunded)
+	}
+
+	// what is left of the order, and nothing after that
+	all, err := RefundAll(ctx, users, refunds, stored, RefundRequest{Reason: "goodwill"})
+
+	if err != nil || all.Amount != money.New(500, "USD") {
+		t.Errorf("RefundAll() = %v, %v, want 5.00 USD", all.Amount, err)
+	}
+
+	if _, err = RefundAll(ctx, users, refunds, stored, RefundRequest{}); !errors.Is(err, ErrNothingToRefund) {
+		t.Errorf("refunding all twice: err = %v, want %v", err, ErrNothingToRefund)
+	}
+}
+
+func TestRefundConflict(t *testing.T) {
+	db := testDatabase(t)
+	ctx := context.Background()
+	users, refunds := db.Collection("Users"), db.Collection("Refunds")
+
+	order := paidOrder(models.OrderDelivered)
+	placeOrders(t, users, order)
+
+	// a refund that raised the total but isn't listed yet
+	update := bson.M{"$set": bson.M{"orders.$.refunded": money.New(100, "USD")}}
+
+	if _, err := users.UpdateOne(ctx, bson.M{"orders._id": order.Order_ID}, update); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := RefundOrder(ctx, users, refunds, order.Order_ID, RefundRequest{Shipping: true}); !errors.Is(err, ErrRefundConflict) {
+		t.Errorf("err = %v, want %v", err, ErrRefundConflict)
+	}
+
+	if count, _ := refunds.CountDocuments(ctx, bson.M{"order_id": order.Order_ID}); count != 0 {
+		t.Errorf("%d refunds saved on a conflict", count)
+	}
+}
+
+func TestRefundUnpaidOrder(t *testing.T) {
+	db := testDatabase(t)
+	ctx := context.Background()
+	users, refunds := db.Collection("Users"), db.Collection("Refunds")
+
+	order := paidOrder(models.OrderShipped)
+	order.Payment_Method = models.Payment{Payment_ID: primitive.NewObjectID(), COD: true}
+	placeOrders(t, users, order)
+
+	if _, err := RefundOrder(ctx, users, refunds, order.Order_ID, RefundRequest{Shipping: true}); !errors.Is(err, ErrOrderNotPaid) {
+		t.Errorf("err = %v, want %v", err, ErrOrderNotPaid)
+	}
+
+	if count, _ := refunds.CountDocuments(ctx, bson.M{"order_id": order.Order_ID}); count != 0 {
+		t.Errorf("%d refunds saved for an unpaid order", count)
+	}
+}
+
+func TestPaid(t *testing.T) {
+	tests := []struct {
+		name    string
+		payment models.Payment
+		status  string
+		want    bool
+	}{
+		{name: "card", payment: models.Payment{Digital: true}, status: models.OrderPlaced, want: true},
+		{name: "card, cancelled", payment: models.Payment{Digital: true}, status: models.OrderCancelled, want: true},
+		{name: "cash on delivery, placed", payment: models.Payment{COD: true}, status: models.OrderPlaced, want: false},
+		{name: "cash on delivery, shipped", payment: models.Payment{COD: true}, status: models.OrderShipped, want: false},
+		{name: "cash on delivery, cancelled", payment: models.Payment{COD: true}, status: models.OrderCancelled, want: false},
+		{name: "cash on delivery, delivered", payment: models.Payment{COD: true}, status: models.OrderDelivered, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := models.Order{Payment_Method: tt.payment, Status: tt.status}
+
+			if got := Paid(order); got != tt.want {
+				t.Errorf("Paid() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRefundedFilter(t *testing.T) {
+	orderID := primitive.NewObjectID()
+
+	tests := []struct {
+		amount int64
+		want   interface{}
+	}{
+		{amount: 0, want: bson.M{"$in": bson.A{nil, 0}}},
+		{amount: 1250, want: int64(1250)},
+	}
+
+	for _, tt := range tests {
+		match := refundedFilter(orderID, tt.amount)["orders"].(bson.M)["$elemMatch"].(bson.M)
+
+		if match["_id"] != orderID {
+			t.Errorf("refundedFilter(%d) matches order %v", tt.amount, match["_id"])
+		}
+
+		if !reflect.DeepEqual(match["refunded.amount"], tt.want) {
+			t.Errorf("refundedFilter(%d) matches refunded %#v, want %#v", tt.amount, match["refunded.amount"], tt.want)
+		}
+	}
+}
+
+func TestRestock(t *testing.T) {
+	db := testDatabase(t)
+	ctx := context.Background()
+	products := db.Collection("Products")
+
+	counted, uncounted := primitive.NewObjectID(), primitive.NewObjectID()
+
+	_, err := products.InsertMany(ctx, []interface{}{
+		bson.M{"_id": counted, "stock": 5},
+		bson.M{"_id": uncounted},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	order := paidOrder(models.OrderDelivered, counted, uncounted)
+	order.Order_Cart = append(order.Order_Cart, order.Order_Cart[0])
+
+	if err = Restock(ctx, products, order, []int{0, 1, 2, 7}); err != nil {
+		t.Fatalf("Restock: %v", err)
+	}
+
+	var doc bson.M
+
+	if err = products.FindOne(ctx, bson.M{"_id": counted}).Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+
+	if stock, _ := numberToInt64(doc["stock"]); stock != 7 {
+		t.Errorf("stock = %v, want 7", doc["stock"])
+	}
+
+	var other bson.M
+
+	if err = products.FindOne(ctx, bson.M{"_id": uncounted}).Decode(&other); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := other["stock"]; ok {
+		t.Errorf("an uncounted product got stock %v", other["stock"])
+	}
+}
+
+func TestCancelOrder(t *testing.T) {
+	db := testDatabase(t)
+	ctx := context.Background()
+	users, products, shipments, refunds := db.Collection("Users"), db.Collection("Products"), db.Collection("Shipments"), db.Collection("Refunds")
+	coupons, redemptions := db.Collection("Coupons"), db.Collection("CouponRedemptions")
+
+	productID := primitive.NewObjectID()
+
+	if _, err := products.InsertOne(ctx, bson.M{"_id": productID, "stock": 4}); err != nil {
+		t.Fatal(err)
+	}
+
+	placed := paidOrder(models.OrderPlaced, productID)
+	shipped := paidOrder(models.OrderShipped)
+	cod := paidOrder(models.OrderPlaced)
+	cod.Payment_Method = models.Payment{COD: true}
+	userID := placeOrders(t, users, placed, shipped, cod)
+
+	if _, err := CreateCoupon(ctx, coupons, models.Coupon{Code: "ONCE", Type: models.CouponPercentage, Percent: 10, Max_Uses: 1, Active: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := RedeemCoupon(ctx, coupons, redemptions, "ONCE", userID, placed.Order_ID, money.New(100, "USD")); err != nil {
+		t.Fatal(err)
+	}
+
+	packing := models.Shipment{Shipment_ID: primitive.NewObjectID(), Order_ID: placed.Order_ID, Lines: []int{0}, Status: models.ShipmentPending}
+
+	if _, err := shipments.InsertOne(ctx, packing); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := CancelOrder(ctx, users, products, shipments, refunds, coupons, redemptions, primitive.NewObjectID().Hex(), placed.Order_ID); !errors.Is(err, ErrCantFindOrder) {
+		t.Errorf("someone else's order: err = %v, want %v", err, ErrCantFindOrder)
+	}
+
+	refund, err := CancelOrder(ctx, users, products, shipments, refunds, coupons, redemptions, userID, placed.Order_ID)
+
+	if err != nil {
+		t.Fatalf("CancelOrder: %v", err)
+	}
+
+	if refund == nil || refund.Amount != money.New(1800, "USD") {
+		t.Errorf("refund = %+v, want everything paid back", refund)
+	}
+
+	if _, order, _ := FindOrder(ctx, users, placed.Order_ID); order.Status != models.OrderCancelled || order.Cancelled_At == nil {
+		t.Errorf("order is %q, cancelled at %v", order.Status, order.Cancelled_At)
+	}
+
+	if count, _ := shipments.CountDocuments(ctx, bson.M{"order_id": placed.Order_ID}); count != 0 {
+		t.Errorf("%d shipments left for a cancelled order", count)
+	}
+
+	var product bson.M
+
+	if err = products.FindOne(ctx, bson.M{"_id": productID}).Decode(&product); err != nil {
+		t.Fatal(err)
+	}
+
+	if stock, _ := numberToInt64(product["stock"]); stock != 5 {
+		t.Errorf("stock = %v, want the cancelled line back", product["stock"])
+	}
+
+	if coupon, _ := FindCouponByCode(ctx, coupons, "ONCE"); coupon.Uses != 0 {
+		t.Errorf("coupon uses = %d, want the use given back", coupon.Uses)
+	}
+
+	if _, err = CancelOrder(ctx, users, products, shipments, refunds, coupons, redemptions, userID, placed.Order_ID); !errors.Is(err, ErrOrderCancelled) {
+		t.Errorf("cancelling twice: err = %v, want %v", err, ErrOrderCancelled)
+	}
+
+	if _, err = CancelOrder(ctx, users, products, shipments, refunds, coupons, redemptions, userID, shipped.Order_ID); !errors.Is(err, ErrCantCancelOrder) {
+		t.Errorf("cancelling a shipped order: err = %v, want %v", err, ErrCantCancelOrder)
+	}
+
+	if refund, err = CancelOrder(ctx, users, products, shipments, refunds, coupons, redemptions, userID, cod.Order_ID); err != nil || refund != nil {
+		t.Errorf("cancelling an unpaid order = %+v, %v, want no refund", refund, err)
+	}
+}
+
+func TestReturnFlow(t *testing.T) {
+	db := testDatabase(t)
+	ctx := context.Background()
+	users, products, shipments := db.Collection("Users"), db.Collection("Products"), db.Collection("Shipments")
+	returns, refunds := db.Collection("Returns"), db.Collection("Refunds")
+
+	productID := primitive.NewObjectID()
+
+	if _, err := products.InsertOne(ctx, bson.M{"_id": productID, "stock": 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	order := paidOrder(models.OrderPartiallyShipped, productID)
+	userID := placeOrders(t, users, order)
+
+	delivered := models.Shipment{Shipment_ID: primitive.NewObjectID(), Order_ID: order.Order_ID, Lines: []int{0}, Status: models.ShipmentDelivered}
+
+	if _, err := shipments.InsertOne(ctx, delivered); err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(lines ...int) (models.Return, error) {
+		return RequestReturn(ctx, users, shipments, returns, userID, models.Return{Order_ID: order.Order_ID, Lines: lines, Reason: "damaged"})
+	}
+
+	if _, err := request(1); !errors.Is(err, ErrInvalidReturnLine) {
+		t.Errorf("an undelivered line: err = %v, want %v", err, ErrInvalidReturnLine)
+	}
+
+	first, err := request(0)
+
+	if err != nil {
+		t.Fatalf("RequestReturn: %v", err)
+	}
+
+	if _, err = request(0); !errors.Is(err, ErrInvalidReturnLine) {
+		t.Errorf("a line in an open return: err = %v, want %v", err, ErrInvalidReturnLine)
+	}
+
+	if _, err = DecideReturn(ctx, returns, first.Return_ID, false, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// a rejected return frees its lines
+	second, err := request(0)
+
+	if err != nil {
+		t.Fatalf("RequestReturn after a rejection: %v", err)
+	}
+
+	if _, _, err = ReceiveReturn(ctx, users, products, returns, refunds, second.Return_ID, true); !errors.Is(err, ErrReturnState) {
+		t.Errorf("receiving an unapproved return: err = %v, want %v", err, ErrReturnState)
+	}
+
+	if _, err = DecideReturn(ctx, returns, second.Return_ID, true, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	received, refund, err := ReceiveReturn(ctx, users, products, returns, refunds, second.Return_ID, true)
+
+	if err != nil {
+		t.Fatalf("ReceiveReturn: %v", err)
+	}
+
+	if received.Status != models.ReturnReceived || !received.Restocked || received.Refund_ID == nil {
+		t.Errorf("received %+v", received)
+	}
+
+	if refund == nil || refund.Refund_ID != *received.Refund_ID {
+		t.Errorf("refund = %+v, want the one the return points to", refund)
+	}
+
+	var product bson.M
+
+	if err = products.FindOne(ctx, bson.M{"_id": productID}).Decode(&product); err != nil {
+		t.Fatal(err)
+	}
+
+	if stock, _ := numberToInt64(product["stock"]); stock != 2 {
+		t.Errorf("stock = %v, want 2", product["stock"])
+	}
+
+	list, err := ListRefunds(ctx, refunds, order.Order_ID)
+
+	if err != nil || len(list) != 1 || list[0].Amount != money.New(1000, "USD") {
+		t.Errorf("refunds = %+v, %v, want the returned line's 10.00 USD", list, err)
+	}
+
+	if _, err = DecideReturn(ctx, returns, primitive.NewObjectID(), true, nil); !errors.Is(err, ErrCantFindReturn) {
+		t.Errorf("missing return: err = %v, want %v", err, ErrCantFindReturn)
+	}
+}
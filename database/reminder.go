@@ -0,0 +1,280 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/logging"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/notification"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrCantFindReminder = errors.New("can't find the cart reminder")
+	ErrCantSaveReminder = errors.New("cannot save the cart reminder")
+	ErrCantScanCarts    = errors.New("cannot look for abandoned carts")
+)
+
+// ReminderAttribution is how long after a reminder a checkout still counts
+// as converted by it.
+var ReminderAttribution = 7 * 24 * time.Hour
+
+func EnsureReminderIndexes(ctx context.Context, reminderCollection *mongo.Collection) error {
+	_, err := reminderCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "token", Value: 1}},
+			Options: options.Index().SetName("reminder_token").SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "sent_at", Value: -1}},
+			Options: options.Index().SetName("reminder_user"),
+		},
+	})
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot create the indexes", "error", err)
+		return ErrCantCreateIndex
+	}
+
+	return nil
+}
+
+// notReminded matches carts not reminded of since they last changed.
+var notReminded = bson.A{
+	bson.M{"reminded_at": bson.M{"$exists": false}},
+	bson.M{"$expr": bson.M{"$lt": bson.A{"$reminded_at", "$updated_at"}}},
+}
+
+// RemindAbandonedCarts sends a reminder with a restore link for each cart
+// with items that hasn't changed for idleFor, once per time it is left.
+// The link is restoreURL with the reminder's token in ?token=. It returns
+// how many reminders went out.
+func RemindAbandonedCarts(
+	ctx context.Context,
+	cartCollection *mongo.Collection,
+	reminderCollection *mongo.Collection,
+	notifier notification.Notifier,
+	idleFor time.Duration,
+	restoreURL string,
+) (int, error) {
+	filter := bson.M{
+		"items.0":    bson.M{"$exists": true},
+		"updated_at": bson.M{"$lte": time.Now().Add(-idleFor)},
+		"$or":        notReminded,
+	}
+
+	cursor, err := cartCollection.Find(ctx, filter)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot look for abandoned carts", "error", err)
+		return 0, ErrCantScanCarts
+	}
+
+	defer cursor.Close(ctx)
+
+	sent := 0
+
+	for cursor.Next(ctx) {
+		var cart models.Cart
+
+		if err = cursor.Decode(&cart); err != nil {
+			logging.FromContext(ctx).Error("cannot look for abandoned carts", "error", err)
+			return sent, ErrCantScanCarts
+		}
+
+		now := time.Now()
+
+		// claiming the cart keeps another instance from reminding of it too,
+		// and skips it if it changed since it was read
+		claim := bson.M{"_id": cart.Cart_ID, "updated_at": cart.Updated_At, "$or": notReminded}
+
+		result, err := cartCollection.UpdateOne(ctx, claim, bson.M{"$set": bson.M{"reminded_at": now}})
+
+		if err != nil {
+			logging.FromContext(ctx).Error("cannot look for abandoned carts", "error", err)
+			return sent, ErrCantScanCarts
+		}
+
+		if result.MatchedCount == 0 {
+			continue
+		}
+
+		token, err := randomToken()
+
+		if err != nil {
+			logging.FromContext(ctx).Error("cannot save the cart reminder", "error", err)
+			return sent, ErrCantSaveReminder
+		}
+
+		reminder := models.CartReminder{
+			Reminder_ID: primitive.NewObjectID(),
+			Cart_ID:     cart.Cart_ID,
+			User_ID:     cart.User_ID,
+			Items:       cart.Items,
+			Token:       token,
+			Sent_At:     now,
+		}
+
+		if _, err = reminderCollection.InsertOne(ctx, reminder); err != nil {
+			logging.FromContext(ctx).Error("cannot save the cart reminder", "error", err)
+			return sent, ErrCantSaveReminder
+		}
+
+		event := notification.Event{
+			Kind:    notification.AbandonedCart,
+			User_ID: cart.User_ID,
+			Data: map[string]string{
+				"restore_url": restoreURL + "?token=" + token,
+				"item_count":  strconv.Itoa(len(cart.Items)),
+				"first_item":  productName(cart.Items[0]),
+			},
+			Created_At: now,
+		}
+
+		if err = notifier.Notify(ctx, event); err != nil {
+			logging.FromContext(ctx).Error("cannot send the cart reminder", "error", err)
+			continue
+		}
+
+		sent++
+	}
+
+	if err = cursor.Err(); err != nil {
+		logging.FromContext(ctx).Error("cannot look for abandoned carts", "error", err)
+		return sent, ErrCantScanCarts
+	}
+
+	return sent, nil
+}
+
+// RestoreCart follows the restore link of a reminder: the first use is
+// recorded, and an empty cart gets the reminded items back. A cart that has
+// items again is left as it is.
+func RestoreCart(
+	ctx context.Context,
+	cartCollection *mongo.Collection,
+	reminderCollection *mongo.Collection,
+	token string,
+) (models.CartReminder, error) {
+	var reminder models.CartReminder
+
+	if token == "" {
+		return reminder, ErrCantFindReminder
+	}
+
+	err := reminderCollection.FindOne(ctx, bson.M{"token": token}).Decode(&reminder)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return reminder, ErrCantFindReminder
+	}
+
+	if err != nil {
+		logging.FromContext(ctx).Error("can't find the cart reminder", "error", err)
+		return reminder, ErrCantFindReminder
+	}
+
+	now := time.Now()
+
+	if reminder.Restored_At == nil {
+		filter := bson.M{"_id": reminder.Reminder_ID, "restored_at": bson.M{"$exists": false}}
+
+		if _, err = reminderCollection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"restored_at": now}}); err != nil {
+			logging.FromContext(ctx).Error("cannot save the cart reminder", "error", err)
+			return reminder, ErrCantSaveReminder
+		}
+
+		reminder.Restored_At = &now
+	}
+
+	filter := bson.M{"user_id": reminder.User_ID, "items.0": bson.M{"$exists": false}}
+	update := bson.M{"$set": bson.M{"items": reminder.Items, "updated_at": now}}
+
+	if _, err = cartCollection.UpdateOne(ctx, filter, update); err != nil {
+		logging.FromContext(ctx).Error("cannot add this product to the cart", "error", err)
+		return reminder, ErrCantUpdateUser
+	}
+
+	return reminder, nil
+}
+
+// RecordCartConversion credits the user's latest reminder sent within
+// ReminderAttribution with the order placed from their cart.
+func RecordCartConversion(
+	ctx context.Context,
+	reminderCollection *mongo.Collection,
+	userID string,
+	orderID primitive.ObjectID,
+) error {
+	now := time.Now()
+
+	filter := bson.M{
+		"user_id":      userID,
+		"sent_at":      bson.M{"$gte": now.Add(-ReminderAttribution)},
+		"converted_at": bson.M{"$exists": false},
+	}
+	update := bson.M{"$set": bson.M{"converted_at": now, "order_id": orderID}}
+	opts := options.FindOneAndUpdate().SetSort(bson.D{{Key: "sent_at", Value: -1}})
+
+	err := reminderCollection.FindOneAndUpdate(ctx, filter, update, opts).Err()
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil
+	}
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot save the cart reminder", "error", err)
+		return ErrCantSaveReminder
+	}
+
+	return nil
+}
+
+// ReminderStats sums up the reminders sent since a time.
+type ReminderStats struct {
+	Sent            int64   `json:"sent"`
+	Restored        int64   `json:"restored"`
+	Converted       int64   `json:"converted"`
+	Conversion_Rate float64 `json:"conversion_rate"`
+}
+
+func CartReminderStats(ctx context.Context, reminderCollection *mongo.Collection, since time.Time) (ReminderStats, error) {
+	var stats ReminderStats
+
+	counts := []struct {
+		field *int64
+		extra string
+	}{
+		{&stats.Sent, ""},
+		{&stats.Restored, "restored_at"},
+		{&stats.Converted, "converted_at"},
+	}
+
+	for _, count := range counts {
+		filter := bson.M{"sent_at": bson.M{"$gte": since}}
+
+		if count.extra != "" {
+			filter[count.extra] = bson.M{"$exists": true}
+		}
+
+		n, err := reminderCollection.CountDocuments(ctx, filter)
+
+		if err != nil {
+			logging.FromContext(ctx).Error("can't find the cart reminder", "error", err)
+			return stats, ErrCantFindReminder
+		}
+
+		*count.field = n
+	}
+
+	if stats.Sent > 0 {
+		stats.Conversion_Rate = float64(stats.Converted) / float64(stats.Sent)
+	}
+
+	return stats, nil
+}
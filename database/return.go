@@ -0,0 +1,281 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/logging"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrCantFindReturn    = errors.New("can't find the return")
+	ErrCantSaveReturn    = errors.New("cannot save the return")
+	ErrInvalidReturnLine = errors.New("the lines must be delivered items of the order that are not in another return")
+	ErrReturnState       = errors.New("the return can't move to this status from its current one")
+)
+
+func EnsureRefundIndexes(ctx context.Context, returnCollection, refundCollection *mongo.Collection) error {
+	_, err := returnCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "order_id", Value: 1}},
+			Options: options.Index().SetName("return_order"),
+		},
+		{
+			Keys:    bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: 1}},
+			Options: options.Index().SetName("return_status"),
+		},
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}},
+			Options: options.Index().SetName("return_user"),
+		},
+	})
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot create the indexes", "error", err)
+		return ErrCantCreateIndex
+	}
+
+	_, err = refundCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "order_id", Value: 1}},
+		Options: options.Index().SetName("refund_order"),
+	})
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot create the indexes", "error", err)
+		return ErrCantCreateIndex
+	}
+
+	return nil
+}
+
+// RequestReturn opens a return of delivered lines of one of the user's
+// orders. A line can only be in one return unless that one was rejected.
+func RequestReturn(
+	ctx context.Context,
+	userCollection *mongo.Collection,
+	shipmentCollection *mongo.Collection,
+	returnCollection *mongo.Collection,
+	userID string,
+	request models.Return,
+) (models.Return, error) {
+	owner, order, err := FindOrder(ctx, userCollection, request.Order_ID)
+
+	if err != nil {
+		return request, err
+	}
+
+	if owner != userID {
+		return request, ErrCantFindOrder
+	}
+
+	if order.Status == models.OrderCancelled {
+		return request, ErrOrderCancelled
+	}
+
+	shipments, err := ListShipments(ctx, shipmentCollection, request.Order_ID)
+
+	if err != nil {
+		return request, err
+	}
+
+	returnable := make(map[int]bool)
+
+	for _, shipment := range shipments {
+		if shipment.Status == models.ShipmentDelivered {
+			for _, line := range shipment.Lines {
+				returnable[line] = true
+			}
+		}
+	}
+
+	open, err := ListReturns(ctx, returnCollection, bson.M{
+		"order_id": request.Order_ID,
+		"status":   bson.M{"$ne": models.ReturnRejected},
+	})
+
+	if err != nil {
+		return request, err
+	}
+
+	for _, ret := range open {
+		for _, line := range ret.Lines {
+			returnable[line] = false
+		}
+	}
+
+	for _, line := range request.Lines {
+		if !returnable[line] {
+			return request, ErrInvalidReturnLine
+		}
+
+		returnable[line] = false
+	}
+
+	request.Return_ID = primitive.NewObjectID()
+	request.User_ID = userID
+	request.Status = models.ReturnRequested
+	request.Note = nil
+	request.Restocked = false
+	request.Refund_ID = nil
+	request.Created_At = time.Now()
+	request.Updated_At = request.Created_At
+
+	if _, err = returnCollection.InsertOne(ctx, request); err != nil {
+		logging.FromContext(ctx).Error("cannot save the return", "error", err)
+		return request, ErrCantSaveReturn
+	}
+
+	return request, nil
+}
+
+// ListReturns lists the returns matching filter, oldest first.
+func ListReturns(ctx context.Context, returnCollection *mongo.Collection, filter bson.M) ([]models.Return, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+
+	cursor, err := returnCollection.Find(ctx, filter, opts)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("can't find the return", "error", err)
+		return nil, ErrCantFindReturn
+	}
+
+	defer cursor.Close(ctx)
+
+	returns := make([]models.Return, 0)
+
+	if err = cursor.All(ctx, &returns); err != nil {
+		logging.FromContext(ctx).Error("can't find the return", "error", err)
+		return nil, ErrCantFindReturn
+	}
+
+	return returns, nil
+}
+
+// advanceReturn moves a return from one status to the next in a single
+// conditional update, like advanceShipment.
+func advanceReturn(
+	ctx context.Context,
+	returnCollection *mongo.Collection,
+	returnID primitive.ObjectID,
+	from string,
+	set bson.M,
+) (models.Return, error) {
+	var ret models.Return
+
+	set["updated_at"] = time.Now()
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	err := returnCollection.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": returnID, "status": from},
+		bson.M{"$set": set},
+		opts,
+	).Decode(&ret)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		count, err := returnCollection.CountDocuments(ctx, bson.M{"_id": returnID})
+
+		if err == nil && count == 0 {
+			return ret, ErrCantFindReturn
+		}
+
+		return ret, ErrReturnState
+	}
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot save the return", "error", err)
+		return ret, ErrCantSaveReturn
+	}
+
+	return ret, nil
+}
+
+// DecideReturn approves or rejects a requested return, with an optional
+// note for the customer.
+func DecideReturn(
+	ctx context.Context,
+	returnCollection *mongo.Collection,
+	returnID primitive.ObjectID,
+	approve bool,
+	note *string,
+) (models.Return, error) {
+	status := models.ReturnRejected
+
+	if approve {
+		status = models.ReturnApproved
+	}
+
+	return advanceReturn(ctx, returnCollection, returnID, models.ReturnRequested, bson.M{"status": status, "note": note})
+}
+
+// ReceiveReturn records that the goods of an approved return came back:
+// with restock they go back in stock, and the lines are refunded for what is
+// left of what was paid for them. The refund is nil when nothing was left.
+func ReceiveReturn(
+	ctx context.Context,
+	userCollection *mongo.Collection,
+	prodCollection *mongo.Collection,
+	returnCollection *mongo.Collection,
+	refundCollection *mongo.Collection,
+	returnID primitive.ObjectID,
+	restock bool,
+) (models.Return, *models.Refund, error) {
+	ret, err := advanceReturn(ctx, returnCollection, returnID, models.ReturnApproved, bson.M{
+		"status":    models.ReturnReceived,
+		"restocked": restock,
+	})
+
+	if err != nil {
+		return ret, nil, err
+	}
+
+	_, order, err := FindOrder(ctx, userCollection, ret.Order_ID)
+
+	if err != nil {
+		return ret, nil, err
+	}
+
+	if restock {
+		if err = Restock(ctx, prodCollection, order, ret.Lines); err != nil {
+			return ret, nil, err
+		}
+	}
+
+	lines := make([]RefundLine, len(ret.Lines))
+
+	for i, line := range ret.Lines {
+		lines[i] = RefundLine{Line: line}
+	}
+
+	refund, err := RefundOrder(ctx, userCollection, refundCollection, ret.Order_ID, RefundRequest{
+		Lines:     lines,
+		Reason:    ret.Reason,
+		Return_ID: &ret.Return_ID,
+	})
+
+	// staff may have refunded the lines by hand already, and a cash on
+	// delivery order not delivered in full hasn't been paid for
+	if errors.Is(err, ErrNothingToRefund) || errors.Is(err, ErrOrderNotPaid) {
+		return ret, nil, nil
+	}
+
+	if err != nil {
+		return ret, nil, err
+	}
+
+	ret.Refund_ID = &refund.Refund_ID
+
+	if _, err = returnCollection.UpdateByID(ctx, ret.Return_ID, bson.M{"$set": bson.M{"refund_id": refund.Refund_ID}}); err != nil {
+		logging.FromContext(ctx).Error("cannot save the return", "error", err)
+		return ret, nil, ErrCantSaveReturn
+	}
+
+	return ret, &refund, nil
+}
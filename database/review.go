@@ -0,0 +1,284 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/logging"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrNotDelivered       = errors.New("only customers with a delivered order of this product can review it")
+	ErrCantFindReview     = errors.New("can't find the review")
+	ErrCantSaveReview     = errors.New("cannot save the review")
+	ErrCantListReviews    = errors.New("cannot list the reviews")
+	ErrCantUpdateRating   = errors.New("cannot update the product rating")
+	ErrInvalidReviewState = errors.New("invalid review status")
+)
+
+// EnsureReviewIndexes keeps one review per customer and product and backs
+// the per-product listing.
+func EnsureReviewIndexes(ctx context.Context, reviewCollection *mongo.Collection) error {
+	indexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "product_id", Value: 1}, {Key: "user_id", Value: 1}},
+			Options: options.Index().SetName("review_product_user").SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "product_id", Value: 1}, {Key: "status", Value: 1}, {Key: "_id", Value: -1}},
+			Options: options.Index().SetName("review_product_status"),
+		},
+	}
+
+	if _, err := reviewCollection.Indexes().CreateMany(ctx, indexes); err != nil {
+		logging.FromContext(ctx).Error("cannot create the indexes", "error", err)
+		return ErrCantCreateIndex
+	}
+
+	return nil
+}
+
+// HasDeliveredProduct reports whether the user has a delivered order that
+// contains the product; orders are delivered once all their shipments are.
+func HasDeliveredProduct(
+	ctx context.Context,
+	userCollection *mongo.Collection,
+	userID string,
+	productID primitive.ObjectID,
+) (bool, error) {
+	id, err := primitive.ObjectIDFromHex(userID)
+
+	if err != nil {
+		logging.FromContext(ctx).Warn("this user is not valid", "error", err)
+		return false, ErrUserIdIsNotValid
+	}
+
+	filter := bson.M{
+		"_id": id,
+		"orders": bson.M{"$elemMatch": bson.M{
+			"status":         models.OrderDelivered,
+			"order_list._id": productID,
+		}},
+	}
+
+	count, err := userCollection.CountDocuments(ctx, filter)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("was unable to get the item from the cart", "error", err)
+		return false, ErrCantGetItem
+	}
+
+	return count > 0, nil
+}
+
+// SaveReview creates or replaces the user's review of a product. Every edit
+// goes back to moderation, so the rating only counts it once approved again.
+func SaveReview(
+	ctx context.Context,
+	userCollection *mongo.Collection,
+	reviewCollection *mongo.Collection,
+	prodCollection *mongo.Collection,
+	review models.Review,
+) (models.Review, error) {
+	delivered, err := HasDeliveredProduct(ctx, userCollection, review.User_ID, review.Product_ID)
+
+	if err != nil {
+		return review, err
+	}
+
+	if !delivered {
+		return review, ErrNotDelivered
+	}
+
+	now := time.Now()
+	filter := bson.M{"product_id": review.Product_ID, "user_id": review.User_ID}
+	update := bson.M{
+		"$set": bson.M{
+			"author":     review.Author,
+			"rating":     review.Rating,
+			"text":       review.Text,
+			"status":     models.ReviewPending,
+			"updated_at": now,
+		},
+		"$setOnInsert": bson.M{
+			"_id":        primitive.NewObjectID(),
+			"created_at": now,
+		},
+	}
+
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var saved models.Review
+
+	if err = reviewCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&saved); err != nil {
+		logging.FromContext(ctx).Error("cannot save the review", "error", err)
+		return review, ErrCantSaveReview
+	}
+
+	// an edited review may have been approved before and counted
+	if err = UpdateProductRating(ctx, reviewCollection, prodCollection, review.Product_ID); err != nil {
+		return saved, err
+	}
+
+	return saved, nil
+}
+
+// ListReviews returns up to limit reviews of a product with the given status,
+// newest first. A nil productID lists every product, which is what the
+// moderation queue uses.
+func ListReviews(
+	ctx context.Context,
+	reviewCollection *mongo.Collection,
+	productID *primitive.ObjectID,
+	status string,
+	limit int64,
+) ([]models.Review, error) {
+	filter := bson.M{"status": status}
+
+	if productID != nil {
+		filter["product_id"] = *productID
+	}
+
+	if limit <= 0 || limit > MaxPageLimit {
+		limit = MaxPageLimit
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(limit)
+
+	cursor, err := reviewCollection.Find(ctx, filter, opts)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot list the reviews", "error", err)
+		return nil, ErrCantListReviews
+	}
+
+	defer cursor.Close(ctx)
+
+	reviews := make([]models.Review, 0)
+
+	if err = cursor.All(ctx, &reviews); err != nil {
+		logging.FromContext(ctx).Error("cannot list the reviews", "error", err)
+		return nil, ErrCantListReviews
+	}
+
+	return reviews, nil
+}
+
+// ModerateReview moves a review to approved or rejected and refreshes the
+// product rating.
+func ModerateReview(
+	ctx context.Context,
+	reviewCollection *mongo.Collection,
+	prodCollection *mongo.Collection,
+	reviewID primitive.ObjectID,
+	status string,
+) error {
+	if status != models.ReviewApproved && status != models.ReviewRejected {
+		return ErrInvalidReviewState
+	}
+
+	var review models.Review
+
+	update := bson.M{"$set": bson.M{"status": status, "updated_at": time.Now()}}
+
+	err := reviewCollection.FindOneAndUpdate(ctx, bson.M{"_id": reviewID}, update).Decode(&review)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrCantFindReview
+	}
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot save the review", "error", err)
+		return ErrCantSaveReview
+	}
+
+	return UpdateProductRating(ctx, reviewCollection, prodCollection, review.Product_ID)
+}
+
+// DeleteReview removes a review. When userID is not empty only that user's
+// review is removed, which is how customers delete their own.
+func DeleteReview(
+	ctx context.Context,
+	reviewCollection *mongo.Collection,
+	prodCollection *mongo.Collection,
+	reviewID primitive.ObjectID,
+	userID string,
+) error {
+	filter := bson.M{"_id": reviewID}
+
+	if userID != "" {
+		filter["user_id"] = userID
+	}
+
+	var review models.Review
+
+	err := reviewCollection.FindOneAndDelete(ctx, filter).Decode(&review)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrCantFindReview
+	}
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot save the review", "error", err)
+		return ErrCantSaveReview
+	}
+
+	return UpdateProductRating(ctx, reviewCollection, prodCollection, review.Product_ID)
+}
+
+// UpdateProductRating recomputes the average and count of the approved
+// reviews of a product and stores them on it.
+func UpdateProductRating(
+	ctx context.Context,
+	reviewCollection *mongo.Collection,
+	prodCollection *mongo.Collection,
+	productID primitive.ObjectID,
+) error {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"product_id": productID, "status": models.ReviewApproved}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":    "$product_id",
+			"rating": bson.M{"$avg": "$rating"},
+			"count":  bson.M{"$sum": 1},
+		}}},
+	}
+
+	cursor, err := reviewCollection.Aggregate(ctx, pipeline)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot update the product rating", "error", err)
+		return ErrCantUpdateRating
+	}
+
+	var result []struct {
+		Rating float64 `bson:"rating"`
+		Count  int64   `bson:"count"`
+	}
+
+	if err = cursor.All(ctx, &result); err != nil {
+		logging.FromContext(ctx).Error("cannot update the product rating", "error", err)
+		return ErrCantUpdateRating
+	}
+
+	var rating float64
+	var count int64
+
+	if len(result) > 0 {
+		rating, count = result[0].Rating, result[0].Count
+	}
+
+	update := bson.M{"$set": bson.M{"rating": rating, "rating_count": count}}
+
+	if _, err = prodCollection.UpdateByID(ctx, productID, update); err != nil {
+		logging.FromContext(ctx).Error("cannot update the product rating", "error", err)
+		return ErrCantUpdateRating
+	}
+
+	return nil
+}
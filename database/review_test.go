@@ -0,0 +1,164 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// addCustomer stores a user with one order of productID in the given status
+// and returns the user's id.
+func addCustomer(t *testing.T, userCollection *mongo.Collection, productID primitive.ObjectID, status string) string {
+	t.Helper()
+
+	user := models.User{
+		ID: primitive.NewObjectID(),
+		Order_Status: []models.Order{{
+			Order_ID:   primitive.NewObjectID(),
+			Order_Cart: []models.ProductUser{{Product_ID: productID}},
+			Status:     status,
+		}},
+	}
+
+	if _, err := userCollection.InsertOne(context.Background(), user); err != nil {
+		t.Fatalf("InsertOne: %v", err)
+	}
+
+	return user.ID.Hex()
+}
+
+func TestSaveReviewNeedsADeliveredOrder(t *testing.T) {
+	db := testDatabase(t)
+	ctx := context.Background()
+	users, reviews, products := db.Collection("Users"), db.Collection("Reviews"), db.Collection("Products")
+
+	productID := primitive.NewObjectID()
+
+	tests := []struct {
+		name   string
+		userID string
+		want   error
+	}{
+		{name: "delivered", userID: addCustomer(t, users, productID, models.OrderDelivered)},
+		{name: "not delivered yet", userID: addCustomer(t, users, productID, models.OrderPlaced), want: ErrNotDelivered},
+		{name: "another product", userID: addCustomer(t, users, primitive.NewObjectID(), models.OrderDelivered), want: ErrNotDelivered},
+		{name: "no such user", userID: primitive.NewObjectID().Hex(), want: ErrNotDelivered},
+		{name: "invalid user id", userID: "nope", want: ErrUserIdIsNotValid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			review := models.Review{Product_ID: productID, User_ID: tt.userID, Rating: 4}
+
+			if _, err := SaveReview(ctx, users, reviews, products, review); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReviewModeration(t *testing.T) {
+	db := testDatabase(t)
+	ctx := context.Background()
+	users, reviews, products := db.Collection("Users"), db.Collection("Reviews"), db.Collection("Products")
+
+	productID := primitive.NewObjectID()
+
+	if _, err := products.InsertOne(ctx, models.Product{Product_ID: productID}); err != nil {
+		t.Fatalf("InsertOne: %v", err)
+	}
+
+	rating := func(want float64, count int64) {
+		t.Helper()
+
+		var product models.Product
+
+		if err := products.FindOne(ctx, bson.M{"_id": productID}).Decode(&product); err != nil {
+			t.Fatalf("FindOne: %v", err)
+		}
+
+		if product.Rating != want || product.Rating_Count != count {
+			t.Errorf("rating = %v of %d reviews, want %v of %d", product.Rating, product.Rating_Count, want, count)
+		}
+	}
+
+	save := func(userID string, stars uint8) models.Review {
+		t.Helper()
+
+		review, err := SaveReview(ctx, users, reviews, products, models.Review{Product_ID: productID, User_ID: userID, Rating: stars})
+
+		if err != nil {
+			t.Fatalf("SaveReview: %v", err)
+		}
+
+		if review.Status != models.ReviewPending {
+			t.Errorf("saved as %q, want pending", review.Status)
+		}
+
+		return review
+	}
+
+	moderate := func(review models.Review, status string) {
+		t.Helper()
+
+		if err := ModerateReview(ctx, reviews, products, review.Review_ID, status); err != nil {
+			t.Fatalf("ModerateReview: %v", err)
+		}
+	}
+
+	ann := addCustomer(t, users, productID, models.OrderDelivered)
+	bob := addCustomer(t, users, productID, models.OrderDelivered)
+	cid := addCustomer(t, users, productID, models.OrderDelivered)
+
+	first := save(ann, 4)
+	rating(0, 0)
+
+	moderate(first, models.ReviewApproved)
+	rating(4, 1)
+
+	second := save(bob, 1)
+	moderate(second, models.ReviewApproved)
+	rating(2.5, 2)
+
+	moderate(save(cid, 5), models.ReviewRejected)
+	rating(2.5, 2)
+
+	// an edit goes back to moderation and stops counting until approved
+	edited := save(ann, 5)
+
+	if edited.Review_ID != first.Review_ID {
+		t.Errorf("the edit made review %v, want %v replaced", edited.Review_ID, first.Review_ID)
+	}
+
+	rating(1, 1)
+
+	pending, err := ListReviews(ctx, reviews, &productID, models.ReviewPending, 0)
+
+	if err != nil || len(pending) != 1 || pending[0].Review_ID != first.Review_ID {
+		t.Errorf("pending reviews = %v, %v, want only the edited one", pending, err)
+	}
+
+	if err = ModerateReview(ctx, reviews, products, first.Review_ID, "maybe"); !errors.Is(err, ErrInvalidReviewState) {
+		t.Errorf("moderating to maybe: err = %v, want ErrInvalidReviewState", err)
+	}
+
+	if err = ModerateReview(ctx, reviews, products, primitive.NewObjectID(), models.ReviewApproved); !errors.Is(err, ErrCantFindReview) {
+		t.Errorf("moderating a missing review: err = %v, want ErrCantFindReview", err)
+	}
+
+	// customers can only delete their own reviews
+	if err = DeleteReview(ctx, reviews, products, second.Review_ID, ann); !errors.Is(err, ErrCantFindReview) {
+		t.Errorf("deleting another's review: err = %v, want ErrCantFindReview", err)
+	}
+
+	if err = DeleteReview(ctx, reviews, products, second.Review_ID, bob); err != nil {
+		t.Fatalf("DeleteReview: %v", err)
+	}
+
+	rating(0, 0)
+}
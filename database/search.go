@@ -0,0 +1,245 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/logging"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/search"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const SortRelevance = "relevance"
+
+const MaxSuggestions = 10
+
+var (
+	ErrEmptySearch      = errors.New("search query has no searchable terms")
+	ErrCantSearch       = errors.New("cannot search the products")
+	ErrCantCreateIndex  = errors.New("cannot create the product indexes")
+	ErrCantIndexProduct = errors.New("cannot index the product")
+)
+
+// EnsureProductIndexes creates the text index used for relevance search and
+// the multikey index on search_terms used for autocomplete, then fills
+// search_terms on products stored before it existed.
+func EnsureProductIndexes(ctx context.Context, prodCollection *mongo.Collection) error {
+	indexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "product_name", Value: "text"},
+				{Key: "description", Value: "text"},
+			},
+			Options: options.Index().
+				SetName("product_text").
+				SetWeights(bson.M{"product_name": 10, "description": 2}).
+				SetDefaultLanguage("english"),
+		},
+		{
+			Keys:    bson.D{{Key: "search_terms", Value: 1}},
+			Options: options.Index().SetName("product_search_terms"),
+		},
+	}
+
+	if _, err := prodCollection.Indexes().CreateMany(ctx, indexes); err != nil {
+		logging.FromContext(ctx).Error("cannot create the indexes", "error", err)
+		return ErrCantCreateIndex
+	}
+
+	cursor, err := prodCollection.Find(ctx, bson.M{"search_terms": bson.M{"$exists": false}})
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot index the product", "error", err)
+		return ErrCantIndexProduct
+	}
+
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var product models.Product
+
+		if err := cursor.Decode(&product); err != nil {
+			logging.FromContext(ctx).Error("cannot decode the product", "error", err)
+			continue
+		}
+
+		if err := IndexProduct(ctx, prodCollection, product); err != nil {
+			return err
+		}
+	}
+
+	return cursor.Err()
+}
+
+// ProductTerms returns the normalized terms stored on a product for
+// autocomplete and typo correction.
+func ProductTerms(product models.Product) []string {
+	var name, description string
+
+	if product.Product_Name != nil {
+		name = *product.Product_Name
+	}
+
+	if product.Description != nil {
+		description = *product.Description
+	}
+
+	return search.Terms(name, description)
+}
+
+// IndexProduct refreshes the search_terms of a stored product.
+func IndexProduct(ctx context.Context, prodCollection *mongo.Collection, product models.Product) error {
+	update := bson.M{"$set": bson.M{"search_terms": ProductTerms(product)}}
+
+	if _, err := prodCollection.UpdateByID(ctx, product.Product_ID, update); err != nil {
+		logging.FromContext(ctx).Error("cannot index the product", "error", err)
+		return ErrCantIndexProduct
+	}
+
+	return nil
+}
+
+// textMatch builds a $text stage matching any of terms. Terms come from
+// search.Tokenize, so quotes and negations in user input never reach Mongo.
+func textMatch(terms []string) bson.M {
+	return bson.M{"$text": bson.M{"$search": strings.Join(terms, " ")}}
+}
+
+// SearchProducts runs a full-text search for any of terms, ranked by
+// relevance, or by q.Sort when the caller asks for an explicit order.
+func SearchProducts(
+	ctx context.Context,
+	prodCollection *mongo.Collection,
+	terms []string,
+	q ProductQuery,
+) ([]models.Product, string, error) {
+	if len(terms) == 0 {
+		return nil, "", ErrEmptySearch
+	}
+
+	match := textMatch(terms)
+
+	if q.Sort != "" && q.Sort != SortRelevance {
+		return ListProducts(ctx, prodCollection, q, match)
+	}
+
+	if q.Limit <= 0 {
+		q.Limit = DefaultPageLimit
+	}
+
+	if q.Limit > MaxPageLimit {
+		q.Limit = MaxPageLimit
+	}
+
+	// scores can't be used in a range filter, so relevance pages are offsets
+	var offset int64
+
+	if q.Cursor != "" {
+		cur, _, err := decodeCursor(q.Cursor)
+
+		if err != nil || cur.Offset < 0 {
+			return nil, "", ErrInvalidCursor
+		}
+
+		offset = cur.Offset
+	}
+
+	score := bson.M{"$meta": "textScore"}
+
+	opts := options.Find().
+		SetProjection(bson.M{"score": score}).
+		SetSort(bson.D{{Key: "score", Value: score}, {Key: "_id", Value: 1}}).
+		SetSkip(offset).
+		SetLimit(q.Limit + 1)
+
+	cursor, err := prodCollection.Find(ctx, q.filter(match), opts)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot search the products", "error", err)
+		return nil, "", ErrCantSearch
+	}
+
+	defer cursor.Close(ctx)
+
+	products := make([]models.Product, 0, q.Limit)
+
+	if err = cursor.All(ctx, &products); err != nil {
+		logging.FromContext(ctx).Error("cant find the product", "error", err)
+		return nil, "", ErrCantDecodeProducts
+	}
+
+	if int64(len(products)) <= q.Limit {
+		return products, "", nil
+	}
+
+	products = products[:q.Limit]
+	last := products[len(products)-1]
+
+	next := pageCursor{ID: last.Product_ID.Hex(), Offset: offset + q.Limit}
+
+	return products, encodeCursor(next), nil
+}
+
+// AutocompleteProducts returns up to limit product names whose words start
+// with the last term of prefix and contain every preceding term.
+func AutocompleteProducts(
+	ctx context.Context,
+	prodCollection *mongo.Collection,
+	prefix string,
+	limit int64,
+) ([]string, error) {
+	terms := search.QueryTerms(prefix)
+
+	if len(terms) == 0 {
+		return nil, ErrEmptySearch
+	}
+
+	if limit <= 0 || limit > MaxSuggestions {
+		limit = MaxSuggestions
+	}
+
+	last := terms[len(terms)-1]
+
+	// anchored and quoted, so the prefix is served from the search_terms index
+	and := bson.A{bson.M{"search_terms": bson.M{"$regex": "^" + regexp.QuoteMeta(last)}}}
+
+	if len(terms) > 1 {
+		and = append(and, bson.M{"search_terms": bson.M{"$all": terms[:len(terms)-1]}})
+	}
+
+	opts := options.Find().
+		SetProjection(bson.M{"product_name": 1}).
+		SetSort(bson.D{{Key: "rating", Value: -1}, {Key: "_id", Value: 1}}).
+		SetLimit(limit)
+
+	cursor, err := prodCollection.Find(ctx, bson.M{"$and": and}, opts)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot search the products", "error", err)
+		return nil, ErrCantSearch
+	}
+
+	defer cursor.Close(ctx)
+
+	var products []models.Product
+
+	if err = cursor.All(ctx, &products); err != nil {
+		logging.FromContext(ctx).Error("cant find the product", "error", err)
+		return nil, ErrCantDecodeProducts
+	}
+
+	suggestions := make([]string, 0, len(products))
+
+	for _, product := range products {
+		if product.Product_Name != nil {
+			suggestions = append(suggestions, *product.Product_Name)
+		}
+	}
+
+	return suggestions, nil
+}
@@ -0,0 +1,103 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestProductTerms(t *testing.T) {
+	name, description := "Tênis Runner", "Light running shoes, the runner's choice"
+
+	tests := []struct {
+		product models.Product
+		want    []string
+	}{
+		{product: models.Product{}, want: []string{}},
+		{product: models.Product{Product_Name: &name}, want: []string{"tenis", "runner"}},
+		{
+			product: models.Product{Product_Name: &name, Description: &description},
+			want:    []string{"tenis", "runner", "light", "running", "shoes", "the", "s", "choice"},
+		},
+	}
+
+	for _, tt := range tests {
+		if got := ProductTerms(tt.product); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ProductTerms = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestSearchProductsRefusesBadInput(t *testing.T) {
+	tests := []struct {
+		name  string
+		terms []string
+		query ProductQuery
+		want  error
+	}{
+		{name: "no terms", want: ErrEmptySearch},
+		{name: "bad cursor", terms: []string{"shoes"}, query: ProductQuery{Cursor: "nope"}, want: ErrInvalidCursor},
+		{
+			name:  "negative offset",
+			terms: []string{"shoes"},
+			query: ProductQuery{Cursor: encodeCursor(pageCursor{ID: primitive.NewObjectID().Hex(), Offset: -1})},
+			want:  ErrInvalidCursor,
+		},
+		{name: "unknown sort", terms: []string{"shoes"}, query: ProductQuery{Sort: "cheapest"}, want: ErrInvalidSort},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// nothing reaches the collection
+			if _, _, err := SearchProducts(context.Background(), nil, tt.terms, tt.query); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAutocompleteProducts(t *testing.T) {
+	db := testDatabase(t)
+	ctx := context.Background()
+	products := db.Collection("Products")
+
+	names := []string{"Running Shoes", "Red Running Shorts", "Rugby Ball", "Blue Shoes"}
+
+	for i, name := range names {
+		name := name
+		product := models.Product{Product_ID: primitive.NewObjectID(), Product_Name: &name, Rating: float64(i)}
+
+		if _, err := products.InsertOne(ctx, product); err != nil {
+			t.Fatalf("InsertOne: %v", err)
+		}
+
+		if err := IndexProduct(ctx, products, product); err != nil {
+			t.Fatalf("IndexProduct: %v", err)
+		}
+	}
+
+	tests := []struct {
+		prefix string
+		want   []string
+	}{
+		// best rated first
+		{prefix: "ru", want: []string{"Rugby Ball", "Red Running Shorts", "Running Shoes"}},
+		{prefix: "RUN", want: []string{"Red Running Shorts", "Running Shoes"}},
+		{prefix: "running sho", want: []string{"Red Running Shorts", "Running Shoes"}},
+		{prefix: "blue sho", want: []string{"Blue Shoes"}},
+		{prefix: "sh.*", want: []string{"Blue Shoes", "Red Running Shorts", "Running Shoes"}},
+		{prefix: "x", want: []string{}},
+	}
+
+	for _, tt := range tests {
+		got, err := AutocompleteProducts(ctx, products, tt.prefix, 0)
+
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("AutocompleteProducts(%q) = %q, %v, want %q", tt.prefix, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,432 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/logging"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrCantFindOrder       = errors.New("can't find the order")
+	ErrCantFindShipment    = errors.New("can't find the shipment")
+	ErrCantUpdateOrder     = errors.New("cannot update the order")
+	ErrCantSaveShipment    = errors.New("cannot save the shipment")
+	ErrInvalidShipmentLine = errors.New("the lines must be items of the order that are not in another shipment")
+	ErrNothingToShip       = errors.New("every item of the order is already in a shipment")
+	ErrShipmentState       = errors.New("the shipment can't move to this status from its current one")
+	ErrShipmentConflict    = errors.New("another shipment took some of these items meanwhile, try again")
+)
+
+// EnsureShipmentIndexes indexes shipments by order. The index is unique on
+// each of the shipment's lines, so no two shipments can hold the same line
+// of an order.
+func EnsureShipmentIndexes(ctx context.Context, shipmentCollection *mongo.Collection) error {
+	_, err := shipmentCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "order_id", Value: 1}, {Key: "lines", Value: 1}},
+		Options: options.Index().SetName("shipment_order_line").SetUnique(true),
+	})
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot create the indexes", "error", err)
+		return ErrCantCreateIndex
+	}
+
+	return nil
+}
+
+// FindOrder finds an order among every user's orders and returns it with
+// the id of the user who placed it.
+func FindOrder(ctx context.Context, userCollection *mongo.Collection, orderID primitive.ObjectID) (string, models.Order, error) {
+	var user models.User
+
+	opts := options.FindOne().SetProjection(bson.M{"user_id": 1, "orders.$": 1})
+
+	err := userCollection.FindOne(ctx, bson.M{"orders._id": orderID}, opts).Decode(&user)
+
+	if errors.Is(err, mongo.ErrNoDocuments) || (err == nil && len(user.Order_Status) == 0) {
+		return "", models.Order{}, ErrCantFindOrder
+	}
+
+	if err != nil {
+		logging.FromContext(ctx).Error("can't find the order", "error", err)
+		return "", models.Order{}, ErrCantFindOrder
+	}
+
+	return user.User_ID, user.Order_Status[0], nil
+}
+
+func ListShipments(ctx context.Context, shipmentCollection *mongo.Collection, orderID primitive.ObjectID) ([]models.Shipment, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}})
+
+	cursor, err := shipmentCollection.Find(ctx, bson.M{"order_id": orderID}, opts)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("can't find the shipment", "error", err)
+		return nil, ErrCantFindShipment
+	}
+
+	defer cursor.Close(ctx)
+
+	shipments := make([]models.Shipment, 0)
+
+	if err = cursor.All(ctx, &shipments); err != nil {
+		logging.FromContext(ctx).Error("can't find the shipment", "error", err)
+		return nil, ErrCantFindShipment
+	}
+
+	return shipments, nil
+}
+
+// UnshippedLines returns the lines of an order with lineCount lines that no
+// shipment holds yet.
+func UnshippedLines(lineCount int, shipments []models.Shipment) []int {
+	taken := make(map[int]bool)
+
+	for _, shipment := range shipments {
+		for _, line := range shipment.Lines {
+			taken[line] = true
+		}
+	}
+
+	lines := make([]int, 0)
+
+	for line := 0; line < lineCount; line++ {
+		if !taken[line] {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines
+}
+
+// DeriveOrderStatus works out an order's status from its shipments: placed
+// until something ships, partially shipped until every line has left,
+// shipped until every line has arrived, then delivered.
+func DeriveOrderStatus(lineCount int, shipments []models.Shipment) string {
+	shipped, delivered := 0, 0
+
+	for _, shipment := range shipments {
+		switch shipment.Status {
+		case models.ShipmentDelivered:
+			delivered += len(shipment.Lines)
+			shipped += len(shipment.Lines)
+		case models.ShipmentShipped:
+			shipped += len(shipment.Lines)
+		}
+	}
+
+	switch {
+	case shipped == 0:
+		return models.OrderPlaced
+	case shipped < lineCount:
+		return models.OrderPartiallyShipped
+	case delivered < lineCount:
+		return models.OrderShipped
+	}
+
+	return models.OrderDelivered
+}
+
+// RefreshOrderStatus stores the status derived from the order's shipments
+// on the order.
+func RefreshOrderStatus(
+	ctx context.Context,
+	userCollection *mongo.Collection,
+	shipmentCollection *mongo.Collection,
+	orderID primitive.ObjectID,
+) (string, error) {
+	_, order, err := FindOrder(ctx, userCollection, orderID)
+
+	if err != nil {
+		return "", err
+	}
+
+	// a cancelled order stays cancelled whatever happens to its parcels
+	if order.Status == models.OrderCancelled {
+		return order.Status, nil
+	}
+
+	shipments, err := ListShipments(ctx, shipmentCollection, orderID)
+
+	if err != nil {
+		return "", err
+	}
+
+	status := DeriveOrderStatus(len(order.Order_Cart), shipments)
+
+	// the order may have been cancelled since it was read
+	filter := bson.M{"orders": bson.M{"$elemMatch": bson.M{
+		"_id":    orderID,
+		"status": bson.M{"$ne": models.OrderCancelled},
+	}}}
+	update := bson.M{"$set": bson.M{"orders.$.status": status}}
+
+	result, err := userCollection.UpdateOne(ctx, filter, update)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot update the order", "error", err)
+		return "", ErrCantUpdateOrder
+	}
+
+	if result.MatchedCount == 0 {
+		return models.OrderCancelled, nil
+	}
+
+	return status, nil
+}
+
+// CreateShipment packs lines of the order into a new pending shipment. With
+// no lines it takes every line not shipped yet. The shipment index claims
+// the lines, so when another shipment took one of them meanwhile this one
+// gets ErrShipmentConflict.
+func CreateShipment(
+	ctx context.Context,
+	userCollection *mongo.Collection,
+	shipmentCollection *mongo.Collection,
+	orderID primitive.ObjectID,
+	lines []int,
+	carrier *string,
+	trackingNumber *string,
+) (models.Shipment, error) {
+	var shipment models.Shipment
+
+	userID, order, err := FindOrder(ctx, userCollection, orderID)
+
+	if err != nil {
+		return shipment, err
+	}
+
+	if order.Status == models.OrderCancelled {
+		return shipment, ErrOrderCancelled
+	}
+
+	existing, err := ListShipments(ctx, shipmentCollection, orderID)
+
+	if err != nil {
+		return shipment, err
+	}
+
+	free := UnshippedLines(len(order.Order_Cart), existing)
+
+	if len(free) == 0 {
+		return shipment, ErrNothingToShip
+	}
+
+	if len(lines) == 0 {
+		lines = free
+	}
+
+	available := make(map[int]bool, len(free))
+
+	for _, line := range free {
+		available[line] = true
+	}
+
+	for _, line := range lines {
+		if !available[line] {
+			return shipment, ErrInvalidShipmentLine
+		}
+
+		// also rejects a line listed twice
+		available[line] = false
+	}
+
+	sort.Ints(lines)
+
+	shipment = models.Shipment{
+		Shipment_ID:     primitive.NewObjectID(),
+		Order_ID:        orderID,
+		User_ID:         userID,
+		Lines:           lines,
+		Carrier:         carrier,
+		Tracking_Number: trackingNumber,
+		Status:          models.ShipmentPending,
+		Created_At:      time.Now(),
+	}
+
+	_, err = shipmentCollection.InsertOne(ctx, shipment)
+
+	if mongo.IsDuplicateKeyError(err) {
+		return shipment, ErrShipmentConflict
+	}
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot save the shipment", "error", err)
+		return shipment, ErrCantSaveShipment
+	}
+
+	return shipment, nil
+}
+
+// advanceShipment moves a shipment from one status to the next in a single
+// conditional update, so two clerks can't ship or deliver it twice.
+func advanceShipment(
+	ctx context.Context,
+	userCollection *mongo.Collection,
+	shipmentCollection *mongo.Collection,
+	shipmentID primitive.ObjectID,
+	from string,
+	set bson.M,
+) (models.Shipment, error) {
+	var shipment models.Shipment
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	err := shipmentCollection.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": shipmentID, "status": from},
+		bson.M{"$set": set},
+		opts,
+	).Decode(&shipment)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		count, err := shipmentCollection.CountDocuments(ctx, bson.M{"_id": shipmentID})
+
+		if err == nil && count == 0 {
+			return shipment, ErrCantFindShipment
+		}
+
+		return shipment, ErrShipmentState
+	}
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot save the shipment", "error", err)
+		return shipment, ErrCantSaveShipment
+	}
+
+	if _, err = RefreshOrderStatus(ctx, userCollection, shipmentCollection, shipment.Order_ID); err != nil {
+		return shipment, err
+	}
+
+	return shipment, nil
+}
+
+// MarkShipmentShipped records that a pending shipment left with the carrier.
+// carrier and trackingNumber replace the ones set at creation when given.
+func MarkShipmentShipped(
+	ctx context.Context,
+	userCollection *mongo.Collection,
+	shipmentCollection *mongo.Collection,
+	shipmentID primitive.ObjectID,
+	carrier *string,
+	trackingNumber *string,
+) (models.Shipment, error) {
+	set := bson.M{"status": models.ShipmentShipped, "shipped_at": time.Now()}
+
+	if carrier != nil {
+		set["carrier"] = carrier
+	}
+
+	if trackingNumber != nil {
+		set["tracking_number"] = trackingNumber
+	}
+
+	return advanceShipment(ctx, userCollection, shipmentCollection, shipmentID, models.ShipmentPending, set)
+}
+
+func MarkShipmentDelivered(
+	ctx context.Context,
+	userCollection *mongo.Collection,
+	shipmentCollection *mongo.Collection,
+	shipmentID primitive.ObjectID,
+) (models.Shipment, error) {
+	set := bson.M{"status": models.ShipmentDelivered, "delivered_at": time.Now()}
+
+	return advanceShipment(ctx, userCollection, shipmentCollection, shipmentID, models.ShipmentShipped, set)
+}
+
+// TrackedItem is an order line as the customer sees it in tracking.
+type TrackedItem struct {
+	Line         int                `json:"line"`
+	Product_ID   primitive.ObjectID `json:"product_id"`
+	Product_Name *string            `json:"product_name"`
+	Image        *string            `json:"image"`
+}
+
+type TrackedShipment struct {
+	models.Shipment
+	Items []TrackedItem `json:"items"`
+}
+
+// Tracking is the customer's view of an order's fulfillment.
+type Tracking struct {
+	Order_ID   primitive.ObjectID `json:"order_id"`
+	Status     string             `json:"status"`
+	Ordered_At time.Time          `json:"ordered_at"`
+	Shipments  []TrackedShipment  `json:"shipments"`
+	// Unshipped are the items not in any shipment yet
+	Unshipped []TrackedItem `json:"unshipped"`
+}
+
+// OrderTracking returns the tracking view of one of the user's orders.
+// Someone else's order is reported as not found.
+func OrderTracking(
+	ctx context.Context,
+	userCollection *mongo.Collection,
+	shipmentCollection *mongo.Collection,
+	userID string,
+	orderID primitive.ObjectID,
+) (Tracking, error) {
+	var tracking Tracking
+
+	owner, order, err := FindOrder(ctx, userCollection, orderID)
+
+	if err != nil {
+		return tracking, err
+	}
+
+	if owner != userID {
+		return tracking, ErrCantFindOrder
+	}
+
+	shipments, err := ListShipments(ctx, shipmentCollection, orderID)
+
+	if err != nil {
+		return tracking, err
+	}
+
+	item := func(line int) TrackedItem {
+		product := order.Order_Cart[line]
+
+		return TrackedItem{
+			Line:         line,
+			Product_ID:   product.Product_ID,
+			Product_Name: product.Product_Name,
+			Image:        product.Image,
+		}
+	}
+
+	tracking = Tracking{
+		Order_ID:   order.Order_ID,
+		Status:     order.Status,
+		Ordered_At: order.Ordered_At,
+		Shipments:  make([]TrackedShipment, 0, len(shipments)),
+		Unshipped:  make([]TrackedItem, 0),
+	}
+
+	for _, shipment := range shipments {
+		tracked := TrackedShipment{Shipment: shipment, Items: make([]TrackedItem, 0, len(shipment.Lines))}
+
+		for _, line := range shipment.Lines {
+			if line < len(order.Order_Cart) {
+				tracked.Items = append(tracked.Items, item(line))
+			}
+		}
+
+		tracking.Shipments = append(tracking.Shipments, tracked)
+	}
+
+	for _, line := range UnshippedLines(len(order.Order_Cart), shipments) {
+		tracking.Unshipped = append(tracking.Unshipped, item(line))
+	}
+
+	return tracking, nil
+}
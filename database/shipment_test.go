@@ -0,0 +1,243 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func shipment(status string, lines ...int) models.Shipment {
+	return models.Shipment{Status: status, Lines: lines}
+}
+
+func TestUnshippedLines(t *testing.T) {
+	shipments := []models.Shipment{shipment(models.ShipmentPending, 0, 2), shipment(models.ShipmentShipped, 4)}
+
+	if got := UnshippedLines(5, shipments); !reflect.DeepEqual(got, []int{1, 3}) {
+		t.Errorf("UnshippedLines() = %v, want [1 3]", got)
+	}
+
+	if got := UnshippedLines(2, nil); !reflect.DeepEqual(got, []int{0, 1}) {
+		t.Errorf("UnshippedLines(no shipments) = %v, want [0 1]", got)
+	}
+}
+
+func TestDeriveOrderStatus(t *testing.T) {
+	tests := []struct {
+		name      string
+		shipments []models.Shipment
+		want      string
+	}{
+		{name: "nothing packed", want: models.OrderPlaced},
+		{name: "packed, not shipped", shipments: []models.Shipment{shipment(models.ShipmentPending, 0, 1, 2)}, want: models.OrderPlaced},
+		{name: "some lines shipped", shipments: []models.Shipment{shipment(models.ShipmentShipped, 0), shipment(models.ShipmentPending, 1, 2)}, want: models.OrderPartiallyShipped},
+		{name: "some lines delivered", shipments: []models.Shipment{shipment(models.ShipmentDelivered, 0, 1)}, want: models.OrderPartiallyShipped},
+		{name: "every line shipped", shipments: []models.Shipment{shipment(models.ShipmentShipped, 0, 1), shipment(models.ShipmentDelivered, 2)}, want: models.OrderShipped},
+		{name: "every line delivered", shipments: []models.Shipment{shipment(models.ShipmentDelivered, 0), shipment(models.ShipmentDelivered, 1, 2)}, want: models.OrderDelivered},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DeriveOrderStatus(3, tt.shipments); got != tt.want {
+				t.Errorf("DeriveOrderStatus() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// addOrder stores a user with one placed order of n lines and returns the
+// user's and the order's ids.
+func addOrder(t *testing.T, userCollection *mongo.Collection, n int) (string, primitive.ObjectID) {
+	t.Helper()
+
+	name := "item"
+	order := models.Order{Order_ID: primitive.NewObjectID(), Status: models.OrderPlaced}
+
+	for i := 0; i < n; i++ {
+		order.Order_Cart = append(order.Order_Cart, models.ProductUser{Product_ID: primitive.NewObjectID(), Product_Name: &name})
+	}
+
+	user := models.User{ID: primitive.NewObjectID(), Order_Status: []models.Order{order}}
+	user.User_ID = user.ID.Hex()
+
+	if _, err := userCollection.InsertOne(context.Background(), user); err != nil {
+		t.Fatalf("InsertOne: %v", err)
+	}
+
+	return user.User_ID, order.Order_ID
+}
+
+func TestShipmentFlow(t *testing.T) {
+	db := testDatabase(t)
+	ctx := context.Background()
+	users, shipments := db.Collection("Users"), db.Collection("Shipments")
+
+	userID, orderID := addOrder(t, users, 3)
+
+	status := func() string {
+		t.Helper()
+
+		_, order, err := FindOrder(ctx, users, orderID)
+
+		if err != nil {
+			t.Fatalf("FindOrder: %v", err)
+		}
+
+		return order.Status
+	}
+
+	first, err := CreateShipment(ctx, users, shipments, orderID, []int{0}, nil, nil)
+
+	if err != nil {
+		t.Fatalf("CreateShipment: %v", err)
+	}
+
+	if first.User_ID != userID || first.Status != models.ShipmentPending {
+		t.Errorf("created %+v", first)
+	}
+
+	for _, lines := range [][]int{{0}, {1, 1}, {3}, {-1}} {
+		if _, err = CreateShipment(ctx, users, shipments, orderID, lines, nil, nil); !errors.Is(err, ErrInvalidShipmentLine) {
+			t.Errorf("lines %v: got %v, want %v", lines, err, ErrInvalidShipmentLine)
+		}
+	}
+
+	carrier, tracking := "ups", "1Z999"
+
+	if _, err = MarkShipmentShipped(ctx, users, shipments, first.Shipment_ID, &carrier, &tracking); err != nil {
+		t.Fatalf("MarkShipmentShipped: %v", err)
+	}
+
+	if got := status(); got != models.OrderPartiallyShipped {
+		t.Errorf("status = %q, want %q", got, models.OrderPartiallyShipped)
+	}
+
+	// without lines the shipment takes what is left
+	rest, err := CreateShipment(ctx, users, shipments, orderID, nil, nil, nil)
+
+	if err != nil || !reflect.DeepEqual(rest.Lines, []int{1, 2}) {
+		t.Fatalf("CreateShipment(rest) = %v, %v, want lines [1 2]", rest.Lines, err)
+	}
+
+	if _, err = CreateShipment(ctx, users, shipments, orderID, nil, nil, nil); !errors.Is(err, ErrNothingToShip) {
+		t.Errorf("nothing left: got %v, want %v", err, ErrNothingToShip)
+	}
+
+	if _, err = MarkShipmentDelivered(ctx, users, shipments, rest.Shipment_ID); !errors.Is(err, ErrShipmentState) {
+		t.Errorf("delivering a pending shipment: got %v, want %v", err, ErrShipmentState)
+	}
+
+	if _, err = MarkShipmentShipped(ctx, users, shipments, rest.Shipment_ID, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = MarkShipmentShipped(ctx, users, shipments, rest.Shipment_ID, nil, nil); !errors.Is(err, ErrShipmentState) {
+		t.Errorf("shipping twice: got %v, want %v", err, ErrShipmentState)
+	}
+
+	if got := status(); got != models.OrderShipped {
+		t.Errorf("status = %q, want %q", got, models.OrderShipped)
+	}
+
+	for _, id := range []primitive.ObjectID{first.Shipment_ID, rest.Shipment_ID} {
+		if _, err = MarkShipmentDelivered(ctx, users, shipments, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := status(); got != models.OrderDelivered {
+		t.Errorf("status = %q, want %q", got, models.OrderDelivered)
+	}
+
+	if _, err = MarkShipmentShipped(ctx, users, shipments, primitive.NewObjectID(), nil, nil); !errors.Is(err, ErrCantFindShipment) {
+		t.Errorf("missing shipment: got %v, want %v", err, ErrCantFindShipment)
+	}
+
+	view, err := OrderTracking(ctx, users, shipments, userID, orderID)
+
+	if err != nil {
+		t.Fatalf("OrderTracking: %v", err)
+	}
+
+	if view.Status != models.OrderDelivered || len(view.Shipments) != 2 || len(view.Unshipped) != 0 {
+		t.Errorf("tracking = %+v", view)
+	}
+
+	if got := view.Shipments[0]; *got.Carrier != carrier || *got.Tracking_Number != tracking || len(got.Items) != 1 {
+		t.Errorf("first shipment = %+v", got)
+	}
+
+	if _, err = OrderTracking(ctx, users, shipments, primitive.NewObjectID().Hex(), orderID); !errors.Is(err, ErrCantFindOrder) {
+		t.Errorf("someone else's order: got %v, want %v", err, ErrCantFindOrder)
+	}
+}
+
+func TestRefreshCancelledOrder(t *testing.T) {
+	db := testDatabase(t)
+	ctx := context.Background()
+	users, shipments := db.Collection("Users"), db.Collection("Shipments")
+
+	_, orderID := addOrder(t, users, 1)
+
+	shipment, err := CreateShipment(ctx, users, shipments, orderID, nil, nil, nil)
+
+	if err != nil {
+		t.Fatalf("CreateShipment: %v", err)
+	}
+
+	update := bson.M{"$set": bson.M{"orders.$.status": models.OrderCancelled}}
+
+	if _, err = users.UpdateOne(ctx, bson.M{"orders._id": orderID}, update); err != nil {
+		t.Fatal(err)
+	}
+
+	// a parcel already on its way when the order was cancelled
+	if _, err = MarkShipmentShipped(ctx, users, shipments, shipment.Shipment_ID, nil, nil); err != nil {
+		t.Fatalf("MarkShipmentShipped: %v", err)
+	}
+
+	_, order, err := FindOrder(ctx, users, orderID)
+
+	if err != nil || order.Status != models.OrderCancelled {
+		t.Errorf("status = %q, %v, want %q", order.Status, err, models.OrderCancelled)
+	}
+}
+
+func TestShipmentLinesAreClaimed(t *testing.T) {
+	db := testDatabase(t)
+	ctx := context.Background()
+	shipments := db.Collection("Shipments")
+
+	if err := EnsureShipmentIndexes(ctx, shipments); err != nil {
+		t.Fatal(err)
+	}
+
+	orderID := primitive.NewObjectID()
+
+	save := func(orderID primitive.ObjectID, lines ...int) error {
+		_, err := shipments.InsertOne(ctx, models.Shipment{Shipment_ID: primitive.NewObjectID(), Order_ID: orderID, Lines: lines})
+		return err
+	}
+
+	if err := save(orderID, 0, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := save(orderID, 2); err != nil {
+		t.Errorf("another line of the order: %v", err)
+	}
+
+	if err := save(primitive.NewObjectID(), 0); err != nil {
+		t.Errorf("the same line of another order: %v", err)
+	}
+
+	if err := save(orderID, 1, 3); !mongo.IsDuplicateKeyError(err) {
+		t.Errorf("a line already in a shipment: err = %v, want a duplicate key", err)
+	}
+}
@@ -0,0 +1,163 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/logging"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/pricing"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrCantFindShippingMethod = errors.New("can't find the shipping method")
+	ErrCantSaveShippingMethod = errors.New("cannot save the shipping method")
+	ErrShippingMethodRequired = errors.New("choose a shipping method")
+)
+
+func CreateShippingMethod(
+	ctx context.Context,
+	shippingCollection *mongo.Collection,
+	method models.ShippingMethod,
+) (models.ShippingMethod, error) {
+	method.Method_ID = primitive.NewObjectID()
+	method.Created_At = time.Now()
+
+	for i, country := range method.Countries {
+		method.Countries[i] = strings.ToUpper(strings.TrimSpace(country))
+	}
+
+	if _, err := shippingCollection.InsertOne(ctx, method); err != nil {
+		logging.FromContext(ctx).Error("cannot save the shipping method", "error", err)
+		return method, ErrCantSaveShippingMethod
+	}
+
+	return method, nil
+}
+
+// ListShippingMethods returns every method, or only the active ones.
+func ListShippingMethods(ctx context.Context, shippingCollection *mongo.Collection, activeOnly bool) ([]models.ShippingMethod, error) {
+	filter := bson.M{}
+
+	if activeOnly {
+		filter["active"] = true
+	}
+
+	cursor, err := shippingCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+
+	if err != nil {
+		logging.FromContext(ctx).Error("can't find the shipping method", "error", err)
+		return nil, ErrCantFindShippingMethod
+	}
+
+	defer cursor.Close(ctx)
+
+	methods := make([]models.ShippingMethod, 0)
+
+	if err = cursor.All(ctx, &methods); err != nil {
+		logging.FromContext(ctx).Error("can't find the shipping method", "error", err)
+		return nil, ErrCantFindShippingMethod
+	}
+
+	return methods, nil
+}
+
+func FindShippingMethod(
+	ctx context.Context,
+	shippingCollection *mongo.Collection,
+	methodID primitive.ObjectID,
+) (models.ShippingMethod, error) {
+	var method models.ShippingMethod
+
+	err := shippingCollection.FindOne(ctx, bson.M{"_id": methodID}).Decode(&method)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return method, ErrCantFindShippingMethod
+	}
+
+	if err != nil {
+		logging.FromContext(ctx).Error("can't find the shipping method", "error", err)
+		return method, ErrCantFindShippingMethod
+	}
+
+	return method, nil
+}
+
+// SetShippingMethodActive switches a method on or off; like coupons, methods
+// stay around for the orders that used them.
+func SetShippingMethodActive(
+	ctx context.Context,
+	shippingCollection *mongo.Collection,
+	methodID primitive.ObjectID,
+	active bool,
+) error {
+	res, err := shippingCollection.UpdateByID(ctx, methodID, bson.M{"$set": bson.M{"active": active}})
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot save the shipping method", "error", err)
+		return ErrCantSaveShippingMethod
+	}
+
+	if res.MatchedCount == 0 {
+		return ErrCantFindShippingMethod
+	}
+
+	return nil
+}
+
+// ShippingQuotes prices every active method that can deliver the user's
+// cart to the address in opts. Methods that can't are left out.
+func ShippingQuotes(
+	ctx context.Context,
+	couponCollection *mongo.Collection,
+	redemptionCollection *mongo.Collection,
+	promotionCollection *mongo.Collection,
+	shippingCollection *mongo.Collection,
+	user models.User,
+	items []models.ProductUser,
+	opts PricingOptions,
+) ([]models.ShippingQuote, error) {
+	opts.Shipping = nil
+
+	totals, err := CartTotals(ctx, couponCollection, redemptionCollection, promotionCollection, user, items, opts)
+
+	if err != nil {
+		return nil, err
+	}
+
+	methods, err := ListShippingMethods(ctx, shippingCollection, true)
+
+	if err != nil {
+		return nil, err
+	}
+
+	spent, err := totals.Subtotal.Sub(totals.Discount)
+
+	if err != nil {
+		return nil, err
+	}
+
+	quotes := make([]models.ShippingQuote, 0, len(methods))
+
+	for _, method := range methods {
+		quote, err := pricing.QuoteShipping(method, totals.Lines, spent, totals.ShippingAddress, opts.Rates)
+
+		if err != nil {
+			continue
+		}
+
+		if totals.Coupon != nil && totals.Coupon.FreeShipping {
+			quote.Cost.Amount = 0
+		}
+
+		quotes = append(quotes, quote)
+	}
+
+	return quotes, nil
+}
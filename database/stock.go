@@ -0,0 +1,109 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/logging"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrCantRestock      = errors.New("cannot restock the products")
+	ErrCantReserveStock = errors.New("cannot reserve the stock")
+)
+
+// counted is the stock filter of products whose stock is counted; the others
+// never run out.
+var counted = bson.M{"$type": "number"}
+
+func stockCounts(lines []models.ProductUser) map[primitive.ObjectID]int64 {
+	counts := make(map[primitive.ObjectID]int64)
+
+	for _, line := range lines {
+		counts[line.Product_ID]++
+	}
+
+	return counts
+}
+
+func addStock(ctx context.Context, prodCollection *mongo.Collection, counts map[primitive.ObjectID]int64) error {
+	for productID, count := range counts {
+		filter := bson.M{"_id": productID, "stock": counted}
+
+		if _, err := prodCollection.UpdateOne(ctx, filter, bson.M{"$inc": bson.M{"stock": count}}); err != nil {
+			logging.FromContext(ctx).Error("cannot restock the products", "error", err)
+			return ErrCantRestock
+		}
+	}
+
+	return nil
+}
+
+// ReserveStock takes the lines out of stock, all or none: when one product
+// has too few left, what was already taken is put back and
+// ErrProductUnavailable is returned, or ErrCantReserveStock when the stock
+// couldn't be read.
+func ReserveStock(ctx context.Context, prodCollection *mongo.Collection, lines []models.ProductUser) error {
+	taken := make(map[primitive.ObjectID]int64)
+
+	for productID, count := range stockCounts(lines) {
+		filter := bson.M{"_id": productID, "stock": bson.M{"$type": "number", "$gte": count}}
+
+		result, err := prodCollection.UpdateOne(ctx, filter, bson.M{"$inc": bson.M{"stock": -count}})
+
+		if err == nil && result.MatchedCount == 1 {
+			taken[productID] = count
+			continue
+		}
+
+		if err == nil {
+			// not matched: either too few left or not counted at all
+			var tracked int64
+
+			tracked, err = prodCollection.CountDocuments(ctx, bson.M{"_id": productID, "stock": counted})
+
+			if err == nil && tracked == 0 {
+				continue
+			}
+		}
+
+		if err := addStock(ctx, prodCollection, taken); err != nil {
+			logging.FromContext(ctx).Error("cannot put the reserved stock back", "error", err)
+		}
+
+		if err != nil {
+			logging.FromContext(ctx).Error("cannot reserve the stock", "error", err)
+			return ErrCantReserveStock
+		}
+
+		return ErrProductUnavailable
+	}
+
+	return nil
+}
+
+// ReleaseStock puts lines reserved by ReserveStock back when the purchase
+// fails. Errors are only logged.
+func ReleaseStock(ctx context.Context, prodCollection *mongo.Collection, lines []models.ProductUser) {
+	if err := addStock(ctx, prodCollection, stockCounts(lines)); err != nil {
+		logging.FromContext(ctx).Error("cannot release the stock", "error", err)
+	}
+}
+
+// Restock puts the given lines of the order back in stock. Products whose
+// stock isn't counted are left alone.
+func Restock(ctx context.Context, prodCollection *mongo.Collection, order models.Order, lines []int) error {
+	items := make([]models.ProductUser, 0, len(lines))
+
+	for _, line := range lines {
+		if line >= 0 && line < len(order.Order_Cart) {
+			items = append(items, order.Order_Cart[line])
+		}
+	}
+
+	return addStock(ctx, prodCollection, stockCounts(items))
+}
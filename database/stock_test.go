@@ -0,0 +1,87 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestReserveStock(t *testing.T) {
+	db := testDatabase(t)
+	ctx := context.Background()
+	products := db.Collection("Products")
+
+	two, one, uncounted := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+
+	_, err := products.InsertMany(ctx, []interface{}{
+		bson.M{"_id": two, "stock": 2},
+		bson.M{"_id": one, "stock": 1},
+		bson.M{"_id": uncounted},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := func(ids ...primitive.ObjectID) []models.ProductUser {
+		items := make([]models.ProductUser, len(ids))
+
+		for i, id := range ids {
+			items[i] = models.ProductUser{Product_ID: id}
+		}
+
+		return items
+	}
+
+	stock := func(id primitive.ObjectID) interface{} {
+		var doc bson.M
+
+		if err := products.FindOne(ctx, bson.M{"_id": id}).Decode(&doc); err != nil {
+			t.Fatal(err)
+		}
+
+		return doc["stock"]
+	}
+
+	steps := []struct {
+		name  string
+		lines []models.ProductUser
+		err   error
+		two   int64
+		one   int64
+	}{
+		{name: "one of each", lines: lines(two, one, uncounted), two: 1, one: 0},
+		{name: "none left of one", lines: lines(two, one), err: ErrProductUnavailable, two: 1, one: 0},
+		{name: "more than left", lines: lines(two, two), err: ErrProductUnavailable, two: 1, one: 0},
+		{name: "uncounted never run out", lines: lines(uncounted, uncounted, uncounted), two: 1, one: 0},
+		{name: "the last one", lines: lines(two), two: 0, one: 0},
+	}
+
+	for _, step := range steps {
+		if err := ReserveStock(ctx, products, step.lines); !errors.Is(err, step.err) {
+			t.Fatalf("%s: err = %v, want %v", step.name, err, step.err)
+		}
+
+		if got, _ := numberToInt64(stock(two)); got != step.two {
+			t.Errorf("%s: stock = %d, want %d", step.name, got, step.two)
+		}
+
+		if got, _ := numberToInt64(stock(one)); got != step.one {
+			t.Errorf("%s: stock = %d, want %d", step.name, got, step.one)
+		}
+	}
+
+	if got := stock(uncounted); got != nil {
+		t.Errorf("uncounted product got stock %v", got)
+	}
+
+	ReleaseStock(ctx, products, lines(two, two, one, uncounted))
+
+	if got, _ := numberToInt64(stock(two)); got != 2 {
+		t.Errorf("released stock = %d, want 2", got)
+	}
+}
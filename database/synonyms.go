@@ -0,0 +1,143 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/logging"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/search"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrCantFindSynonym   = errors.New("can't find the synonym group")
+	ErrCantSaveSynonym   = errors.New("cannot save the synonym group")
+	ErrCantLoadSynonyms  = errors.New("cannot load the synonym dictionary")
+	ErrCantLoadSpellings = errors.New("cannot load the search vocabulary")
+	ErrSynonymNotAWord   = errors.New("each synonym must be a single word")
+)
+
+func ListSynonyms(ctx context.Context, synCollection *mongo.Collection) ([]models.Synonym, error) {
+	cursor, err := synCollection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot load the synonym dictionary", "error", err)
+		return nil, ErrCantLoadSynonyms
+	}
+
+	defer cursor.Close(ctx)
+
+	groups := make([]models.Synonym, 0)
+
+	if err = cursor.All(ctx, &groups); err != nil {
+		logging.FromContext(ctx).Error("cannot load the synonym dictionary", "error", err)
+		return nil, ErrCantLoadSynonyms
+	}
+
+	return groups, nil
+}
+
+// AddSynonymGroup stores a group of equivalent terms, normalized the same way
+// as the catalog so lookups match regardless of case and accents. Each term
+// must be a single word, see search.SynonymTerm.
+func AddSynonymGroup(ctx context.Context, synCollection *mongo.Collection, terms []string) (models.Synonym, error) {
+	group := models.Synonym{
+		Synonym_ID: primitive.NewObjectID(),
+		Created_At: time.Now(),
+	}
+
+	for _, entry := range terms {
+		term, ok := search.SynonymTerm(entry)
+
+		if !ok {
+			return group, ErrSynonymNotAWord
+		}
+
+		group.Terms = append(group.Terms, term)
+	}
+
+	if _, err := synCollection.InsertOne(ctx, group); err != nil {
+		logging.FromContext(ctx).Error("cannot save the synonym group", "error", err)
+		return group, ErrCantSaveSynonym
+	}
+
+	return group, nil
+}
+
+func DeleteSynonymGroup(ctx context.Context, synCollection *mongo.Collection, groupID primitive.ObjectID) error {
+	res, err := synCollection.DeleteOne(ctx, bson.M{"_id": groupID})
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot save the synonym group", "error", err)
+		return ErrCantSaveSynonym
+	}
+
+	if res.DeletedCount == 0 {
+		return ErrCantFindSynonym
+	}
+
+	return nil
+}
+
+// LoadSynonyms replaces the in-memory dictionary with the stored groups.
+func LoadSynonyms(ctx context.Context, synCollection *mongo.Collection, synonyms *search.Synonyms) error {
+	groups, err := ListSynonyms(ctx, synCollection)
+
+	if err != nil {
+		return err
+	}
+
+	terms := make([][]string, 0, len(groups))
+
+	for _, group := range groups {
+		terms = append(terms, group.Terms)
+	}
+
+	synonyms.Reset(terms)
+
+	return nil
+}
+
+// LoadSpellings rebuilds the speller vocabulary from the search_terms of
+// every product.
+func LoadSpellings(ctx context.Context, prodCollection *mongo.Collection, speller *search.Speller) error {
+	opts := options.Find().SetProjection(bson.M{"search_terms": 1})
+
+	cursor, err := prodCollection.Find(ctx, bson.M{}, opts)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot load the search vocabulary", "error", err)
+		return ErrCantLoadSpellings
+	}
+
+	defer cursor.Close(ctx)
+
+	terms := make(map[string]int)
+
+	for cursor.Next(ctx) {
+		var product models.Product
+
+		if err := cursor.Decode(&product); err != nil {
+			logging.FromContext(ctx).Error("cannot decode the product", "error", err)
+			continue
+		}
+
+		for _, term := range product.Search_Terms {
+			terms[term]++
+		}
+	}
+
+	if err := cursor.Err(); err != nil {
+		logging.FromContext(ctx).Error("cannot load the search vocabulary", "error", err)
+		return ErrCantLoadSpellings
+	}
+
+	speller.Reset(terms)
+
+	return nil
+}
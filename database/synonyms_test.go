@@ -0,0 +1,99 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/search"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestSynonymDictionary(t *testing.T) {
+	db := testDatabase(t)
+	ctx := context.Background()
+	synCollection := db.Collection("Synonyms")
+
+	for _, terms := range [][]string{{"tv", "smart television"}, {"shoes", ""}} {
+		if _, err := AddSynonymGroup(ctx, synCollection, terms); !errors.Is(err, ErrSynonymNotAWord) {
+			t.Errorf("AddSynonymGroup(%q): err = %v, want %v", terms, err, ErrSynonymNotAWord)
+		}
+	}
+
+	shoes, err := AddSynonymGroup(ctx, synCollection, []string{"Sneakers", "Trainers"})
+
+	if err != nil {
+		t.Fatalf("AddSynonymGroup: %v", err)
+	}
+
+	if want := []string{"sneakers", "trainers"}; !reflect.DeepEqual(shoes.Terms, want) {
+		t.Errorf("stored %q, want %q", shoes.Terms, want)
+	}
+
+	if _, err = AddSynonymGroup(ctx, synCollection, []string{"tv", "télé"}); err != nil {
+		t.Fatalf("AddSynonymGroup: %v", err)
+	}
+
+	synonyms := search.NewSynonyms()
+
+	if err = LoadSynonyms(ctx, synCollection, synonyms); err != nil {
+		t.Fatalf("LoadSynonyms: %v", err)
+	}
+
+	if got := synonyms.Of("trainers"); !reflect.DeepEqual(got, []string{"sneakers"}) {
+		t.Errorf("synonyms of trainers = %q, want sneakers", got)
+	}
+
+	if got := synonyms.Of("tele"); !reflect.DeepEqual(got, []string{"tv"}) {
+		t.Errorf("synonyms of tele = %q, want tv", got)
+	}
+
+	if err = DeleteSynonymGroup(ctx, synCollection, shoes.Synonym_ID); err != nil {
+		t.Fatalf("DeleteSynonymGroup: %v", err)
+	}
+
+	if err = DeleteSynonymGroup(ctx, synCollection, shoes.Synonym_ID); !errors.Is(err, ErrCantFindSynonym) {
+		t.Errorf("deleting twice: err = %v, want ErrCantFindSynonym", err)
+	}
+
+	if err = LoadSynonyms(ctx, synCollection, synonyms); err != nil {
+		t.Fatalf("LoadSynonyms: %v", err)
+	}
+
+	if got := synonyms.Of("trainers"); len(got) != 0 {
+		t.Errorf("synonyms of trainers after the delete = %q, want none", got)
+	}
+}
+
+func TestLoadSpellings(t *testing.T) {
+	db := testDatabase(t)
+	ctx := context.Background()
+	products := db.Collection("Products")
+
+	for _, name := range []string{"Running Shoes", "Trail Running Shoes", "Leather Boots"} {
+		name := name
+		product := models.Product{Product_ID: primitive.NewObjectID(), Product_Name: &name}
+
+		if _, err := products.InsertOne(ctx, product); err != nil {
+			t.Fatalf("InsertOne: %v", err)
+		}
+
+		if err := IndexProduct(ctx, products, product); err != nil {
+			t.Fatalf("IndexProduct: %v", err)
+		}
+	}
+
+	speller := search.NewSpeller()
+
+	if err := LoadSpellings(ctx, products, speller); err != nil {
+		t.Fatalf("LoadSpellings: %v", err)
+	}
+
+	for typo, want := range map[string]string{"runnign": "running", "bootz": "boots", "leathr": "leather"} {
+		if got, ok := speller.Correct(typo, search.DefaultMaxEdits); !ok || got != want {
+			t.Errorf("Correct(%q) = %q, %v, want %q", typo, got, ok, want)
+		}
+	}
+}
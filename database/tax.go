@@ -0,0 +1,92 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/logging"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/pricing"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrCantFindTaxRule  = errors.New("can't find the tax rule")
+	ErrCantSaveTaxRule  = errors.New("cannot save the tax rule")
+	ErrCantLoadTaxRules = errors.New("cannot load the tax rules")
+)
+
+func ListTaxRules(ctx context.Context, taxCollection *mongo.Collection) ([]models.TaxRule, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "country", Value: 1}, {Key: "region", Value: 1}, {Key: "tax_class", Value: 1}})
+
+	cursor, err := taxCollection.Find(ctx, bson.M{}, opts)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot load the tax rules", "error", err)
+		return nil, ErrCantLoadTaxRules
+	}
+
+	defer cursor.Close(ctx)
+
+	rules := make([]models.TaxRule, 0)
+
+	if err = cursor.All(ctx, &rules); err != nil {
+		logging.FromContext(ctx).Error("cannot load the tax rules", "error", err)
+		return nil, ErrCantLoadTaxRules
+	}
+
+	return rules, nil
+}
+
+// CreateTaxRule stores a rule with its country and region upper-cased, the
+// way tax locations are read from addresses.
+func CreateTaxRule(ctx context.Context, taxCollection *mongo.Collection, rule models.TaxRule) (models.TaxRule, error) {
+	rule.Rule_ID = primitive.NewObjectID()
+	rule.Country = strings.ToUpper(strings.TrimSpace(rule.Country))
+	rule.Region = strings.ToUpper(strings.TrimSpace(rule.Region))
+	rule.Tax_Class = strings.TrimSpace(rule.Tax_Class)
+	rule.Created_At = time.Now()
+
+	if _, err := taxCollection.InsertOne(ctx, rule); err != nil {
+		logging.FromContext(ctx).Error("cannot save the tax rule", "error", err)
+		return rule, ErrCantSaveTaxRule
+	}
+
+	return rule, nil
+}
+
+func DeleteTaxRule(ctx context.Context, taxCollection *mongo.Collection, ruleID primitive.ObjectID) error {
+	res, err := taxCollection.DeleteOne(ctx, bson.M{"_id": ruleID})
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot save the tax rule", "error", err)
+		return ErrCantSaveTaxRule
+	}
+
+	if res.DeletedCount == 0 {
+		return ErrCantFindTaxRule
+	}
+
+	return nil
+}
+
+// LoadTaxRules replaces the rules of table with the stored ones.
+func LoadTaxRules(ctx context.Context, taxCollection *mongo.Collection, table *pricing.RuleTable) error {
+	rules, err := ListTaxRules(ctx, taxCollection)
+
+	if err != nil {
+		return err
+	}
+
+	if err = table.Reset(rules); err != nil {
+		logging.FromContext(ctx).Error("cannot load the tax rules", "error", err)
+		return ErrCantLoadTaxRules
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/money"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/pricing"
+)
+
+func TestTaxRules(t *testing.T) {
+	ctx := context.Background()
+	taxes := testDatabase(t).Collection("TaxRules")
+
+	california, err := CreateTaxRule(ctx, taxes, models.TaxRule{Country: " us", Region: "ca ", Name: "california", Rate: "7.25"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if california.Country != "US" || california.Region != "CA" {
+		t.Errorf("stored %s/%s, want US/CA", california.Country, california.Region)
+	}
+
+	if _, err = CreateTaxRule(ctx, taxes, models.TaxRule{Country: "US", Name: "federal", Rate: "5"}); err != nil {
+		t.Fatal(err)
+	}
+
+	table := pricing.NewRuleTable()
+
+	if err = LoadTaxRules(ctx, taxes, table); err != nil {
+		t.Fatalf("LoadTaxRules: %v", err)
+	}
+
+	line := []pricing.TaxableLine{{Amount: money.New(1000, "USD")}}
+	lines, _ := table.Calculate(pricing.TaxLocation{Country: "US", Region: "CA"}, line)
+
+	if len(lines) != 1 || lines[0].Rule != "california" {
+		t.Errorf("taxes = %+v, want the california rule", lines)
+	}
+
+	if err = DeleteTaxRule(ctx, taxes, california.Rule_ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = DeleteTaxRule(ctx, taxes, california.Rule_ID); !errors.Is(err, ErrCantFindTaxRule) {
+		t.Errorf("deleting twice: got %v, want %v", err, ErrCantFindTaxRule)
+	}
+
+	if err = LoadTaxRules(ctx, taxes, table); err != nil {
+		t.Fatal(err)
+	}
+
+	if lines, _ = table.Calculate(pricing.TaxLocation{Country: "US", Region: "CA"}, line); len(lines) != 1 || lines[0].Rule != "federal" {
+		t.Errorf("taxes = %+v, want the federal rule", lines)
+	}
+
+	// a stored rule the table can't read leaves the loaded rules alone
+	if _, err = taxes.InsertOne(ctx, models.TaxRule{Country: "DE", Rate: "lots"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = LoadTaxRules(ctx, taxes, table); !errors.Is(err, ErrCantLoadTaxRules) {
+		t.Errorf("loading a bad rate: got %v, want %v", err, ErrCantLoadTaxRules)
+	}
+}
@@ -0,0 +1,353 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/events"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/logging"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/webhook"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrCantFindWebhook     = errors.New("can't find the webhook")
+	ErrCantSaveWebhook     = errors.New("cannot save the webhook")
+	ErrCantFindDelivery    = errors.New("can't find the webhook delivery")
+	ErrCantSaveDelivery    = errors.New("cannot save the webhook delivery")
+	ErrCantDeliverWebhooks = errors.New("cannot deliver the webhooks")
+)
+
+func EnsureWebhookIndexes(ctx context.Context, webhookCollection *mongo.Collection, deliveryCollection *mongo.Collection) error {
+	_, err := deliveryCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			// an event the outbox hands over twice is delivered once
+			Keys:    bson.D{{Key: "webhook_id", Value: 1}, {Key: "event_id", Value: 1}},
+			Options: options.Index().SetName("delivery_event").SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "status", Value: 1}, {Key: "next_attempt_at", Value: 1}},
+			Options: options.Index().SetName("delivery_due"),
+		},
+	})
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot create the indexes", "error", err)
+		return ErrCantCreateIndex
+	}
+
+	_, err = webhookCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "active", Value: 1}},
+		Options: options.Index().SetName("webhook_active"),
+	})
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot create the indexes", "error", err)
+		return ErrCantCreateIndex
+	}
+
+	return nil
+}
+
+// CreateWebhook saves an active endpoint with a new signing secret.
+func CreateWebhook(ctx context.Context, webhookCollection *mongo.Collection, hook models.Webhook) (models.Webhook, error) {
+	secret, err := randomToken()
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot save the webhook", "error", err)
+		return hook, ErrCantSaveWebhook
+	}
+
+	hook.Webhook_ID = primitive.NewObjectID()
+	hook.Secret = secret
+	hook.Active = true
+	hook.Created_At = time.Now()
+
+	if hook.Events == nil {
+		hook.Events = make([]string, 0)
+	}
+
+	if _, err = webhookCollection.InsertOne(ctx, hook); err != nil {
+		logging.FromContext(ctx).Error("cannot save the webhook", "error", err)
+		return hook, ErrCantSaveWebhook
+	}
+
+	return hook, nil
+}
+
+func ListWebhooks(ctx context.Context, webhookCollection *mongo.Collection) ([]models.Webhook, error) {
+	cursor, err := webhookCollection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+
+	if err != nil {
+		logging.FromContext(ctx).Error("can't find the webhook", "error", err)
+		return nil, ErrCantFindWebhook
+	}
+
+	defer cursor.Close(ctx)
+
+	hooks := make([]models.Webhook, 0)
+
+	if err = cursor.All(ctx, &hooks); err != nil {
+		logging.FromContext(ctx).Error("can't find the webhook", "error", err)
+		return nil, ErrCantFindWebhook
+	}
+
+	return hooks, nil
+}
+
+func SetWebhookActive(ctx context.Context, webhookCollection *mongo.Collection, webhookID primitive.ObjectID, active bool) error {
+	result, err := webhookCollection.UpdateByID(ctx, webhookID, bson.M{"$set": bson.M{"active": active}})
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot save the webhook", "error", err)
+		return ErrCantSaveWebhook
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrCantFindWebhook
+	}
+
+	return nil
+}
+
+// DeleteWebhook removes the endpoint; its deliveries stay as history.
+func DeleteWebhook(ctx context.Context, webhookCollection *mongo.Collection, webhookID primitive.ObjectID) error {
+	result, err := webhookCollection.DeleteOne(ctx, bson.M{"_id": webhookID})
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot save the webhook", "error", err)
+		return ErrCantSaveWebhook
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrCantFindWebhook
+	}
+
+	return nil
+}
+
+// WebhookSink is the outbox sink that queues a delivery of each event for
+// every active endpoint that wants its type.
+type WebhookSink struct {
+	Webhooks   *mongo.Collection
+	Deliveries *mongo.Collection
+}
+
+func (s WebhookSink) Publish(ctx context.Context, event events.Event) error {
+	filter := bson.M{
+		"active": true,
+		"$or": bson.A{
+			bson.M{"events": bson.M{"$size": 0}},
+			bson.M{"events": event.Type},
+		},
+	}
+
+	cursor, err := s.Webhooks.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+
+	if err != nil {
+		logging.FromContext(ctx).Error("can't find the webhook", "error", err)
+		return ErrCantFindWebhook
+	}
+
+	var hooks []models.Webhook
+
+	if err = cursor.All(ctx, &hooks); err != nil {
+		logging.FromContext(ctx).Error("can't find the webhook", "error", err)
+		return ErrCantFindWebhook
+	}
+
+	body, err := json.Marshal(event)
+
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	for _, hook := range hooks {
+		delivery := models.WebhookDelivery{
+			Delivery_ID:     primitive.NewObjectID(),
+			Webhook_ID:      hook.Webhook_ID,
+			Event_ID:        event.Event_ID,
+			Event_Type:      event.Type,
+			Body:            string(body),
+			Status:          models.DeliveryPending,
+			Next_Attempt_At: now,
+			Attempts:        make([]models.WebhookAttempt, 0),
+			Created_At:      now,
+		}
+
+		if _, err = s.Deliveries.InsertOne(ctx, delivery); err != nil && !mongo.IsDuplicateKeyError(err) {
+			logging.FromContext(ctx).Error("cannot save the webhook delivery", "error", err)
+			return ErrCantSaveDelivery
+		}
+	}
+
+	return nil
+}
+
+// deliveryClaim is how long a delivery being sent is kept from others.
+const deliveryClaim = 2 * time.Minute
+
+// DeliverWebhooks tries up to batch due deliveries and returns how many it
+// tried. A failed delivery is tried again after webhook.RetryDelay, and goes
+// to the dead-letter list after webhook.MaxAttempts; so does a delivery to
+// an endpoint that was turned off or deleted.
+func DeliverWebhooks(
+	ctx context.Context,
+	webhookCollection *mongo.Collection,
+	deliveryCollection *mongo.Collection,
+	sender *webhook.Sender,
+	batch int,
+) (int, error) {
+	sent := 0
+
+	for sent < batch {
+		now := time.Now()
+
+		filter := bson.M{"status": models.DeliveryPending, "next_attempt_at": bson.M{"$lte": now}}
+		update := bson.M{"$set": bson.M{"next_attempt_at": now.Add(deliveryClaim)}}
+		opts := options.FindOneAndUpdate().SetSort(bson.D{{Key: "next_attempt_at", Value: 1}})
+
+		var delivery models.WebhookDelivery
+
+		err := deliveryCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&delivery)
+
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return sent, nil
+		}
+
+		if err != nil {
+			logging.FromContext(ctx).Error("cannot deliver the webhooks", "error", err)
+			return sent, ErrCantDeliverWebhooks
+		}
+
+		var hook models.Webhook
+
+		err = webhookCollection.FindOne(ctx, bson.M{"_id": delivery.Webhook_ID}).Decode(&hook)
+
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			logging.FromContext(ctx).Error("cannot deliver the webhooks", "error", err)
+			return sent, ErrCantDeliverWebhooks
+		}
+
+		attempt := models.WebhookAttempt{At: now}
+
+		if err != nil || !hook.Active || hook.URL == nil {
+			attempt.Error = "the webhook is turned off or gone"
+		} else {
+			attempt.Status_Code, err = sender.Send(ctx, webhook.Request{
+				URL:         *hook.URL,
+				Secret:      hook.Secret,
+				Delivery_ID: delivery.Delivery_ID.Hex(),
+				Event_Type:  delivery.Event_Type,
+				Body:        []byte(delivery.Body),
+			})
+
+			if err != nil {
+				attempt.Error = err.Error()
+			}
+		}
+
+		attempt.Duration_MS = time.Since(now).Milliseconds()
+
+		if err = recordAttempt(ctx, deliveryCollection, delivery, attempt, hook.Active && hook.URL != nil); err != nil {
+			return sent, err
+		}
+
+		sent++
+	}
+
+	return sent, nil
+}
+
+// recordAttempt saves the outcome of an attempt; a failed one is retried
+// only while retry holds and attempts are left.
+func recordAttempt(
+	ctx context.Context,
+	deliveryCollection *mongo.Collection,
+	delivery models.WebhookDelivery,
+	attempt models.WebhookAttempt,
+	retry bool,
+) error {
+	set := bson.M{}
+
+	switch {
+	case attempt.Error == "":
+		set["status"] = models.DeliveryDelivered
+		set["delivered_at"] = attempt.At
+	case retry && delivery.Failures+1 < webhook.MaxAttempts:
+		set["failures"] = delivery.Failures + 1
+		set["next_attempt_at"] = attempt.At.Add(webhook.RetryDelay(delivery.Failures + 1))
+	default:
+		set["failures"] = delivery.Failures + 1
+		set["status"] = models.DeliveryDead
+	}
+
+	update := bson.M{"$set": set, "$push": bson.M{"attempts": attempt}}
+
+	if _, err := deliveryCollection.UpdateByID(ctx, delivery.Delivery_ID, update); err != nil {
+		logging.FromContext(ctx).Error("cannot save the webhook delivery", "error", err)
+		return ErrCantSaveDelivery
+	}
+
+	return nil
+}
+
+// ListDeliveries lists the deliveries filter matches, newest first.
+func ListDeliveries(ctx context.Context, deliveryCollection *mongo.Collection, filter bson.M, limit int64) ([]models.WebhookDelivery, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(limit)
+
+	cursor, err := deliveryCollection.Find(ctx, filter, opts)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("can't find the webhook delivery", "error", err)
+		return nil, ErrCantFindDelivery
+	}
+
+	defer cursor.Close(ctx)
+
+	deliveries := make([]models.WebhookDelivery, 0)
+
+	if err = cursor.All(ctx, &deliveries); err != nil {
+		logging.FromContext(ctx).Error("can't find the webhook delivery", "error", err)
+		return nil, ErrCantFindDelivery
+	}
+
+	return deliveries, nil
+}
+
+// Redeliver queues a delivery to be sent again right away, with a fresh
+// set of attempts, whatever its status; its history stays.
+func Redeliver(ctx context.Context, deliveryCollection *mongo.Collection, deliveryID primitive.ObjectID) (models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+
+	update := bson.M{
+		"$set": bson.M{
+			"status":          models.DeliveryPending,
+			"failures":        0,
+			"next_attempt_at": time.Now(),
+		},
+		"$unset": bson.M{"delivered_at": ""},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	err := deliveryCollection.FindOneAndUpdate(ctx, bson.M{"_id": deliveryID}, update, opts).Decode(&delivery)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return delivery, ErrCantFindDelivery
+	}
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot save the webhook delivery", "error", err)
+		return delivery, ErrCantSaveDelivery
+	}
+
+	return delivery, nil
+}
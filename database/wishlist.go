@@ -0,0 +1,534 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/logging"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	ErrCantFindWishlist    = errors.New("can't find the wishlist")
+	ErrCantSaveWishlist    = errors.New("cannot save the wishlist")
+	ErrWishlistNameTaken   = errors.New("there is already a wishlist with this name")
+	ErrNotOnWishlist       = errors.New("this product is not on the wishlist")
+	ErrNotInCart           = errors.New("this product is not in the cart")
+	ErrCantCheckWishlists  = errors.New("cannot check the wishlists against the catalog")
+	ErrCantCreateShareLink = errors.New("cannot create the share link")
+)
+
+func EnsureWishlistIndexes(ctx context.Context, wishlistCollection *mongo.Collection) error {
+	_, err := wishlistCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "name", Value: 1}},
+			Options: options.Index().SetName("wishlist_user_name").SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "share_token", Value: 1}},
+			Options: options.Index().SetName("wishlist_share").SetUnique(true).SetSparse(true),
+		},
+	})
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot create the indexes", "error", err)
+		return ErrCantCreateIndex
+	}
+
+	return nil
+}
+
+// randomToken makes the secret part of a link, e.g. a share link.
+func randomToken() (string, error) {
+	b := make([]byte, 16)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+func newWishlistItem(product catalogItem, now time.Time) models.WishlistItem {
+	return models.WishlistItem{
+		ProductUser: product.ProductUser,
+		In_Stock:    product.Stock == nil || *product.Stock > 0,
+		Added_At:    now,
+	}
+}
+
+func CreateWishlist(ctx context.Context, wishlistCollection *mongo.Collection, userID string, name string) (models.Wishlist, error) {
+	now := time.Now()
+
+	list := models.Wishlist{
+		Wishlist_ID: primitive.NewObjectID(),
+		User_ID:     userID,
+		Name:        &name,
+		Items:       make([]models.WishlistItem, 0),
+		Notices:     make([]models.CartNotice, 0),
+		Created_At:  now,
+		Updated_At:  now,
+	}
+
+	if _, err := primitive.ObjectIDFromHex(userID); err != nil {
+		logging.FromContext(ctx).Warn("this user is not valid", "error", err)
+		return list, ErrUserIdIsNotValid
+	}
+
+	if _, err := wishlistCollection.InsertOne(ctx, list); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return list, ErrWishlistNameTaken
+		}
+
+		logging.FromContext(ctx).Error("cannot save the wishlist", "error", err)
+		return list, ErrCantSaveWishlist
+	}
+
+	return list, nil
+}
+
+// ListWishlists returns the user's wishlists, oldest first, after checking
+// them against the catalog.
+func ListWishlists(
+	ctx context.Context,
+	prodCollection *mongo.Collection,
+	wishlistCollection *mongo.Collection,
+	userID string,
+) ([]models.Wishlist, error) {
+	if err := CheckWishlists(ctx, prodCollection, wishlistCollection, bson.M{"user_id": userID}); err != nil {
+		return nil, err
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+
+	cursor, err := wishlistCollection.Find(ctx, bson.M{"user_id": userID}, opts)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("can't find the wishlist", "error", err)
+		return nil, ErrCantFindWishlist
+	}
+
+	defer cursor.Close(ctx)
+
+	lists := make([]models.Wishlist, 0)
+
+	if err = cursor.All(ctx, &lists); err != nil {
+		logging.FromContext(ctx).Error("can't find the wishlist", "error", err)
+		return nil, ErrCantFindWishlist
+	}
+
+	return lists, nil
+}
+
+func DeleteWishlist(ctx context.Context, wishlistCollection *mongo.Collection, userID string, wishlistID primitive.ObjectID) error {
+	result, err := wishlistCollection.DeleteOne(ctx, bson.M{"_id": wishlistID, "user_id": userID})
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot save the wishlist", "error", err)
+		return ErrCantSaveWishlist
+	}
+
+	if result.DeletedCount == 0 {
+		return ErrCantFindWishlist
+	}
+
+	return nil
+}
+
+// pushWishlistItem adds item to the wishlist filter matches unless it is
+// already on it. It reports whether filter matched a wishlist.
+func pushWishlistItem(ctx context.Context, wishlistCollection *mongo.Collection, filter bson.M, item models.WishlistItem) (bool, error) {
+	conditional := bson.M{"items._id": bson.M{"$ne": item.Product_ID}}
+
+	for key, value := range filter {
+		conditional[key] = value
+	}
+
+	update := bson.M{
+		"$push": bson.M{"items": item},
+		"$set":  bson.M{"updated_at": item.Added_At},
+	}
+
+	result, err := wishlistCollection.UpdateOne(ctx, conditional, update)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot save the wishlist", "error", err)
+		return false, ErrCantSaveWishlist
+	}
+
+	if result.MatchedCount > 0 {
+		return true, nil
+	}
+
+	count, err := wishlistCollection.CountDocuments(ctx, filter)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot save the wishlist", "error", err)
+		return false, ErrCantSaveWishlist
+	}
+
+	return count > 0, nil
+}
+
+// AddToWishlist puts the product on one of the user's wishlists; adding it
+// again changes nothing.
+func AddToWishlist(
+	ctx context.Context,
+	prodCollection *mongo.Collection,
+	wishlistCollection *mongo.Collection,
+	userID string,
+	wishlistID primitive.ObjectID,
+	productID primitive.ObjectID,
+) error {
+	product, err := findCatalogItem(ctx, prodCollection, productID)
+
+	if err != nil {
+		return err
+	}
+
+	found, err := pushWishlistItem(ctx, wishlistCollection, bson.M{"_id": wishlistID, "user_id": userID}, newWishlistItem(product, time.Now()))
+
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		return ErrCantFindWishlist
+	}
+
+	return nil
+}
+
+func RemoveFromWishlist(
+	ctx context.Context,
+	wishlistCollection *mongo.Collection,
+	userID string,
+	wishlistID primitive.ObjectID,
+	productID primitive.ObjectID,
+) error {
+	filter := bson.M{"_id": wishlistID, "user_id": userID}
+	update := bson.M{
+		"$pull": bson.M{"items": bson.M{"_id": productID}},
+		"$set":  bson.M{"updated_at": time.Now()},
+	}
+
+	result, err := wishlistCollection.UpdateOne(ctx, filter, update)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot save the wishlist", "error", err)
+		return ErrCantSaveWishlist
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrCantFindWishlist
+	}
+
+	return nil
+}
+
+// ShareWishlist gives the wishlist a new share token, which replaces any
+// earlier link, or with share false takes the link away.
+func ShareWishlist(
+	ctx context.Context,
+	wishlistCollection *mongo.Collection,
+	userID string,
+	wishlistID primitive.ObjectID,
+	share bool,
+) (models.Wishlist, error) {
+	var list models.Wishlist
+
+	update := bson.M{"$unset": bson.M{"share_token": ""}}
+
+	if share {
+		token, err := randomToken()
+
+		if err != nil {
+			logging.FromContext(ctx).Error("cannot create the share link", "error", err)
+			return list, ErrCantCreateShareLink
+		}
+
+		update = bson.M{"$set": bson.M{"share_token": token}}
+	}
+
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	err := wishlistCollection.FindOneAndUpdate(ctx, bson.M{"_id": wishlistID, "user_id": userID}, update, opts).Decode(&list)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return list, ErrCantFindWishlist
+	}
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot save the wishlist", "error", err)
+		return list, ErrCantSaveWishlist
+	}
+
+	return list, nil
+}
+
+// SharedWishlist finds the wishlist shared with token.
+func SharedWishlist(ctx context.Context, wishlistCollection *mongo.Collection, token string) (models.Wishlist, error) {
+	var list models.Wishlist
+
+	if token == "" {
+		return list, ErrCantFindWishlist
+	}
+
+	err := wishlistCollection.FindOne(ctx, bson.M{"share_token": token}).Decode(&list)
+
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return list, ErrCantFindWishlist
+	}
+
+	if err != nil {
+		logging.FromContext(ctx).Error("can't find the wishlist", "error", err)
+		return list, ErrCantFindWishlist
+	}
+
+	return list, nil
+}
+
+// MoveToCart puts a product of the wishlist in the user's cart and takes it
+// off the wishlist.
+func MoveToCart(
+	ctx context.Context,
+	prodCollection *mongo.Collection,
+	cartCollection *mongo.Collection,
+	wishlistCollection *mongo.Collection,
+	userID string,
+	wishlistID primitive.ObjectID,
+	productID primitive.ObjectID,
+) error {
+	count, err := wishlistCollection.CountDocuments(ctx, bson.M{"_id": wishlistID, "user_id": userID, "items._id": productID})
+
+	if err != nil {
+		logging.FromContext(ctx).Error("can't find the wishlist", "error", err)
+		return ErrCantFindWishlist
+	}
+
+	if count == 0 {
+		return ErrNotOnWishlist
+	}
+
+	if err = AddProductToCart(ctx, prodCollection, cartCollection, productID, userID); err != nil {
+		return err
+	}
+
+	return RemoveFromWishlist(ctx, wishlistCollection, userID, wishlistID, productID)
+}
+
+// SaveForLater takes a product out of the user's cart and puts it on their
+// models.SavedForLater wishlist.
+func SaveForLater(
+	ctx context.Context,
+	prodCollection *mongo.Collection,
+	cartCollection *mongo.Collection,
+	wishlistCollection *mongo.Collection,
+	userID string,
+	productID primitive.ObjectID,
+) error {
+	if _, err := primitive.ObjectIDFromHex(userID); err != nil {
+		logging.FromContext(ctx).Warn("this user is not valid", "error", err)
+		return ErrUserIdIsNotValid
+	}
+
+	cart, err := findCart(ctx, cartCollection, userID)
+
+	if err != nil {
+		return err
+	}
+
+	inCart := false
+
+	for _, item := range cart.Items {
+		if item.Product_ID == productID {
+			inCart = true
+			break
+		}
+	}
+
+	if !inCart {
+		return ErrNotInCart
+	}
+
+	product, err := findCatalogItem(ctx, prodCollection, productID)
+
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	filter := bson.M{"user_id": userID, "name": models.SavedForLater}
+
+	create := bson.M{"$setOnInsert": bson.M{
+		"_id":        primitive.NewObjectID(),
+		"items":      make([]models.WishlistItem, 0),
+		"notices":    make([]models.CartNotice, 0),
+		"created_at": now,
+		"updated_at": now,
+	}}
+
+	// a concurrent save may create the list first, which is just as good
+	_, err = wishlistCollection.UpdateOne(ctx, filter, create, options.Update().SetUpsert(true))
+
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		logging.FromContext(ctx).Error("cannot save the wishlist", "error", err)
+		return ErrCantSaveWishlist
+	}
+
+	if _, err = pushWishlistItem(ctx, wishlistCollection, filter, newWishlistItem(product, now)); err != nil {
+		return err
+	}
+
+	return RemoveCartItem(ctx, prodCollection, cartCollection, productID, userID)
+}
+
+// checkWishlistItems checks the wishlist items against the catalog: each
+// item takes the product's current price and details, items of products
+// that are gone are dropped, and price drops and products back in stock get
+// a notice.
+func checkWishlistItems(
+	items []models.WishlistItem,
+	catalog map[primitive.ObjectID]catalogItem,
+	now time.Time,
+) ([]models.WishlistItem, []models.CartNotice) {
+	fresh := make([]models.WishlistItem, 0, len(items))
+	notices := make([]models.CartNotice, 0)
+
+	notice := func(kind string, item models.ProductUser, message string) *models.CartNotice {
+		notices = append(notices, models.CartNotice{
+			Kind:         kind,
+			Product_ID:   item.Product_ID,
+			Product_Name: item.Product_Name,
+			Message:      message,
+			Noticed_At:   now,
+		})
+
+		return &notices[len(notices)-1]
+	}
+
+	for _, item := range items {
+		product, ok := catalog[item.Product_ID]
+
+		if !ok {
+			notice(models.CartItemUnavailable, item.ProductUser, fmt.Sprintf("%s is no longer sold and was removed from your wishlist", productName(item.ProductUser)))
+			continue
+		}
+
+		checked := newWishlistItem(product, item.Added_At)
+
+		if checked.In_Stock && !item.In_Stock {
+			notice(models.WishlistBackInStock, product.ProductUser, fmt.Sprintf("%s is back in stock", productName(product.ProductUser)))
+		}
+
+		oldPrice, newPrice := item.Price, product.Price
+
+		// a rise only moves the price a drop is measured from
+		if oldPrice.Currency == newPrice.Currency && newPrice.Amount < oldPrice.Amount {
+			message := fmt.Sprintf("the price of %s dropped from %s to %s", productName(product.ProductUser), oldPrice, newPrice)
+
+			n := notice(models.WishlistPriceDropped, product.ProductUser, message)
+			n.Old_Price, n.New_Price = &oldPrice, &newPrice
+		}
+
+		fresh = append(fresh, checked)
+	}
+
+	return fresh, notices
+}
+
+// CheckWishlists checks the wishlists filter matches, all with a nil filter,
+// against the catalog, see checkWishlistItems, and saves what changed. A
+// wishlist changed meanwhile is left for the next check.
+func CheckWishlists(
+	ctx context.Context,
+	prodCollection *mongo.Collection,
+	wishlistCollection *mongo.Collection,
+	filter bson.M,
+) error {
+	query := bson.M{"items.0": bson.M{"$exists": true}}
+
+	for key, value := range filter {
+		query[key] = value
+	}
+
+	cursor, err := wishlistCollection.Find(ctx, query)
+
+	if err != nil {
+		logging.FromContext(ctx).Error("cannot check the wishlists against the catalog", "error", err)
+		return ErrCantCheckWishlists
+	}
+
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var list models.Wishlist
+
+		if err = cursor.Decode(&list); err != nil {
+			logging.FromContext(ctx).Error("cannot check the wishlists against the catalog", "error", err)
+			return ErrCantCheckWishlists
+		}
+
+		products := make([]models.ProductUser, len(list.Items))
+
+		for i, item := range list.Items {
+			products[i] = item.ProductUser
+		}
+
+		catalog, err := catalogItems(ctx, prodCollection, products)
+
+		if err != nil {
+			return ErrCantCheckWishlists
+		}
+
+		now := time.Now()
+		items, notices := checkWishlistItems(list.Items, catalog, now)
+
+		if len(notices) == 0 && reflect.DeepEqual(items, list.Items) {
+			continue
+		}
+
+		update := bson.M{
+			"$set":  bson.M{"items": items, "updated_at": now},
+			"$push": bson.M{"notices": bson.M{"$each": notices}},
+		}
+
+		_, err = wishlistCollection.UpdateOne(ctx, bson.M{"_id": list.Wishlist_ID, "updated_at": list.Updated_At}, update)
+
+		if err != nil {
+			logging.FromContext(ctx).Error("cannot check the wishlists against the catalog", "error", err)
+			return ErrCantCheckWishlists
+		}
+	}
+
+	if err = cursor.Err(); err != nil {
+		logging.FromContext(ctx).Error("cannot check the wishlists against the catalog", "error", err)
+		return ErrCantCheckWishlists
+	}
+
+	return nil
+}
+
+// AcknowledgeWishlistNotices drops the notices of list once the customer
+// has been shown them; newer ones stay.
+func AcknowledgeWishlistNotices(ctx context.Context, wishlistCollection *mongo.Collection, list models.Wishlist) error {
+	if len(list.Notices) == 0 {
+		return nil
+	}
+
+	if err := acknowledgeNotices(ctx, wishlistCollection, list.Wishlist_ID, list.Notices); err != nil {
+		logging.FromContext(ctx).Error("cannot save the wishlist", "error", err)
+		return ErrCantSaveWishlist
+	}
+
+	return nil
+}
@@ -0,0 +1,169 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/logging"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Types of domain events.
+const (
+	UserSignedUp    = "UserSignedUp"
+	CartUpdated     = "CartUpdated"
+	OrderPlaced     = "OrderPlaced"
+	OrderShipped    = "OrderShipped"
+	PaymentCaptured = "PaymentCaptured"
+	OrderDelivered  = "OrderDelivered"
+	OrderCancelled  = "OrderCancelled"
+	OrderRefunded   = "OrderRefunded"
+	ReturnUpdated   = "ReturnUpdated"
+)
+
+// Event is a domain event: something that happened to the aggregate, the
+// user, cart or order, in Aggregate_ID. Sinks may see an event more than
+// once and can tell repeats apart by Event_ID.
+type Event struct {
+	Event_ID     primitive.ObjectID `json:"id" bson:"_id"`
+	Type         string             `json:"type" bson:"type"`
+	Aggregate_ID string             `json:"aggregate_id" bson:"aggregate_id"`
+	Payload      json.RawMessage    `json:"payload" bson:"payload"`
+	Occurred_At  time.Time          `json:"occurred_at" bson:"occurred_at"`
+}
+
+// New makes an event with payload encoded as JSON.
+func New(eventType string, aggregateID string, payload interface{}) (Event, error) {
+	data, err := json.Marshal(payload)
+
+	if err != nil {
+		return Event{}, err
+	}
+
+	return Event{
+		Event_ID:     primitive.NewObjectID(),
+		Type:         eventType,
+		Aggregate_ID: aggregateID,
+		Payload:      data,
+		Occurred_At:  time.Now(),
+	}, nil
+}
+
+// Sink receives dispatched events. An error makes the dispatcher try the
+// event again later.
+type Sink interface {
+	Publish(ctx context.Context, event Event) error
+}
+
+// SinkFunc lets a function be a Sink.
+type SinkFunc func(ctx context.Context, event Event) error
+
+func (f SinkFunc) Publish(ctx context.Context, event Event) error {
+	return f(ctx, event)
+}
+
+// LogSink writes events to the log.
+type LogSink struct{}
+
+func (LogSink) Publish(ctx context.Context, event Event) error {
+	logging.FromContext(ctx).Info("event", "type", event.Type, "event_id", event.Event_ID.Hex(), "aggregate_id", event.Aggregate_ID, "payload", string(event.Payload))
+	return nil
+}
+
+// MemorySink keeps the events it receives in process, for tests.
+type MemorySink struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (s *MemorySink) Publish(ctx context.Context, event Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.events = append(s.events, event)
+
+	return nil
+}
+
+// Events returns the events received so far.
+func (s *MemorySink) Events() []Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Event(nil), s.events...)
+}
+
+// Actions of CartUpdated.
+const (
+	CartItemAdded     = "item_added"
+	CartItemRemoved   = "item_removed"
+	CartSavedForLater = "saved_for_later"
+	CartMovedFromList = "moved_from_wishlist"
+	CartMergedGuest   = "merged_guest_cart"
+)
+
+type UserSignedUpPayload struct {
+	User_ID    string `json:"user_id"`
+	Email      string `json:"email"`
+	First_Name string `json:"first_name"`
+	Last_Name  string `json:"last_name"`
+}
+
+type CartUpdatedPayload struct {
+	User_ID    string `json:"user_id"`
+	Action     string `json:"action"`
+	Product_ID string `json:"product_id,omitempty"`
+}
+
+type OrderPlacedPayload struct {
+	User_ID string       `json:"user_id"`
+	Order   models.Order `json:"order"`
+}
+
+type OrderShippedPayload struct {
+	User_ID  string          `json:"user_id"`
+	Order_ID string          `json:"order_id"`
+	Shipment models.Shipment `json:"shipment"`
+}
+
+type PaymentCapturedPayload struct {
+	User_ID    string      `json:"user_id"`
+	Order_ID   string      `json:"order_id"`
+	Payment_ID string      `json:"payment_id"`
+	Method     string      `json:"method"`
+	Amount     money.Money `json:"amount"`
+}
+
+// OrderDeliveredPayload is a parcel of the order that arrived; Status is
+// the order's status after it, delivered once every parcel did.
+type OrderDeliveredPayload struct {
+	User_ID  string          `json:"user_id"`
+	Order_ID string          `json:"order_id"`
+	Status   string          `json:"status"`
+	Shipment models.Shipment `json:"shipment"`
+}
+
+// OrderCancelledPayload has the refund of what was paid, if anything was.
+type OrderCancelledPayload struct {
+	User_ID  string         `json:"user_id"`
+	Order_ID string         `json:"order_id"`
+	Refund   *models.Refund `json:"refund"`
+}
+
+type OrderRefundedPayload struct {
+	User_ID  string        `json:"user_id"`
+	Order_ID string        `json:"order_id"`
+	Refund   models.Refund `json:"refund"`
+}
+
+// ReturnUpdatedPayload is a return that was requested or moved on, in its
+// new status.
+type ReturnUpdatedPayload struct {
+	User_ID  string        `json:"user_id"`
+	Order_ID string        `json:"order_id"`
+	Return   models.Return `json:"return"`
+}
@@ -0,0 +1,160 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+// MaxBytes is the largest upload accepted.
+const MaxBytes = 10 << 20
+
+// MaxPixels bounds the decoded size, so a small file can't expand into
+// gigabytes of memory.
+const MaxPixels = 40_000_000
+
+var (
+	ErrTooLarge        = errors.New("image is too large")
+	ErrUnsupportedType = errors.New("only jpeg, png and gif images are accepted")
+	ErrCorrupt         = errors.New("image could not be decoded")
+)
+
+// Size is a thumbnail box; images are scaled to fit inside it.
+type Size struct {
+	Name   string
+	Width  int
+	Height int
+}
+
+var ThumbnailSizes = []Size{
+	{Name: "small", Width: 150, Height: 150},
+	{Name: "medium", Width: 400, Height: 400},
+	{Name: "large", Width: 800, Height: 800},
+}
+
+var extensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// Sniff returns the content type of data from its first bytes, ignoring
+// whatever the client claimed.
+func Sniff(data []byte) (string, error) {
+	contentType := http.DetectContentType(data)
+
+	if _, ok := extensions[contentType]; !ok {
+		return "", ErrUnsupportedType
+	}
+
+	return contentType, nil
+}
+
+func Extension(contentType string) string {
+	return extensions[contentType]
+}
+
+// Decode checks the dimensions before decoding the pixels.
+func Decode(data []byte) (image.Image, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+
+	return img, nil
+}
+
+// Fit scales src down to fit in size, keeping the aspect ratio. Images that
+// already fit are returned as is.
+func Fit(src image.Image, size Size) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	if w <= size.Width && h <= size.Height {
+		return src
+	}
+
+	dw, dh := size.Width, h*size.Width/w
+
+	if dh > size.Height {
+		dw, dh = w*size.Height/h, size.Height
+	}
+
+	return resize(src, max(dw, 1), max(dh, 1))
+}
+
+// resize is a box filter: each destination pixel is the average of the
+// source pixels it covers, which is what a downscale wants.
+func resize(src image.Image, dw, dh int) image.Image {
+	b := src.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < dh; y++ {
+		y0 := b.Min.Y + y*sh/dh
+		y1 := max(b.Min.Y+(y+1)*sh/dh, y0+1)
+
+		for x := 0; x < dw; x++ {
+			x0 := b.Min.X + x*sw/dw
+			x1 := max(b.Min.X+(x+1)*sw/dw, x0+1)
+
+			var r, g, bl, a, n uint64
+
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					c := color.NRGBAModel.Convert(src.At(sx, sy)).(color.NRGBA)
+					r += uint64(c.R)
+					g += uint64(c.G)
+					bl += uint64(c.B)
+					a += uint64(c.A)
+					n++
+				}
+			}
+
+			dst.SetNRGBA(x, y, color.NRGBA{
+				R: uint8(r / n),
+				G: uint8(g / n),
+				B: uint8(bl / n),
+				A: uint8(a / n),
+			})
+		}
+	}
+
+	return dst
+}
+
+// Encode writes thumbnails as png when the original may have transparency
+// and as jpeg otherwise. It returns the content type used.
+func Encode(img image.Image, originalType string) ([]byte, string, error) {
+	var buf bytes.Buffer
+
+	if originalType == "image/png" || originalType == "image/gif" {
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, "", err
+		}
+
+		return buf.Bytes(), "image/png", nil
+	}
+
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85}); err != nil {
+		return nil, "", err
+	}
+
+	return buf.Bytes(), "image/jpeg", nil
+}
@@ -0,0 +1,163 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+func encodePNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: 200, G: 100, B: 50, A: 255})
+		}
+	}
+
+	var buf bytes.Buffer
+
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestSniff(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+		err  error
+	}{
+		{name: "png", data: encodePNG(t, 1, 1), want: "image/png"},
+		{name: "gif", data: []byte("GIF89a\x01\x00\x01\x00"), want: "image/gif"},
+		{name: "jpeg", data: []byte("\xff\xd8\xff\xe0"), want: "image/jpeg"},
+		{name: "text", data: []byte("hello"), err: ErrUnsupportedType},
+		{name: "svg", data: []byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`), err: ErrUnsupportedType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Sniff(tt.data)
+
+			if !errors.Is(err, tt.err) || got != tt.want {
+				t.Errorf("Sniff() = %q, %v, want %q, %v", got, err, tt.want, tt.err)
+			}
+		})
+	}
+}
+
+func TestDecode(t *testing.T) {
+	if _, err := Decode([]byte("\x89PNG\r\n\x1a\nnot really")); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("corrupt png: got %v, want %v", err, ErrCorrupt)
+	}
+
+	img, err := Decode(encodePNG(t, 3, 2))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if b := img.Bounds(); b.Dx() != 3 || b.Dy() != 2 {
+		t.Errorf("decoded %v, want 3x2", b)
+	}
+}
+
+func TestDecodeChecksDimensionsFirst(t *testing.T) {
+	data := encodePNG(t, 1, 1)
+
+	// the IHDR chunk right after the signature holds the width and height;
+	// the pixel data that follows is never read
+	big := append([]byte(nil), data...)
+	copy(big[16:24], []byte{0, 0, 0x27, 0x10, 0, 0, 0x27, 0x10})
+	binary.BigEndian.PutUint32(big[29:33], crc32.ChecksumIEEE(big[12:29]))
+
+	if _, err := Decode(big); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("10000x10000 png: got %v, want %v", err, ErrTooLarge)
+	}
+}
+
+func TestFit(t *testing.T) {
+	box := Size{Name: "box", Width: 100, Height: 100}
+
+	tests := []struct {
+		name      string
+		w, h      int
+		wantW     int
+		wantH     int
+		unchanged bool
+	}{
+		{name: "already fits", w: 80, h: 50, wantW: 80, wantH: 50, unchanged: true},
+		{name: "wide", w: 400, h: 200, wantW: 100, wantH: 50},
+		{name: "tall", w: 200, h: 400, wantW: 50, wantH: 100},
+		{name: "square", w: 300, h: 300, wantW: 100, wantH: 100},
+		{name: "very thin keeps a pixel", w: 1000, h: 1, wantW: 100, wantH: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := image.NewNRGBA(image.Rect(0, 0, tt.w, tt.h))
+			got := Fit(src, box)
+
+			if b := got.Bounds(); b.Dx() != tt.wantW || b.Dy() != tt.wantH {
+				t.Errorf("Fit(%dx%d) = %dx%d, want %dx%d", tt.w, tt.h, b.Dx(), b.Dy(), tt.wantW, tt.wantH)
+			}
+
+			if tt.unchanged && got != image.Image(src) {
+				t.Error("an image that fits should be returned as is")
+			}
+		})
+	}
+}
+
+func TestFitAveragesPixels(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	src.SetNRGBA(0, 0, color.NRGBA{R: 0, A: 255})
+	src.SetNRGBA(1, 0, color.NRGBA{R: 200, A: 255})
+
+	got := Fit(src, Size{Width: 1, Height: 1})
+
+	if c := color.NRGBAModel.Convert(got.At(0, 0)).(color.NRGBA); c.R != 100 || c.A != 255 {
+		t.Errorf("got %v, want the average of both pixels", c)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+
+	tests := []struct {
+		original string
+		want     string
+	}{
+		{original: "image/png", want: "image/png"},
+		{original: "image/gif", want: "image/png"},
+		{original: "image/jpeg", want: "image/jpeg"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.original, func(t *testing.T) {
+			data, contentType, err := Encode(img, tt.original)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if contentType != tt.want {
+				t.Errorf("content type %q, want %q", contentType, tt.want)
+			}
+
+			if sniffed, _ := Sniff(data); sniffed != tt.want {
+				t.Errorf("encoded data looks like %q, want %q", sniffed, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// New builds the service's logger, writing JSON lines to w unless
+// LOG_FORMAT is "text". LOG_LEVEL is one of debug, info, warn or error,
+// info by default.
+func New(w io.Writer) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: level(os.Getenv("LOG_LEVEL"))}
+
+	if strings.EqualFold(os.Getenv("LOG_FORMAT"), "text") {
+		return slog.New(slog.NewTextHandler(w, opts))
+	}
+
+	return slog.New(slog.NewJSONHandler(w, opts))
+}
+
+func level(name string) slog.Level {
+	switch strings.ToLower(name) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// New(os.Stderr) is made the default logger as soon as this package loads,
+// before the database package connects in its own initialization; the
+// standard log package writes to it from then on as well.
+func init() {
+	slog.SetDefault(New(os.Stderr))
+}
+
+type loggerKey struct{}
+
+type requestIDKey struct{}
+
+// WithLogger returns a copy of ctx that carries logger, for FromContext.
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext is the logger ctx carries, with the fields of the request or
+// job it belongs to, or the default logger.
+func FromContext(ctx context.Context) *slog.Logger {
+	if ctx != nil {
+		if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+			return logger
+		}
+	}
+
+	return slog.Default()
+}
+
+// WithRequestID returns a copy of ctx for the request with the id, whose
+// logger logs it as "request_id".
+func WithRequestID(ctx context.Context, id string) context.Context {
+	ctx = context.WithValue(ctx, requestIDKey{}, id)
+
+	return WithLogger(ctx, FromContext(ctx).With("request_id", id))
+}
+
+// RequestID is the id of the request ctx belongs to, or "".
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+
+	id, _ := ctx.Value(requestIDKey{}).(string)
+
+	return id
+}
@@ -1,13 +1,31 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/Ricardo-Cardozo/ecommerce_golang/blobstore"
 	"github.com/Ricardo-Cardozo/ecommerce_golang/controllers"
 	"github.com/Ricardo-Cardozo/ecommerce_golang/database"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/events"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/logging"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/metrics"
 	"github.com/Ricardo-Cardozo/ecommerce_golang/middleware"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/money"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/notification"
 	"github.com/Ricardo-Cardozo/ecommerce_golang/routes"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/scheduler"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/search"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/tracing"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/webhook"
 	"github.com/gin-gonic/gin"
 )
 
@@ -18,21 +36,422 @@ func main() {
 		port = "8000"
 	}
 
+	shutdownTracing, err := tracing.Setup(context.Background())
+
+	if err != nil {
+		fatal("cannot set up tracing", err)
+	}
+
+	if err := database.Connect(context.Background()); err != nil {
+		fatal("cannot connect to mongodb", err)
+	}
+
+	// only for a MongoDB that can't be made a replica set, e.g. in
+	// development; events may be lost
+	database.EventsWithoutTransactions = os.Getenv("OUTBOX_WITHOUT_TRANSACTIONS") == "true"
+
+	if err := database.CheckTransactions(context.Background(), database.Client); err != nil {
+		fatal("cannot record events", err)
+	}
+
+	blobDir := os.Getenv("BLOB_DIR")
+
+	if blobDir == "" {
+		blobDir = "uploads"
+	}
+
+	blobs, err := blobstore.NewLocalStore(blobDir, "/images")
+
+	if err != nil {
+		fatal("cannot open the blob store", err)
+	}
+
+	controllers.Blobs = blobs
+
+	if currency := os.Getenv("DEFAULT_CURRENCY"); money.Valid(currency) {
+		money.DefaultCurrency = strings.ToUpper(currency)
+	}
+
+	ratesFile := os.Getenv("RATES_FILE")
+
+	if ratesFile == "" {
+		ratesFile = "rates.json"
+	}
+
+	if err := controllers.Rates.Load(ratesFile); err != nil {
+		fatal("cannot load the exchange rates", err)
+	}
+
+	controllers.RatesFile = ratesFile
+
+	if edits, err := strconv.Atoi(os.Getenv("SEARCH_MAX_EDITS")); err == nil && edits >= 0 {
+		search.DefaultMaxEdits = edits
+	}
+
+	notifier, err := newNotifier()
+
+	if err != nil {
+		fatal("cannot set up the notifications", err)
+	}
+
+	controllers.Notifier = notifier
+
 	app := controllers.NewApplication(
 		database.ProductData(database.Client, "Products"),
 		database.UserData(database.Client, "Users"),
 	)
 
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+
+	if err := database.MigrateProductPrices(ctx, controllers.ProductCollection); err != nil {
+		slog.Error("cannot prepare the database", "error", err)
+	}
+
+	if err := database.MigrateCarts(ctx, controllers.UserCollection, controllers.CartCollection); err != nil {
+		slog.Error("cannot prepare the database", "error", err)
+	}
+
+	if err := database.EnsureCartIndexes(ctx, controllers.CartCollection); err != nil {
+		slog.Error("cannot prepare the database", "error", err)
+	}
+
+	if err := database.EnsureWishlistIndexes(ctx, controllers.WishlistCollection); err != nil {
+		slog.Error("cannot prepare the database", "error", err)
+	}
+
+	if err := database.EnsureReminderIndexes(ctx, controllers.ReminderCollection); err != nil {
+		slog.Error("cannot prepare the database", "error", err)
+	}
+
+	if err := database.EnsureOutboxIndexes(ctx, controllers.OutboxCollection); err != nil {
+		slog.Error("cannot prepare the database", "error", err)
+	}
+
+	if err := database.EnsureProductIndexes(ctx, controllers.ProductCollection); err != nil {
+		slog.Error("cannot prepare the database", "error", err)
+	}
+
+	if err := database.EnsureReviewIndexes(ctx, controllers.ReviewCollection); err != nil {
+		slog.Error("cannot prepare the database", "error", err)
+	}
+
+	if err := database.EnsureCouponIndexes(ctx, controllers.CouponCollection, controllers.RedemptionCollection); err != nil {
+		slog.Error("cannot prepare the database", "error", err)
+	}
+
+	if err := database.EnsureShipmentIndexes(ctx, controllers.ShipmentCollection); err != nil {
+		slog.Error("cannot prepare the database", "error", err)
+	}
+
+	if err := database.EnsureRefundIndexes(ctx, controllers.ReturnCollection, controllers.RefundCollection); err != nil {
+		slog.Error("cannot prepare the database", "error", err)
+	}
+
+	if err := database.EnsureWebhookIndexes(ctx, controllers.WebhookCollection, controllers.DeliveryCollection); err != nil {
+		slog.Error("cannot prepare the database", "error", err)
+	}
+
+	if err := database.LoadSpellings(ctx, controllers.ProductCollection, controllers.Speller); err != nil {
+		slog.Error("cannot prepare the database", "error", err)
+	}
+
+	if err := database.LoadSynonyms(ctx, controllers.SynonymCollection, controllers.Synonyms); err != nil {
+		slog.Error("cannot prepare the database", "error", err)
+	}
+
+	if err := database.LoadTaxRules(ctx, controllers.TaxRuleCollection, controllers.Taxes); err != nil {
+		slog.Error("cannot prepare the database", "error", err)
+	}
+
+	cancel()
+
+	restoreURL := os.Getenv("CART_RESTORE_URL")
+
+	if restoreURL == "" {
+		restoreURL = "http://localhost:" + port + "/cart/restore"
+	}
+
+	idleFor := durationEnv("ABANDONED_CART_AFTER", 24*time.Hour)
+
+	jobs := scheduler.New()
+
+	jobs.Add("wishlists", durationEnv("WISHLIST_CHECK_INTERVAL", 15*time.Minute), func(ctx context.Context) error {
+		return database.CheckWishlists(ctx, controllers.ProductCollection, controllers.WishlistCollection, nil)
+	})
+
+	jobs.Add("abandoned carts", durationEnv("ABANDONED_CART_SCAN_INTERVAL", 15*time.Minute), func(ctx context.Context) error {
+		sent, err := database.RemindAbandonedCarts(
+			ctx,
+			controllers.CartCollection,
+			controllers.ReminderCollection,
+			controllers.Notifier,
+			idleFor,
+			restoreURL,
+		)
+
+		if sent > 0 {
+			logging.FromContext(ctx).Info("sent abandoned cart reminders", "count", sent)
+		}
+
+		return err
+	})
+
+	outbox := &database.OutboxDispatcher{
+		Collection: controllers.OutboxCollection,
+		Sinks: map[string]events.Sink{
+			"log": events.LogSink{},
+			"webhooks": database.WebhookSink{
+				Webhooks:   controllers.WebhookCollection,
+				Deliveries: controllers.DeliveryCollection,
+			},
+		},
+		Batch: 100,
+	}
+
+	jobs.Add("outbox", durationEnv("OUTBOX_INTERVAL", 5*time.Second), func(ctx context.Context) error {
+		_, err := outbox.Dispatch(ctx)
+		return err
+	})
+
+	sender := webhook.NewSender()
+
+	jobs.Add("webhooks", durationEnv("WEBHOOK_INTERVAL", 5*time.Second), func(ctx context.Context) error {
+		_, err := database.DeliverWebhooks(ctx, controllers.WebhookCollection, controllers.DeliveryCollection, sender, 50)
+		return err
+	})
+
+	jobs.Start(context.Background())
+
 	router := gin.New()
-	router.Use(gin.Logger())
+	router.Use(middleware.RequestID(), middleware.Tracing(), middleware.Logger(), middleware.Metrics())
+
+	router.Static("/images", blobDir)
+	router.GET("/healthz", controllers.Healthy())
+	router.GET("/readyz", controllers.Ready())
 
 	routes.UserRoutes(router)
+	routes.AdminRoutes(router)
+
+	router.POST("/guest/cart", controllers.NewGuestCart())
+
+	// created before Authentication is added, so guests only need their
+	// cart token
+	guest := router.Group("/guest", middleware.CartToken())
+	guest.GET("/addtocart", app.AddToCart())
+	guest.GET("/removeitem", app.RemoveItem())
+	guest.GET("/listcart", controllers.GetItemFromCart())
+	guest.GET("/shipping/quotes", controllers.ShippingQuotes())
+	guest.POST("/checkout", controllers.GuestCheckout())
+	guest.GET("/orders/tracking", controllers.TrackOrder())
+	guest.POST("/orders/cancel", controllers.CancelOrder())
+
 	router.Use(middleware.Authentication())
 
 	router.GET("/addtocart", app.AddToCart())
 	router.GET("/removeitem", app.RemoveItem())
 	router.GET("/cartcheckout", app.BuyFromCart())
 	router.GET("/instantbuy", app.InstantBuy())
+	router.GET("/listcart", controllers.GetItemFromCart())
+	router.GET("/shipping/quotes", controllers.ShippingQuotes())
+	router.GET("/orders/tracking", controllers.TrackOrder())
+	router.POST("/orders/cancel", controllers.CancelOrder())
+	router.GET("/orders/returns", controllers.MyReturns())
+	router.POST("/orders/returns", controllers.RequestReturn())
+	router.POST("/cart/coupon", controllers.ApplyCoupon())
+	router.DELETE("/cart/coupon", controllers.RemoveCoupon())
+	router.GET("/users/notifications", controllers.NotificationPreferences())
+	router.PUT("/users/notifications", controllers.SetNotificationPreferences())
+	router.POST("/cart/saveforlater", controllers.SaveForLater())
+	router.GET("/wishlists", controllers.ListWishlists())
+	router.POST("/wishlists", controllers.CreateWishlist())
+	router.DELETE("/wishlists", controllers.DeleteWishlist())
+	router.POST("/wishlists/items", controllers.AddToWishlist())
+	router.DELETE("/wishlists/items", controllers.RemoveFromWishlist())
+	router.PUT("/wishlists/share", controllers.ShareWishlist())
+	router.POST("/wishlists/movetocart", controllers.MoveToCart())
+	router.POST("/reviews", controllers.AddReview())
+	router.DELETE("/reviews", controllers.DeleteMyReview())
+
+	server := &http.Server{Addr: ":" + port, Handler: router}
+
+	// the metrics are for the Prometheus server only, so they are served on
+	// a listener of their own, METRICS_ADDR, kept off the public port
+	metricsAddr := os.Getenv("METRICS_ADDR")
+
+	if metricsAddr == "" {
+		metricsAddr = "localhost:9090"
+	}
+
+	metricsMux := http.NewServeMux()
+	metricsMux.Handle("/metrics", metrics.Default.Handler())
+
+	metricsServer := &http.Server{Addr: metricsAddr, Handler: metricsMux}
+
+	stop, cancelStop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+
+	failed := make(chan error, 2)
+
+	for _, s := range []*http.Server{server, metricsServer} {
+		go func(s *http.Server) {
+			slog.Info("listening", "addr", s.Addr)
+
+			if err := s.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				failed <- err
+			}
+		}(s)
+	}
+
+	code := 0
+
+	select {
+	case err := <-failed:
+		slog.Error("the server stopped", "error", err)
+		code = 1
+	case <-stop.Done():
+		slog.Info("shutting down")
+	}
+
+	// a second signal stops the service right away
+	cancelStop()
+
+	if !shutdown(server, metricsServer, jobs, shutdownTracing) {
+		code = 1
+	}
+
+	os.Exit(code)
+}
+
+// shutdown stops the service gracefully and tells whether all went well.
+// Readiness fails first, and after SHUTDOWN_DELAY, for load balancers to
+// notice, the server stops taking requests and waits up to
+// SHUTDOWN_TIMEOUT, 30 seconds by default, for those in flight. Then the
+// metrics server and the jobs stop, the spans left are flushed and MongoDB,
+// which all of them may still use until then, is disconnected.
+func shutdown(
+	server *http.Server,
+	metricsServer *http.Server,
+	jobs *scheduler.Scheduler,
+	shutdownTracing func(context.Context) error,
+) bool {
+	controllers.Draining.Store(true)
+
+	time.Sleep(durationEnv("SHUTDOWN_DELAY", 0))
+
+	ctx, cancel := context.WithTimeout(context.Background(), durationEnv("SHUTDOWN_TIMEOUT", 30*time.Second))
+
+	defer cancel()
+
+	ok := true
+
+	if err := server.Shutdown(ctx); err != nil {
+		slog.Error("cannot drain the requests in flight", "error", err)
+		ok = false
+	}
+
+	if err := metricsServer.Shutdown(ctx); err != nil {
+		slog.Error("cannot stop the metrics server", "error", err)
+		ok = false
+	}
+
+	jobs.Stop()
+
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Error("cannot flush the spans", "error", err)
+		ok = false
+	}
+
+	if err := database.Disconnect(ctx); err != nil {
+		slog.Error("cannot disconnect from mongodb", "error", err)
+		ok = false
+	}
+
+	slog.Info("stopped")
+
+	return ok
+}
+
+// fatal logs err and stops the service.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// durationEnv reads a duration such as "90m" from the environment, or
+// fallback when it is unset or not positive.
+func durationEnv(name string, fallback time.Duration) time.Duration {
+	d, err := time.ParseDuration(os.Getenv(name))
+
+	if err != nil || d <= 0 {
+		return fallback
+	}
+
+	return d
+}
+
+// newNotifier sets up the notification channels from the environment:
+// NOTIFY_EMAIL is "smtp" (SMTP_ADDR, SMTP_FROM, SMTP_USERNAME and
+// SMTP_PASSWORD), "sink" for a local SMTP sink on SMTP_SINK_ADDR, "file"
+// for NOTIFY_FILE or "log", the default; NOTIFY_SMS is "file" or "log".
+func newNotifier() (notification.Notifier, error) {
+	templates, err := notification.NewTemplates(notification.DefaultTemplates)
+
+	if err != nil {
+		return nil, err
+	}
+
+	file := os.Getenv("NOTIFY_FILE")
+
+	if file == "" {
+		file = "notifications.log"
+	}
+
+	fileSink := &notification.FileSink{Path: file}
+
+	from := os.Getenv("SMTP_FROM")
+
+	if from == "" {
+		from = "shop@localhost"
+	}
+
+	dispatcher := &notification.Dispatcher{
+		Templates: templates,
+		Contacts:  database.UserContacts{Collection: controllers.UserCollection},
+		Email:     notification.LogSender{},
+		SMS:       notification.LogSender{},
+		Backoff:   notification.DefaultBackoff,
+	}
+
+	switch os.Getenv("NOTIFY_EMAIL") {
+	case "smtp":
+		dispatcher.Email = notification.SMTPSender{
+			Addr:     os.Getenv("SMTP_ADDR"),
+			From:     from,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+		}
+	case "sink":
+		addr := os.Getenv("SMTP_SINK_ADDR")
+
+		if addr == "" {
+			addr = "127.0.0.1:2525"
+		}
+
+		sink, err := notification.StartSMTPSink(addr)
+
+		if err != nil {
+			return nil, err
+		}
+
+		slog.Info("SMTP sink listening", "addr", sink.Addr)
+
+		dispatcher.Email = notification.SMTPSender{Addr: sink.Addr, From: from}
+	case "file":
+		dispatcher.Email = fileSink
+	}
+
+	if os.Getenv("NOTIFY_SMS") == "file" {
+		dispatcher.SMS = fileSink
+	}
 
-	log.Fatal(router.Run(":" + port))
+	return dispatcher, nil
 }
@@ -0,0 +1,311 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are latency buckets in seconds, from 5ms to 10s.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Registry holds metrics and writes them in the Prometheus text format,
+// for a Prometheus server to scrape; nothing is pushed anywhere.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+}
+
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Default is the registry the service's metrics are in.
+var Default = NewRegistry()
+
+func (r *Registry) register(m metric) {
+	r.mu.Lock()
+	r.metrics = append(r.metrics, m)
+	r.mu.Unlock()
+}
+
+// Write writes every metric, in the order they were created.
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	metrics := append([]metric(nil), r.metrics...)
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+
+	for _, m := range metrics {
+		m.write(bw)
+	}
+
+	return bw.Flush()
+}
+
+// Handler serves the metrics for scraping.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = r.Write(w)
+	})
+}
+
+// family is what counters and histograms share: a name, its help and the
+// series for each combination of label values.
+type family struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]interface{}
+	values map[string][]string
+}
+
+func newFamily(name string, help string, kind string, labels []string) *family {
+	return &family{
+		name:   name,
+		help:   help,
+		kind:   kind,
+		labels: labels,
+		series: make(map[string]interface{}),
+		values: make(map[string][]string),
+	}
+}
+
+// get returns the series for values, made by create the first time.
+func (f *family) get(values []string, create func() interface{}) interface{} {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s has %d labels, got %d values", f.name, len(f.labels), len(values)))
+	}
+
+	key := strings.Join(values, "\xff")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	s, ok := f.series[key]
+
+	if !ok {
+		s = create()
+		f.series[key] = s
+		f.values[key] = append([]string(nil), values...)
+	}
+
+	return s
+}
+
+// each calls fn for every series, sorted by label values so scrapes are
+// stable.
+func (f *family) each(fn func(labels string, s interface{})) {
+	f.mu.Lock()
+
+	keys := make([]string, 0, len(f.series))
+
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	series := make([]interface{}, len(keys))
+	labels := make([]string, len(keys))
+
+	for i, key := range keys {
+		series[i] = f.series[key]
+		labels[i] = f.labelPairs(f.values[key])
+	}
+
+	f.mu.Unlock()
+
+	for i := range keys {
+		fn(labels[i], series[i])
+	}
+}
+
+func (f *family) header(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.kind)
+}
+
+func (f *family) labelPairs(values []string) string {
+	pairs := make([]string, len(values))
+
+	for i, value := range values {
+		pairs[i] = f.labels[i] + `="` + escapeLabel(value) + `"`
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+// Counter only goes up.
+type Counter struct {
+	mu    sync.Mutex
+	value float64
+}
+
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add adds v, which must not be negative.
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		return
+	}
+
+	c.mu.Lock()
+	c.value += v
+	c.mu.Unlock()
+}
+
+func (c *Counter) get() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.value
+}
+
+// CounterVec is a counter for each combination of label values.
+type CounterVec struct {
+	*family
+}
+
+// NewCounter creates a counter in the registry; its name should end in
+// _total.
+func (r *Registry) NewCounter(name string, help string, labels ...string) *CounterVec {
+	v := &CounterVec{newFamily(name, help, "counter", labels)}
+	r.register(v)
+
+	return v
+}
+
+// With is the counter for the label values, in the order of the labels.
+func (v *CounterVec) With(values ...string) *Counter {
+	return v.get(values, func() interface{} { return &Counter{} }).(*Counter)
+}
+
+func (v *CounterVec) write(w *bufio.Writer) {
+	v.header(w)
+	v.each(func(labels string, s interface{}) {
+		fmt.Fprintf(w, "%s%s %s\n", v.name, braces(labels), formatFloat(s.(*Counter).get()))
+	})
+}
+
+// Histogram counts observations in buckets.
+type Histogram struct {
+	mu      sync.Mutex
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, upper := range h.buckets {
+		if v <= upper {
+			h.counts[i]++
+		}
+	}
+
+	h.sum += v
+	h.count++
+}
+
+// HistogramVec is a histogram for each combination of label values.
+type HistogramVec struct {
+	*family
+	buckets []float64
+}
+
+// NewHistogram creates a histogram in the registry with the upper bounds
+// in buckets, which must be sorted.
+func (r *Registry) NewHistogram(name string, help string, buckets []float64, labels ...string) *HistogramVec {
+	v := &HistogramVec{newFamily(name, help, "histogram", labels), buckets}
+	r.register(v)
+
+	return v
+}
+
+// With is the histogram for the label values, in the order of the labels.
+func (v *HistogramVec) With(values ...string) *Histogram {
+	return v.get(values, func() interface{} {
+		return &Histogram{buckets: v.buckets, counts: make([]uint64, len(v.buckets))}
+	}).(*Histogram)
+}
+
+func (v *HistogramVec) write(w *bufio.Writer) {
+	v.header(w)
+	v.each(func(labels string, s interface{}) {
+		h := s.(*Histogram)
+
+		h.mu.Lock()
+		counts := append([]uint64(nil), h.counts...)
+		sum, count := h.sum, h.count
+		h.mu.Unlock()
+
+		prefix := labels
+
+		if prefix != "" {
+			prefix += ","
+		}
+
+		for i, upper := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket{%sle=\"%s\"} %d\n", v.name, prefix, formatFloat(upper), counts[i])
+		}
+
+		fmt.Fprintf(w, "%s_bucket{%sle=\"+Inf\"} %d\n", v.name, prefix, count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", v.name, braces(labels), formatFloat(sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", v.name, braces(labels), count)
+	})
+}
+
+func braces(labels string) string {
+	if labels == "" {
+		return ""
+	}
+
+	return "{" + labels + "}"
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func scrape(t *testing.T, r *Registry) string {
+	t.Helper()
+
+	var b strings.Builder
+
+	if err := r.Write(&b); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	return b.String()
+}
+
+func TestCounterFormat(t *testing.T) {
+	r := NewRegistry()
+
+	requests := r.NewCounter("requests_total", "Requests served,\nby path.", "path", "status")
+	requests.With("/products", "200").Add(2)
+	requests.With(`C:\shop "quoted"`+"\nnext", "500").Inc()
+	requests.With("/products", "200").Add(-1)
+
+	r.NewCounter("jobs_total", `Jobs run, in C:\jobs.`).With().Inc()
+
+	want := `# HELP requests_total Requests served,\nby path.
+# TYPE requests_total counter
+requests_total{path="/products",status="200"} 2
+requests_total{path="C:\\shop \"quoted\"\nnext",status="500"} 1
+# HELP jobs_total Jobs run, in C:\\jobs.
+# TYPE jobs_total counter
+jobs_total 1
+`
+
+	if got := scrape(t, r); got != want {
+		t.Errorf("scraped\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestHistogramFormat(t *testing.T) {
+	r := NewRegistry()
+
+	latency := r.NewHistogram("latency_seconds", "Latency.", []float64{0.1, 1}, "route")
+	latency.With("/cart").Observe(0.05)
+	latency.With("/cart").Observe(0.5)
+	latency.With("/cart").Observe(3)
+
+	r.NewHistogram("wait_seconds", "Wait.", []float64{0.5}).With().Observe(0.25)
+
+	want := `# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/cart",le="0.1"} 1
+latency_seconds_bucket{route="/cart",le="1"} 2
+latency_seconds_bucket{route="/cart",le="+Inf"} 3
+latency_seconds_sum{route="/cart"} 3.55
+latency_seconds_count{route="/cart"} 3
+# HELP wait_seconds Wait.
+# TYPE wait_seconds histogram
+wait_seconds_bucket{le="0.5"} 1
+wait_seconds_bucket{le="+Inf"} 1
+wait_seconds_sum 0.25
+wait_seconds_count 1
+`
+
+	if got := scrape(t, r); got != want {
+		t.Errorf("scraped\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestFormatFloat(t *testing.T) {
+	tests := []struct {
+		v    float64
+		want string
+	}{
+		{v: 0, want: "0"},
+		{v: 1.5, want: "1.5"},
+		{v: 1e21, want: "1e+21"},
+		{v: math.Inf(1), want: "+Inf"},
+		{v: math.Inf(-1), want: "-Inf"},
+		{v: math.NaN(), want: "NaN"},
+	}
+
+	for _, tt := range tests {
+		if got := formatFloat(tt.v); got != tt.want {
+			t.Errorf("formatFloat(%v) = %q, want %q", tt.v, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"math"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/money"
+)
+
+// The service's metrics.
+var (
+	HTTPRequests = Default.NewCounter(
+		"http_requests_total",
+		"HTTP requests handled, by method, route and status.",
+		"method", "route", "status",
+	)
+	HTTPDuration = Default.NewHistogram(
+		"http_request_duration_seconds",
+		"How long HTTP requests took, by method, route and status.",
+		DefaultBuckets,
+		"method", "route", "status",
+	)
+
+	MongoDuration = Default.NewHistogram(
+		"mongodb_command_duration_seconds",
+		"How long MongoDB commands took, by collection and command.",
+		DefaultBuckets,
+		"collection", "command",
+	)
+	MongoErrors = Default.NewCounter(
+		"mongodb_command_errors_total",
+		"MongoDB commands that failed, by collection and command.",
+		"collection", "command",
+	)
+
+	CartsCreated = Default.NewCounter(
+		"carts_created_total",
+		"Carts created by a first item or a guest cart merged into an account.",
+	)
+	OrdersPlaced = Default.NewCounter(
+		"orders_placed_total",
+		"Orders placed, by currency.",
+		"currency",
+	)
+	Revenue = Default.NewCounter(
+		"revenue_total",
+		"Total price of the orders placed, in the major unit of each currency.",
+		"currency",
+	)
+	FailedLogins = Default.NewCounter(
+		"failed_logins_total",
+		"Sign in attempts that failed, by reason.",
+		"reason",
+	)
+)
+
+// Reasons a sign in fails.
+const (
+	LoginUnknownUser   = "unknown_user"
+	LoginWrongPassword = "wrong_password"
+)
+
+// OrderPlaced counts an order and its total price.
+func OrderPlaced(total money.Money) {
+	OrdersPlaced.With(total.Currency).Inc()
+	Revenue.With(total.Currency).Add(float64(total.Amount) / math.Pow10(money.Digits(total.Currency)))
+}
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"net/http"
+
+	token "github.com/Ricardo-Cardozo/ecommerce_golang/tokens"
+	"github.com/gin-gonic/gin"
+)
+
+// CartToken lets a guest use their cart with the X-Cart-Token header. The
+// guest's cart id is set as "uid", like a signed in user's, and "guest" is
+// set to true.
+func CartToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cartToken := c.GetHeader("X-Cart-Token")
+
+		if cartToken == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": "No X-Cart-Token header provided",
+			})
+			return
+		}
+
+		claims, err := token.ValidateCartToken(c.Request.Context(), cartToken)
+
+		if err != "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"error": err,
+			})
+			return
+		}
+
+		c.Set("uid", claims.Cart_ID)
+		c.Set("guest", true)
+		c.Next()
+	}
+}
@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+// Metrics counts and times requests by method, route and status. Requests
+// that match no route are put together under "unmatched", so scans for
+// random paths don't add a series each.
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		route := c.FullPath()
+
+		if route == "" {
+			route = "unmatched"
+		}
+
+		status := strconv.Itoa(c.Writer.Status())
+
+		metrics.HTTPRequests.With(c.Request.Method, route, status).Inc()
+		metrics.HTTPDuration.With(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
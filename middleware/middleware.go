@@ -3,6 +3,7 @@ package middleware
 import (
 	"net/http"
 
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
 	token "github.com/Ricardo-Cardozo/ecommerce_golang/tokens"
 	"github.com/gin-gonic/gin"
 )
@@ -36,7 +37,7 @@ func Authentication() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
 				"error": "No Authorization header provided",
 			})
 			return
@@ -46,10 +47,10 @@ func Authentication() gin.HandlerFunc {
 		if len(authHeader) > 7 && authHeader[0:7] == "Bearer " {
 			ClientToken := authHeader[7:]
 
-			claims, err := token.ValidateToken(ClientToken)
+			claims, err := token.ValidateToken(c.Request.Context(), ClientToken)
 
 			if err != "" {
-				c.JSON(http.StatusUnauthorized, gin.H{
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
 					"error": err,
 				})
 				return
@@ -57,13 +58,30 @@ func Authentication() gin.HandlerFunc {
 
 			c.Set("email", claims.Email)
 			c.Set("uid", claims.Uid)
+			c.Set("first_name", claims.First_Name)
+			c.Set("role", claims.Role)
 			c.Next()
 
 		} else {
-			c.JSON(http.StatusUnauthorized, gin.H{
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
 				"error": "Invalid Authorization header format",
 			})
 			return
 		}
 	}
 }
+
+// Admin lets only staff through, after Authentication; other users get a
+// 403.
+func Admin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("role") != models.RoleAdmin {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error": "this is only for staff",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
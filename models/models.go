@@ -3,6 +3,7 @@ package models
 import (
 	"time"
 
+	"github.com/Ricardo-Cardozo/ecommerce_golang/money"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -18,25 +19,91 @@ type User struct {
 	Created_At      time.Time          `json:"created_at"`
 	Updated_At      time.Time          `json:"updated_at"`
 	User_ID         string             `json:"user_id"`
-	UserCart        []ProductUser      `json:"usercart" bson:"usercart"`
 	Address_Details []Address          `json:"address" bson:"address"`
 	Order_Status    []Order            `json:"orders" bson:"orders"`
+	Coupon_Code     *string            `json:"coupon_code" bson:"coupon_code"`
+	// Guest documents hold the cart and orders of a buyer without an account;
+	// they have no password and can't sign in.
+	Guest bool `json:"guest" bson:"guest,omitempty"`
+	// Notifications are the channels the user wants messages on; nil means
+	// the defaults, email only.
+	Notifications *NotificationPreferences `json:"notifications" bson:"notifications,omitempty"`
+	// Role is RoleAdmin for staff, who may use the /admin routes, and empty
+	// for customers. It can't be set by signing up; it is given in the
+	// database.
+	Role string `json:"role" bson:"role,omitempty"`
+}
+
+// RoleAdmin is the role of staff users.
+const RoleAdmin = "admin"
+
+type NotificationPreferences struct {
+	Email bool `json:"email" bson:"email"`
+	SMS   bool `json:"sms" bson:"sms"`
 }
 
 type Product struct {
 	Product_ID   primitive.ObjectID `bson:"_id"`
 	Product_Name *string            `json:"product_name"`
-	Price        *uint64            `json:"price"`
-	Rating       *uint8             `json:"rating"`
-	Image        *string            `json:"image"`
+	Description  *string            `json:"description"`
+	Price        money.Money        `json:"price"`
+	// Prices are fixed prices per market currency; other currencies are
+	// converted from Price with the exchange-rate table.
+	Prices        []money.Money `json:"prices"`
+	Display_Price *money.Money  `json:"display_price,omitempty" bson:"-"`
+	// Tax_Class picks the tax rules that apply, e.g. "reduced"; empty is
+	// DefaultTaxClass.
+	Tax_Class *string `json:"tax_class"`
+	// Weight_Grams and Dimensions feed weight-based shipping rates.
+	Weight_Grams int64          `json:"weight_grams"`
+	Dimensions   *Dimensions    `json:"dimensions"`
+	Stock        *int64         `json:"stock"` // nil when the product isn't counted
+	Rating       float64        `json:"rating"`
+	Rating_Count int64          `json:"rating_count"`
+	Image        *string        `json:"image"`
+	Images       []ProductImage `json:"images"`
+	Category     *string        `json:"category"`
+	Brand        *string        `json:"brand"`
+	Variants     []Variant      `json:"variants"`
+	Created_At   time.Time      `json:"created_at"`
+	Search_Terms []string       `json:"-"`
+}
+
+type ProductImage struct {
+	Image_ID     primitive.ObjectID `json:"_id" bson:"_id"`
+	Key          string             `json:"-" bson:"key"`
+	URL          string             `json:"url" bson:"url"`
+	Content_Type string             `json:"content_type" bson:"content_type"`
+	Width        int                `json:"width" bson:"width"`
+	Height       int                `json:"height" bson:"height"`
+	Position     int                `json:"position" bson:"position"`
+	Thumbnails   []Thumbnail        `json:"thumbnails" bson:"thumbnails"`
+}
+
+type Thumbnail struct {
+	Size   string `json:"size" bson:"size"`
+	Key    string `json:"-" bson:"key"`
+	URL    string `json:"url" bson:"url"`
+	Width  int    `json:"width" bson:"width"`
+	Height int    `json:"height" bson:"height"`
+}
+
+type Variant struct {
+	SKU        *string           `json:"sku" bson:"sku"`
+	Attributes map[string]string `json:"attributes" bson:"attributes"`
 }
 
 type ProductUser struct {
 	Product_ID   primitive.ObjectID `bson:"_id"`
 	Product_Name *string            `json:"product_name" bson:"product_name"`
-	Price        int                `json:"price" bson:"price"`
-	Rating       *uint              `json:"rating" bson:"rating"`
+	Price        money.Money        `json:"price" bson:"price"`
+	Prices       []money.Money      `json:"prices,omitempty" bson:"prices,omitempty"`
+	Tax_Class    *string            `json:"tax_class,omitempty" bson:"tax_class,omitempty"`
+	Weight_Grams int64              `json:"weight_grams,omitempty" bson:"weight_grams,omitempty"`
+	Dimensions   *Dimensions        `json:"dimensions,omitempty" bson:"dimensions,omitempty"`
+	Rating       *float64           `json:"rating" bson:"rating"`
 	Image        *string            `json:"image" bson:"image"`
+	Category     *string            `json:"category" bson:"category"`
 }
 
 type Address struct {
@@ -45,18 +112,422 @@ type Address struct {
 	Street     *string            `json:"street_name" bson:"street_name"`
 	City       *string            `json:"city_name" bson:"city_name"`
 	Pincode    *string            `json:"pincode" bson:"pincode"`
+	Country    *string            `json:"country" bson:"country"`
+	Region     *string            `json:"region" bson:"region"`
 }
 
 type Order struct {
 	Order_ID       primitive.ObjectID `bson:"_id"`
 	Order_Cart     []ProductUser      `json:"order_list" bson:"order_list"`
 	Ordered_At     time.Time          `json:"ordered_at" bson:"ordered_at"`
-	Price          int                `json:"total_price" bson:"total_price"`
-	Discount       *int               `json:"discount" bson:"discount"`
+	Price          money.Money        `json:"total_price" bson:"total_price"`
+	Discount       money.Money        `json:"discount" bson:"discount"`
+	Coupon_Code    *string            `json:"coupon_code" bson:"coupon_code"`
+	Subtotal       money.Money        `json:"subtotal" bson:"subtotal"`
+	Promotions     []AppliedPromotion `json:"promotions" bson:"promotions"`
 	Payment_Method Payment            `json:"payment_method" bson:"payment_method"`
+	// Currency is what the customer was charged in; Exchange_Rates lists the
+	// conversions used for lines without a price in it.
+	Currency       string       `json:"currency" bson:"currency"`
+	Exchange_Rates []money.Rate `json:"exchange_rates" bson:"exchange_rates"`
+	// Tax is the tax added on top of the net amount by exclusive lines plus
+	// the tax already inside inclusive lines; Tax_Lines breaks it down.
+	Tax       money.Money    `json:"tax" bson:"tax"`
+	Tax_Lines []LineTax      `json:"tax_lines" bson:"tax_lines"`
+	Shipping  *ShippingQuote `json:"shipping" bson:"shipping"`
+	// Shipping_Address is a copy, so editing the address book later doesn't
+	// change where a past order went.
+	Shipping_Address *Address `json:"shipping_address" bson:"shipping_address"`
+	// Coupon_Lines spreads the coupon part of Discount over the lines, so a
+	// line can be refunded for what was actually paid for it.
+	Coupon_Lines []LineDiscount `json:"coupon_lines" bson:"coupon_lines"`
+	// Refunded is the sum of the order's refunds.
+	Refunded     money.Money `json:"refunded" bson:"refunded"`
+	Status       string      `json:"status" bson:"status"`
+	Cancelled_At *time.Time  `json:"cancelled_at,omitempty" bson:"cancelled_at,omitempty"`
 }
 
+// Order statuses past OrderPlaced follow from the order's shipments.
+const (
+	OrderPlaced           = "placed"
+	OrderPartiallyShipped = "partially_shipped"
+	OrderShipped          = "shipped"
+	OrderDelivered        = "delivered"
+	OrderCancelled        = "cancelled"
+)
+
 type Payment struct {
-	Digital bool
-	COD     bool
+	// Payment_ID identifies the payment refunds are issued against.
+	Payment_ID primitive.ObjectID `json:"payment_id" bson:"payment_id,omitempty"`
+	Digital    bool
+	COD        bool
+}
+
+type Synonym struct {
+	Synonym_ID primitive.ObjectID `json:"_id" bson:"_id"`
+	Terms      []string           `json:"terms" bson:"terms" validate:"required,min=2,dive,required"`
+	Created_At time.Time          `json:"created_at" bson:"created_at"`
+}
+
+const (
+	ReviewPending  = "pending"
+	ReviewApproved = "approved"
+	ReviewRejected = "rejected"
+)
+
+type Review struct {
+	Review_ID  primitive.ObjectID `json:"_id" bson:"_id"`
+	Product_ID primitive.ObjectID `json:"product_id" bson:"product_id"`
+	User_ID    string             `json:"user_id" bson:"user_id"`
+	Author     *string            `json:"author" bson:"author"`
+	Rating     uint8              `json:"rating" bson:"rating" validate:"required,min=1,max=5"`
+	Text       *string            `json:"text" bson:"text" validate:"omitempty,max=5000"`
+	Status     string             `json:"status" bson:"status"`
+	Created_At time.Time          `json:"created_at" bson:"created_at"`
+	Updated_At time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+const (
+	CouponPercentage   = "percentage"
+	CouponFixedAmount  = "fixed_amount"
+	CouponFreeShipping = "free_shipping"
+)
+
+type Coupon struct {
+	Coupon_ID         primitive.ObjectID   `json:"_id" bson:"_id"`
+	Code              string               `json:"code" bson:"code" validate:"required,min=3,max=32,alphanum"`
+	Type              string               `json:"type" bson:"type" validate:"required,oneof=percentage fixed_amount free_shipping"`
+	Percent           int64                `json:"percent" bson:"percent" validate:"min=0,max=100"`
+	Amount            money.Money          `json:"amount" bson:"amount"`
+	Starts_At         *time.Time           `json:"starts_at" bson:"starts_at"`
+	Ends_At           *time.Time           `json:"ends_at" bson:"ends_at"`
+	Min_Cart_Value    money.Money          `json:"min_cart_value" bson:"min_cart_value"`
+	Max_Uses          int                  `json:"max_uses" bson:"max_uses" validate:"min=0"`
+	Max_Uses_Per_User int                  `json:"max_uses_per_user" bson:"max_uses_per_user" validate:"min=0"`
+	Uses              int                  `json:"uses" bson:"uses"`
+	Product_IDs       []primitive.ObjectID `json:"product_ids" bson:"product_ids"`
+	Categories        []string             `json:"categories" bson:"categories"`
+	Active            bool                 `json:"active" bson:"active"`
+	Created_At        time.Time            `json:"created_at" bson:"created_at"`
+}
+
+type CouponRedemption struct {
+	Redemption_ID primitive.ObjectID `json:"_id" bson:"_id"`
+	Coupon_ID     primitive.ObjectID `json:"coupon_id" bson:"coupon_id"`
+	User_ID       string             `json:"user_id" bson:"user_id"`
+	Order_ID      primitive.ObjectID `json:"order_id" bson:"order_id"`
+	Discount      money.Money        `json:"discount" bson:"discount"`
+	Redeemed_At   time.Time          `json:"redeemed_at" bson:"redeemed_at"`
+	// Slot numbers the user's uses of a coupon with a per-user limit, from
+	// 0; a unique index keeps two redemptions from taking the same one.
+	Slot *int `json:"-" bson:"slot,omitempty"`
+}
+
+const (
+	PromotionBuyXGetY       = "buy_x_get_y"
+	PromotionSpendThreshold = "spend_threshold"
+	PromotionBundle         = "bundle"
+)
+
+type Promotion struct {
+	Promotion_ID primitive.ObjectID   `json:"_id" bson:"_id"`
+	Name         string               `json:"name" bson:"name" validate:"required,max=100"`
+	Type         string               `json:"type" bson:"type" validate:"required,oneof=buy_x_get_y spend_threshold bundle"`
+	Priority     int                  `json:"priority" bson:"priority"`
+	Active       bool                 `json:"active" bson:"active"`
+	Starts_At    *time.Time           `json:"starts_at" bson:"starts_at"`
+	Ends_At      *time.Time           `json:"ends_at" bson:"ends_at"`
+	Product_IDs  []primitive.ObjectID `json:"product_ids" bson:"product_ids"`
+	Categories   []string             `json:"categories" bson:"categories"`
+	// buy_x_get_y: buy Buy_Quantity, get Get_Quantity at Get_Percent off
+	Buy_Quantity int   `json:"buy_quantity" bson:"buy_quantity" validate:"min=0"`
+	Get_Quantity int   `json:"get_quantity" bson:"get_quantity" validate:"min=0"`
+	Get_Percent  int64 `json:"get_percent" bson:"get_percent" validate:"min=0,max=100"`
+	// spend_threshold: the highest tier reached applies
+	Tiers []PromotionTier `json:"tiers" bson:"tiers" validate:"dive"`
+	// bundle: one of each of Product_IDs together cost Bundle_Price
+	Bundle_Price money.Money `json:"bundle_price" bson:"bundle_price"`
+	Created_At   time.Time   `json:"created_at" bson:"created_at"`
+}
+
+type PromotionTier struct {
+	Min_Subtotal money.Money `json:"min_subtotal" bson:"min_subtotal"`
+	Amount       money.Money `json:"amount" bson:"amount"`
+	Percent      int64       `json:"percent" bson:"percent" validate:"min=0,max=100"`
+}
+
+// AppliedPromotion is a promotion as it was applied to a cart or order.
+// Lines index into the cart, or the order's order_list.
+type AppliedPromotion struct {
+	Promotion_ID primitive.ObjectID `json:"promotion_id" bson:"promotion_id"`
+	Name         string             `json:"name" bson:"name"`
+	Description  string             `json:"description" bson:"description"`
+	Discount     money.Money        `json:"discount" bson:"discount"`
+	Lines        []LineDiscount     `json:"lines" bson:"lines"`
+}
+
+type LineDiscount struct {
+	Line       int                `json:"line" bson:"line"`
+	Product_ID primitive.ObjectID `json:"product_id" bson:"product_id"`
+	Amount     money.Money        `json:"amount" bson:"amount"`
+}
+
+// DefaultTaxClass is the tax class of products that don't set one.
+const DefaultTaxClass = "standard"
+
+// TaxRule is one row of the tax table. Region and Tax_Class may be empty to
+// cover a whole country or every class; the most specific matching rule
+// wins. Rate is a decimal percentage like "8.875". With Inclusive set,
+// prices in that location already contain the tax.
+type TaxRule struct {
+	Rule_ID    primitive.ObjectID `json:"_id" bson:"_id"`
+	Country    string             `json:"country" bson:"country" validate:"required,len=2"`
+	Region     string             `json:"region" bson:"region"`
+	Tax_Class  string             `json:"tax_class" bson:"tax_class"`
+	Name       string             `json:"name" bson:"name"`
+	Rate       string             `json:"rate" bson:"rate" validate:"required"`
+	Inclusive  bool               `json:"inclusive" bson:"inclusive"`
+	Created_At time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// LineTax is the tax on one cart or order line, after its discounts.
+type LineTax struct {
+	Line       int                `json:"line" bson:"line"`
+	Product_ID primitive.ObjectID `json:"product_id" bson:"product_id"`
+	Tax_Class  string             `json:"tax_class" bson:"tax_class"`
+	Rule       string             `json:"rule" bson:"rule"`
+	Rate       string             `json:"rate" bson:"rate"`
+	Inclusive  bool               `json:"inclusive" bson:"inclusive"`
+	Taxable    money.Money        `json:"taxable" bson:"taxable"`
+	Tax        money.Money        `json:"tax" bson:"tax"`
+}
+
+// Dimensions of a packed product, in millimetres.
+type Dimensions struct {
+	Length int64 `json:"length_mm" bson:"length_mm" validate:"min=0,max=100000"`
+	Width  int64 `json:"width_mm" bson:"width_mm" validate:"min=0,max=100000"`
+	Height int64 `json:"height_mm" bson:"height_mm" validate:"min=0,max=100000"`
+}
+
+const (
+	ShippingFlat      = "flat"
+	ShippingWeight    = "weight"
+	ShippingFreeAbove = "free_above"
+	ShippingPickup    = "pickup"
+)
+
+// ShippingMethod is a way of delivering an order. Rate is the flat price,
+// the base price of weight-based shipping or the price below Free_Above.
+// Per_Kg is charged for every started kilogram of billable weight.
+type ShippingMethod struct {
+	Method_ID  primitive.ObjectID `json:"_id" bson:"_id"`
+	Name       string             `json:"name" bson:"name" validate:"required"`
+	Type       string             `json:"type" bson:"type" validate:"required,oneof=flat weight free_above pickup"`
+	Active     bool               `json:"active" bson:"active"`
+	Rate       money.Money        `json:"rate" bson:"rate"`
+	Per_Kg     money.Money        `json:"per_kg" bson:"per_kg"`
+	Free_Above money.Money        `json:"free_above" bson:"free_above"`
+	// Countries limits delivery to these ISO codes; empty delivers anywhere.
+	Countries        []string  `json:"countries" bson:"countries"`
+	Max_Weight_Grams int64     `json:"max_weight_grams" bson:"max_weight_grams" validate:"min=0"`
+	Pickup_Location  *string   `json:"pickup_location" bson:"pickup_location"`
+	Created_At       time.Time `json:"created_at" bson:"created_at"`
+}
+
+// ShippingQuote is the price of a method for one cart and address, and what
+// an order keeps of the chosen method.
+type ShippingQuote struct {
+	Method_ID       primitive.ObjectID `json:"method_id" bson:"method_id"`
+	Name            string             `json:"name" bson:"name"`
+	Type            string             `json:"type" bson:"type"`
+	Cost            money.Money        `json:"cost" bson:"cost"`
+	Weight_Grams    int64              `json:"weight_grams" bson:"weight_grams"`
+	Pickup_Location *string            `json:"pickup_location,omitempty" bson:"pickup_location,omitempty"`
+}
+
+const (
+	ShipmentPending   = "pending"
+	ShipmentShipped   = "shipped"
+	ShipmentDelivered = "delivered"
+)
+
+// Shipment is one parcel of an order. Lines index into the order's
+// order_list; an order can be split over several shipments, but a line goes
+// in only one.
+type Shipment struct {
+	Shipment_ID     primitive.ObjectID `json:"_id" bson:"_id"`
+	Order_ID        primitive.ObjectID `json:"order_id" bson:"order_id"`
+	User_ID         string             `json:"user_id" bson:"user_id"`
+	Lines           []int              `json:"lines" bson:"lines"`
+	Carrier         *string            `json:"carrier" bson:"carrier"`
+	Tracking_Number *string            `json:"tracking_number" bson:"tracking_number"`
+	Status          string             `json:"status" bson:"status"`
+	Created_At      time.Time          `json:"created_at" bson:"created_at"`
+	Shipped_At      *time.Time         `json:"shipped_at" bson:"shipped_at"`
+	Delivered_At    *time.Time         `json:"delivered_at" bson:"delivered_at"`
+}
+
+const (
+	ReturnRequested = "requested"
+	ReturnApproved  = "approved"
+	ReturnRejected  = "rejected"
+	ReturnReceived  = "received"
+)
+
+// Return is a customer's request to send back delivered lines of an order.
+// Staff approve or reject it, and receiving the goods refunds them.
+type Return struct {
+	Return_ID  primitive.ObjectID  `json:"_id" bson:"_id"`
+	Order_ID   primitive.ObjectID  `json:"order_id" bson:"order_id"`
+	User_ID    string              `json:"user_id" bson:"user_id"`
+	Lines      []int               `json:"lines" bson:"lines" validate:"required,min=1"`
+	Reason     string              `json:"reason" bson:"reason" validate:"required,oneof=damaged defective wrong_item not_as_described no_longer_needed other"`
+	Comment    *string             `json:"comment" bson:"comment" validate:"omitempty,max=2000"`
+	Status     string              `json:"status" bson:"status"`
+	Note       *string             `json:"note" bson:"note"`
+	Restocked  bool                `json:"restocked" bson:"restocked"`
+	Refund_ID  *primitive.ObjectID `json:"refund_id" bson:"refund_id"`
+	Created_At time.Time           `json:"created_at" bson:"created_at"`
+	Updated_At time.Time           `json:"updated_at" bson:"updated_at"`
+}
+
+// Refund is money given back on an order, against the order's payment.
+// Lines say what each order line got back; Shipping is the part of the
+// shipping cost refunded.
+type Refund struct {
+	Refund_ID      primitive.ObjectID  `json:"_id" bson:"_id"`
+	Order_ID       primitive.ObjectID  `json:"order_id" bson:"order_id"`
+	User_ID        string              `json:"user_id" bson:"user_id"`
+	Payment_ID     primitive.ObjectID  `json:"payment_id" bson:"payment_id"`
+	Payment_Method Payment             `json:"payment_method" bson:"payment_method"`
+	Return_ID      *primitive.ObjectID `json:"return_id" bson:"return_id"`
+	Lines          []LineDiscount      `json:"lines" bson:"lines"`
+	Shipping       money.Money         `json:"shipping" bson:"shipping"`
+	Amount         money.Money         `json:"amount" bson:"amount"`
+	Reason         string              `json:"reason" bson:"reason"`
+	Created_At     time.Time           `json:"created_at" bson:"created_at"`
+}
+
+// Cart is a customer's cart, guest or not. Items are copies of the products
+// as they were last checked against the catalog; each read checks them
+// again and records what changed in Notices until the customer has seen it.
+type Cart struct {
+	Cart_ID    primitive.ObjectID `json:"_id" bson:"_id"`
+	User_ID    string             `json:"user_id" bson:"user_id"`
+	Items      []ProductUser      `json:"items" bson:"items"`
+	Notices    []CartNotice       `json:"notices" bson:"notices"`
+	Created_At time.Time          `json:"created_at" bson:"created_at"`
+	Updated_At time.Time          `json:"updated_at" bson:"updated_at"`
+	// Reminded_At is when the customer was last reminded of the cart; a
+	// cart changed since can be reminded of again.
+	Reminded_At *time.Time `json:"-" bson:"reminded_at,omitempty"`
+}
+
+const (
+	CartPriceIncreased  = "price_increased"
+	CartPriceDecreased  = "price_decreased"
+	CartItemUnavailable = "unavailable"
+	CartQuantityReduced = "quantity_reduced"
+)
+
+// CartNotice tells the customer that an item of their cart changed in the
+// catalog since they added it. Prices are in the currency the cart was read
+// in.
+type CartNotice struct {
+	Kind         string             `json:"kind" bson:"kind"`
+	Product_ID   primitive.ObjectID `json:"product_id" bson:"product_id"`
+	Product_Name *string            `json:"product_name" bson:"product_name"`
+	Old_Price    *money.Money       `json:"old_price,omitempty" bson:"old_price,omitempty"`
+	New_Price    *money.Money       `json:"new_price,omitempty" bson:"new_price,omitempty"`
+	Message      string             `json:"message" bson:"message"`
+	Noticed_At   time.Time          `json:"noticed_at" bson:"noticed_at"`
+}
+
+// SavedForLater is the name of the wishlist items saved from the cart go
+// to; it is created on first use.
+const SavedForLater = "Saved for later"
+
+// Wishlist is one of a customer's named lists of products kept for later.
+// Anyone with Share_Token can read it while it is set. Items are checked
+// against the catalog periodically and on each read, see CartNotice for
+// what Notices hold.
+type Wishlist struct {
+	Wishlist_ID primitive.ObjectID `json:"_id" bson:"_id"`
+	User_ID     string             `json:"user_id" bson:"user_id"`
+	Name        *string            `json:"name" bson:"name" validate:"required,min=1,max=60"`
+	Items       []WishlistItem     `json:"items" bson:"items"`
+	Share_Token *string            `json:"share_token,omitempty" bson:"share_token,omitempty"`
+	Notices     []CartNotice       `json:"notices" bson:"notices"`
+	Created_At  time.Time          `json:"created_at" bson:"created_at"`
+	Updated_At  time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+// WishlistItem is a product as it was last checked; In_Stock tells when it
+// comes back.
+type WishlistItem struct {
+	ProductUser `bson:",inline"`
+	In_Stock    bool      `json:"in_stock" bson:"in_stock"`
+	Added_At    time.Time `json:"added_at" bson:"added_at"`
+}
+
+const (
+	WishlistPriceDropped = "price_dropped"
+	WishlistBackInStock  = "back_in_stock"
+)
+
+// CartReminder is a reminder sent about an abandoned cart with the items
+// the cart held then, which its restore link, see Token, puts back.
+type CartReminder struct {
+	Reminder_ID  primitive.ObjectID  `json:"_id" bson:"_id"`
+	Cart_ID      primitive.ObjectID  `json:"cart_id" bson:"cart_id"`
+	User_ID      string              `json:"user_id" bson:"user_id"`
+	Items        []ProductUser       `json:"items" bson:"items"`
+	Token        string              `json:"-" bson:"token"`
+	Sent_At      time.Time           `json:"sent_at" bson:"sent_at"`
+	Restored_At  *time.Time          `json:"restored_at" bson:"restored_at,omitempty"`
+	Converted_At *time.Time          `json:"converted_at" bson:"converted_at,omitempty"`
+	Order_ID     *primitive.ObjectID `json:"order_id" bson:"order_id,omitempty"`
+}
+
+// Webhook is a merchant endpoint told about domain events, e.g. an ERP.
+// Events filters the event types it gets; empty means all. Requests are
+// signed with Secret, see webhook.Sign.
+type Webhook struct {
+	Webhook_ID primitive.ObjectID `json:"_id" bson:"_id"`
+	URL        *string            `json:"url" bson:"url" validate:"required,url"`
+	Events     []string           `json:"events" bson:"events" validate:"dive,oneof=UserSignedUp CartUpdated OrderPlaced OrderShipped PaymentCaptured OrderDelivered OrderCancelled OrderRefunded ReturnUpdated"`
+	Secret     string             `json:"-" bson:"secret"`
+	Active     bool               `json:"active" bson:"active"`
+	Created_At time.Time          `json:"created_at" bson:"created_at"`
+}
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	// DeliveryDead deliveries ran out of attempts and wait on the
+	// dead-letter list for a manual redelivery.
+	DeliveryDead = "dead"
+)
+
+// WebhookDelivery is one event on its way to one endpoint, with the
+// history of its attempts. Body is sent as is on every attempt.
+type WebhookDelivery struct {
+	Delivery_ID     primitive.ObjectID `json:"_id" bson:"_id"`
+	Webhook_ID      primitive.ObjectID `json:"webhook_id" bson:"webhook_id"`
+	Event_ID        primitive.ObjectID `json:"event_id" bson:"event_id"`
+	Event_Type      string             `json:"event_type" bson:"event_type"`
+	Body            string             `json:"body" bson:"body"`
+	Status          string             `json:"status" bson:"status"`
+	Failures        int                `json:"failures" bson:"failures"`
+	Next_Attempt_At time.Time          `json:"next_attempt_at" bson:"next_attempt_at"`
+	Attempts        []WebhookAttempt   `json:"attempts" bson:"attempts"`
+	Created_At      time.Time          `json:"created_at" bson:"created_at"`
+	Delivered_At    *time.Time         `json:"delivered_at" bson:"delivered_at,omitempty"`
+}
+
+type WebhookAttempt struct {
+	At          time.Time `json:"at" bson:"at"`
+	Status_Code int       `json:"status_code" bson:"status_code"`
+	Error       string    `json:"error,omitempty" bson:"error,omitempty"`
+	Duration_MS int64     `json:"duration_ms" bson:"duration_ms"`
 }
@@ -0,0 +1,60 @@
+package money
+
+import (
+	"fmt"
+	"math"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+)
+
+// UnmarshalBSONValue reads both the {amount, currency} document and the
+// bare numbers prices were stored as before. A bare number is a whole amount
+// in DefaultCurrency.
+func (m *Money) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	val := bsoncore.Value{Type: t, Data: data}
+
+	switch t {
+	case bsontype.EmbeddedDocument:
+		var doc struct {
+			Amount   int64  `bson:"amount"`
+			Currency string `bson:"currency"`
+		}
+
+		if err := bson.Unmarshal(data, &doc); err != nil {
+			return err
+		}
+
+		*m = New(doc.Amount, doc.Currency)
+		return nil
+	case bsontype.Null, bsontype.Undefined:
+		*m = Money{}
+		return nil
+	case bsontype.Int32:
+		return m.fromLegacy(int64(val.Int32()))
+	case bsontype.Int64:
+		return m.fromLegacy(val.Int64())
+	case bsontype.Double:
+		f := val.Double()
+
+		if f != math.Trunc(f) || f > math.MaxInt64 || f < math.MinInt64 {
+			return fmt.Errorf("cannot read %v as a legacy price", f)
+		}
+
+		return m.fromLegacy(int64(f))
+	}
+
+	return fmt.Errorf("cannot decode %s into money", t)
+}
+
+func (m *Money) fromLegacy(major int64) error {
+	converted, err := FromMajor(major, DefaultCurrency)
+
+	if err != nil {
+		return err
+	}
+
+	*m = converted
+	return nil
+}
@@ -0,0 +1,66 @@
+package money
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestUnmarshalBSONValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		price   interface{}
+		want    Money
+		wantErr bool
+	}{
+		{name: "document", price: bson.M{"amount": int64(1999), "currency": "eur"}, want: New(1999, "EUR")},
+		{name: "legacy int32", price: int32(20), want: New(2000, "USD")},
+		{name: "legacy int64", price: int64(20), want: New(2000, "USD")},
+		{name: "legacy whole double", price: 20.0, want: New(2000, "USD")},
+		{name: "null", price: nil, want: Money{}},
+		{name: "legacy fraction", price: 19.99, wantErr: true},
+		{name: "string", price: "20", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := bson.Marshal(bson.M{"price": tt.price})
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var doc struct {
+				Price Money `bson:"price"`
+			}
+
+			err = bson.Unmarshal(data, &doc)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want an error: %v", err, tt.wantErr)
+			}
+
+			if err == nil && doc.Price != tt.want {
+				t.Errorf("price = %v, want %v", doc.Price, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	data, err := bson.Marshal(struct {
+		Price Money `bson:"price"`
+	}{Price: New(1050, "BRL")})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc struct {
+		Price Money `bson:"price"`
+	}
+
+	if err = bson.Unmarshal(data, &doc); err != nil || doc.Price != New(1050, "BRL") {
+		t.Errorf("read back %v, %v", doc.Price, err)
+	}
+}
@@ -0,0 +1,288 @@
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+)
+
+var (
+	ErrCurrencyMismatch = errors.New("cannot combine amounts in different currencies")
+	ErrOverflow         = errors.New("amount is out of range")
+	ErrUnknownCurrency  = errors.New("unknown currency")
+)
+
+// DefaultCurrency is used for amounts stored before prices carried a
+// currency, and for new amounts that don't name one.
+var DefaultCurrency = "USD"
+
+// digits is the number of minor unit digits of each supported ISO 4217
+// currency.
+var digits = map[string]int{
+	"ARS": 2,
+	"AUD": 2,
+	"BRL": 2,
+	"CAD": 2,
+	"CHF": 2,
+	"CLP": 0,
+	"CNY": 2,
+	"EUR": 2,
+	"GBP": 2,
+	"JPY": 0,
+	"KRW": 0,
+	"MXN": 2,
+	"USD": 2,
+}
+
+// Money is an amount in the minor unit of its currency, e.g. cents. All
+// arithmetic stays in integers; rounding happens only where a ratio is
+// taken, and always half to even.
+type Money struct {
+	Amount   int64  `json:"amount" bson:"amount"`
+	Currency string `json:"currency" bson:"currency"`
+}
+
+func New(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: strings.ToUpper(currency)}
+}
+
+// Zero is an empty amount of the currency.
+func Zero(currency string) Money {
+	return New(0, currency)
+}
+
+// Valid reports whether c is a supported currency code.
+func Valid(c string) bool {
+	_, ok := digits[strings.ToUpper(c)]
+	return ok
+}
+
+// Digits returns the minor unit digits of the currency, 2 when unknown.
+func Digits(c string) int {
+	if d, ok := digits[strings.ToUpper(c)]; ok {
+		return d
+	}
+
+	return 2
+}
+
+// FromMajor converts a whole amount in major units, like 10 dollars, to
+// Money.
+func FromMajor(major int64, currency string) (Money, error) {
+	factor := int64(math.Pow10(Digits(currency)))
+
+	if major > math.MaxInt64/factor || major < math.MinInt64/factor {
+		return Money{}, ErrOverflow
+	}
+
+	return New(major*factor, currency), nil
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) sameCurrency(o Money) error {
+	if m.Currency != o.Currency {
+		return ErrCurrencyMismatch
+	}
+
+	return nil
+}
+
+func (m Money) Add(o Money) (Money, error) {
+	if err := m.sameCurrency(o); err != nil {
+		return Money{}, err
+	}
+
+	sum := m.Amount + o.Amount
+
+	if (o.Amount > 0 && sum < m.Amount) || (o.Amount < 0 && sum > m.Amount) {
+		return Money{}, ErrOverflow
+	}
+
+	return New(sum, m.Currency), nil
+}
+
+func (m Money) Sub(o Money) (Money, error) {
+	if o.Amount == math.MinInt64 {
+		return Money{}, ErrOverflow
+	}
+
+	return m.Add(New(-o.Amount, o.Currency))
+}
+
+// Mul multiplies by a quantity.
+func (m Money) Mul(n int64) (Money, error) {
+	if m.Amount == 0 || n == 0 {
+		return Zero(m.Currency), nil
+	}
+
+	product := m.Amount * n
+
+	if product/n != m.Amount || (m.Amount == -1 && n == math.MinInt64) || (n == -1 && m.Amount == math.MinInt64) {
+		return Money{}, ErrOverflow
+	}
+
+	return New(product, m.Currency), nil
+}
+
+// Cmp compares two amounts of the same currency like strings.Compare.
+func (m Money) Cmp(o Money) (int, error) {
+	if err := m.sameCurrency(o); err != nil {
+		return 0, err
+	}
+
+	switch {
+	case m.Amount < o.Amount:
+		return -1, nil
+	case m.Amount > o.Amount:
+		return 1, nil
+	}
+
+	return 0, nil
+}
+
+// Ratio returns m * num / den rounded half to even. It can't overflow as
+// long as |num| <= |den|.
+func (m Money) Ratio(num, den int64) Money {
+	if den == 0 {
+		return Zero(m.Currency)
+	}
+
+	r := new(big.Rat).SetFrac(
+		new(big.Int).Mul(big.NewInt(m.Amount), big.NewInt(num)),
+		big.NewInt(den),
+	)
+
+	return New(roundHalfEven(r), m.Currency)
+}
+
+// Percent returns pct percent of m, rounded half to even.
+func (m Money) Percent(pct int64) Money {
+	return m.Ratio(pct, 100)
+}
+
+// Allocate splits m across weights proportionally. Parts are rounded down
+// and the leftover minor units go to the largest remainders, so the parts
+// always add up to m exactly.
+func (m Money) Allocate(weights []int64) []Money {
+	parts := make([]Money, len(weights))
+
+	if m.Amount < 0 && m.Amount != math.MinInt64 {
+		for i, part := range New(-m.Amount, m.Currency).Allocate(weights) {
+			parts[i] = New(-part.Amount, m.Currency)
+		}
+
+		return parts
+	}
+
+	total := big.NewInt(0)
+
+	for i, w := range weights {
+		parts[i] = Zero(m.Currency)
+
+		if w > 0 {
+			total.Add(total, big.NewInt(w))
+		}
+	}
+
+	if total.Sign() == 0 {
+		return parts
+	}
+
+	remainders := make([]*big.Int, len(weights))
+	left := m.Amount
+
+	for i, w := range weights {
+		if w <= 0 {
+			continue
+		}
+
+		q, r := new(big.Int).QuoRem(
+			new(big.Int).Mul(big.NewInt(m.Amount), big.NewInt(w)),
+			total,
+			new(big.Int),
+		)
+
+		parts[i].Amount = q.Int64()
+		remainders[i] = r
+		left -= q.Int64()
+	}
+
+	// left is below the number of weighted parts, one pass is enough
+	for ; left > 0; left-- {
+		best := -1
+
+		for i, r := range remainders {
+			if r != nil && (best < 0 || r.Cmp(remainders[best]) > 0) {
+				best = i
+			}
+		}
+
+		parts[best].Amount++
+		remainders[best] = nil
+	}
+
+	return parts
+}
+
+func roundHalfEven(r *big.Rat) int64 {
+	num, den := r.Num(), r.Denom()
+
+	q, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+
+	// compare 2*|rem| with den to see which side of .5 we are on
+	twice := new(big.Int).Abs(rem)
+	twice.Mul(twice, big.NewInt(2))
+
+	switch twice.Cmp(den) {
+	case 1:
+		q.Add(q, big.NewInt(int64(num.Sign())))
+	case 0:
+		if q.Bit(0) == 1 {
+			q.Add(q, big.NewInt(int64(num.Sign())))
+		}
+	}
+
+	return q.Int64()
+}
+
+// String formats the amount in major units, e.g. "12.30 USD".
+func (m Money) String() string {
+	d := Digits(m.Currency)
+
+	if d == 0 {
+		return fmt.Sprintf("%d %s", m.Amount, m.Currency)
+	}
+
+	sign := ""
+	amount := new(big.Int).SetInt64(m.Amount)
+
+	if amount.Sign() < 0 {
+		sign = "-"
+		amount.Neg(amount)
+	}
+
+	factor := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(d)), nil)
+	major, minor := new(big.Int).QuoRem(amount, factor, new(big.Int))
+
+	return fmt.Sprintf("%s%d.%0*d %s", sign, major, d, minor, m.Currency)
+}
+
+// Sum adds amounts that must all be in currency.
+func Sum(currency string, amounts ...Money) (Money, error) {
+	total := Zero(currency)
+
+	for _, amount := range amounts {
+		var err error
+
+		if total, err = total.Add(amount); err != nil {
+			return Money{}, err
+		}
+	}
+
+	return total, nil
+}
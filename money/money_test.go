@@ -0,0 +1,149 @@
+package money
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRatioRoundsHalfToEven(t *testing.T) {
+	tests := []struct {
+		amount   int64
+		num, den int64
+		want     int64
+	}{
+		{amount: 10, num: 1, den: 4, want: 2},   // 2.5 -> 2
+		{amount: 30, num: 1, den: 4, want: 8},   // 7.5 -> 8
+		{amount: 5, num: 1, den: 2, want: 2},    // 2.5 -> 2
+		{amount: 7, num: 1, den: 2, want: 4},    // 3.5 -> 4
+		{amount: 10, num: 1, den: 3, want: 3},   // 3.33 -> 3
+		{amount: 20, num: 1, den: 3, want: 7},   // 6.67 -> 7
+		{amount: -10, num: 1, den: 4, want: -2}, // -2.5 -> -2
+		{amount: -30, num: 1, den: 4, want: -8}, // -7.5 -> -8
+		{amount: -20, num: 1, den: 3, want: -7}, // -6.67 -> -7
+		{amount: 1999, num: 0, den: 5, want: 0},
+		{amount: 1999, num: 1, den: 0, want: 0},
+		{amount: math.MaxInt64, num: 1, den: 1, want: math.MaxInt64},
+	}
+
+	for _, tt := range tests {
+		got := New(tt.amount, "USD").Ratio(tt.num, tt.den)
+
+		if got.Amount != tt.want || got.Currency != "USD" {
+			t.Errorf("%d * %d/%d = %v, want %d USD", tt.amount, tt.num, tt.den, got, tt.want)
+		}
+	}
+}
+
+func TestPercent(t *testing.T) {
+	tests := []struct {
+		amount int64
+		pct    int64
+		want   int64
+	}{
+		{amount: 1000, pct: 15, want: 150},
+		{amount: 1050, pct: 10, want: 105},
+		{amount: 25, pct: 10, want: 2}, // 2.5 -> 2
+		{amount: 35, pct: 10, want: 4}, // 3.5 -> 4
+		{amount: 999, pct: 100, want: 999},
+		{amount: 999, pct: 0, want: 0},
+	}
+
+	for _, tt := range tests {
+		if got := New(tt.amount, "EUR").Percent(tt.pct); got.Amount != tt.want {
+			t.Errorf("%d%% of %d = %d, want %d", tt.pct, tt.amount, got.Amount, tt.want)
+		}
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		name    string
+		amount  int64
+		weights []int64
+		want    []int64
+	}{
+		{name: "even", amount: 100, weights: []int64{1, 1}, want: []int64{50, 50}},
+		{name: "leftover to the first of equal remainders", amount: 100, weights: []int64{1, 1, 1}, want: []int64{34, 33, 33}},
+		{name: "leftover to the largest remainder", amount: 10, weights: []int64{3, 7, 5}, want: []int64{2, 5, 3}},
+		{name: "proportional", amount: 1000, weights: []int64{200, 300, 500}, want: []int64{200, 300, 500}},
+		{name: "more parts than units", amount: 2, weights: []int64{1, 1, 1}, want: []int64{1, 1, 0}},
+		{name: "zero and negative weights get nothing", amount: 100, weights: []int64{0, 1, -5, 1}, want: []int64{0, 50, 0, 50}},
+		{name: "no weight", amount: 100, weights: []int64{0, 0}, want: []int64{0, 0}},
+		{name: "nothing to split", amount: 0, weights: []int64{1, 2}, want: []int64{0, 0}},
+		{name: "negative amount", amount: -100, weights: []int64{1, 1, 1}, want: []int64{-34, -33, -33}},
+		{name: "no parts", amount: 100, weights: nil, want: []int64{}},
+		{name: "large weights", amount: math.MaxInt64, weights: []int64{math.MaxInt64, math.MaxInt64}, want: []int64{math.MaxInt64/2 + 1, math.MaxInt64 / 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts := New(tt.amount, "usd").Allocate(tt.weights)
+
+			if len(parts) != len(tt.want) {
+				t.Fatalf("got %d parts, want %d", len(parts), len(tt.want))
+			}
+
+			sum := int64(0)
+
+			for i, part := range parts {
+				if part.Amount != tt.want[i] || part.Currency != "USD" {
+					t.Errorf("part %d = %v, want %d USD", i, part, tt.want[i])
+				}
+
+				sum += part.Amount
+			}
+
+			if hasWeight(tt.weights) && sum != tt.amount {
+				t.Errorf("parts add up to %d, want %d", sum, tt.amount)
+			}
+		})
+	}
+}
+
+func hasWeight(weights []int64) bool {
+	for _, w := range weights {
+		if w > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestArithmetic(t *testing.T) {
+	if _, err := New(1, "USD").Add(New(1, "EUR")); err != ErrCurrencyMismatch {
+		t.Errorf("adding USD to EUR: err = %v, want ErrCurrencyMismatch", err)
+	}
+
+	if _, err := New(math.MaxInt64, "USD").Add(New(1, "USD")); err != ErrOverflow {
+		t.Errorf("adding past the max: err = %v, want ErrOverflow", err)
+	}
+
+	if _, err := New(math.MaxInt64/2+1, "USD").Mul(2); err != ErrOverflow {
+		t.Errorf("multiplying past the max: err = %v, want ErrOverflow", err)
+	}
+
+	sum, err := Sum("USD", New(150, "USD"), New(-50, "USD"), New(1, "USD"))
+
+	if err != nil || sum != New(101, "USD") {
+		t.Errorf("Sum = %v, %v, want 1.01 USD", sum, err)
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		m    Money
+		want string
+	}{
+		{m: New(1230, "USD"), want: "12.30 USD"},
+		{m: New(5, "EUR"), want: "0.05 EUR"},
+		{m: New(-1205, "BRL"), want: "-12.05 BRL"},
+		{m: New(1500, "JPY"), want: "1500 JPY"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.m.String(); got != tt.want {
+			t.Errorf("String() = %q, want %q", got, tt.want)
+		}
+	}
+}
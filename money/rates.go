@@ -0,0 +1,203 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNoRate      = errors.New("no exchange rate for this currency")
+	ErrInvalidRate = errors.New("exchange rates must be positive decimal numbers")
+)
+
+// Table is the exchange-rate table as it is stored and edited: how many units
+// of each currency one unit of Base buys. Rates are decimal strings so they
+// round-trip exactly.
+type Table struct {
+	Base      string            `json:"base"`
+	Rates     map[string]string `json:"rates"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// Rate is a conversion that was applied, kept on orders so the charged
+// amounts can be explained later.
+type Rate struct {
+	From  string    `json:"from" bson:"from"`
+	To    string    `json:"to" bson:"to"`
+	Value string    `json:"rate" bson:"rate"`
+	AsOf  time.Time `json:"as_of" bson:"as_of"`
+}
+
+// Rates converts amounts between currencies with the current table. It is
+// safe for concurrent use.
+type Rates struct {
+	mu    sync.RWMutex
+	table Table
+	rates map[string]*big.Rat
+}
+
+func NewRates() *Rates {
+	r := &Rates{}
+	_ = r.Set(Table{Base: DefaultCurrency})
+	return r
+}
+
+// Set validates the table and replaces the current one.
+func (r *Rates) Set(table Table) error {
+	table.Base = strings.ToUpper(table.Base)
+
+	if !Valid(table.Base) {
+		return ErrUnknownCurrency
+	}
+
+	rates := map[string]*big.Rat{table.Base: big.NewRat(1, 1)}
+	clean := make(map[string]string, len(table.Rates))
+
+	for currency, value := range table.Rates {
+		currency = strings.ToUpper(currency)
+
+		if !Valid(currency) {
+			return ErrUnknownCurrency
+		}
+
+		rate, ok := new(big.Rat).SetString(value)
+
+		if !ok || rate.Sign() <= 0 {
+			return ErrInvalidRate
+		}
+
+		rates[currency] = rate
+		clean[currency] = value
+	}
+
+	table.Rates = clean
+
+	if table.UpdatedAt.IsZero() {
+		table.UpdatedAt = time.Now().UTC()
+	}
+
+	r.mu.Lock()
+	r.table, r.rates = table, rates
+	r.mu.Unlock()
+
+	return nil
+}
+
+func (r *Rates) Table() Table {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	table := r.table
+	table.Rates = make(map[string]string, len(r.table.Rates))
+
+	for currency, value := range r.table.Rates {
+		table.Rates[currency] = value
+	}
+
+	return table
+}
+
+// Load reads the table from a JSON file. A missing file leaves the current
+// table, so the service still runs with same-currency prices only.
+func (r *Rates) Load(path string) error {
+	raw, err := os.ReadFile(path)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	var table Table
+
+	if err = json.Unmarshal(raw, &table); err != nil {
+		return err
+	}
+
+	return r.Set(table)
+}
+
+// Save writes the current table to path, replacing it atomically.
+func (r *Rates) Save(path string) error {
+	raw, err := json.MarshalIndent(r.Table(), "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".rates-*")
+
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(raw); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// Convert converts m to the currency to through the base currency, rounding
+// half to even in the minor unit of to.
+func (r *Rates) Convert(m Money, to string) (Money, Rate, error) {
+	to = strings.ToUpper(to)
+
+	if m.Currency == to {
+		return m, Rate{From: to, To: to, Value: "1"}, nil
+	}
+
+	r.mu.RLock()
+	from, okFrom := r.rates[m.Currency]
+	target, okTo := r.rates[to]
+	asOf := r.table.UpdatedAt
+	r.mu.RUnlock()
+
+	if !okFrom || !okTo {
+		return Money{}, Rate{}, ErrNoRate
+	}
+
+	rate := new(big.Rat).Quo(target, from)
+
+	// minor units differ between currencies, e.g. cents to yen
+	scale := new(big.Rat).SetFrac(
+		new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(Digits(to))), nil),
+		new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(Digits(m.Currency))), nil),
+	)
+
+	amount := new(big.Rat).SetInt64(m.Amount)
+	amount.Mul(amount, rate).Mul(amount, scale)
+
+	rounded := new(big.Int).Quo(amount.Num(), amount.Denom())
+
+	if new(big.Int).Abs(rounded).Cmp(big.NewInt(1<<62)) > 0 {
+		return Money{}, Rate{}, ErrOverflow
+	}
+
+	applied := Rate{From: m.Currency, To: to, Value: decimal(rate), AsOf: asOf}
+
+	return New(roundHalfEven(amount), to), applied, nil
+}
+
+// decimal formats a rate with up to 8 decimals and no trailing zeros.
+func decimal(r *big.Rat) string {
+	s := r.FloatString(8)
+	s = strings.TrimRight(s, "0")
+
+	return strings.TrimSuffix(s, ".")
+}
@@ -0,0 +1,138 @@
+package money
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testRates(t *testing.T) *Rates {
+	t.Helper()
+
+	rates := NewRates()
+	err := rates.Set(Table{Base: "usd", Rates: map[string]string{"eur": "0.92", "JPY": "150.5", "BRL": "0.5"}})
+
+	if err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	return rates
+}
+
+func TestConvert(t *testing.T) {
+	rates := testRates(t)
+
+	tests := []struct {
+		name string
+		m    Money
+		to   string
+		want Money
+		rate string
+		err  error
+	}{
+		{name: "same currency", m: New(1000, "USD"), to: "usd", want: New(1000, "USD"), rate: "1"},
+		{name: "from the base", m: New(1000, "USD"), to: "EUR", want: New(920, "EUR"), rate: "0.92"},
+		{name: "to fewer digits", m: New(1000, "USD"), to: "JPY", want: New(1505, "JPY"), rate: "150.5"},
+		{name: "to the base", m: New(1505, "JPY"), to: "USD", want: New(1000, "USD"), rate: "0.00664452"},
+		{name: "through the base", m: New(1000, "EUR"), to: "BRL", want: New(543, "BRL"), rate: "0.54347826"},
+		{name: "half to even down", m: New(1, "USD"), to: "BRL", want: New(0, "BRL"), rate: "0.5"},
+		{name: "half to even up", m: New(3, "USD"), to: "BRL", want: New(2, "BRL"), rate: "0.5"},
+		{name: "no rate", m: New(1000, "USD"), to: "GBP", err: ErrNoRate},
+		{name: "no rate from", m: New(1000, "GBP"), to: "USD", err: ErrNoRate},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, rate, err := rates.Convert(tt.m, tt.to)
+
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+
+			if got != tt.want || rate.Value != tt.rate {
+				t.Errorf("Convert(%v, %s) = %v at %s, want %v at %s", tt.m, tt.to, got, rate.Value, tt.want, tt.rate)
+			}
+		})
+	}
+}
+
+func TestSetValidates(t *testing.T) {
+	tests := []struct {
+		name  string
+		table Table
+		want  error
+	}{
+		{name: "unknown base", table: Table{Base: "XXX"}, want: ErrUnknownCurrency},
+		{name: "unknown currency", table: Table{Base: "USD", Rates: map[string]string{"XXX": "1"}}, want: ErrUnknownCurrency},
+		{name: "not a number", table: Table{Base: "USD", Rates: map[string]string{"EUR": "lots"}}, want: ErrInvalidRate},
+		{name: "zero", table: Table{Base: "USD", Rates: map[string]string{"EUR": "0"}}, want: ErrInvalidRate},
+		{name: "negative", table: Table{Base: "USD", Rates: map[string]string{"EUR": "-1"}}, want: ErrInvalidRate},
+		{name: "fraction", table: Table{Base: "USD", Rates: map[string]string{"EUR": "23/25"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rates := testRates(t)
+
+			if err := rates.Set(tt.table); !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+
+			// a rejected table leaves the current one in place
+			if _, _, err := rates.Convert(New(1, "USD"), "JPY"); (err == nil) != (tt.want != nil) {
+				t.Errorf("JPY conversion after Set: %v", err)
+			}
+		})
+	}
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rates.json")
+	asOf := time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+	saved := NewRates()
+
+	if err := saved.Set(Table{Base: "EUR", Rates: map[string]string{"USD": "1.087"}, UpdatedAt: asOf}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := saved.Save(path); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	loaded := NewRates()
+
+	if err := loaded.Load(path); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	table := loaded.Table()
+
+	if table.Base != "EUR" || table.Rates["USD"] != "1.087" || !table.UpdatedAt.Equal(asOf) {
+		t.Errorf("loaded %+v", table)
+	}
+
+	_, rate, err := loaded.Convert(New(100, "EUR"), "USD")
+
+	if err != nil || !rate.AsOf.Equal(asOf) {
+		t.Errorf("conversion rate %+v, %v, want one as of %v", rate, err, asOf)
+	}
+
+	if err = loaded.Load(filepath.Join(t.TempDir(), "missing.json")); err != nil {
+		t.Errorf("loading a missing file: %v", err)
+	}
+
+	if loaded.Table().Base != "EUR" {
+		t.Error("loading a missing file replaced the table")
+	}
+
+	if err = os.WriteFile(path, []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = loaded.Load(path); err == nil {
+		t.Error("loaded a broken file")
+	}
+}
@@ -0,0 +1,81 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/logging"
+)
+
+// EmailSender is the email channel.
+type EmailSender interface {
+	SendEmail(ctx context.Context, to string, subject string, body string) error
+}
+
+// SMSSender is the SMS channel.
+type SMSSender interface {
+	SendSMS(ctx context.Context, to string, body string) error
+}
+
+// LogSender writes messages to the log instead of sending them.
+type LogSender struct{}
+
+func (LogSender) SendEmail(ctx context.Context, to string, subject string, body string) error {
+	logging.FromContext(ctx).Info("email", "to", to, "subject", subject, "body", body)
+	return nil
+}
+
+func (LogSender) SendSMS(ctx context.Context, to string, body string) error {
+	logging.FromContext(ctx).Info("sms", "to", to, "body", body)
+	return nil
+}
+
+// FileSink appends messages to a file as JSON lines instead of sending
+// them, for development.
+type FileSink struct {
+	Path string
+	mu   sync.Mutex
+}
+
+type sentMessage struct {
+	Channel string    `json:"channel"`
+	To      string    `json:"to"`
+	Subject string    `json:"subject,omitempty"`
+	Body    string    `json:"body"`
+	Sent_At time.Time `json:"sent_at"`
+}
+
+func (s *FileSink) write(message sentMessage) error {
+	line, err := json.Marshal(message)
+
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, err := os.OpenFile(s.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err = f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+func (s *FileSink) SendEmail(ctx context.Context, to string, subject string, body string) error {
+	return s.write(sentMessage{Channel: "email", To: to, Subject: subject, Body: body, Sent_At: time.Now()})
+}
+
+func (s *FileSink) SendSMS(ctx context.Context, to string, body string) error {
+	return s.write(sentMessage{Channel: "sms", To: to, Body: body, Sent_At: time.Now()})
+}
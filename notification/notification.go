@@ -0,0 +1,126 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/logging"
+)
+
+var (
+	ErrNoTemplate  = errors.New("there is no template for this notification")
+	ErrNoRecipient = errors.New("the user has no address on any channel they accept")
+)
+
+// Kinds of events.
+const (
+	OrderPlaced   = "order_placed"
+	OrderShipped  = "order_shipped"
+	PasswordReset = "password_reset"
+	Verification  = "verification"
+	AbandonedCart = "abandoned_cart"
+)
+
+// Event is something a user should be told about. Data holds what the
+// message about it needs, e.g. a link.
+type Event struct {
+	Kind       string
+	User_ID    string
+	Data       map[string]string
+	Created_At time.Time
+}
+
+// Notifier delivers events to users.
+type Notifier interface {
+	Notify(ctx context.Context, event Event) error
+}
+
+// LogNotifier only logs events, for when no channel is set up.
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(ctx context.Context, event Event) error {
+	logging.FromContext(ctx).Info("notification", "kind", event.Kind, "user_id", event.User_ID, "data", event.Data)
+	return nil
+}
+
+// Preferences are the channels a user accepts messages on.
+type Preferences struct {
+	Email bool
+	SMS   bool
+}
+
+// DefaultPreferences apply to users who never chose.
+var DefaultPreferences = Preferences{Email: true}
+
+// Contact is how to reach a user.
+type Contact struct {
+	First_Name  string
+	Email       string
+	Phone       string
+	Preferences Preferences
+}
+
+// Contacts looks up how to reach users.
+type Contacts interface {
+	Contact(ctx context.Context, userID string) (Contact, error)
+}
+
+// Dispatcher is the Notifier that renders events with Templates and sends
+// them on the channels the user accepts, retrying failed sends with
+// Backoff. Templates marked Required go by email whatever the preferences
+// say. A nil channel is not used.
+type Dispatcher struct {
+	Templates *Templates
+	Contacts  Contacts
+	Email     EmailSender
+	SMS       SMSSender
+	Backoff   Backoff
+}
+
+func (d *Dispatcher) Notify(ctx context.Context, event Event) error {
+	contact, err := d.Contacts.Contact(ctx, event.User_ID)
+
+	if err != nil {
+		return err
+	}
+
+	data := map[string]string{"first_name": contact.First_Name}
+
+	for key, value := range event.Data {
+		data[key] = value
+	}
+
+	message, err := d.Templates.Render(event.Kind, data)
+
+	if err != nil {
+		return err
+	}
+
+	email := d.Email != nil && contact.Email != "" && (contact.Preferences.Email || message.Required)
+	sms := d.SMS != nil && contact.Phone != "" && contact.Preferences.SMS && message.SMS != ""
+
+	if !email && !sms {
+		return ErrNoRecipient
+	}
+
+	var errs []error
+
+	if email {
+		err := d.Backoff.Retry(ctx, func() error {
+			return d.Email.SendEmail(ctx, contact.Email, message.Subject, message.Email)
+		})
+
+		errs = append(errs, err)
+	}
+
+	if sms {
+		err := d.Backoff.Retry(ctx, func() error {
+			return d.SMS.SendSMS(ctx, contact.Phone, message.SMS)
+		})
+
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
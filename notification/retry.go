@@ -0,0 +1,47 @@
+package notification
+
+import (
+	"context"
+	"time"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/logging"
+)
+
+// Backoff retries a failed send up to Attempts times in all, waiting
+// Initial before the first retry and twice as long before each next one, up
+// to Max.
+type Backoff struct {
+	Attempts int
+	Initial  time.Duration
+	Max      time.Duration
+}
+
+var DefaultBackoff = Backoff{Attempts: 5, Initial: time.Second, Max: 30 * time.Second}
+
+// Retry calls send until it succeeds, the attempts run out or ctx is done,
+// and returns the last error.
+func (b Backoff) Retry(ctx context.Context, send func() error) error {
+	wait := b.Initial
+
+	for attempt := 1; ; attempt++ {
+		err := send()
+
+		if err == nil || attempt >= b.Attempts {
+			return err
+		}
+
+		logging.FromContext(ctx).Warn("send failed", "attempt", attempt, "attempts", b.Attempts, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+
+		wait *= 2
+
+		if b.Max > 0 && wait > b.Max {
+			wait = b.Max
+		}
+	}
+}
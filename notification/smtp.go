@@ -0,0 +1,184 @@
+package notification
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SMTPSender sends email through an SMTP server at Addr, "host:port". It
+// signs in when Username is set.
+type SMTPSender struct {
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+func (s SMTPSender) SendEmail(ctx context.Context, to string, subject string, body string) error {
+	var auth smtp.Auth
+
+	if s.Username != "" {
+		host, _, err := net.SplitHostPort(s.Addr)
+
+		if err != nil {
+			return err
+		}
+
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+
+	var msg strings.Builder
+
+	fmt.Fprintf(&msg, "From: %s\r\n", s.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	msg.WriteString("\r\n")
+
+	return smtp.SendMail(s.Addr, auth, s.From, []string{to}, []byte(msg.String()))
+}
+
+// SinkMail is a message the SMTP sink received.
+type SinkMail struct {
+	From string
+	To   []string
+	Data string
+}
+
+// SMTPSink is a local SMTP server that accepts every message and keeps it
+// instead of delivering it, for development and tests. Point an
+// SMTPSender at Addr.
+type SMTPSink struct {
+	Addr     string
+	listener net.Listener
+	mu       sync.Mutex
+	mail     []SinkMail
+}
+
+// StartSMTPSink listens on addr, e.g. "127.0.0.1:2525", or a free port with
+// "127.0.0.1:0".
+func StartSMTPSink(addr string) (*SMTPSink, error) {
+	listener, err := net.Listen("tcp", addr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	sink := &SMTPSink{Addr: listener.Addr().String(), listener: listener}
+
+	go sink.serve()
+
+	return sink, nil
+}
+
+// Mail returns the messages received so far.
+func (s *SMTPSink) Mail() []SinkMail {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]SinkMail(nil), s.mail...)
+}
+
+func (s *SMTPSink) Close() error {
+	return s.listener.Close()
+}
+
+func (s *SMTPSink) serve() {
+	for {
+		conn, err := s.listener.Accept()
+
+		if err != nil {
+			return
+		}
+
+		go s.session(conn)
+	}
+}
+
+func (s *SMTPSink) session(conn net.Conn) {
+	defer conn.Close()
+
+	text := textproto.NewConn(conn)
+	reply := func(code int, message string) bool {
+		return text.PrintfLine("%d %s", code, message) == nil
+	}
+
+	if !reply(220, "smtp sink ready") {
+		return
+	}
+
+	var mail SinkMail
+
+	for {
+		line, err := text.ReadLine()
+
+		if err != nil {
+			return
+		}
+
+		verb, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			reply(250, "smtp sink")
+		case "MAIL":
+			mail = SinkMail{From: address(arg)}
+			reply(250, "OK")
+		case "RCPT":
+			mail.To = append(mail.To, address(arg))
+			reply(250, "OK")
+		case "DATA":
+			if !reply(354, "end data with <CR><LF>.<CR><LF>") {
+				return
+			}
+
+			data, err := text.ReadDotBytes()
+
+			if err != nil {
+				return
+			}
+
+			mail.Data = string(data)
+
+			s.mu.Lock()
+			s.mail = append(s.mail, mail)
+			s.mu.Unlock()
+
+			slog.Info("smtp sink received mail", "from", mail.From, "to", strings.Join(mail.To, ", "), "data", mail.Data)
+
+			reply(250, "OK")
+		case "RSET":
+			mail = SinkMail{}
+			reply(250, "OK")
+		case "NOOP":
+			reply(250, "OK")
+		case "QUIT":
+			reply(221, "bye")
+			return
+		default:
+			reply(502, "command not implemented")
+		}
+	}
+}
+
+// address takes the address out of "FROM:<a@b.c>" or "TO:<a@b.c>".
+func address(arg string) string {
+	_, addr, _ := strings.Cut(arg, ":")
+	addr = strings.TrimSpace(addr)
+
+	if i := strings.IndexByte(addr, '>'); i >= 0 {
+		addr = addr[:i]
+	}
+
+	return strings.TrimPrefix(addr, "<")
+}
@@ -0,0 +1,150 @@
+package notification
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// Template is the text of one kind of message, in text/template syntax
+// over the event's data. SMS is empty for kinds not sent by SMS. Required
+// messages, such as password resets, are emailed even to users who turned
+// email off.
+type Template struct {
+	Subject  string
+	Email    string
+	SMS      string
+	Required bool
+}
+
+// Message is a Template rendered for one event.
+type Message = Template
+
+var DefaultTemplates = map[string]Template{
+	OrderPlaced: {
+		Subject: "Your order {{.order_id}} is placed",
+		Email: `Hi {{.first_name}},
+
+thank you for your order {{.order_id}} of {{.item_count}} item(s). We'll
+let you know as soon as it ships.`,
+		SMS: "Thanks for your order {{.order_id}}! We'll tell you when it ships.",
+	},
+	OrderShipped: {
+		Subject: "Your order {{.order_id}} is on its way",
+		Email: `Hi {{.first_name}},
+
+part of your order {{.order_id}} has shipped{{if .carrier}} with {{.carrier}}{{end}}.
+{{- if .tracking_number}}
+The tracking number is {{.tracking_number}}.{{end}}`,
+		SMS: "Your order {{.order_id}} has shipped{{if .tracking_number}}, tracking number {{.tracking_number}}{{end}}.",
+	},
+	PasswordReset: {
+		Subject: "Reset your password",
+		Email: `Hi {{.first_name}},
+
+follow this link to choose a new password: {{.reset_url}}
+
+If you didn't ask for this, you can ignore this message.`,
+		Required: true,
+	},
+	Verification: {
+		Subject: "Your verification code",
+		Email: `Hi {{.first_name}},
+
+your verification code is {{.code}}.`,
+		SMS:      "Your verification code is {{.code}}.",
+		Required: true,
+	},
+	AbandonedCart: {
+		Subject: "You left something in your cart",
+		Email: `Hi {{.first_name}},
+
+{{.first_item}}{{if ne .item_count "1"}} and more are{{else}} is{{end}} still waiting in your cart.
+Pick up where you left off: {{.restore_url}}`,
+	},
+}
+
+type parsedTemplate struct {
+	subject, email, sms *template.Template
+	required            bool
+}
+
+// Templates are parsed Templates by event kind.
+type Templates struct {
+	kinds map[string]parsedTemplate
+}
+
+func NewTemplates(texts map[string]Template) (*Templates, error) {
+	t := &Templates{kinds: make(map[string]parsedTemplate, len(texts))}
+
+	for kind, text := range texts {
+		var p parsedTemplate
+		var err error
+
+		parse := func(part string, body string) *template.Template {
+			if err != nil || body == "" {
+				return nil
+			}
+
+			var parsed *template.Template
+
+			parsed, err = template.New(kind + "." + part).Option("missingkey=zero").Parse(body)
+
+			return parsed
+		}
+
+		p.subject = parse("subject", text.Subject)
+		p.email = parse("email", text.Email)
+		p.sms = parse("sms", text.SMS)
+		p.required = text.Required
+
+		if err != nil {
+			return nil, fmt.Errorf("template %s: %w", kind, err)
+		}
+
+		t.kinds[kind] = p
+	}
+
+	return t, nil
+}
+
+func execute(t *template.Template, data map[string]string) (string, error) {
+	if t == nil {
+		return "", nil
+	}
+
+	var b strings.Builder
+
+	if err := t.Execute(&b, data); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(b.String()), nil
+}
+
+// Render fills in the templates of kind with data.
+func (t *Templates) Render(kind string, data map[string]string) (Message, error) {
+	p, ok := t.kinds[kind]
+
+	if !ok {
+		return Message{}, ErrNoTemplate
+	}
+
+	message := Message{Required: p.required}
+
+	var err error
+
+	if message.Subject, err = execute(p.subject, data); err != nil {
+		return message, err
+	}
+
+	if message.Email, err = execute(p.email, data); err != nil {
+		return message, err
+	}
+
+	if message.SMS, err = execute(p.sms, data); err != nil {
+		return message, err
+	}
+
+	return message, nil
+}
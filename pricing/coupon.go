@@ -0,0 +1,119 @@
+package pricing
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/money"
+)
+
+var (
+	ErrCouponInactive     = errors.New("this coupon is not active")
+	ErrCouponNotStarted   = errors.New("this coupon is not valid yet")
+	ErrCouponExpired      = errors.New("this coupon has expired")
+	ErrCouponExhausted    = errors.New("this coupon has reached its usage limit")
+	ErrCouponUserLimit    = errors.New("you have already used this coupon")
+	ErrCouponMinCartValue = errors.New("the cart does not reach the minimum value for this coupon")
+	ErrCouponNotEligible  = errors.New("no item in the cart is eligible for this coupon")
+	ErrCouponCurrency     = errors.New("this coupon is not valid in the cart currency")
+)
+
+// CouponUse is what a coupon did to a cart.
+type CouponUse struct {
+	Code         string      `json:"code"`
+	Type         string      `json:"type"`
+	Discount     money.Money `json:"discount"`
+	FreeShipping bool        `json:"free_shipping"`
+	// Lines spreads Discount over the eligible lines, for line taxes.
+	Lines []models.LineDiscount `json:"lines"`
+}
+
+// ApplyCoupon checks the coupon against the cart and computes its discount.
+// userUses is how many times the customer already redeemed it. The discount
+// never exceeds the value of the eligible lines.
+func ApplyCoupon(coupon models.Coupon, cart []models.ProductUser, userUses int, now time.Time) (CouponUse, error) {
+	currency := cartCurrency(cart)
+	use := CouponUse{Code: coupon.Code, Type: coupon.Type, Discount: money.Zero(currency)}
+
+	switch {
+	case !coupon.Active:
+		return use, ErrCouponInactive
+	case coupon.Starts_At != nil && now.Before(*coupon.Starts_At):
+		return use, ErrCouponNotStarted
+	case coupon.Ends_At != nil && !now.Before(*coupon.Ends_At):
+		return use, ErrCouponExpired
+	case coupon.Max_Uses > 0 && coupon.Uses >= coupon.Max_Uses:
+		return use, ErrCouponExhausted
+	case coupon.Max_Uses_Per_User > 0 && userUses >= coupon.Max_Uses_Per_User:
+		return use, ErrCouponUserLimit
+	}
+
+	subtotal, eligibleTotal := money.Zero(currency), money.Zero(currency)
+	eligibleLines := 0
+	weights := make([]int64, len(cart))
+
+	for i, line := range cart {
+		var err error
+
+		if subtotal, err = subtotal.Add(line.Price); err != nil {
+			return use, err
+		}
+
+		if matches(coupon.Product_IDs, coupon.Categories, line) {
+			if eligibleTotal, err = eligibleTotal.Add(line.Price); err != nil {
+				return use, err
+			}
+
+			eligibleLines++
+			weights[i] = line.Price.Amount
+		}
+	}
+
+	if !coupon.Min_Cart_Value.IsZero() {
+		cmp, err := subtotal.Cmp(coupon.Min_Cart_Value)
+
+		if err != nil {
+			return use, ErrCouponCurrency
+		}
+
+		if cmp < 0 {
+			return use, ErrCouponMinCartValue
+		}
+	}
+
+	if eligibleLines == 0 {
+		return use, ErrCouponNotEligible
+	}
+
+	switch coupon.Type {
+	case models.CouponPercentage:
+		use.Discount = eligibleTotal.Percent(min(coupon.Percent, 100))
+	case models.CouponFixedAmount:
+		cmp, err := coupon.Amount.Cmp(eligibleTotal)
+
+		if err != nil {
+			return use, ErrCouponCurrency
+		}
+
+		use.Discount = eligibleTotal
+
+		if cmp < 0 {
+			use.Discount = coupon.Amount
+		}
+	case models.CouponFreeShipping:
+		use.FreeShipping = true
+	}
+
+	for i, share := range use.Discount.Allocate(weights) {
+		if share.Amount > 0 {
+			use.Lines = append(use.Lines, models.LineDiscount{
+				Line:       i,
+				Product_ID: cart[i].Product_ID,
+				Amount:     share,
+			})
+		}
+	}
+
+	return use, nil
+}
@@ -0,0 +1,136 @@
+package pricing
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var now = time.Date(2026, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+func line(amount int64, currency string, category string) models.ProductUser {
+	return models.ProductUser{
+		Product_ID: primitive.NewObjectID(),
+		Price:      money.New(amount, currency),
+		Category:   &category,
+	}
+}
+
+func usd(amounts ...int64) []models.ProductUser {
+	cart := make([]models.ProductUser, len(amounts))
+
+	for i, amount := range amounts {
+		cart[i] = line(amount, "USD", "misc")
+	}
+
+	return cart
+}
+
+func TestApplyCouponLimits(t *testing.T) {
+	later := now.Add(time.Hour)
+
+	tests := []struct {
+		name     string
+		coupon   models.Coupon
+		userUses int
+		want     error
+	}{
+		{name: "inactive", coupon: models.Coupon{Type: models.CouponPercentage, Percent: 10}, want: ErrCouponInactive},
+		{name: "not started", coupon: models.Coupon{Type: models.CouponPercentage, Percent: 10, Active: true, Starts_At: &later}, want: ErrCouponNotStarted},
+		{name: "ends now", coupon: models.Coupon{Type: models.CouponPercentage, Percent: 10, Active: true, Ends_At: &now}, want: ErrCouponExpired},
+		{name: "used up", coupon: models.Coupon{Type: models.CouponPercentage, Percent: 10, Active: true, Max_Uses: 5, Uses: 5}, want: ErrCouponExhausted},
+		{name: "used up by the user", coupon: models.Coupon{Type: models.CouponPercentage, Percent: 10, Active: true, Max_Uses_Per_User: 1}, userUses: 1, want: ErrCouponUserLimit},
+		{name: "below the minimum", coupon: models.Coupon{Type: models.CouponPercentage, Percent: 10, Active: true, Min_Cart_Value: money.New(5000, "USD")}, want: ErrCouponMinCartValue},
+		{name: "minimum in another currency", coupon: models.Coupon{Type: models.CouponPercentage, Percent: 10, Active: true, Min_Cart_Value: money.New(1, "EUR")}, want: ErrCouponCurrency},
+		{name: "amount in another currency", coupon: models.Coupon{Type: models.CouponFixedAmount, Amount: money.New(100, "EUR"), Active: true}, want: ErrCouponCurrency},
+		{name: "no eligible line", coupon: models.Coupon{Type: models.CouponPercentage, Percent: 10, Active: true, Categories: []string{"shoes"}}, want: ErrCouponNotEligible},
+		{name: "valid", coupon: models.Coupon{Type: models.CouponPercentage, Percent: 10, Active: true, Max_Uses: 5, Uses: 4, Max_Uses_Per_User: 2}, userUses: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ApplyCoupon(tt.coupon, usd(1000), tt.userUses, now); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyCouponDiscount(t *testing.T) {
+	hats := line(300, "USD", "hats")
+	shoes := line(5000, "USD", "shoes")
+	cart := []models.ProductUser{hats, shoes}
+
+	tests := []struct {
+		name         string
+		coupon       models.Coupon
+		discount     int64
+		freeShipping bool
+	}{
+		{name: "percentage", coupon: models.Coupon{Type: models.CouponPercentage, Percent: 10}, discount: 530},
+		{name: "percentage above 100", coupon: models.Coupon{Type: models.CouponPercentage, Percent: 150}, discount: 5300},
+		{name: "fixed amount", coupon: models.Coupon{Type: models.CouponFixedAmount, Amount: money.New(1000, "USD")}, discount: 1000},
+		{name: "fixed amount above the eligible lines", coupon: models.Coupon{Type: models.CouponFixedAmount, Amount: money.New(1000, "USD"), Categories: []string{"hats"}}, discount: 300},
+		{name: "restricted to a product", coupon: models.Coupon{Type: models.CouponPercentage, Percent: 10, Product_IDs: []primitive.ObjectID{shoes.Product_ID}}, discount: 500},
+		{name: "free shipping", coupon: models.Coupon{Type: models.CouponFreeShipping}, freeShipping: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.coupon.Active = true
+			use, err := ApplyCoupon(tt.coupon, cart, 0, now)
+
+			if err != nil {
+				t.Fatalf("ApplyCoupon: %v", err)
+			}
+
+			if use.Discount != money.New(tt.discount, "USD") || use.FreeShipping != tt.freeShipping {
+				t.Errorf("got %+v, want discount %d USD and free shipping %v", use, tt.discount, tt.freeShipping)
+			}
+		})
+	}
+}
+
+func TestFixedCouponNeverExceedsEligibleLines(t *testing.T) {
+	cart := []models.ProductUser{line(300, "USD", "hats"), line(5000, "USD", "shoes")}
+	coupon := models.Coupon{Type: models.CouponFixedAmount, Amount: money.New(1000, "USD"), Active: true, Categories: []string{"hats"}}
+
+	use, err := ApplyCoupon(coupon, cart, 0, now)
+
+	if err != nil {
+		t.Fatalf("ApplyCoupon: %v", err)
+	}
+
+	if use.Discount.Amount != 300 || len(use.Lines) != 1 || use.Lines[0].Line != 0 {
+		t.Errorf("discount = %v on %+v, want 300 on line 0", use.Discount, use.Lines)
+	}
+}
+
+func TestCouponLinesAddUpToTheDiscount(t *testing.T) {
+	cart := usd(1000, 2000, 3001)
+	coupon := models.Coupon{Type: models.CouponFixedAmount, Amount: money.New(1000, "USD"), Active: true}
+
+	use, err := ApplyCoupon(coupon, cart, 0, now)
+
+	if err != nil {
+		t.Fatalf("ApplyCoupon: %v", err)
+	}
+
+	sum := int64(0)
+
+	for _, l := range use.Lines {
+		sum += l.Amount.Amount
+
+		if l.Product_ID != cart[l.Line].Product_ID {
+			t.Errorf("line %d names product %v", l.Line, l.Product_ID)
+		}
+	}
+
+	if sum != use.Discount.Amount || len(use.Lines) != 3 {
+		t.Errorf("lines %+v add up to %d, want %v over 3 lines", use.Lines, sum, use.Discount)
+	}
+}
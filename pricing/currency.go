@@ -0,0 +1,63 @@
+package pricing
+
+import (
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/money"
+)
+
+// ListPrice resolves a product's price in currency: its fixed price for that
+// market if it has one, otherwise base converted with rates. The returned
+// rate is nil when no conversion was needed.
+func ListPrice(base money.Money, prices []money.Money, currency string, rates *money.Rates) (money.Money, *money.Rate, error) {
+	for _, price := range prices {
+		if price.Currency == currency {
+			return price, nil, nil
+		}
+	}
+
+	if base.Currency == currency {
+		return base, nil, nil
+	}
+
+	converted, rate, err := rates.Convert(base, currency)
+
+	if err != nil {
+		return money.Money{}, nil, err
+	}
+
+	return converted, &rate, nil
+}
+
+// Localize prices every cart line in currency and returns the distinct
+// conversions it used, so an order can record them.
+func Localize(cart []models.ProductUser, currency string, rates *money.Rates) ([]models.ProductUser, []money.Rate, error) {
+	lines := make([]models.ProductUser, len(cart))
+	used := make([]money.Rate, 0)
+
+	for i, line := range cart {
+		price, rate, err := ListPrice(line.Price, line.Prices, currency, rates)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		lines[i] = line
+		lines[i].Price = price
+
+		if rate != nil && !hasRate(used, *rate) {
+			used = append(used, *rate)
+		}
+	}
+
+	return lines, used, nil
+}
+
+func hasRate(rates []money.Rate, rate money.Rate) bool {
+	for _, r := range rates {
+		if r.From == rate.From && r.To == rate.To {
+			return true
+		}
+	}
+
+	return false
+}
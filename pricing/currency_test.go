@@ -0,0 +1,89 @@
+package pricing
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/money"
+)
+
+func testRates(t *testing.T) *money.Rates {
+	t.Helper()
+
+	rates := money.NewRates()
+
+	if err := rates.Set(money.Table{Base: "USD", Rates: map[string]string{"EUR": "0.9"}}); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+
+	return rates
+}
+
+func TestListPrice(t *testing.T) {
+	rates := testRates(t)
+	base := money.New(1000, "USD")
+	fixed := []money.Money{money.New(950, "EUR")}
+
+	tests := []struct {
+		name      string
+		prices    []money.Money
+		currency  string
+		want      money.Money
+		converted bool
+		err       error
+	}{
+		{name: "base currency", currency: "USD", want: base},
+		{name: "fixed price for the market", prices: fixed, currency: "EUR", want: money.New(950, "EUR")},
+		{name: "converted from the base", currency: "EUR", want: money.New(900, "EUR"), converted: true},
+		{name: "no rate", prices: fixed, currency: "GBP", err: money.ErrNoRate},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, rate, err := ListPrice(base, tt.prices, tt.currency, rates)
+
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+
+			if got != tt.want || (rate != nil) != tt.converted {
+				t.Errorf("ListPrice() = %v, %+v, want %v, converted %v", got, rate, tt.want, tt.converted)
+			}
+		})
+	}
+}
+
+func TestLocalize(t *testing.T) {
+	rates := testRates(t)
+
+	cart := usd(1000, 2000)
+	cart = append(cart, line(700, "EUR", "misc"))
+	cart[1].Prices = []money.Money{money.New(1500, "EUR")}
+
+	lines, used, err := Localize(cart, "EUR", rates)
+
+	if err != nil {
+		t.Fatalf("Localize: %v", err)
+	}
+
+	want := []int64{900, 1500, 700}
+
+	for i, l := range lines {
+		if l.Price != money.New(want[i], "EUR") {
+			t.Errorf("line %d = %v, want %d EUR", i, l.Price, want[i])
+		}
+	}
+
+	if len(used) != 1 || used[0].From != "USD" || used[0].To != "EUR" || used[0].Value != "0.9" {
+		t.Errorf("rates used = %+v, want only USD to EUR", used)
+	}
+
+	if cart[0].Price != money.New(1000, "USD") {
+		t.Error("Localize changed the cart it was given")
+	}
+
+	if _, _, err = Localize([]models.ProductUser{line(100, "USD", "misc")}, "JPY", rates); !errors.Is(err, money.ErrNoRate) {
+		t.Errorf("no rate: err = %v, want %v", err, money.ErrNoRate)
+	}
+}
@@ -0,0 +1,302 @@
+package pricing
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// matches reports whether a line falls under a product/category restriction.
+// An empty restriction covers every line.
+func matches(productIDs []primitive.ObjectID, categories []string, line models.ProductUser) bool {
+	if len(productIDs) == 0 && len(categories) == 0 {
+		return true
+	}
+
+	for _, id := range productIDs {
+		if id == line.Product_ID {
+			return true
+		}
+	}
+
+	if line.Category != nil {
+		for _, category := range categories {
+			if category == *line.Category {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func running(promotion models.Promotion, now time.Time) bool {
+	return promotion.Active &&
+		(promotion.Starts_At == nil || !now.Before(*promotion.Starts_At)) &&
+		(promotion.Ends_At == nil || now.Before(*promotion.Ends_At))
+}
+
+// promoCart tracks what is left of each cart line while promotions are
+// applied, so one unit never feeds two item-level promotions. Amounts are
+// minor units of the cart currency; Price has already checked that the
+// lines share it and that their sum fits.
+type promoCart struct {
+	currency string
+	lines    []models.ProductUser
+	net      []int64
+	consumed []bool
+}
+
+func (pc *promoCart) discount(applied *models.AppliedPromotion, line int, amount int64) {
+	amount = min(amount, pc.net[line])
+
+	if amount <= 0 {
+		return
+	}
+
+	pc.net[line] -= amount
+	applied.Discount.Amount += amount
+	applied.Lines = append(applied.Lines, models.LineDiscount{
+		Line:       line,
+		Product_ID: pc.lines[line].Product_ID,
+		Amount:     money.New(amount, pc.currency),
+	})
+}
+
+// spread allocates amount over lines proportionally to their net price, so
+// the parts add up to it exactly.
+func (pc *promoCart) spread(applied *models.AppliedPromotion, all []int, amount int64) {
+	lines := make([]int, 0, len(all))
+	weights := make([]int64, 0, len(all))
+	base := int64(0)
+
+	for _, line := range all {
+		if pc.net[line] > 0 {
+			lines = append(lines, line)
+			weights = append(weights, pc.net[line])
+			base += pc.net[line]
+		}
+	}
+
+	if base <= 0 {
+		return
+	}
+
+	shares := money.New(min(amount, base), pc.currency).Allocate(weights)
+
+	for i, line := range lines {
+		pc.discount(applied, line, shares[i].Amount)
+	}
+}
+
+// ApplyPromotions runs the running promotions over the cart in priority
+// order (highest first) and returns what each one took off, line by line.
+// Buy-x-get-y and bundle rules consume the units they use; spend thresholds
+// look at what is left to pay after them.
+func ApplyPromotions(promotions []models.Promotion, cart []models.ProductUser, now time.Time) []models.AppliedPromotion {
+	pc := &promoCart{
+		currency: cartCurrency(cart),
+		lines:    cart,
+		net:      make([]int64, len(cart)),
+		consumed: make([]bool, len(cart)),
+	}
+
+	for i, line := range cart {
+		pc.net[i] = line.Price.Amount
+	}
+
+	ordered := make([]models.Promotion, 0, len(promotions))
+
+	for _, promotion := range promotions {
+		if running(promotion, now) {
+			ordered = append(ordered, promotion)
+		}
+	}
+
+	// item-level rules go first so thresholds see discounted amounts
+	sort.SliceStable(ordered, func(i, j int) bool {
+		ti := ordered[i].Type == models.PromotionSpendThreshold
+		tj := ordered[j].Type == models.PromotionSpendThreshold
+
+		if ti != tj {
+			return tj
+		}
+
+		return ordered[i].Priority > ordered[j].Priority
+	})
+
+	applied := make([]models.AppliedPromotion, 0)
+
+	for _, promotion := range ordered {
+		result := models.AppliedPromotion{
+			Promotion_ID: promotion.Promotion_ID,
+			Name:         promotion.Name,
+			Discount:     money.Zero(pc.currency),
+		}
+
+		switch promotion.Type {
+		case models.PromotionBuyXGetY:
+			pc.buyXGetY(promotion, &result)
+		case models.PromotionBundle:
+			pc.bundle(promotion, &result)
+		case models.PromotionSpendThreshold:
+			pc.spendThreshold(promotion, &result)
+		}
+
+		if result.Discount.Amount > 0 {
+			applied = append(applied, result)
+		}
+	}
+
+	return applied
+}
+
+// buyXGetY groups the eligible units from most to least expensive; in every
+// full group of buy+get units the cheapest get units are discounted.
+func (pc *promoCart) buyXGetY(promotion models.Promotion, result *models.AppliedPromotion) {
+	group := promotion.Buy_Quantity + promotion.Get_Quantity
+
+	if promotion.Buy_Quantity <= 0 || promotion.Get_Quantity <= 0 || promotion.Get_Percent <= 0 {
+		return
+	}
+
+	units := make([]int, 0)
+
+	for i, line := range pc.lines {
+		if !pc.consumed[i] && matches(promotion.Product_IDs, promotion.Categories, line) {
+			units = append(units, i)
+		}
+	}
+
+	sort.SliceStable(units, func(a, b int) bool {
+		return pc.net[units[a]] > pc.net[units[b]]
+	})
+
+	free := 0
+
+	for start := 0; start+group <= len(units); start += group {
+		for k, line := range units[start : start+group] {
+			pc.consumed[line] = true
+
+			if k >= promotion.Buy_Quantity {
+				pc.discount(result, line, money.New(pc.net[line], pc.currency).Percent(min(promotion.Get_Percent, 100)).Amount)
+				free++
+			}
+		}
+	}
+
+	if free == 0 {
+		return
+	}
+
+	offer := "free"
+
+	if promotion.Get_Percent < 100 {
+		offer = fmt.Sprintf("%d%% off", promotion.Get_Percent)
+	}
+
+	result.Description = fmt.Sprintf(
+		"buy %d, get %d %s: %d item(s) discounted",
+		promotion.Buy_Quantity, promotion.Get_Quantity, offer, free,
+	)
+}
+
+// bundle prices every complete set of the bundle's products at
+// Bundle_Price, as many times as the cart holds a full set.
+func (pc *promoCart) bundle(promotion models.Promotion, result *models.AppliedPromotion) {
+	if len(promotion.Product_IDs) < 2 || promotion.Bundle_Price.Currency != pc.currency {
+		return
+	}
+
+	sets := 0
+
+	for {
+		set := make([]int, 0, len(promotion.Product_IDs))
+
+		for _, id := range promotion.Product_IDs {
+			for i, line := range pc.lines {
+				if !pc.consumed[i] && line.Product_ID == id && !contains(set, i) {
+					set = append(set, i)
+					break
+				}
+			}
+		}
+
+		if len(set) < len(promotion.Product_IDs) {
+			break
+		}
+
+		total := int64(0)
+
+		for _, line := range set {
+			pc.consumed[line] = true
+			total += pc.net[line]
+		}
+
+		if total > promotion.Bundle_Price.Amount {
+			pc.spread(result, set, total-promotion.Bundle_Price.Amount)
+		}
+
+		sets++
+	}
+
+	if result.Discount.Amount > 0 {
+		result.Description = fmt.Sprintf("bundle of %d items for %s: applied %d time(s)",
+			len(promotion.Product_IDs), promotion.Bundle_Price, sets)
+	}
+}
+
+// spendThreshold applies the highest tier whose minimum the eligible lines
+// reach, spread over those lines. Tiers in another currency are ignored.
+func (pc *promoCart) spendThreshold(promotion models.Promotion, result *models.AppliedPromotion) {
+	lines := make([]int, 0)
+	spent := int64(0)
+
+	for i, line := range pc.lines {
+		if matches(promotion.Product_IDs, promotion.Categories, line) {
+			lines = append(lines, i)
+			spent += pc.net[i]
+		}
+	}
+
+	var best *models.PromotionTier
+
+	for i := range promotion.Tiers {
+		tier := &promotion.Tiers[i]
+
+		if tier.Min_Subtotal.Currency != pc.currency || (!tier.Amount.IsZero() && tier.Amount.Currency != pc.currency) {
+			continue
+		}
+
+		if spent >= tier.Min_Subtotal.Amount && (best == nil || tier.Min_Subtotal.Amount > best.Min_Subtotal.Amount) {
+			best = tier
+		}
+	}
+
+	if best == nil {
+		return
+	}
+
+	// spread caps the amount at what is left to pay, so it can't overflow
+	amount := best.Amount.Amount + money.New(spent, pc.currency).Percent(min(best.Percent, 100)).Amount
+
+	pc.spread(result, lines, amount)
+
+	if result.Discount.Amount > 0 {
+		result.Description = fmt.Sprintf("spend %s, save %s", best.Min_Subtotal, result.Discount)
+	}
+}
+
+func contains(list []int, v int) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+
+	return false
+}
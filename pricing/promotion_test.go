@@ -0,0 +1,176 @@
+package pricing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestApplyPromotions(t *testing.T) {
+	past := now.Add(-time.Hour)
+	later := now.Add(time.Hour)
+
+	shoes := []models.ProductUser{line(3000, "USD", "shoes"), line(2000, "USD", "shoes"), line(1000, "USD", "hats")}
+	a, b := line(1000, "USD", "misc"), line(800, "USD", "misc")
+
+	buyOneGetOne := models.Promotion{
+		Name:         "shoes b1g1",
+		Type:         models.PromotionBuyXGetY,
+		Active:       true,
+		Categories:   []string{"shoes"},
+		Buy_Quantity: 1,
+		Get_Quantity: 1,
+		Get_Percent:  100,
+	}
+	halfOff := buyOneGetOne
+	halfOff.Get_Percent = 50
+
+	bundle := models.Promotion{
+		Name:         "a and b",
+		Type:         models.PromotionBundle,
+		Active:       true,
+		Priority:     2,
+		Product_IDs:  []primitive.ObjectID{a.Product_ID, b.Product_ID},
+		Bundle_Price: money.New(1500, "USD"),
+	}
+	anyTwo := models.Promotion{
+		Name:         "any two",
+		Type:         models.PromotionBuyXGetY,
+		Active:       true,
+		Priority:     1,
+		Buy_Quantity: 1,
+		Get_Quantity: 1,
+		Get_Percent:  100,
+	}
+	euroBundle := bundle
+	euroBundle.Bundle_Price = money.New(1500, "EUR")
+
+	tenOffFifty := models.Promotion{
+		Name:     "10% over 50",
+		Type:     models.PromotionSpendThreshold,
+		Active:   true,
+		Priority: 10,
+		Tiers: []models.PromotionTier{
+			{Min_Subtotal: money.New(5000, "USD"), Percent: 10},
+			{Min_Subtotal: money.New(10000, "USD"), Amount: money.New(500, "USD"), Percent: 10},
+			{Min_Subtotal: money.New(1, "EUR"), Percent: 90},
+		},
+	}
+
+	inactive := tenOffFifty
+	inactive.Active = false
+	ended := tenOffFifty
+	ended.Ends_At = &past
+	notStarted := tenOffFifty
+	notStarted.Starts_At = &later
+
+	tests := []struct {
+		name       string
+		cart       []models.ProductUser
+		promotions []models.Promotion
+		want       []int64
+	}{
+		{
+			name:       "buy one get one discounts the cheaper unit",
+			cart:       shoes,
+			promotions: []models.Promotion{buyOneGetOne},
+			want:       []int64{2000},
+		},
+		{
+			name:       "only full groups count",
+			cart:       append(append([]models.ProductUser(nil), shoes...), line(1000, "USD", "shoes")),
+			promotions: []models.Promotion{halfOff},
+			want:       []int64{1000},
+		},
+		{
+			name:       "bundle at its price",
+			cart:       []models.ProductUser{a, b, a},
+			promotions: []models.Promotion{bundle},
+			want:       []int64{300},
+		},
+		{
+			name:       "bundled units are not used again",
+			cart:       []models.ProductUser{a, b},
+			promotions: []models.Promotion{anyTwo, bundle},
+			want:       []int64{300},
+		},
+		{
+			name:       "bundle priced in another currency",
+			cart:       []models.ProductUser{a, b},
+			promotions: []models.Promotion{euroBundle},
+			want:       []int64{},
+		},
+		{
+			name:       "spend threshold",
+			cart:       usd(3000, 2500),
+			promotions: []models.Promotion{tenOffFifty},
+			want:       []int64{550},
+		},
+		{
+			name:       "highest tier reached in the cart currency",
+			cart:       usd(6000, 4000),
+			promotions: []models.Promotion{tenOffFifty},
+			want:       []int64{1500},
+		},
+		{
+			name:       "threshold not reached",
+			cart:       usd(3000, 1999),
+			promotions: []models.Promotion{tenOffFifty},
+			want:       []int64{},
+		},
+		{
+			name:       "item promotion first, then the threshold on what is left",
+			cart:       append(append([]models.ProductUser(nil), shoes...), usd(1000)...),
+			promotions: []models.Promotion{tenOffFifty, buyOneGetOne},
+			want:       []int64{2000, 500},
+		},
+		{
+			name:       "promotions that aren't running",
+			cart:       usd(10000),
+			promotions: []models.Promotion{inactive, ended, notStarted},
+			want:       []int64{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			applied := ApplyPromotions(tt.promotions, tt.cart, now)
+
+			if len(applied) != len(tt.want) {
+				t.Fatalf("applied %+v, want discounts %v", applied, tt.want)
+			}
+
+			taken := make([]int64, len(tt.cart))
+
+			for i, promotion := range applied {
+				if promotion.Discount != money.New(tt.want[i], "USD") {
+					t.Errorf("%s took %v, want %d USD", promotion.Name, promotion.Discount, tt.want[i])
+				}
+
+				sum := int64(0)
+
+				for _, l := range promotion.Lines {
+					sum += l.Amount.Amount
+					taken[l.Line] += l.Amount.Amount
+
+					if l.Product_ID != tt.cart[l.Line].Product_ID {
+						t.Errorf("line %d names product %v", l.Line, l.Product_ID)
+					}
+				}
+
+				if sum != promotion.Discount.Amount {
+					t.Errorf("%s lines add up to %d, want %v", promotion.Name, sum, promotion.Discount)
+				}
+			}
+
+			for i, amount := range taken {
+				if amount > tt.cart[i].Price.Amount {
+					t.Errorf("line %d discounted %d, more than its price %v", i, amount, tt.cart[i].Price)
+				}
+			}
+		})
+	}
+}
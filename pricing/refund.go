@@ -0,0 +1,63 @@
+package pricing
+
+import (
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/money"
+)
+
+// LinesPaid is what the customer paid for each line of the order: its price
+// less its share of promotions and the coupon, plus exclusive tax. Orders
+// placed before coupon lines were recorded spread the rest of the discount
+// over the lines in proportion to their price.
+func LinesPaid(order models.Order) []money.Money {
+	currency := order.Currency
+
+	if currency == "" {
+		currency = order.Price.Currency
+	}
+
+	paid := make([]int64, len(order.Order_Cart))
+	prices := make([]int64, len(order.Order_Cart))
+
+	for i, line := range order.Order_Cart {
+		paid[i] = line.Price.Amount
+		prices[i] = line.Price.Amount
+	}
+
+	discounted := int64(0)
+
+	subtract := func(lines []models.LineDiscount) {
+		for _, line := range lines {
+			if line.Line >= 0 && line.Line < len(paid) {
+				paid[line.Line] -= line.Amount.Amount
+				discounted += line.Amount.Amount
+			}
+		}
+	}
+
+	for _, applied := range order.Promotions {
+		subtract(applied.Lines)
+	}
+
+	subtract(order.Coupon_Lines)
+
+	if rest := order.Discount.Amount - discounted; rest > 0 && len(paid) > 0 {
+		for i, share := range money.New(rest, currency).Allocate(prices) {
+			paid[i] -= share.Amount
+		}
+	}
+
+	for _, tax := range order.Tax_Lines {
+		if !tax.Inclusive && tax.Line >= 0 && tax.Line < len(paid) {
+			paid[tax.Line] += tax.Tax.Amount
+		}
+	}
+
+	lines := make([]money.Money, len(paid))
+
+	for i, amount := range paid {
+		lines[i] = money.New(max(amount, 0), currency)
+	}
+
+	return lines
+}
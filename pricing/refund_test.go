@@ -0,0 +1,108 @@
+package pricing
+
+import (
+	"testing"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/money"
+)
+
+func TestLinesPaid(t *testing.T) {
+	discount := func(line int, amount int64) models.LineDiscount {
+		return models.LineDiscount{Line: line, Amount: money.New(amount, "USD")}
+	}
+
+	tax := func(line int, amount int64, inclusive bool) models.LineTax {
+		return models.LineTax{Line: line, Tax: money.New(amount, "USD"), Inclusive: inclusive}
+	}
+
+	tests := []struct {
+		name  string
+		order models.Order
+		want  []int64
+	}{
+		{
+			name:  "full price",
+			order: models.Order{Currency: "USD", Order_Cart: usd(1000, 500)},
+			want:  []int64{1000, 500},
+		},
+		{
+			name: "promotion and coupon lines, exclusive tax on top",
+			order: models.Order{
+				Currency:     "USD",
+				Order_Cart:   usd(1000, 500),
+				Discount:     money.New(150, "USD"),
+				Promotions:   []models.AppliedPromotion{{Lines: []models.LineDiscount{discount(0, 100)}}},
+				Coupon_Lines: []models.LineDiscount{discount(1, 50)},
+				Tax_Lines:    []models.LineTax{tax(0, 90, false), tax(1, 10, true)},
+			},
+			want: []int64{990, 450},
+		},
+		{
+			name: "discount from before lines were recorded spread by price",
+			order: models.Order{
+				Currency:   "USD",
+				Order_Cart: usd(1000, 500),
+				Discount:   money.New(300, "USD"),
+			},
+			want: []int64{800, 400},
+		},
+		{
+			name: "only the part of the discount without lines is spread",
+			order: models.Order{
+				Currency:   "USD",
+				Order_Cart: usd(1000, 500),
+				Discount:   money.New(250, "USD"),
+				Promotions: []models.AppliedPromotion{{Lines: []models.LineDiscount{discount(0, 100)}}},
+			},
+			want: []int64{800, 450},
+		},
+		{
+			name: "never below zero",
+			order: models.Order{
+				Currency:     "USD",
+				Order_Cart:   usd(100),
+				Discount:     money.New(150, "USD"),
+				Coupon_Lines: []models.LineDiscount{discount(0, 150)},
+			},
+			want: []int64{0},
+		},
+		{
+			name: "lines out of range are ignored",
+			order: models.Order{
+				Currency:     "USD",
+				Order_Cart:   usd(100),
+				Coupon_Lines: []models.LineDiscount{discount(3, 50), discount(-1, 50)},
+				Tax_Lines:    []models.LineTax{tax(5, 10, false)},
+			},
+			want: []int64{100},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			paid := LinesPaid(tt.order)
+
+			if len(paid) != len(tt.want) {
+				t.Fatalf("got %d lines, want %d", len(paid), len(tt.want))
+			}
+
+			for i, amount := range paid {
+				if amount.Amount != tt.want[i] || amount.Currency != "USD" {
+					t.Errorf("line %d paid %v, want %d USD", i, amount, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLinesPaidInTheOrderCurrency(t *testing.T) {
+	order := models.Order{
+		Price:      money.New(1000, "EUR"),
+		Order_Cart: []models.ProductUser{line(1000, "EUR", "misc")},
+	}
+
+	if paid := LinesPaid(order); paid[0] != money.New(1000, "EUR") {
+		t.Errorf("paid %v, want 10.00 EUR", paid[0])
+	}
+}
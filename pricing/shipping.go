@@ -0,0 +1,149 @@
+package pricing
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/money"
+)
+
+var (
+	ErrShippingUnavailable = errors.New("this shipping method can't deliver this cart to this address")
+	ErrAddressRequired     = errors.New("this shipping method needs a delivery address")
+)
+
+// VolumetricDivisor turns a parcel's volume in cubic millimetres into its
+// volumetric weight in grams, the common 5000 cm³/kg of couriers.
+const VolumetricDivisor = 5000
+
+// BillableWeight is the weight couriers charge for: each line weighs the
+// larger of its actual and volumetric weight.
+func BillableWeight(cart []models.ProductUser) int64 {
+	total := int64(0)
+
+	for _, line := range cart {
+		weight := line.Weight_Grams
+
+		if d := line.Dimensions; d != nil {
+			// each side is at most 100 m, so the volume fits an int64
+			weight = max(weight, d.Length*d.Width*d.Height/VolumetricDivisor)
+		}
+
+		total += max(weight, 0)
+	}
+
+	return total
+}
+
+func deliversTo(method models.ShippingMethod, country string) bool {
+	if len(method.Countries) == 0 {
+		return true
+	}
+
+	for _, c := range method.Countries {
+		if strings.EqualFold(c, country) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// QuoteShipping prices method for the cart delivered to address, in the
+// currency of spent, which is what the goods cost after discounts. Method
+// amounts in another currency are converted with rates. address may be nil
+// only for local pickup.
+func QuoteShipping(
+	method models.ShippingMethod,
+	cart []models.ProductUser,
+	spent money.Money,
+	address *models.Address,
+	rates *money.Rates,
+) (models.ShippingQuote, error) {
+	weight := BillableWeight(cart)
+
+	quote := models.ShippingQuote{
+		Method_ID:    method.Method_ID,
+		Name:         method.Name,
+		Type:         method.Type,
+		Cost:         money.Zero(spent.Currency),
+		Weight_Grams: weight,
+	}
+
+	if !method.Active {
+		return quote, ErrShippingUnavailable
+	}
+
+	if method.Type == models.ShippingPickup {
+		quote.Pickup_Location = method.Pickup_Location
+		return quote, nil
+	}
+
+	if address == nil {
+		return quote, ErrAddressRequired
+	}
+
+	if !deliversTo(method, LocationOf(*address).Country) {
+		return quote, ErrShippingUnavailable
+	}
+
+	if method.Max_Weight_Grams > 0 && weight > method.Max_Weight_Grams {
+		return quote, ErrShippingUnavailable
+	}
+
+	cost := method.Rate
+
+	switch method.Type {
+	case models.ShippingWeight:
+		// every started kilogram counts
+		perKg, err := method.Per_Kg.Mul((weight + 999) / 1000)
+
+		if err != nil {
+			return quote, err
+		}
+
+		if cost, err = cost.Add(perKg); err != nil {
+			return quote, err
+		}
+	case models.ShippingFreeAbove:
+		threshold, _, err := rates.Convert(method.Free_Above, spent.Currency)
+
+		if err != nil {
+			return quote, err
+		}
+
+		if spent.Amount >= threshold.Amount {
+			return quote, nil
+		}
+	}
+
+	converted, _, err := rates.Convert(cost, spent.Currency)
+
+	if err != nil {
+		return quote, err
+	}
+
+	quote.Cost = converted
+
+	return quote, nil
+}
+
+// AddShipping adds the quote to the totals. A free shipping coupon zeroes
+// its cost.
+func (t *Totals) AddShipping(quote models.ShippingQuote) error {
+	if t.Coupon != nil && t.Coupon.FreeShipping {
+		quote.Cost = money.Zero(t.Currency)
+	}
+
+	total, err := t.Total.Add(quote.Cost)
+
+	if err != nil {
+		return err
+	}
+
+	t.Shipping = &quote
+	t.Total = total
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package pricing
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/money"
+)
+
+func parcels() []models.ProductUser {
+	cart := usd(1000, 1000, 1000)
+	cart[0].Weight_Grams = 1000
+	// 6000 cm³ weighs 1200 g volumetric
+	cart[1].Weight_Grams = 200
+	cart[1].Dimensions = &models.Dimensions{Length: 300, Width: 200, Height: 100}
+
+	return cart
+}
+
+func TestBillableWeight(t *testing.T) {
+	if got := BillableWeight(parcels()); got != 2200 {
+		t.Errorf("BillableWeight() = %d, want 2200", got)
+	}
+
+	if got := BillableWeight(nil); got != 0 {
+		t.Errorf("BillableWeight(nil) = %d, want 0", got)
+	}
+}
+
+func TestQuoteShipping(t *testing.T) {
+	rates := testRates(t)
+	us, de := "us", "DE"
+	counter := "the shop counter"
+
+	flat := models.ShippingMethod{Name: "flat", Type: models.ShippingFlat, Active: true, Rate: money.New(500, "USD")}
+	usOnly := flat
+	usOnly.Countries = []string{"US"}
+	light := flat
+	light.Max_Weight_Grams = 1000
+	inactive := flat
+	inactive.Active = false
+	weight := models.ShippingMethod{Type: models.ShippingWeight, Active: true, Rate: money.New(300, "USD"), Per_Kg: money.New(200, "USD")}
+	freeAbove := models.ShippingMethod{Type: models.ShippingFreeAbove, Active: true, Rate: money.New(500, "USD"), Free_Above: money.New(1000, "USD")}
+	pickup := models.ShippingMethod{Type: models.ShippingPickup, Active: true, Rate: money.New(500, "USD"), Pickup_Location: &counter}
+
+	tests := []struct {
+		name    string
+		method  models.ShippingMethod
+		spent   money.Money
+		country *string
+		want    money.Money
+		err     error
+	}{
+		{name: "flat", method: flat, spent: money.New(1000, "USD"), country: &us, want: money.New(500, "USD")},
+		{name: "converted to the cart currency", method: flat, spent: money.New(1000, "EUR"), country: &de, want: money.New(450, "EUR")},
+		{name: "switched off", method: inactive, spent: money.New(1000, "USD"), country: &us, err: ErrShippingUnavailable},
+		{name: "needs an address", method: flat, spent: money.New(1000, "USD"), err: ErrAddressRequired},
+		{name: "delivers to the country", method: usOnly, spent: money.New(1000, "USD"), country: &us, want: money.New(500, "USD")},
+		{name: "doesn't deliver to the country", method: usOnly, spent: money.New(1000, "USD"), country: &de, err: ErrShippingUnavailable},
+		{name: "too heavy", method: light, spent: money.New(1000, "USD"), country: &us, err: ErrShippingUnavailable},
+		{name: "every started kilogram", method: weight, spent: money.New(1000, "USD"), country: &us, want: money.New(900, "USD")},
+		{name: "free above reached", method: freeAbove, spent: money.New(1000, "USD"), country: &us, want: money.New(0, "USD")},
+		{name: "free above not reached", method: freeAbove, spent: money.New(999, "USD"), country: &us, want: money.New(500, "USD")},
+		{name: "free above in another currency", method: freeAbove, spent: money.New(900, "EUR"), country: &de, want: money.New(0, "EUR")},
+		{name: "pickup needs no address", method: pickup, spent: money.New(1000, "USD"), want: money.New(0, "USD")},
+		{name: "no rate for the method currency", method: flat, spent: money.New(1000, "GBP"), country: &us, err: money.ErrNoRate},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var address *models.Address
+
+			if tt.country != nil {
+				address = &models.Address{Country: tt.country}
+			}
+
+			quote, err := QuoteShipping(tt.method, parcels(), tt.spent, address, rates)
+
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+
+			if err == nil && quote.Cost != tt.want {
+				t.Errorf("cost = %v, want %v", quote.Cost, tt.want)
+			}
+
+			if quote.Weight_Grams != 2200 {
+				t.Errorf("weight = %d, want 2200", quote.Weight_Grams)
+			}
+		})
+	}
+}
+
+func TestAddShipping(t *testing.T) {
+	quote := models.ShippingQuote{Name: "flat", Cost: money.New(500, "USD")}
+
+	totals := Totals{Currency: "USD", Total: money.New(1000, "USD")}
+
+	if err := totals.AddShipping(quote); err != nil {
+		t.Fatal(err)
+	}
+
+	if totals.Total != money.New(1500, "USD") || totals.Shipping == nil || totals.Shipping.Cost != quote.Cost {
+		t.Errorf("total %v with shipping %+v, want 15.00 USD", totals.Total, totals.Shipping)
+	}
+
+	free := Totals{Currency: "USD", Total: money.New(1000, "USD"), Coupon: &CouponUse{FreeShipping: true}}
+
+	if err := free.AddShipping(quote); err != nil {
+		t.Fatal(err)
+	}
+
+	if free.Total != money.New(1000, "USD") || free.Shipping.Cost != money.Zero("USD") {
+		t.Errorf("total %v with shipping %+v, want the coupon to make it free", free.Total, free.Shipping)
+	}
+}
@@ -0,0 +1,187 @@
+package pricing
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrInvalidTaxRate = errors.New("a tax rate must be a decimal percentage between 0 and 100")
+
+// TaxLocation is where the order is delivered, which decides the rules that
+// apply. Country is an ISO 3166 alpha-2 code.
+type TaxLocation struct {
+	Country string `json:"country"`
+	Region  string `json:"region,omitempty"`
+}
+
+// LocationOf reads the tax location from an address book entry.
+func LocationOf(address models.Address) TaxLocation {
+	var location TaxLocation
+
+	if address.Country != nil {
+		location.Country = strings.ToUpper(strings.TrimSpace(*address.Country))
+	}
+
+	if address.Region != nil {
+		location.Region = strings.ToUpper(strings.TrimSpace(*address.Region))
+	}
+
+	return location
+}
+
+// TaxableLine is what is left to pay for one cart line after promotions and
+// coupons.
+type TaxableLine struct {
+	Line      int
+	ProductID primitive.ObjectID
+	TaxClass  string
+	Amount    money.Money
+}
+
+// TaxCalculator computes the tax of each line delivered to location.
+type TaxCalculator interface {
+	Calculate(location TaxLocation, lines []TaxableLine) ([]models.LineTax, error)
+}
+
+// ParseTaxRate reads a decimal percentage like "20" or "8.875" as the
+// fraction num/den of a hundred.
+func ParseTaxRate(rate string) (num, den int64, err error) {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(rate))
+
+	if !ok || r.Sign() < 0 || r.Cmp(big.NewRat(100, 1)) > 0 {
+		return 0, 0, ErrInvalidTaxRate
+	}
+
+	// keep 100*den+num, used for inclusive prices, well inside an int64
+	if !r.Denom().IsInt64() || r.Denom().Int64() > 1_000_000_000 {
+		return 0, 0, ErrInvalidTaxRate
+	}
+
+	return r.Num().Int64(), r.Denom().Int64(), nil
+}
+
+type taxRule struct {
+	models.TaxRule
+	num, den int64
+}
+
+// RuleTable is a TaxCalculator over a table of models.TaxRule. It is safe
+// for concurrent use and can be reloaded while serving.
+type RuleTable struct {
+	mu    sync.RWMutex
+	rules []taxRule
+}
+
+func NewRuleTable() *RuleTable {
+	return &RuleTable{}
+}
+
+// Reset replaces the rules, refusing the whole table if one rate is invalid.
+func (t *RuleTable) Reset(rules []models.TaxRule) error {
+	parsed := make([]taxRule, 0, len(rules))
+
+	for _, rule := range rules {
+		num, den, err := ParseTaxRate(rule.Rate)
+
+		if err != nil {
+			return err
+		}
+
+		rule.Country = strings.ToUpper(rule.Country)
+		rule.Region = strings.ToUpper(rule.Region)
+		parsed = append(parsed, taxRule{TaxRule: rule, num: num, den: den})
+	}
+
+	t.mu.Lock()
+	t.rules = parsed
+	t.mu.Unlock()
+
+	return nil
+}
+
+// match finds the most specific rule for the location and class: a rule for
+// the region beats one for the whole country, and a rule for the class
+// beats one for every class.
+func (t *RuleTable) match(location TaxLocation, class string) (taxRule, bool) {
+	best, bestScore := taxRule{}, -1
+
+	for _, rule := range t.rules {
+		if rule.Country != location.Country {
+			continue
+		}
+
+		score := 0
+
+		switch rule.Region {
+		case "":
+		case location.Region:
+			score += 2
+		default:
+			continue
+		}
+
+		switch rule.Tax_Class {
+		case "":
+		case class:
+			score++
+		default:
+			continue
+		}
+
+		if score > bestScore {
+			best, bestScore = rule, score
+		}
+	}
+
+	return best, bestScore >= 0
+}
+
+// Calculate taxes each line with its matching rule; lines without one are
+// not taxed. Inclusive rules extract the tax from the amount, exclusive ones
+// add it on top. Each line is rounded half to even on its own.
+func (t *RuleTable) Calculate(location TaxLocation, lines []TaxableLine) ([]models.LineTax, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	taxes := make([]models.LineTax, 0, len(lines))
+
+	for _, line := range lines {
+		class := line.TaxClass
+
+		if class == "" {
+			class = models.DefaultTaxClass
+		}
+
+		rule, ok := t.match(location, class)
+
+		if !ok {
+			continue
+		}
+
+		tax := models.LineTax{
+			Line:       line.Line,
+			Product_ID: line.ProductID,
+			Tax_Class:  class,
+			Rule:       rule.Name,
+			Rate:       rule.Rate,
+			Inclusive:  rule.Inclusive,
+			Taxable:    line.Amount,
+		}
+
+		if rule.Inclusive {
+			tax.Tax = line.Amount.Ratio(rule.num, 100*rule.den+rule.num)
+		} else {
+			tax.Tax = line.Amount.Ratio(rule.num, 100*rule.den)
+		}
+
+		taxes = append(taxes, tax)
+	}
+
+	return taxes, nil
+}
@@ -0,0 +1,144 @@
+package pricing
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/money"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func taxTable(t *testing.T, rules ...models.TaxRule) *RuleTable {
+	t.Helper()
+
+	table := NewRuleTable()
+
+	if err := table.Reset(rules); err != nil {
+		t.Fatalf("Reset: %v", err)
+	}
+
+	return table
+}
+
+func TestParseTaxRate(t *testing.T) {
+	tests := []struct {
+		rate     string
+		num, den int64
+		err      error
+	}{
+		{rate: "20", num: 20, den: 1},
+		{rate: " 8.875 ", num: 71, den: 8},
+		{rate: "0", num: 0, den: 1},
+		{rate: "100", num: 100, den: 1},
+		{rate: "100.5", err: ErrInvalidTaxRate},
+		{rate: "-1", err: ErrInvalidTaxRate},
+		{rate: "ten", err: ErrInvalidTaxRate},
+		{rate: "", err: ErrInvalidTaxRate},
+		{rate: "0.0000000001", err: ErrInvalidTaxRate},
+	}
+
+	for _, tt := range tests {
+		num, den, err := ParseTaxRate(tt.rate)
+
+		if num != tt.num || den != tt.den || !errors.Is(err, tt.err) {
+			t.Errorf("ParseTaxRate(%q) = %d/%d, %v, want %d/%d, %v", tt.rate, num, den, err, tt.num, tt.den, tt.err)
+		}
+	}
+}
+
+func TestResetRefusesTheWholeTable(t *testing.T) {
+	table := taxTable(t, models.TaxRule{Country: "US", Rate: "5"})
+
+	err := table.Reset([]models.TaxRule{{Country: "US", Rate: "7"}, {Country: "DE", Rate: "lots"}})
+
+	if !errors.Is(err, ErrInvalidTaxRate) {
+		t.Fatalf("err = %v, want %v", err, ErrInvalidTaxRate)
+	}
+
+	taxes, _ := table.Calculate(TaxLocation{Country: "US"}, []TaxableLine{{Amount: money.New(100, "USD")}})
+
+	if len(taxes) != 1 || taxes[0].Rate != "5" {
+		t.Errorf("taxes = %+v, want the old 5%% rule", taxes)
+	}
+}
+
+func TestCalculate(t *testing.T) {
+	table := taxTable(t,
+		models.TaxRule{Country: "us", Name: "federal", Rate: "5"},
+		models.TaxRule{Country: "US", Region: "ca", Name: "california", Rate: "7.25"},
+		models.TaxRule{Country: "US", Tax_Class: "food", Name: "food", Rate: "1"},
+		models.TaxRule{Country: "DE", Name: "mwst", Rate: "19", Inclusive: true},
+	)
+
+	id := primitive.NewObjectID()
+	food := "food"
+
+	tests := []struct {
+		name     string
+		location TaxLocation
+		class    string
+		amount   int64
+		rule     string
+		tax      int64
+	}{
+		{name: "country rule", location: TaxLocation{Country: "US", Region: "NY"}, amount: 1000, rule: "federal", tax: 50},
+		{name: "region rule, 72.5 rounds half to even", location: TaxLocation{Country: "US", Region: "CA"}, amount: 1000, rule: "california", tax: 72},
+		{name: "a region rule beats a class rule", location: TaxLocation{Country: "US", Region: "CA"}, class: food, amount: 1000, rule: "california", tax: 72},
+		{name: "class rule", location: TaxLocation{Country: "US"}, class: food, amount: 1000, rule: "food", tax: 10},
+		{name: "inclusive", location: TaxLocation{Country: "DE"}, amount: 1190, rule: "mwst", tax: 190},
+		{name: "no rule", location: TaxLocation{Country: "BR"}, amount: 1000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			taxes, err := table.Calculate(tt.location, []TaxableLine{
+				{Line: 3, ProductID: id, TaxClass: tt.class, Amount: money.New(tt.amount, "USD")},
+			})
+
+			if err != nil {
+				t.Fatalf("Calculate: %v", err)
+			}
+
+			if tt.rule == "" {
+				if len(taxes) != 0 {
+					t.Errorf("taxes = %+v, want none", taxes)
+				}
+
+				return
+			}
+
+			if len(taxes) != 1 {
+				t.Fatalf("taxes = %+v, want one line", taxes)
+			}
+
+			tax := taxes[0]
+
+			if tax.Rule != tt.rule || tax.Tax != money.New(tt.tax, "USD") {
+				t.Errorf("taxed %v by %q, want %d by %q", tax.Tax, tax.Rule, tt.tax, tt.rule)
+			}
+
+			wantClass := tt.class
+
+			if wantClass == "" {
+				wantClass = models.DefaultTaxClass
+			}
+
+			if tax.Line != 3 || tax.Product_ID != id || tax.Tax_Class != wantClass || tax.Taxable != money.New(tt.amount, "USD") {
+				t.Errorf("tax line = %+v", tax)
+			}
+		})
+	}
+}
+
+func TestLocationOf(t *testing.T) {
+	country, region := " us", "ca "
+
+	if got := LocationOf(models.Address{Country: &country, Region: &region}); got != (TaxLocation{Country: "US", Region: "CA"}) {
+		t.Errorf("LocationOf() = %+v", got)
+	}
+
+	if got := LocationOf(models.Address{}); got != (TaxLocation{}) {
+		t.Errorf("LocationOf(empty) = %+v", got)
+	}
+}
@@ -0,0 +1,155 @@
+package pricing
+
+import (
+	"time"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/money"
+)
+
+// Totals is the priced view of a cart, shared by the cart listing and
+// checkout so both show the same numbers.
+type Totals struct {
+	Currency string `json:"currency"`
+	// Lines is the cart as priced, every line in Currency.
+	Lines    []models.ProductUser `json:"-"`
+	Subtotal money.Money          `json:"subtotal"`
+	// ExchangeRates are the conversions used for lines without a price in
+	// Currency.
+	ExchangeRates []money.Rate              `json:"exchange_rates,omitempty"`
+	Promotions    []models.AppliedPromotion `json:"promotions"`
+	Coupon        *CouponUse                `json:"coupon,omitempty"`
+	// CouponError explains why an applied coupon gives no discount right now.
+	CouponError string      `json:"coupon_error,omitempty"`
+	CouponErr   error       `json:"-"`
+	Discount    money.Money `json:"discount"`
+	// Tax is the tax of every line; only the part from exclusive lines is
+	// added to Total, inclusive lines already contain theirs.
+	TaxLocation TaxLocation      `json:"tax_location"`
+	Tax         money.Money      `json:"tax"`
+	TaxLines    []models.LineTax `json:"tax_lines"`
+	// Shipping is the chosen method, see AddShipping, delivered to
+	// ShippingAddress; tax is not charged on it.
+	Shipping        *models.ShippingQuote `json:"shipping,omitempty"`
+	ShippingAddress *models.Address       `json:"shipping_address,omitempty"`
+	Total           money.Money           `json:"total"`
+}
+
+// cartCurrency is the currency of the first line; Price refuses carts that
+// mix currencies.
+func cartCurrency(cart []models.ProductUser) string {
+	if len(cart) == 0 || cart[0].Price.Currency == "" {
+		return money.DefaultCurrency
+	}
+
+	return cart[0].Price.Currency
+}
+
+// Price computes the totals of cart in currency: automatic promotions first,
+// then the coupon over what is left to pay, then tax on each line's net
+// amount for the location. coupon and taxes may be nil. It fails when a line
+// is not in currency (see Localize) or the amounts don't fit in an int64.
+func Price(
+	currency string,
+	cart []models.ProductUser,
+	promotions []models.Promotion,
+	coupon *models.Coupon,
+	userUses int,
+	taxes TaxCalculator,
+	location TaxLocation,
+	now time.Time,
+) (Totals, error) {
+	totals := Totals{
+		Currency:    currency,
+		Lines:       cart,
+		TaxLocation: location,
+		Tax:         money.Zero(currency),
+		TaxLines:    make([]models.LineTax, 0),
+	}
+
+	prices := make([]money.Money, 0, len(cart))
+
+	for _, line := range cart {
+		prices = append(prices, line.Price)
+	}
+
+	subtotal, err := money.Sum(currency, prices...)
+
+	if err != nil {
+		return totals, err
+	}
+
+	totals.Subtotal = subtotal
+	totals.Promotions = ApplyPromotions(promotions, cart, now)
+
+	net := make([]models.ProductUser, len(cart))
+	copy(net, cart)
+
+	discount := int64(0)
+
+	for _, applied := range totals.Promotions {
+		discount += applied.Discount.Amount
+
+		for _, line := range applied.Lines {
+			net[line.Line].Price.Amount -= line.Amount.Amount
+		}
+	}
+
+	if coupon != nil {
+		use, err := ApplyCoupon(*coupon, net, userUses, now)
+
+		if err != nil {
+			totals.CouponErr = err
+			totals.CouponError = err.Error()
+		} else {
+			totals.Coupon = &use
+			discount += use.Discount.Amount
+
+			for _, line := range use.Lines {
+				net[line.Line].Price.Amount -= line.Amount.Amount
+			}
+		}
+	}
+
+	totals.Discount = money.New(discount, currency)
+	totals.Total = money.New(max(subtotal.Amount-discount, 0), currency)
+
+	if taxes == nil {
+		return totals, nil
+	}
+
+	taxable := make([]TaxableLine, 0, len(net))
+
+	for i, line := range net {
+		class := ""
+
+		if line.Tax_Class != nil {
+			class = *line.Tax_Class
+		}
+
+		taxable = append(taxable, TaxableLine{
+			Line:      i,
+			ProductID: line.Product_ID,
+			TaxClass:  class,
+			Amount:    money.New(max(line.Price.Amount, 0), currency),
+		})
+	}
+
+	if totals.TaxLines, err = taxes.Calculate(location, taxable); err != nil {
+		return totals, err
+	}
+
+	for _, line := range totals.TaxLines {
+		if totals.Tax, err = totals.Tax.Add(line.Tax); err != nil {
+			return totals, err
+		}
+
+		if !line.Inclusive {
+			if totals.Total, err = totals.Total.Add(line.Tax); err != nil {
+				return totals, err
+			}
+		}
+	}
+
+	return totals, nil
+}
@@ -0,0 +1,242 @@
+package pricing
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/models"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/money"
+)
+
+func TestPrice(t *testing.T) {
+	past := now.Add(-time.Hour)
+
+	buyOneGetOne := models.Promotion{
+		Name:         "shoes b1g1",
+		Type:         models.PromotionBuyXGetY,
+		Active:       true,
+		Categories:   []string{"shoes"},
+		Buy_Quantity: 1,
+		Get_Quantity: 1,
+		Get_Percent:  100,
+	}
+	tenOffFifty := models.Promotion{
+		Name:   "10% over 50",
+		Type:   models.PromotionSpendThreshold,
+		Active: true,
+		Tiers: []models.PromotionTier{
+			{Min_Subtotal: money.New(5000, "USD"), Percent: 10},
+		},
+	}
+	percentCoupon := &models.Coupon{Code: "TEN", Type: models.CouponPercentage, Percent: 10, Active: true}
+	fixedCoupon := &models.Coupon{Code: "TWO", Type: models.CouponFixedAmount, Amount: money.New(200, "USD"), Active: true}
+	expiredCoupon := &models.Coupon{Code: "OLD", Type: models.CouponPercentage, Percent: 50, Active: true, Ends_At: &past}
+
+	shoes := []models.ProductUser{line(3000, "USD", "shoes"), line(2000, "USD", "shoes"), line(1000, "USD", "hats")}
+
+	food := "food"
+	groceries := usd(10000, 10000)
+	groceries[1].Tax_Class = &food
+
+	us := TaxLocation{Country: "US", Region: "CA"}
+	usRules := []models.TaxRule{
+		{Country: "US", Name: "federal", Rate: "5"},
+		{Country: "US", Region: "CA", Name: "california", Rate: "7.25"},
+		{Country: "US", Tax_Class: "food", Name: "food", Rate: "1"},
+		{Country: "US", Region: "CA", Tax_Class: "food", Name: "california food", Rate: "0"},
+	}
+
+	tests := []struct {
+		name       string
+		cart       []models.ProductUser
+		promotions []models.Promotion
+		coupon     *models.Coupon
+		rules      []models.TaxRule
+		location   TaxLocation
+		subtotal   int64
+		discount   int64
+		tax        int64
+		total      int64
+		couponErr  error
+	}{
+		{
+			name:     "nothing applies",
+			cart:     usd(1000, 500),
+			subtotal: 1500,
+			total:    1500,
+		},
+		{
+			name:       "buy one get one discounts the cheaper unit",
+			cart:       shoes,
+			promotions: []models.Promotion{buyOneGetOne},
+			subtotal:   6000,
+			discount:   2000,
+			total:      4000,
+		},
+		{
+			name:       "spend threshold spread over the lines",
+			cart:       usd(3000, 2500),
+			promotions: []models.Promotion{tenOffFifty},
+			subtotal:   5500,
+			discount:   550,
+			total:      4950,
+		},
+		{
+			name:       "threshold not reached",
+			cart:       usd(3000, 1999),
+			promotions: []models.Promotion{tenOffFifty},
+			subtotal:   4999,
+			total:      4999,
+		},
+		{
+			name:       "item promotion first, then the threshold on what is left",
+			cart:       append(append([]models.ProductUser(nil), shoes...), usd(1000)...),
+			promotions: []models.Promotion{tenOffFifty, buyOneGetOne},
+			subtotal:   7000,
+			// 2000 off the shoes, then 10% of the 5000 left
+			discount: 2500,
+			total:    4500,
+		},
+		{
+			name:       "coupon over what promotions left",
+			cart:       usd(3000, 2500),
+			promotions: []models.Promotion{tenOffFifty},
+			coupon:     percentCoupon,
+			subtotal:   5500,
+			// 550, then 10% of 4950
+			discount: 1045,
+			total:    4455,
+		},
+		{
+			name:      "expired coupon gives nothing",
+			cart:      usd(1000),
+			coupon:    expiredCoupon,
+			subtotal:  1000,
+			total:     1000,
+			couponErr: ErrCouponExpired,
+		},
+		{
+			name:     "exclusive tax on the net amount",
+			cart:     usd(1000),
+			coupon:   fixedCoupon,
+			rules:    []models.TaxRule{{Country: "US", Rate: "8.875"}},
+			location: TaxLocation{Country: "US"},
+			subtotal: 1000,
+			discount: 200,
+			tax:      71,
+			total:    871,
+		},
+		{
+			name:     "tax rounds half to even per line",
+			cart:     usd(100, 300),
+			rules:    []models.TaxRule{{Country: "US", Rate: "2.5"}},
+			location: TaxLocation{Country: "US"},
+			subtotal: 400,
+			// 2.5 -> 2 and 7.5 -> 8
+			tax:   10,
+			total: 410,
+		},
+		{
+			name:     "inclusive tax is not added",
+			cart:     []models.ProductUser{line(1190, "EUR", "misc")},
+			rules:    []models.TaxRule{{Country: "DE", Rate: "19", Inclusive: true}},
+			location: TaxLocation{Country: "de"},
+			subtotal: 1190,
+			tax:      190,
+			total:    1190,
+		},
+		{
+			name:     "the region and class rules win over the country's",
+			cart:     groceries,
+			rules:    usRules,
+			location: us,
+			subtotal: 20000,
+			tax:      725,
+			total:    20725,
+		},
+		{
+			name:     "a country's class rule beats its general one",
+			cart:     groceries,
+			rules:    usRules,
+			location: TaxLocation{Country: "US", Region: "NY"},
+			subtotal: 20000,
+			tax:      600,
+			total:    20600,
+		},
+		{
+			name:     "no rule for the location",
+			cart:     usd(1000),
+			rules:    usRules,
+			location: TaxLocation{Country: "BR"},
+			subtotal: 1000,
+			total:    1000,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			currency := cartCurrency(tt.cart)
+
+			var taxes TaxCalculator
+
+			if tt.rules != nil {
+				taxes = taxTable(t, tt.rules...)
+			}
+
+			location := tt.location
+			location.Country = LocationOf(models.Address{Country: &location.Country}).Country
+
+			totals, err := Price(currency, tt.cart, tt.promotions, tt.coupon, 0, taxes, location, now)
+
+			if err != nil {
+				t.Fatalf("Price: %v", err)
+			}
+
+			check := func(what string, got money.Money, want int64) {
+				t.Helper()
+
+				if got.Amount != want || got.Currency != currency {
+					t.Errorf("%s = %v, want %d %s", what, got, want, currency)
+				}
+			}
+
+			check("subtotal", totals.Subtotal, tt.subtotal)
+			check("discount", totals.Discount, tt.discount)
+			check("tax", totals.Tax, tt.tax)
+			check("total", totals.Total, tt.total)
+
+			if !errors.Is(totals.CouponErr, tt.couponErr) {
+				t.Errorf("coupon error = %v, want %v", totals.CouponErr, tt.couponErr)
+			}
+
+			// what the promotions and the coupon took off each line adds up
+			// to the discount
+			taken := int64(0)
+
+			for _, applied := range totals.Promotions {
+				for _, l := range applied.Lines {
+					taken += l.Amount.Amount
+				}
+			}
+
+			if totals.Coupon != nil {
+				for _, l := range totals.Coupon.Lines {
+					taken += l.Amount.Amount
+				}
+			}
+
+			if taken != tt.discount {
+				t.Errorf("line discounts add up to %d, want %d", taken, tt.discount)
+			}
+		})
+	}
+}
+
+func TestPriceRefusesMixedCurrencies(t *testing.T) {
+	cart := []models.ProductUser{line(1000, "USD", "misc"), line(1000, "EUR", "misc")}
+
+	if _, err := Price("USD", cart, nil, nil, 0, nil, TaxLocation{}, now); !errors.Is(err, money.ErrCurrencyMismatch) {
+		t.Errorf("err = %v, want ErrCurrencyMismatch", err)
+	}
+}
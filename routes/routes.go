@@ -2,13 +2,64 @@ package routes
 
 import (
 	"github.com/Ricardo-Cardozo/ecommerce_golang/controllers"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/middleware"
 	"github.com/gin-gonic/gin"
 )
 
 func UserRoutes(incomingRoutes *gin.Engine) {
 	incomingRoutes.POST("/users/signup", controllers.Signup())
 	incomingRoutes.POST("/users/login", controllers.Login())
-	incomingRoutes.POST("/admin/addproduct", controllers.ProductViewerAdmin())
 	incomingRoutes.GET("/users/productview", controllers.SearchProduct())
-	incomingRoutes.GET("/users/search", controllers.SearchProductByQuery())
+	incomingRoutes.GET("/users/search", controllers.SearchProducts())
+	incomingRoutes.GET("/users/autocomplete", controllers.Autocomplete())
+	incomingRoutes.GET("/users/reviews", controllers.ProductReviews())
+	incomingRoutes.GET("/users/wishlists/shared", controllers.SharedWishlist())
+	incomingRoutes.GET("/cart/restore", controllers.RestoreCart())
+}
+
+// AdminRoutes are the staff's; they need a signed in user with the admin
+// role.
+func AdminRoutes(incomingRoutes *gin.Engine) {
+	admin := incomingRoutes.Group("/admin", middleware.Authentication(), middleware.Admin())
+	admin.POST("/addproduct", controllers.ProductViewerAdmin())
+	admin.POST("/products/images", controllers.UploadProductImage())
+	admin.PUT("/products/images/order", controllers.ReorderProductImages())
+	admin.DELETE("/products/images", controllers.DeleteProductImage())
+	admin.GET("/coupons", controllers.ListCoupons())
+	admin.POST("/coupons", controllers.CreateCoupon())
+	admin.PUT("/coupons/active", controllers.SetCouponActive())
+	admin.GET("/promotions", controllers.ListPromotions())
+	admin.POST("/promotions", controllers.CreatePromotion())
+	admin.PUT("/promotions/active", controllers.SetPromotionActive())
+	admin.GET("/shipping", controllers.ListShippingMethods())
+	admin.POST("/shipping", controllers.CreateShippingMethod())
+	admin.PUT("/shipping/active", controllers.SetShippingMethodActive())
+	admin.GET("/orders/shipments", controllers.ListShipments())
+	admin.POST("/orders/shipments", controllers.CreateShipment())
+	admin.PUT("/shipments/ship", controllers.ShipShipment())
+	admin.PUT("/shipments/deliver", controllers.DeliverShipment())
+	admin.GET("/orders/refunds", controllers.ListRefunds())
+	admin.POST("/orders/refunds", controllers.RefundOrder())
+	admin.GET("/returns", controllers.ListReturns())
+	admin.PUT("/returns/decide", controllers.DecideReturn())
+	admin.PUT("/returns/receive", controllers.ReceiveReturn())
+	admin.GET("/taxrules", controllers.ListTaxRules())
+	admin.POST("/taxrules", controllers.CreateTaxRule())
+	admin.DELETE("/taxrules", controllers.DeleteTaxRule())
+	admin.GET("/rates", controllers.GetRates())
+	admin.PUT("/rates", controllers.UpdateRates())
+	admin.GET("/synonyms", controllers.ListSynonyms())
+	admin.POST("/synonyms", controllers.AddSynonyms())
+	admin.DELETE("/synonyms", controllers.DeleteSynonyms())
+	admin.GET("/carts/reminders", controllers.CartReminderStats())
+	admin.GET("/reviews", controllers.PendingReviews())
+	admin.POST("/reviews/moderate", controllers.ModerateReview())
+	admin.DELETE("/reviews", controllers.DeleteReview())
+	admin.GET("/webhooks", controllers.ListWebhooks())
+	admin.POST("/webhooks", controllers.CreateWebhook())
+	admin.DELETE("/webhooks", controllers.DeleteWebhook())
+	admin.PUT("/webhooks/active", controllers.SetWebhookActive())
+	admin.GET("/webhooks/deliveries", controllers.ListDeliveries())
+	admin.POST("/webhooks/deliveries/redeliver", controllers.RedeliverWebhook())
+	admin.GET("/webhooks/deadletters", controllers.DeadLetters())
 }
@@ -0,0 +1,86 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/logging"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/tracing"
+)
+
+// Job is background work run every Interval. A run gets at most Interval to
+// finish and the next one only starts after it, so runs never overlap.
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context) error
+}
+
+// Scheduler runs jobs inside the service until it is stopped.
+type Scheduler struct {
+	jobs   []Job
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func New() *Scheduler {
+	return &Scheduler{}
+}
+
+// Add registers a job; jobs added after Start don't run.
+func (s *Scheduler) Add(name string, interval time.Duration, run func(ctx context.Context) error) {
+	s.jobs = append(s.jobs, Job{Name: name, Interval: interval, Run: run})
+}
+
+// Start runs every job in its own goroutine, the first time one interval
+// from now.
+func (s *Scheduler) Start(ctx context.Context) {
+	ctx, s.cancel = context.WithCancel(ctx)
+
+	for _, job := range s.jobs {
+		s.wg.Add(1)
+
+		go func(job Job) {
+			defer s.wg.Done()
+			s.loop(ctx, job)
+		}(job)
+	}
+}
+
+func (s *Scheduler) loop(ctx context.Context, job Job) {
+	ticker := time.NewTicker(job.Interval)
+
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			runCtx, cancel := context.WithTimeout(ctx, job.Interval)
+			runCtx = logging.WithLogger(runCtx, logging.FromContext(ctx).With("job", job.Name))
+			runCtx, span := tracing.Start(runCtx, "job "+job.Name)
+
+			err := job.Run(runCtx)
+
+			if err != nil {
+				logging.FromContext(runCtx).Error("job failed", "error", err)
+			}
+
+			tracing.End(span, err)
+
+			cancel()
+		}
+	}
+}
+
+// Stop cancels the runs in progress and waits for the jobs to return.
+func (s *Scheduler) Stop() {
+	if s.cancel == nil {
+		return
+	}
+
+	s.cancel()
+	s.wg.Wait()
+}
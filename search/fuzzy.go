@@ -0,0 +1,138 @@
+package search
+
+import (
+	"sync"
+)
+
+// DefaultMaxEdits is the edit distance allowed when correcting long terms.
+// Shorter terms get less room, see editsFor.
+var DefaultMaxEdits = 2
+
+// Distance returns the optimal string alignment distance between a and b:
+// insertions, deletions, substitutions and swaps of adjacent letters each
+// cost one, so "iphnoe" is one edit away from "iphone".
+func Distance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+
+	// three rolling rows are enough for the transposition lookback
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+		}
+
+		prev2, prev, cur = prev, cur, prev2
+	}
+
+	return prev[len(rb)]
+}
+
+// editsFor scales the allowed distance with the term length, so "tv" is never
+// "corrected" into "tea".
+func editsFor(term string, maxEdits int) int {
+	n := len([]rune(term))
+
+	switch {
+	case n <= 3:
+		return 0
+	case n <= 5:
+		return min(1, maxEdits)
+	}
+
+	return maxEdits
+}
+
+// Speller knows every term of the catalog and how often it appears, and
+// corrects query terms against it.
+type Speller struct {
+	mu    sync.RWMutex
+	terms map[string]int
+}
+
+func NewSpeller() *Speller {
+	return &Speller{terms: make(map[string]int)}
+}
+
+// Add records the terms of one product.
+func (s *Speller) Add(terms ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, term := range terms {
+		s.terms[term]++
+	}
+}
+
+// Reset replaces the vocabulary, used when it is rebuilt from storage.
+func (s *Speller) Reset(terms map[string]int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.terms = terms
+}
+
+func (s *Speller) Known(term string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.terms[term] > 0
+}
+
+// Correct returns the closest known term within maxEdits of term, preferring
+// the more frequent one on ties. Known terms are returned unchanged.
+func (s *Speller) Correct(term string, maxEdits int) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.terms[term] > 0 {
+		return term, true
+	}
+
+	limit := editsFor(term, maxEdits)
+
+	if limit <= 0 {
+		return "", false
+	}
+
+	length := len([]rune(term))
+	best, bestDist, bestFreq := "", limit+1, 0
+
+	for candidate, freq := range s.terms {
+		diff := len([]rune(candidate)) - length
+
+		if diff > limit || -diff > limit {
+			continue
+		}
+
+		d := Distance(term, candidate)
+
+		if d > limit {
+			continue
+		}
+
+		if d < bestDist || (d == bestDist && (freq > bestFreq || (freq == bestFreq && candidate < best))) {
+			best, bestDist, bestFreq = candidate, d, freq
+		}
+	}
+
+	return best, best != ""
+}
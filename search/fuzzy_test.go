@@ -0,0 +1,72 @@
+package search
+
+import "testing"
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{a: "iphone", b: "iphone", want: 0},
+		{a: "iphnoe", b: "iphone", want: 1},
+		{a: "iphon", b: "iphone", want: 1},
+		{a: "ipbone", b: "iphone", want: 1},
+		{a: "kitten", b: "sitting", want: 3},
+		{a: "", b: "abc", want: 3},
+		{a: "abc", b: "", want: 3},
+		// a swap can't be edited again, unlike with Damerau-Levenshtein
+		{a: "ca", b: "abc", want: 3},
+		{a: "café", b: "cafe", want: 1},
+		{a: "tênis", b: "tenis", want: 1},
+	}
+
+	for _, tt := range tests {
+		if got := Distance(tt.a, tt.b); got != tt.want {
+			t.Errorf("Distance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+
+		if got := Distance(tt.b, tt.a); got != tt.want {
+			t.Errorf("Distance(%q, %q) = %d, want %d", tt.b, tt.a, got, tt.want)
+		}
+	}
+}
+
+func TestCorrect(t *testing.T) {
+	speller := NewSpeller()
+	speller.Reset(map[string]int{
+		"iphone":  5,
+		"phone":   2,
+		"shirt":   3,
+		"short":   7,
+		"tv":      4,
+		"tea":     1,
+		"samsung": 1,
+	})
+
+	tests := []struct {
+		term string
+		want string
+		ok   bool
+	}{
+		{term: "iphone", want: "iphone", ok: true},
+		{term: "iphnoe", want: "iphone", ok: true},
+		{term: "samsugn", want: "samsung", ok: true},
+		// the more frequent of two terms one edit away
+		{term: "shart", want: "short", ok: true},
+		// nothing further than the allowed edits, 2 from six letters and
+		// 1 below
+		{term: "sxmxuxg", want: "", ok: false},
+		{term: "shrtt", want: "", ok: false},
+		// short terms are never corrected
+		{term: "te", want: "", ok: false},
+		{term: "tvs", want: "", ok: false},
+	}
+
+	for _, tt := range tests {
+		got, ok := speller.Correct(tt.term, DefaultMaxEdits)
+
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("Correct(%q) = %q, %v, want %q, %v", tt.term, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// MaxQueryTerms bounds how many terms of a user query are looked up, so a
+// pasted paragraph can't turn into an expensive search.
+const MaxQueryTerms = 10
+
+// Normalize lowercases s and strips diacritics, so "Café" and "cafe" compare
+// equal.
+func Normalize(s string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+
+	out, _, err := transform.String(t, s)
+
+	if err != nil {
+		out = s
+	}
+
+	return strings.ToLower(out)
+}
+
+// Tokenize splits s into normalized words. Everything that is not a letter
+// or a digit is a separator, which also drops any operator characters a
+// client might try to smuggle into the storage query.
+func Tokenize(s string) []string {
+	return strings.FieldsFunc(Normalize(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Terms returns the distinct tokens of all fields, in first-seen order. It is
+// what gets stored on a product for prefix lookups.
+func Terms(fields ...string) []string {
+	seen := make(map[string]bool)
+	terms := make([]string, 0)
+
+	for _, field := range fields {
+		for _, token := range Tokenize(field) {
+			if !seen[token] {
+				seen[token] = true
+				terms = append(terms, token)
+			}
+		}
+	}
+
+	return terms
+}
+
+// QueryTerms tokenizes a user supplied query, keeping at most MaxQueryTerms
+// distinct terms.
+func QueryTerms(query string) []string {
+	terms := Terms(query)
+
+	if len(terms) > MaxQueryTerms {
+		terms = terms[:MaxQueryTerms]
+	}
+
+	return terms
+}
@@ -0,0 +1,66 @@
+package search
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{in: "Café", want: "cafe"},
+		{in: "TÊNIS Nike", want: "tenis nike"},
+		{in: "Ærø", want: "ærø"},
+		{in: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := Normalize(tt.in); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{in: "Running Shoes", want: []string{"running", "shoes"}},
+		{in: `"red" -shoes $where`, want: []string{"red", "shoes", "where"}},
+		{in: "iPhone 15-Pro", want: []string{"iphone", "15", "pro"}},
+		{in: " ... ", want: []string{}},
+	}
+
+	for _, tt := range tests {
+		if got := Tokenize(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Tokenize(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestTerms(t *testing.T) {
+	got := Terms("Red Shoes", "shoes for running, RED or blue")
+	want := []string{"red", "shoes", "for", "running", "or", "blue"}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Terms = %q, want %q", got, want)
+	}
+}
+
+func TestQueryTermsKeepsTheFirstTerms(t *testing.T) {
+	words := make([]string, 0, 2*MaxQueryTerms)
+
+	for i := 0; i < 2*MaxQueryTerms; i++ {
+		words = append(words, "w"+strconv.Itoa(i), "w"+strconv.Itoa(i))
+	}
+
+	got := QueryTerms(strings.Join(words, " "))
+
+	if len(got) != MaxQueryTerms || got[0] != "w0" || got[MaxQueryTerms-1] != "w"+strconv.Itoa(MaxQueryTerms-1) {
+		t.Errorf("QueryTerms = %q, want w0 to w%d", got, MaxQueryTerms-1)
+	}
+}
@@ -0,0 +1,140 @@
+package search
+
+import (
+	"strings"
+	"sync"
+)
+
+// Synonyms maps every term of a group to the whole group, so searching
+// "sneakers" also finds "trainers" and the other way round.
+type Synonyms struct {
+	mu     sync.RWMutex
+	groups map[string][]string
+}
+
+func NewSynonyms() *Synonyms {
+	return &Synonyms{groups: make(map[string][]string)}
+}
+
+// SynonymTerm normalizes a dictionary entry, which must be a single word:
+// the words of a phrase would each stand for the whole group, "smart" for
+// "tv" in {"tv", "smart television"}.
+func SynonymTerm(entry string) (string, bool) {
+	tokens := Tokenize(entry)
+
+	if len(tokens) != 1 {
+		return "", false
+	}
+
+	return tokens[0], true
+}
+
+// Reset replaces the dictionary with the given groups. Entries are
+// normalized with SynonymTerm; those that aren't single words are left out.
+func (s *Synonyms) Reset(groups [][]string) {
+	index := make(map[string][]string)
+
+	for _, group := range groups {
+		terms := make([]string, 0, len(group))
+
+		for _, entry := range group {
+			if term, ok := SynonymTerm(entry); ok {
+				terms = appendMissing(terms, term)
+			}
+		}
+
+		if len(terms) < 2 {
+			continue
+		}
+
+		for _, term := range terms {
+			index[term] = appendMissing(index[term], terms...)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.groups = index
+}
+
+// Of returns the synonyms of term, not including term itself.
+func (s *Synonyms) Of(term string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]string, 0)
+
+	for _, other := range s.groups[term] {
+		if other != term {
+			out = append(out, other)
+		}
+	}
+
+	return out
+}
+
+func appendMissing(list []string, terms ...string) []string {
+	for _, term := range terms {
+		found := false
+
+		for _, existing := range list {
+			if existing == term {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			list = append(list, term)
+		}
+	}
+
+	return list
+}
+
+// Expansion is a user query rewritten for lookup.
+type Expansion struct {
+	// Terms are the corrected query terms followed by their synonyms.
+	Terms []string
+	// DidYouMean is the corrected query, empty when no term was changed.
+	DidYouMean string
+}
+
+// Expand corrects unknown query terms against speller, within maxEdits, and
+// adds the synonyms of every resulting term. Terms that can't be corrected,
+// or that are in the synonym dictionary, are kept as typed. Either speller or
+// synonyms may be nil.
+func Expand(query string, speller *Speller, synonyms *Synonyms, maxEdits int) Expansion {
+	typed := QueryTerms(query)
+	corrected := make([]string, 0, len(typed))
+	changed := false
+
+	for _, term := range typed {
+		// a dictionary term is a deliberate word, not a typo of a catalog term
+		known := synonyms != nil && len(synonyms.Of(term)) > 0
+
+		if speller != nil && !known {
+			if fixed, ok := speller.Correct(term, maxEdits); ok && fixed != term {
+				term = fixed
+				changed = true
+			}
+		}
+
+		corrected = append(corrected, term)
+	}
+
+	exp := Expansion{Terms: appendMissing(nil, corrected...)}
+
+	if synonyms != nil {
+		for _, term := range corrected {
+			exp.Terms = appendMissing(exp.Terms, synonyms.Of(term)...)
+		}
+	}
+
+	if changed {
+		exp.DidYouMean = strings.Join(corrected, " ")
+	}
+
+	return exp
+}
@@ -0,0 +1,102 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	speller := NewSpeller()
+	speller.Reset(map[string]int{"running": 3, "shoes": 5, "shirt": 2, "trainer": 1})
+
+	synonyms := NewSynonyms()
+	synonyms.Reset([][]string{{"Sneakers", "trainers"}, {"shoes", "footwear"}})
+
+	tests := []struct {
+		name       string
+		query      string
+		speller    *Speller
+		synonyms   *Synonyms
+		terms      []string
+		didYouMean string
+	}{
+		{
+			name:       "typo corrected, then its synonyms",
+			query:      "Runnign shoes",
+			speller:    speller,
+			synonyms:   synonyms,
+			terms:      []string{"running", "shoes", "footwear"},
+			didYouMean: "running shoes",
+		},
+		{
+			name:     "dictionary terms are kept as typed",
+			query:    "trainers",
+			speller:  speller,
+			synonyms: synonyms,
+			terms:    []string{"trainers", "sneakers"},
+		},
+		{
+			name:     "unknown terms are kept",
+			query:    "xyzzy shoes shoes",
+			speller:  speller,
+			synonyms: synonyms,
+			terms:    []string{"xyzzy", "shoes", "footwear"},
+		},
+		{
+			name:  "without speller and synonyms",
+			query: "Runnign",
+			terms: []string{"runnign"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exp := Expand(tt.query, tt.speller, tt.synonyms, DefaultMaxEdits)
+
+			if !reflect.DeepEqual(exp.Terms, tt.terms) || exp.DidYouMean != tt.didYouMean {
+				t.Errorf("Expand(%q) = %q, %q, want %q, %q", tt.query, exp.Terms, exp.DidYouMean, tt.terms, tt.didYouMean)
+			}
+		})
+	}
+}
+
+func TestSynonymTerm(t *testing.T) {
+	tests := []struct {
+		entry string
+		want  string
+		ok    bool
+	}{
+		{entry: "Télé", want: "tele", ok: true},
+		{entry: "  TV ", want: "tv", ok: true},
+		{entry: "smart television"},
+		{entry: "t-shirt"},
+		{entry: ""},
+	}
+
+	for _, tt := range tests {
+		if got, ok := SynonymTerm(tt.entry); got != tt.want || ok != tt.ok {
+			t.Errorf("SynonymTerm(%q) = %q, %v, want %q, %v", tt.entry, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestSynonymsResetSkipsPhrases(t *testing.T) {
+	synonyms := NewSynonyms()
+	synonyms.Reset([][]string{{"tv", "smart television", "telly"}, {"hoodie", "sweatshirt with a hood"}})
+
+	tests := []struct {
+		term string
+		want []string
+	}{
+		{term: "tv", want: []string{"telly"}},
+		{term: "smart", want: []string{}},
+		{term: "television", want: []string{}},
+		{term: "hoodie", want: []string{}},
+	}
+
+	for _, tt := range tests {
+		if got := synonyms.Of(tt.term); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Of(%q) = %q, want %q", tt.term, got, tt.want)
+		}
+	}
+}
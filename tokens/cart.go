@@ -0,0 +1,73 @@
+package token
+
+import (
+	"context"
+	"time"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/tracing"
+	"github.com/golang-jwt/jwt"
+)
+
+// CartAudience marks cart tokens, so they are never taken for access
+// tokens.
+const CartAudience = "cart"
+
+// CartTokenLifetime is how long a guest keeps their cart.
+var CartTokenLifetime = 30 * 24 * time.Hour
+
+// CartClaims identify a guest's cart, which lives in a guest user document.
+type CartClaims struct {
+	Cart_ID string
+	jwt.StandardClaims
+}
+
+func CartTokenGenerator(ctx context.Context, cartID string) (token string, expiresAt time.Time, err error) {
+	_, span := tracing.Start(ctx, "cart_token.generate")
+
+	defer func() { tracing.End(span, err) }()
+
+	expiresAt = time.Now().Add(CartTokenLifetime)
+
+	claims := &CartClaims{
+		Cart_ID: cartID,
+		StandardClaims: jwt.StandardClaims{
+			Audience:  CartAudience,
+			ExpiresAt: expiresAt.Unix(),
+		},
+	}
+
+	token, err = jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(SECRET_KEY))
+
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return token, expiresAt, nil
+}
+
+func ValidateCartToken(ctx context.Context, carttoken string) (claims *CartClaims, msg string) {
+	_, span := tracing.Start(ctx, "cart_token.validate")
+
+	defer func() { endSpan(span, msg) }()
+
+	token, err := jwt.ParseWithClaims(
+		carttoken,
+		&CartClaims{},
+		func(token *jwt.Token) (interface{}, error) {
+			return []byte(SECRET_KEY), nil
+		})
+
+	if err != nil {
+		msg = err.Error()
+		return
+	}
+
+	claims, ok := token.Claims.(*CartClaims)
+
+	if !ok || claims.Audience != CartAudience || claims.Cart_ID == "" {
+		msg = "this is not a cart token"
+		return
+	}
+
+	return claims, msg
+}
@@ -2,16 +2,19 @@ package token
 
 import (
 	"context"
-	"log"
 	"os"
 	"time"
 
 	"github.com/Ricardo-Cardozo/ecommerce_golang/database"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/logging"
+	"github.com/Ricardo-Cardozo/ecommerce_golang/tracing"
 	"github.com/golang-jwt/jwt"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
@@ -23,19 +26,27 @@ type SignedDetails struct {
 	Email      string
 	First_Name string
 	Uid        string
+	Role       string
 	jwt.StandardClaims
 }
 
 func TokenGenerator(
+	ctx context.Context,
 	email string,
 	firstname string,
 	lastname string,
 	uid string,
+	role string,
 ) (accesstoken string, refreshtoken string, err error) {
+	_, span := tracing.Start(ctx, "token.generate")
+
+	defer func() { tracing.End(span, err) }()
+
 	claims := &SignedDetails{
 		Email:      email,
 		First_Name: firstname,
 		Uid:        uid,
+		Role:       role,
 		StandardClaims: jwt.StandardClaims{
 			ExpiresAt: time.Now().Local().Add(time.Hour * time.Duration(24)).Unix(),
 		},
@@ -61,7 +72,11 @@ func TokenGenerator(
 	return token, refreshtoken, nil
 }
 
-func ValidateToken(accesstoken string) (claims *SignedDetails, msg string) {
+func ValidateToken(ctx context.Context, accesstoken string) (claims *SignedDetails, msg string) {
+	_, span := tracing.Start(ctx, "token.validate")
+
+	defer func() { endSpan(span, msg) }()
+
 	token, err := jwt.ParseWithClaims(
 		accesstoken,
 		&SignedDetails{},
@@ -81,6 +96,11 @@ func ValidateToken(accesstoken string) (claims *SignedDetails, msg string) {
 		return
 	}
 
+	if claims.Audience == CartAudience {
+		msg = "a cart token can't be used to sign in"
+		return
+	}
+
 	if claims.ExpiresAt < time.Now().Local().Unix() {
 		msg = "token is already expired"
 		return
@@ -90,9 +110,13 @@ func ValidateToken(accesstoken string) (claims *SignedDetails, msg string) {
 
 }
 
-func UpdateAllTokens(accestoken string, refreshtoken string, userid string) (string, error) {
+func UpdateAllTokens(ctx context.Context, accestoken string, refreshtoken string, userid string) (string, error) {
+	ctx, span := tracing.Start(ctx, "token.save")
+
+	defer span.End()
+
 	ctx, cancel := context.WithTimeout(
-		context.Background(),
+		ctx,
 		100*time.Second,
 	)
 
@@ -115,8 +139,19 @@ func UpdateAllTokens(accestoken string, refreshtoken string, userid string) (str
 	}}, &opt)
 
 	if err != nil {
-		log.Panic(err.Error())
+		logging.FromContext(ctx).Error("cannot save the tokens", "error", err)
+		span.SetStatus(codes.Error, err.Error())
+		return "", err
 	}
 
 	return "Succesfully token updated!", nil
 }
+
+// endSpan ends the span of a token check that failed with msg, if it did.
+func endSpan(span trace.Span, msg string) {
+	if msg != "" {
+		span.SetStatus(codes.Error, msg)
+	}
+
+	span.End()
+}
@@ -0,0 +1,252 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Ricardo-Cardozo/ecommerce_golang/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// MaxAttempts is how many times a delivery is tried before it goes to the
+// dead-letter list.
+var MaxAttempts = 8
+
+// RetryDelay is how long to wait after a delivery failed failures times:
+// 30 seconds, doubling each time, at most 6 hours.
+func RetryDelay(failures int) time.Duration {
+	delay := 30 * time.Second
+
+	for i := 1; i < failures && delay < 6*time.Hour; i++ {
+		delay *= 2
+	}
+
+	if delay > 6*time.Hour {
+		delay = 6 * time.Hour
+	}
+
+	return delay
+}
+
+// Sign is the hex HMAC-SHA256 of "<timestamp>.<body>" with the endpoint's
+// secret. Receivers recompute it to check the request came from us, and
+// reject old timestamps to stop replays.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+var (
+	ErrInvalidURL       = errors.New("the webhook URL must be an absolute https URL")
+	ErrForbiddenAddress = errors.New("the webhook URL must not point to a loopback, link-local or private address")
+)
+
+// CheckURL tells whether raw may be a webhook endpoint: an https URL with a
+// host that isn't obviously internal. Names that resolve to internal
+// addresses are caught when Sender connects.
+func CheckURL(raw string) error {
+	u, err := url.Parse(raw)
+
+	if err != nil || u.Scheme != "https" || u.Hostname() == "" || u.User != nil {
+		return ErrInvalidURL
+	}
+
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrForbiddenAddress
+	}
+
+	if ip := net.ParseIP(host); ip != nil && !public(ip) {
+		return ErrForbiddenAddress
+	}
+
+	return nil
+}
+
+// internalNetworks are the ranges not covered by the net.IP methods that
+// public refuses too.
+var internalNetworks = parseNetworks(
+	"100.64.0.0/10", // carrier-grade NAT
+	"192.0.0.0/24",  // IETF protocol assignments
+	"198.18.0.0/15", // benchmarking
+)
+
+// nat64 holds IPv6 addresses that stand for the IPv4 address in their last
+// 4 bytes, see RFC 6052.
+var nat64 = parseNetworks("64:ff9b::/96")[0]
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+
+		if err != nil {
+			panic(err)
+		}
+
+		networks[i] = network
+	}
+
+	return networks
+}
+
+// public tells whether ip may be reached by a webhook, so that endpoints
+// can't make the service call itself, its cloud's metadata service or
+// anything else on its network. IPv4 addresses written as IPv6 ones, mapped
+// or through NAT64, are judged as the IPv4 address.
+func public(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	} else if nat64.Contains(ip) {
+		ip = ip[net.IPv6len-net.IPv4len:]
+	}
+
+	for _, network := range internalNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+
+	return !(ip.IsLoopback() ||
+		ip.IsPrivate() ||
+		ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast())
+}
+
+// refuseInternal is a net.Dialer Control that refuses to connect to
+// addresses that aren't public, whatever name resolved to them.
+func refuseInternal(network string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+
+	if err != nil {
+		return err
+	}
+
+	if ip := net.ParseIP(host); ip == nil || !public(ip) {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, host)
+	}
+
+	return nil
+}
+
+// Request is one delivery attempt.
+type Request struct {
+	URL         string
+	Secret      string
+	Delivery_ID string
+	Event_Type  string
+	Body        []byte
+}
+
+// Sender posts deliveries to webhook endpoints.
+type Sender struct {
+	Client *http.Client
+}
+
+// NewSender makes a Sender that only connects to public addresses, also
+// when following redirects, and never through a proxy, which could reach
+// what it can't.
+func NewSender() *Sender {
+	dialer := &net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   refuseInternal,
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &Sender{Client: &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("stopped after 5 redirects")
+			}
+
+			return CheckURL(req.URL.String())
+		},
+	}}
+}
+
+// Send posts the request's body with its signature headers and returns the
+// response status. Anything but a 2xx status is an error. The post is
+// traced, and carries the trace context for endpoints that trace too.
+func (s *Sender) Send(ctx context.Context, request Request) (status int, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "POST webhook",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(http.MethodPost),
+			attribute.String("webhook.event", request.Event_Type),
+			attribute.String("webhook.delivery", request.Delivery_ID),
+		),
+	)
+
+	defer func() {
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		tracing.End(span, err)
+	}()
+
+	if err = CheckURL(request.URL); err != nil {
+		return 0, err
+	}
+
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, request.URL, bytes.NewReader(request.Body))
+
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := time.Now().Unix()
+
+	httpRequest.Header.Set("Content-Type", "application/json")
+	httpRequest.Header.Set("X-Webhook-Event", request.Event_Type)
+	httpRequest.Header.Set("X-Webhook-Delivery", request.Delivery_ID)
+	httpRequest.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(timestamp, 10))
+	httpRequest.Header.Set("X-Webhook-Signature", "sha256="+Sign(request.Secret, timestamp, request.Body))
+
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(httpRequest.Header))
+
+	response, err := s.Client.Do(httpRequest)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer response.Body.Close()
+
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, fmt.Errorf("the endpoint answered %s", response.Status)
+	}
+
+	return response.StatusCode, nil
+}